@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/RomanAgaltsev/urlcut/internal/app"
+	"github.com/RomanAgaltsev/urlcut/internal/buildinfo"
 )
 
 var (
@@ -14,10 +15,8 @@ var (
 )
 
 func main() {
-	// Выводим информацию о сборке
-	log.Printf("Build version: %s\n", buildVersion)
-	log.Printf("Build date: %s\n", buildDate)
-	log.Printf("Build commit: %s\n", buildCommit)
+	// Передаем информацию о сборке приложению - она выводится в лог, по флагу -version и в GET /version
+	buildinfo.Set(buildVersion, buildDate, buildCommit)
 
 	// Создаем и инициализируем приложение
 	application, err := app.New()
@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// quotaHandlers владеет обработчиками управления квотами пользователей.
+type quotaHandlers struct {
+	shortener interfaces.Service // сервис сокращателя ссылок
+}
+
+// mountQuota добавляет в роутер обработчики квот пользователя /users/{uid}/quota:
+//   - GET возвращает переопределенные и действующие квоты
+//   - PUT переопределяет квоты
+//   - DELETE удаляет переопределение - начинают действовать глобальные квоты
+func mountQuota(r chi.Router, shortener interfaces.Service) {
+	h := &quotaHandlers{shortener: shortener}
+
+	r.Get("/users/{uid}/quota", h.get)
+	r.Put("/users/{uid}/quota", h.set)
+	r.Delete("/users/{uid}/quota", h.delete)
+}
+
+// get возвращает квоты пользователя.
+func (h *quotaHandlers) get(w http.ResponseWriter, r *http.Request) {
+	uid, ok := userUID(w, r)
+	if !ok {
+		return
+	}
+
+	quota, err := h.shortener.UserQuota(r.Context(), uid)
+	if err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(quota); err != nil {
+		slog.InfoContext(r.Context(), "failed to encode user quota", "error", err.Error())
+	}
+}
+
+// set переопределяет квоты пользователя и возвращает их вместе с действующими квотами.
+func (h *quotaHandlers) set(w http.ResponseWriter, r *http.Request) {
+	uid, ok := userUID(w, r)
+	if !ok {
+		return
+	}
+
+	var quota model.Quota
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&quota); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.shortener.SetUserQuota(r.Context(), uid, quota); err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	h.get(w, r)
+}
+
+// delete удаляет переопределение квот пользователя.
+func (h *quotaHandlers) delete(w http.ResponseWriter, r *http.Request) {
+	uid, ok := userUID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.shortener.DeleteUserQuota(r.Context(), uid); err != nil {
+		writeQuotaError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userUID получает идентификатор пользователя из пути запроса.
+// Если идентификатор некорректный, отвечает статусом Bad Request.
+func userUID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	uid, err := uuid.Parse(chi.URLParam(r, "uid"))
+	if err != nil {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return uid, true
+}
+
+// writeQuotaError отвечает статусом, соответствующим ошибке операции с квотами.
+func writeQuotaError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, model.ErrInvalidQuota):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrQuotaUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		slog.InfoContext(r.Context(), "failed to process user quota", "error", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
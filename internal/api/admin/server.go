@@ -0,0 +1,87 @@
+// Пакет admin реализует служебный HTTP сервер сокращателя ссылок с метриками и профилированием.
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/logger"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+)
+
+// ErrInitServerFailed ошибка инициализации служебного HTTP сервера.
+var ErrInitServerFailed = fmt.Errorf("failed to init admin HTTP server")
+
+// Mount добавляет служебные обработчики в переданный роутер.
+// Используется и служебным сервером, и основным сервером, если служебный адрес не задан.
+// Обработчики, изменяющие работу приложения, требуют токен доступа и без токена в конфигурации не добавляются.
+// Обработчики квот пользователей добавляются, если передан сервис сокращателя.
+func Mount(router chi.Router, cfg *config.Config, shortener interfaces.Service) {
+	router.Handle("/metrics", metrics.Handler())
+
+	if cfg.AdminToken == "" {
+		return
+	}
+
+	router.Group(func(r chi.Router) {
+		r.Use(withToken(cfg.AdminToken))
+
+		r.Handle("/log/level", logger.LevelHandler())
+
+		if shortener != nil {
+			mountQuota(r, shortener)
+		}
+	})
+}
+
+// NewServer создает служебный HTTP сервер на отдельном адресе из конфигурации.
+// Обработчики профилирования net/http/pprof доступны только на служебном сервере и требуют токен доступа.
+func NewServer(cfg *config.Config, shortener interfaces.Service) (*http.Server, error) {
+	if cfg.AdminAddress == "" {
+		return nil, ErrInitServerFailed
+	}
+
+	router := chi.NewRouter()
+	Mount(router, cfg, shortener)
+
+	if cfg.AdminToken != "" {
+		router.Group(func(r chi.Router) {
+			r.Use(withToken(cfg.AdminToken))
+
+			r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+			r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+			r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+			r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+			// Индекс и именованные профили: heap, goroutine, allocs и другие
+			r.HandleFunc("/debug/pprof/*", pprof.Index)
+		})
+	}
+
+	return &http.Server{
+		Addr:    cfg.AdminAddress,
+		Handler: router,
+	}, nil
+}
+
+// withToken возвращает миддлваре, пропускающую только запросы с переданным токеном
+// в заголовке "Authorization: Bearer <токен>".
+func withToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
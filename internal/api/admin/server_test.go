@@ -0,0 +1,214 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/logger"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+	"github.com/RomanAgaltsev/urlcut/internal/mocks"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+	"github.com/RomanAgaltsev/urlcut/internal/services"
+)
+
+func TestServer(t *testing.T) {
+	_, err := NewServer(&config.Config{}, nil)
+	assert.Equal(t, ErrInitServerFailed, err)
+
+	server, err := NewServer(&config.Config{AdminAddress: "localhost:9090"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9090", server.Addr)
+
+	metrics.URLsCreated.Inc()
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(body), "urlcut_urls_created_total")
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestServerLogLevel(t *testing.T) {
+	require.NoError(t, logger.Initialize(&config.Config{LogLevel: "info"}))
+
+	// Без токена в конфигурации уровень логирования изменить нельзя
+	router := chi.NewRouter()
+	Mount(router, &config.Config{}, nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	server, err := NewServer(&config.Config{AdminAddress: "localhost:9090", AdminToken: "admin-token"}, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	setLevel := func(token, level string) int {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/log/level", strings.NewReader(`{"level":"`+level+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, setLevel("", "debug"))
+	assert.Equal(t, http.StatusUnauthorized, setLevel("wrong-token", "debug"))
+	assert.False(t, slog.Default().Enabled(context.Background(), slog.LevelDebug))
+
+	assert.Equal(t, http.StatusOK, setLevel("admin-token", "debug"))
+	assert.True(t, slog.Default().Enabled(context.Background(), slog.LevelDebug))
+
+	assert.Equal(t, http.StatusBadRequest, setLevel("admin-token", "verbose"))
+}
+
+func TestServerPprof(t *testing.T) {
+	server, err := NewServer(&config.Config{AdminAddress: "localhost:9090", AdminToken: "admin-token"}, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	get := func(path, token string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := get("/debug/pprof/", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, body := get("/debug/pprof/", "admin-token")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "goroutine")
+
+	status, body = get("/debug/pprof/goroutine?debug=1", "admin-token")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "goroutine profile")
+
+	status, _ = get("/debug/pprof/cmdline", "admin-token")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Без токена в конфигурации профилирование выключено
+	server, err = NewServer(&config.Config{AdminAddress: "localhost:9090"}, nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServerUserQuota(t *testing.T) {
+	cfg := &config.Config{
+		AdminAddress:      "localhost:9090",
+		AdminToken:        "admin-token",
+		BaseURL:           "http://localhost:8080",
+		IDlength:          8,
+		QuotaMaxBatchSize: 1000,
+	}
+
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+	shortener, err := services.NewShortener(repo, cfg)
+	require.NoError(t, err)
+	defer func() { _ = shortener.Close() }()
+
+	server, err := NewServer(cfg, shortener)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	uid := uuid.New()
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	status, body := do(http.MethodGet, "/users/"+uid.String()+"/quota", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"override":null,"effective":{"max_links":0,"max_batch_size":1000,"max_url_length":0}}`, body)
+
+	status, body = do(http.MethodPut, "/users/"+uid.String()+"/quota", `{"max_links":5,"max_batch_size":-1}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"override":{"max_links":5,"max_batch_size":-1,"max_url_length":0},
+		"effective":{"max_links":5,"max_batch_size":0,"max_url_length":0}}`, body)
+
+	status, _ = do(http.MethodPut, "/users/"+uid.String()+"/quota", `{"max_links":"many"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = do(http.MethodPut, "/users/"+uid.String()+"/quota", `{"max_links":4294967296}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = do(http.MethodGet, "/users/not-a-uuid/quota", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = do(http.MethodDelete, "/users/"+uid.String()+"/quota", "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, body = do(http.MethodGet, "/users/"+uid.String()+"/quota", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"override":null`)
+
+	// Без токена квоты недоступны
+	resp, err := http.Get(ts.URL + "/users/" + uid.String() + "/quota")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Хранилище без поддержки квот
+	ctrl := gomock.NewController(t)
+	unsupported, err := services.NewShortener(mocks.NewMockRepository(ctrl), cfg)
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	Mount(router, cfg, unsupported)
+	req := httptest.NewRequest(http.MethodGet, "/users/"+uid.String()+"/quota", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
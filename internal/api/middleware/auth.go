@@ -4,8 +4,8 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
 
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 
 	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
@@ -15,114 +15,133 @@ import (
 // Сначала выполняется поиск JWT токена с именем "jwt" в куки запроса.
 // Далее, если токен в куки не найден, выполняется получение токена из заголовка "Authorization".
 // Если токен не был найден, генерируется новый и в заголовки ответа добавляется кука с ним.
-func WithAuth(ja *jwtauth.JWTAuth) func(http.Handler) http.Handler {
+// Недействительный токен - поддельный, просроченный или подписанный неизвестным ключом - в изменяющем
+// запросе отклоняется со статусом Unauthorized, а в читающем запросе заменяется новым.
+// Действительный токен перевыпускается, когда подходит срок перевыпуска, - срок действия сдвигается.
+func WithAuth(a *auth.Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			// Переменные для токена
-			var tokenString string
 			var token jwt.Token
 			var err error
 
-			// Пробуем получить токен из куки
-			tokenString = tokenFromCookie(r)
-			if tokenString == "" {
-				// Пробуем получить токен из заголовка Authorization
-				tokenString = r.Header.Get("Authorization")
-			}
+			// Пробуем получить токен из куки или заголовка Authorization
+			tokenString := tokenFromRequest(r)
 
 			// Проверяем, удалось ли получить строку токена
-			if tokenString == "" {
-				// Получить строку токена не удалось, создаем новую
-				token, tokenString, err = auth.NewJWTToken(ja)
-				if err != nil {
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			if tokenString != "" {
+				token, err = a.Verify(tokenString)
+				if err != nil && mutating(r.Method) {
+					unauthorized(w, true)
 					return
 				}
-			} else {
-				// Декодируем токен
-				token, _ = ja.Decode(tokenString)
-				// Пробуем валидировать токен
-				if err = jwt.Validate(token, ja.ValidateOptions()...); err != nil {
-					token, tokenString, err = auth.NewJWTToken(ja)
-					if err != nil {
-						http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-						return
-					}
-				}
+			}
+
+			switch {
+			case token == nil:
+				// Токена нет или он недействителен, выдаем новый
+				token, tokenString, err = a.NewToken("")
+			case a.NeedsRefresh(token, tokenString):
+				// Перевыпускаем токен для того же пользователя
+				token, tokenString, err = a.NewToken(auth.UserID(token))
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
 			}
 
 			// Устанавливает куку в ответ
-			http.SetCookie(w, auth.NewCookieWithDefaults(tokenString))
+			http.SetCookie(w, a.Cookie(token, tokenString))
 			w.Header().Set("Authorization", tokenString)
 
-			// Валидацию прошли, получим утверждения
-			claims := token.PrivateClaims()
-
 			// uid пользователя передаем дальше через контекст
-			ctx := context.WithValue(r.Context(), auth.UserIDClaimName, claims[string(auth.UserIDClaimName)])
+			ctx := context.WithValue(r.Context(), auth.UserIDClaimName, auth.UserID(token))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
-// WithID работает аналогично WithAuth, но, при отсутствии токена в куке или заголовке, не выдает новый,
-// а возвращает статус Unauthorized - отказывает в авторизации запроса.
-func WithID(ja *jwtauth.JWTAuth) func(http.Handler) http.Handler {
+// WithID работает аналогично WithAuth, но, при отсутствии или недействительности токена в куке или заголовке,
+// не выдает новый, а возвращает статус Unauthorized - отказывает в авторизации запроса.
+func WithID(a *auth.Authenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			// Пробуем получить токен из куки
-			tokenString := tokenFromCookie(r)
-			if tokenString == "" {
-				// Пробуем получить токен из заголовка Authorization
-				tokenString = r.Header.Get("Authorization")
-			}
+			// Пробуем получить токен из куки или заголовка Authorization
+			tokenString := tokenFromRequest(r)
 
 			// Если строки токена нет - нет авторизации
 			if tokenString == "" {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				unauthorized(w, false)
 				return
 			}
 
-			// Декодируем токен
-			token, err := ja.Decode(tokenString)
-
-			// Если токен не получилось декодировать - нет авторизации
+			// Если токен не прошел проверку - нет авторизации
+			token, err := a.Verify(tokenString)
 			if err != nil {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-				return
-			}
-
-			// Если токен не получилось валидировать - нет авторизации
-			if err = jwt.Validate(token, ja.ValidateOptions()...); err != nil {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				unauthorized(w, true)
 				return
 			}
 
-			// Валидацию прошли, получим утверждения
-			claims := token.PrivateClaims()
-
-			// Получаем идентификатор пользователя
-			id, ok := claims[string(auth.UserIDClaimName)]
-			// Если в утверждениях идентификатора нет или он пустой - нет авторизации
-			if !ok || id == "" {
-				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-				return
+			// Перевыпускаем токен, если подошел срок
+			if a.NeedsRefresh(token, tokenString) {
+				token, tokenString, err = a.NewToken(auth.UserID(token))
+				if err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				http.SetCookie(w, a.Cookie(token, tokenString))
+				w.Header().Set("Authorization", tokenString)
 			}
 
 			// uid пользователя передаем дальше через контекст
-			ctx := context.WithValue(r.Context(), auth.UserIDClaimName, id)
+			ctx := context.WithValue(r.Context(), auth.UserIDClaimName, auth.UserID(token))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
+// tokenFromRequest возвращает строку токена из куки или, если куки нет, из заголовка Authorization.
+// В заголовке токен принимается как с префиксом "Bearer", так и без него.
+func tokenFromRequest(r *http.Request) string {
+	if tokenString := tokenFromCookie(r); tokenString != "" {
+		return tokenString
+	}
+
+	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(tokenString) > 7 && strings.EqualFold(tokenString[:7], "Bearer ") {
+		tokenString = strings.TrimSpace(tokenString[7:])
+	}
+	return tokenString
+}
+
 func tokenFromCookie(r *http.Request) string {
 	for _, cookie := range r.Cookies() {
-		if cookie.Name == "jwt" {
+		if cookie.Name == auth.DefaultCookieName {
 			return cookie.Value
 		}
 	}
 	return ""
 }
+
+// mutating сообщает, изменяет ли запрос с переданным методом данные.
+func mutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// unauthorized отказывает в авторизации запроса. Если токен был передан, но не прошел проверку,
+// клиенту сообщается об этом в заголовке WWW-Authenticate.
+func unauthorized(w http.ResponseWriter, invalidToken bool) {
+	if invalidToken {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// bodyLimitKey - ключ контекста запроса, по которому хранится ограничение размера тела запроса.
+type bodyLimitKey struct{}
+
+// WithBodyLimit возвращает миддлваре, ограничивающую размер тела запроса переданным количеством байт.
+// Чтение тела сверх ограничения завершается ошибкой *http.MaxBytesError. Ограничение сохраняется
+// в контексте запроса - по нему WithGzip ограничивает размер распакованного тела.
+// Ограничение 0 и меньше означает, что размер тела не ограничивается.
+func WithBodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if limit <= 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Ранний отказ, если размер тела известен заранее
+			if r.ContentLength > limit {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, limit)))
+		})
+	}
+}
+
+// BodyLimitFromContext возвращает ограничение размера тела запроса из контекста.
+// Если ограничение не задано, возвращается false.
+func BodyLimitFromContext(ctx context.Context) (int64, bool) {
+	limit, ok := ctx.Value(bodyLimitKey{}).(int64)
+	return limit, ok
+}
+
+// IsBodyTooLarge сообщает, что ошибка чтения тела запроса вызвана превышением ограничения его размера.
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -1,53 +1,380 @@
 package middleware
 
 import (
-	"compress/gzip"
+	"bytes"
+	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Кодировки сжатия данных.
+const (
+	// EncodingGzip - сжатие gzip.
+	EncodingGzip = "gzip"
+
+	// EncodingZstd - сжатие zstd.
+	EncodingZstd = "zstd"
 )
 
-type compressReader struct {
-	reader   io.ReadCloser
-	gzreader *gzip.Reader
+// CompressMinSize - минимальный размер ответа в байтах, начиная с которого ответ сжимается.
+// Сжатие ответов меньшего размера не окупает затрат на него.
+const CompressMinSize = 1024
+
+// ErrUnsupportedEncoding ошибка неподдерживаемой кодировки тела запроса.
+var ErrUnsupportedEncoding = fmt.Errorf("unsupported content encoding")
+
+// responseEncodings - кодировки сжатия ответов в порядке предпочтения сервера.
+var responseEncodings = []string{EncodingZstd, EncodingGzip}
+
+// Пулы кодировщиков и декодировщиков - их создание дороже сжатия небольших тел запросов и ответов.
+var (
+	gzipWriterPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	zstdEncoderPool = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+	gzipReaderPool  sync.Pool // *gzip.Reader, создается только по корректному потоку
+	zstdDecoderPool = sync.Pool{New: func() any {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		return dec
+	}}
+)
+
+// WithGzip выполняет роль миддлваре сжатия данных.
+// Тело запроса, сжатое gzip или zstd, распаковывается целиком до передачи хендлеру,
+// поэтому неподдерживаемая кодировка и поврежденные данные отклоняются со статусом Bad Request.
+// Размер распакованного тела не превышает ограничения из WithBodyLimit, иначе запрос отклоняется
+// со статусом Request Entity Too Large.
+// Ответ сжимается кодировкой, выбранной по заголовку Accept-Encoding запроса, если его тип
+// поддается сжатию, а размер не меньше CompressMinSize.
+func WithGzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := decodeRequestBody(r); err != nil {
+			slog.InfoContext(r.Context(), "failed to decode request body", "error", err.Error())
+			status := http.StatusBadRequest
+			if IsBodyTooLarge(err) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+		}
+		defer func() { _ = cw.Close() }()
+
+		h.ServeHTTP(cw, r)
+	})
 }
 
-func newCompressReader(r io.ReadCloser) (*compressReader, error) {
-	zr, err := gzip.NewReader(r)
+// decodeRequestBody распаковывает тело запроса по заголовку Content-Encoding.
+// После распаковки заголовки запроса описывают уже распакованное тело.
+func decodeRequestBody(r *http.Request) error {
+	var decode func(io.Reader, int64) ([]byte, error)
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return nil
+	case EncodingGzip, "x-gzip":
+		decode = readGzip
+	case EncodingZstd:
+		decode = readZstd
+	default:
+		return fmt.Errorf("%w %q", ErrUnsupportedEncoding, r.Header.Get("Content-Encoding"))
+	}
+
+	limit, _ := BodyLimitFromContext(r.Context())
+	body, err := decode(r.Body, limit)
+	_ = r.Body.Close()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &compressReader{
-		reader:   r,
-		gzreader: zr,
-	}, nil
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+
+	return nil
 }
 
-// Read читает сжатые данные.
-func (c *compressReader) Read(p []byte) (n int, err error) {
-	return c.gzreader.Read(p)
+// readGzip читает и распаковывает поток gzip не более чем до limit байт.
+func readGzip(src io.Reader, limit int64) ([]byte, error) {
+	zr, ok := gzipReaderPool.Get().(*gzip.Reader)
+	if ok {
+		if err := zr.Reset(src); err != nil {
+			gzipReaderPool.Put(zr)
+			return nil, err
+		}
+	} else {
+		var err error
+		if zr, err = gzip.NewReader(src); err != nil {
+			return nil, err
+		}
+	}
+	defer gzipReaderPool.Put(zr)
+
+	body, err := readAll(zr, limit)
+	if err != nil {
+		return nil, err
+	}
+	return body, zr.Close()
 }
 
-// Close закрывает чтение.
-func (c *compressReader) Close() error {
-	if err := c.reader.Close(); err != nil {
-		return err
+// readZstd читает и распаковывает поток zstd не более чем до limit байт.
+func readZstd(src io.Reader, limit int64) ([]byte, error) {
+	dec := zstdDecoderPool.Get().(*zstd.Decoder)
+	defer zstdDecoderPool.Put(dec)
+
+	if err := dec.Reset(src); err != nil {
+		return nil, err
 	}
-	return c.gzreader.Close()
+	return readAll(dec, limit)
 }
 
-// WithGzip выполняет роль миддлваре сжатия данных.
-func WithGzip(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-			compReader, err := newCompressReader(r.Body)
+// readAll читает распакованные данные не более чем до limit байт, 0 - без ограничения.
+// Распаковка прерывается, как только данные превысили ограничение, - так отклоняются
+// небольшие запросы, распаковывающиеся в огромные данные.
+func readAll(src io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(src)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(src, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	return body, nil
+}
+
+// negotiateEncoding выбирает кодировку сжатия ответа по заголовку Accept-Encoding.
+// Выбирается поддерживаемая кодировка с наибольшим весом q, при равных весах - по предпочтению сервера.
+// Пустая строка означает, что ответ не сжимается.
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "x-gzip" {
+			name = EncodingGzip
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				continue
 			}
-			defer func() { _ = compReader.Close() }()
-			r.Body = compReader
+			q = parsed
 		}
-		h.ServeHTTP(w, r)
-	})
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range responseEncodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compressible сообщает, имеет ли смысл сжимать данные переданного типа.
+// Изображения, архивы и другие уже сжатые данные не сжимаются.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+
+	return false
+}
+
+// compressWriter сжимает ответ выбранной кодировкой.
+// Начало ответа накапливается в буфере, пока не станет ясно, нужно ли его сжимать:
+// решение принимается по типу ответа, когда размер буфера достигает CompressMinSize или ответ завершен.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // Кодировка, выбранная по заголовку Accept-Encoding
+
+	status  int            // Статус ответа, отложенный до принятия решения о сжатии
+	buf     []byte         // Начало ответа до принятия решения о сжатии
+	decided bool           // Решение о сжатии принято, заголовки ответа записаны
+	enc     io.WriteCloser // Кодировщик ответа, nil - ответ не сжимается
+}
+
+// WriteHeader откладывает запись статуса до принятия решения о сжатии.
+func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.decided {
+		c.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if c.status == 0 {
+		c.status = statusCode
+	}
+}
+
+// Write записывает данные ответа, при необходимости сжимая их.
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < CompressMinSize {
+			return len(p), nil
+		}
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush отправляет клиенту уже записанные данные ответа.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if err := c.decide(); err != nil {
+			return
+		}
+	}
+	if f, ok := c.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close завершает ответ: принимает решение о сжатии, если оно еще не принято,
+// дописывает сжатые данные и возвращает кодировщик в пул.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 && len(c.buf) == 0 {
+			// Хендлер ничего не записал - ответ формирует http.Server
+			return nil
+		}
+		if err := c.decide(); err != nil {
+			return err
+		}
+	}
+	if c.enc == nil {
+		return nil
+	}
+
+	err := c.enc.Close()
+	switch enc := c.enc.(type) {
+	case *gzip.Writer:
+		gzipWriterPool.Put(enc)
+	case *zstd.Encoder:
+		zstdEncoderPool.Put(enc)
+	}
+	c.enc = nil
+
+	return err
+}
+
+// decide принимает решение о сжатии, записывает заголовки и накопленное начало ответа.
+func (c *compressWriter) decide() error {
+	c.decided = true
+
+	h := c.Header()
+	// Тип ответа определяем до записи, иначе http.Server определит его по сжатым данным
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+
+	if compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+
+		if len(c.buf) >= CompressMinSize && h.Get("Content-Encoding") == "" && bodyAllowed(c.status) {
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", c.encoding)
+			c.enc = c.newEncoder()
+		}
+	}
+
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.enc != nil {
+		_, err := c.enc.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// newEncoder берет из пула кодировщик выбранной кодировки, пишущий в исходный ResponseWriter.
+func (c *compressWriter) newEncoder() io.WriteCloser {
+	if c.encoding == EncodingZstd {
+		enc := zstdEncoderPool.Get().(*zstd.Encoder)
+		enc.Reset(c.ResponseWriter)
+		return enc
+	}
+
+	enc := gzipWriterPool.Get().(*gzip.Writer)
+	enc.Reset(c.ResponseWriter)
+	return enc
+}
+
+// bodyAllowed сообщает, может ли ответ с переданным статусом иметь тело.
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
 }
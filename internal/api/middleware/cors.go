@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCORSWildcardCredentials ошибка параметров CORS, разрешающих запросы с куками с любых источников.
+var ErrCORSWildcardCredentials = fmt.Errorf("wildcard CORS origin is not allowed with credentials")
+
+// CORSOptions - параметры CORS.
+type CORSOptions struct {
+	AllowedOrigins   []string      // Разрешенные источники: точно, "*" - любой, "https://*.example.com" - поддомены
+	AllowedMethods   []string      // Разрешенные методы запросов
+	AllowedHeaders   []string      // Разрешенные заголовки запросов
+	ExposedHeaders   []string      // Заголовки ответа, доступные скрипту на странице
+	AllowCredentials bool          // Разрешить запросы с куками
+	MaxAge           time.Duration // Время кэширования ответа на предварительный запрос, 0 - не кэшируется
+}
+
+// Validate проверяет параметры CORS. Запросы с куками разрешаются только точно заданным источникам
+// и поддоменам конкретного домена: "*" и шаблоны вроде "https://*" или "https://*.com"
+// позволили бы любому сайту выполнять запросы от имени пользователя.
+func (o CORSOptions) Validate() error {
+	if !o.AllowCredentials {
+		return nil
+	}
+	for _, origin := range o.AllowedOrigins {
+		if !strings.Contains(origin, "*") {
+			continue
+		}
+		scheme, domain, ok := strings.Cut(origin, "://*.")
+		if !ok || scheme == "" || !strings.Contains(domain, ".") || strings.Contains(domain, "*") {
+			return fmt.Errorf("%w: %q", ErrCORSWildcardCredentials, origin)
+		}
+	}
+	return nil
+}
+
+// WithCORS возвращает миддлваре, разрешающую кросс-доменные запросы с источников из параметров.
+// Предварительный запрос OPTIONS обрабатывается без передачи хендлеру: разрешенному источнику
+// возвращается статус No Content с разрешенными методами и заголовками, иначе - статус Forbidden.
+// Ответ на обычный запрос с разрешенного источника дополняется заголовками CORS, с неразрешенного
+// источника - передается без них, и браузер не отдаст его скрипту на странице.
+// Если разрешенные источники не заданы, кросс-доменные запросы не разрешаются.
+func WithCORS(opts CORSOptions) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if len(opts.AllowedOrigins) == 0 {
+			return h
+		}
+
+		methods := make(map[string]bool, len(opts.AllowedMethods))
+		for _, method := range opts.AllowedMethods {
+			methods[strings.ToUpper(method)] = true
+		}
+		headers := make(map[string]bool, len(opts.AllowedHeaders))
+		for _, header := range opts.AllowedHeaders {
+			headers[http.CanonicalHeaderKey(header)] = true
+		}
+
+		allowMethods := strings.Join(opts.AllowedMethods, ", ")
+		exposeHeaders := strings.Join(opts.ExposedHeaders, ", ")
+		maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			// Ответ зависит от источника, кэши не должны отдавать его другим источникам
+			w.Header().Add("Vary", "Origin")
+
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := originAllowed(opts.AllowedOrigins, origin)
+
+			if !preflight {
+				if allowed {
+					setAllowOrigin(w, opts, origin)
+					if exposeHeaders != "" {
+						w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+					}
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+			requested := requestedHeaders(r)
+			if !allowed || !methods[method] || !allHeadersAllowed(headers, requested) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			setAllowOrigin(w, opts, origin)
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			if len(requested) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			}
+			if opts.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// setAllowOrigin разрешает ответ источнику запроса.
+// С куками браузер не принимает "*", поэтому источник в этом случае возвращается явно.
+func setAllowOrigin(w http.ResponseWriter, opts CORSOptions, origin string) {
+	if opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	for _, allowed := range opts.AllowedOrigins {
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+// originAllowed сообщает, разрешен ли источник запроса.
+func originAllowed(allowedOrigins []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range allowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		// Шаблон поддоменов: https://*.example.com
+		if scheme, domain, ok := strings.Cut(allowed, "*."); ok &&
+			strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, "."+domain) &&
+			len(origin) > len(scheme)+len(domain)+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedHeaders возвращает заголовки, которые будут отправлены в запросе после предварительного.
+func requestedHeaders(r *http.Request) []string {
+	var requested []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				requested = append(requested, http.CanonicalHeaderKey(header))
+			}
+		}
+	}
+	return requested
+}
+
+// allHeadersAllowed сообщает, разрешены ли все заголовки запроса.
+func allHeadersAllowed(allowed map[string]bool, requested []string) bool {
+	for _, header := range requested {
+		if !allowed[header] {
+			return false
+		}
+	}
+	return true
+}
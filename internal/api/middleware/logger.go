@@ -32,6 +32,7 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 
 // WithLogging выполняет роль миддлваре логирования запросов.
 // Регистрирует путь, метод, статус ответа, длительность и размер ответа для каждого запроса.
+// Запрос, хендлер которого запаниковал до записи статуса, логируется со статусом Internal Server Error.
 func WithLogging(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -46,17 +47,32 @@ func WithLogging(h http.Handler) http.Handler {
 			responseData:   respData,
 		}
 
-		h.ServeHTTP(&lw, r)
+		// Логируем и при панике - ее перехватывает внешний WithRecovery
+		completed := false
+		defer func() {
+			duration := time.Since(start)
 
-		duration := time.Since(start)
+			slog.InfoContext(
+				r.Context(),
+				"got request",
+				slog.String("uri", r.RequestURI),
+				slog.String("method", r.Method),
+				slog.Int("status", panicStatus(respData.status, completed)),
+				slog.Duration("duration", duration),
+				slog.Int("size", respData.size),
+			)
+		}()
 
-		slog.Info(
-			"got request",
-			slog.String("uri", r.RequestURI),
-			slog.String("method", r.Method),
-			slog.Int("status", respData.status),
-			slog.Duration("duration", duration),
-			slog.Int("size", respData.size),
-		)
+		h.ServeHTTP(&lw, r)
+		completed = true
 	})
 }
+
+// panicStatus возвращает статус, с которым ответ уходит клиенту, если хендлер не завершился
+// из-за паники и не успел записать статус, - его записывает WithRecovery.
+func panicStatus(status int, completed bool) int {
+	if !completed && status == 0 {
+		return http.StatusInternalServerError
+	}
+	return status
+}
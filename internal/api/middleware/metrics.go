@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+)
+
+// WithMetrics выполняет роль миддлваре сбора метрик запросов.
+// Запросы учитываются по шаблону маршрута chi, а не по пути, чтобы идентификаторы ссылок
+// не порождали новых значений меток. Запросы без маршрута учитываются с шаблоном "unmatched",
+// запросы с паникой хендлера до записи статуса - со статусом Internal Server Error.
+func WithMetrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		respData := &responseData{}
+		lw := loggingResponseWriter{
+			ResponseWriter: w,
+			responseData:   respData,
+		}
+
+		// Учитываем и запросы с паникой - ее перехватывает внешний WithRecovery
+		completed := false
+		defer func() {
+			// Шаблон маршрута известен только после роутинга
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			// Если хендлер не записал статус явно, ответ ушел со статусом 200
+			status := panicStatus(respData.status, completed)
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+			metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		}()
+
+		h.ServeHTTP(&lw, r)
+		completed = true
+	})
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+	"github.com/RomanAgaltsev/urlcut/internal/ratelimit"
+)
+
+// WithRateLimit возвращает миддлваре ограничения частоты запросов класса маршрутов.
+// Токен забирается из корзины IP адреса клиента и, если запрос авторизован, из корзины пользователя.
+// Оставшийся запас сообщается в заголовках RateLimit-*, при его исчерпании возвращается
+// статус Too Many Requests с заголовком Retry-After. При недоступности хранилища корзин
+// запрос пропускается - ограничение частоты не должно останавливать сервис.
+// IP адрес клиента берется из заголовка ipHeader, если сервис работает за доверенным прокси,
+// иначе - из адреса соединения. Если ограничитель не передан, частота не ограничивается.
+func WithRateLimit(limiter *ratelimit.Limiter, class, ipHeader string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if limiter == nil || !limiter.Limit(class).Enabled() {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys := []string{"ip:" + clientIP(r, ipHeader)}
+			if uid, _ := r.Context().Value(auth.UserIDClaimName).(string); uid != "" {
+				keys = append(keys, "uid:"+uid)
+			}
+
+			result, err := limiter.Allow(r.Context(), class, keys...)
+			if err != nil {
+				slog.WarnContext(r.Context(), "rate limit store is unavailable, request is not limited", slog.String("error", err.Error()))
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				metrics.HTTPRateLimited.WithLabelValues(class).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP возвращает IP адрес клиента из заголовка доверенного прокси или из адреса соединения.
+// В заголовке вида X-Forwarded-For берется последний адрес - его добавил сам доверенный прокси.
+// Предыдущие адреса передал клиент, и им нельзя верить: подменяя их, клиент получал бы новую корзину
+// на каждый запрос.
+func clientIP(r *http.Request, ipHeader string) string {
+	if ipHeader != "" {
+		if values := r.Header.Values(ipHeader); len(values) > 0 {
+			list := values[len(values)-1]
+			last := list[strings.LastIndex(list, ",")+1:]
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд, как их передают заголовки ответа.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
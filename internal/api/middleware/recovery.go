@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoveryResponseWriter отслеживает, начата ли запись ответа.
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader записывает статус ответа.
+func (r *recoveryResponseWriter) WriteHeader(statusCode int) {
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write записывает данные ответа.
+func (r *recoveryResponseWriter) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush отправляет клиенту уже записанные данные ответа.
+func (r *recoveryResponseWriter) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (r *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// WithRecovery выполняет роль миддлваре восстановления после паники в хендлере.
+// Паника логируется вместе со стеком вызовов, клиенту возвращается статус Internal Server Error.
+// Если хендлер уже начал писать ответ, статус изменить нельзя - соединение обрывается,
+// чтобы клиент не принял недописанный ответ за полный.
+// Паника http.ErrAbortHandler пробрасывается дальше - ею хендлер намеренно прерывает ответ.
+func WithRecovery(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			slog.ErrorContext(
+				r.Context(),
+				"panic recovered",
+				slog.Any("panic", rec),
+				slog.String("uri", r.RequestURI),
+				slog.String("method", r.Method),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		h.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/requestid"
+)
+
+// WithRequestID выполняет роль миддлваре идентификатора запроса.
+// Идентификатор берется из заголовка X-Request-ID запроса, а если его нет или он некорректный - создается новый.
+// Идентификатор передается дальше через контекст, возвращается в заголовке ответа и добавляется в спан запроса.
+func WithRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.request_id", id))
+
+		h.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
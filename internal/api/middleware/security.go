@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityHeadersOptions - параметры заголовков безопасности ответа.
+type SecurityHeadersOptions struct {
+	HSTSMaxAge            time.Duration // Срок Strict-Transport-Security, 0 - заголовок не отправляется
+	ReferrerPolicy        string        // Значение Referrer-Policy, пустое - заголовок не отправляется
+	ContentSecurityPolicy string        // Значение Content-Security-Policy для HTML, пустое - заголовок не отправляется
+}
+
+// WithSecurityHeaders возвращает миддлваре, добавляющую в ответы заголовки безопасности:
+// X-Content-Type-Options запрещает браузеру угадывать тип ответа, Referrer-Policy ограничивает
+// передачу адреса страницы при переходе по ссылкам, Strict-Transport-Security требует от браузера
+// обращаться к сервису только по HTTPS. Content-Security-Policy добавляется только в ответы HTML,
+// например в тело перенаправления, - остальные ответы браузер не исполняет.
+func WithSecurityHeaders(opts SecurityHeadersOptions) func(http.Handler) http.Handler {
+	hsts := ""
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			if opts.ReferrerPolicy != "" {
+				header.Set("Referrer-Policy", opts.ReferrerPolicy)
+			}
+			if hsts != "" {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+
+			if opts.ContentSecurityPolicy == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			h.ServeHTTP(&securityResponseWriter{ResponseWriter: w, csp: opts.ContentSecurityPolicy}, r)
+		})
+	}
+}
+
+// securityResponseWriter добавляет Content-Security-Policy, если ответ оказался HTML.
+// Тип ответа известен только в момент записи заголовков.
+type securityResponseWriter struct {
+	http.ResponseWriter
+	csp         string // Значение Content-Security-Policy
+	wroteHeader bool   // Заголовки ответа записаны
+}
+
+// WriteHeader дополняет заголовки ответа HTML политикой безопасности и записывает статус.
+func (s *securityResponseWriter) WriteHeader(statusCode int) {
+	if !s.wroteHeader {
+		s.wroteHeader = true
+		s.setCSP()
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write записывает данные ответа. Если тип ответа не задан, он определяется по данным так же,
+// как это сделает http.Server.
+func (s *securityResponseWriter) Write(p []byte) (int, error) {
+	if !s.wroteHeader {
+		if s.Header().Get("Content-Type") == "" && len(p) > 0 {
+			s.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		s.WriteHeader(http.StatusOK)
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Flush отправляет клиенту уже записанные данные ответа.
+func (s *securityResponseWriter) Flush() {
+	if !s.wroteHeader {
+		s.WriteHeader(http.StatusOK)
+	}
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (s *securityResponseWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// setCSP устанавливает Content-Security-Policy, если ответ - HTML и политика не задана хендлером.
+func (s *securityResponseWriter) setCSP() {
+	header := s.Header()
+	if header.Get("Content-Security-Policy") != "" {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		header.Set("Content-Security-Policy", s.csp)
+	}
+}
@@ -0,0 +1,132 @@
+package url
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// accountHandlers владеет обработчиками регистрации и входа пользователей.
+type accountHandlers struct {
+	shortener     interfaces.Service  // сервис сокращателя ссылок
+	authenticator *auth.Authenticator // выпуск токенов зарегистрированных пользователей
+}
+
+// newAccountHandlers создает обработчики регистрации и входа пользователей.
+func newAccountHandlers(shortener interfaces.Service, authenticator *auth.Authenticator) *accountHandlers {
+	return &accountHandlers{
+		shortener:     shortener,
+		authenticator: authenticator,
+	}
+}
+
+// Register выполняет обработку запроса на регистрацию пользователя с адресом почты и паролем в формате JSON.
+// URL, сокращенные пользователем до регистрации, переходят к нему. В ответ выдается токен
+// зарегистрированного пользователя, с которым его URL доступны и на других устройствах.
+func (h *accountHandlers) Register(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Получаем идентификатор анонимного пользователя
+	uid, err := getUserUID(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	creds, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.shortener.Register(ctx, creds.Email, creds.Password, uid)
+	switch {
+	case errors.Is(err, model.ErrInvalidEmail), errors.Is(err, model.ErrInvalidPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, repository.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, repository.ErrUserUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case err != nil:
+		slog.InfoContext(ctx, "failed to register user", "error", err.Error())
+		http.Error(w, "please look at logs", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeAccount(w, r, user, http.StatusCreated)
+}
+
+// Login выполняет обработку запроса на вход пользователя с адресом почты и паролем в формате JSON.
+// В ответ выдается токен зарегистрированного пользователя вместо анонимного.
+func (h *accountHandlers) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	creds, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.shortener.Login(ctx, creds.Email, creds.Password)
+	switch {
+	case errors.Is(err, model.ErrInvalidCredentials):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, repository.ErrUserUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case err != nil:
+		slog.InfoContext(ctx, "failed to login user", "error", err.Error())
+		http.Error(w, "please look at logs", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeAccount(w, r, user, http.StatusOK)
+}
+
+// writeAccount выдает токен пользователя и пишет в ответ данные пользователя.
+func (h *accountHandlers) writeAccount(w http.ResponseWriter, r *http.Request, user *model.User, status int) {
+	token, tokenString, err := h.authenticator.NewToken(user.ID.String())
+	if err != nil {
+		slog.InfoContext(r.Context(), "failed to issue token", "error", err.Error())
+		http.Error(w, "please look at logs", http.StatusInternalServerError)
+		return
+	}
+
+	// Токен пользователя заменяет анонимный токен, выданный миддлваре авторизации
+	w.Header().Del("Set-Cookie")
+	http.SetCookie(w, h.authenticator.Cookie(token, tokenString))
+	w.Header().Set("Authorization", tokenString)
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+
+	if err = json.NewEncoder(w).Encode(model.AccountDTO{UID: user.ID, Email: user.Email}); err != nil {
+		slog.InfoContext(r.Context(), "failed to encode account", "error", err.Error())
+	}
+}
+
+// decodeCredentials читает из тела запроса адрес почты и пароль.
+// При ошибке в ответ пишется статус Bad Request или Request Entity Too Large.
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (model.CredentialsDTO, bool) {
+	var creds model.CredentialsDTO
+
+	dec := json.NewDecoder(r.Body)
+	defer func() { _ = r.Body.Close() }()
+
+	if err := dec.Decode(&creds); err != nil {
+		if !bodyTooLarge(w, err) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return creds, false
+	}
+	return creds, true
+}
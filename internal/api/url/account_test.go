@@ -0,0 +1,127 @@
+package url
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+)
+
+func TestAccountHandlers(t *testing.T) {
+	hlp := newHelper(t)
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// newDevice возвращает клиента со своими куками - отдельное устройство пользователя
+	newDevice := func() *http.Client {
+		jar, errj := cookiejar.New(nil)
+		require.NoError(t, errj)
+		return &http.Client{Transport: ts.Client().Transport, Jar: jar}
+	}
+
+	post := func(client *http.Client, path, payload string) (*http.Response, []byte) {
+		resp, errp := client.Post(ts.URL+path, ContentTypeJSON, strings.NewReader(payload))
+		require.NoError(t, errp)
+		defer func() { _ = resp.Body.Close() }()
+
+		body, errp := io.ReadAll(resp.Body)
+		require.NoError(t, errp)
+		return resp, body
+	}
+
+	userURLs := func(client *http.Client) []model.UserURLDTO {
+		resp, errg := client.Get(ts.URL + "/api/user/urls")
+		require.NoError(t, errg)
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var urls []model.UserURLDTO
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&urls))
+		return urls
+	}
+
+	const credentials = `{"email":"user@example.com","password":"correct horse"}`
+
+	// Анонимный пользователь сокращает URL на первом устройстве
+	laptop := newDevice()
+	resp, _ := post(laptop, "/api/shorten", `{"url":"https://practicum.yandex.ru"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	anonymous := laptop.Jar.Cookies(resp.Request.URL)
+
+	// Некорректные запросы на регистрацию
+	resp, _ = post(laptop, "/api/user/register", `{"email":`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = post(laptop, "/api/user/register", `{"email":"not an email","password":"correct horse"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = post(laptop, "/api/user/register", `{"email":"user@example.com","password":"short"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Регистрация передает URL анонимного пользователя зарегистрированному
+	resp, body := post(laptop, "/api/user/register", credentials)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, ContentTypeJSON, resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get("Authorization"))
+
+	var account model.AccountDTO
+	require.NoError(t, json.Unmarshal(body, &account))
+	assert.Equal(t, "user@example.com", account.Email)
+	assert.NotContains(t, string(body), "correct horse")
+
+	urls := userURLs(laptop)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "https://practicum.yandex.ru", urls[0].OriginalURL)
+
+	// Анонимный токен больше не дает доступа к URL зарегистрированного пользователя
+	stolen := newDevice()
+	stolen.Jar.SetCookies(resp.Request.URL, anonymous)
+	assert.Empty(t, userURLs(stolen))
+
+	// Адрес почты уже занят
+	phone := newDevice()
+	resp, _ = post(phone, "/api/user/register", credentials)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Неверный пароль
+	resp, _ = post(phone, "/api/user/login", `{"email":"user@example.com","password":"battery staple"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+
+	// Вход на новом устройстве восстанавливает доступ к URL
+	assert.Empty(t, userURLs(phone))
+	resp, body = post(phone, "/api/user/login", credentials)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var loggedIn model.AccountDTO
+	require.NoError(t, json.Unmarshal(body, &loggedIn))
+	assert.Equal(t, account, loggedIn)
+
+	urls = userURLs(phone)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "https://practicum.yandex.ru", urls[0].OriginalURL)
+
+	// Недействительный токен не мешает войти
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/user/login", strings.NewReader(credentials))
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: auth.DefaultCookieName, Value: "invalid"})
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
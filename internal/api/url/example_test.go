@@ -16,9 +16,6 @@ import (
 func Example() {
 	// Объявляем служебные константы
 	const (
-		// Путь к файловому хранилищу URL
-		fileStoragePath = "storage.json"
-
 		// Оригинальный URL, который необходимо сократить
 		url = "https://practicum.yandex.ru/"
 	)
@@ -26,8 +23,8 @@ func Example() {
 	// Получаем конфигурацию приложения
 	cfg, _ := config.Get()
 
-	// Создаем in memory репозиторий
-	repo := repository.NewInMemoryRepository(fileStoragePath)
+	// Создаем in memory репозиторий без файлового хранилища
+	repo, _ := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
 
 	// Создаем сервис сокращения URL
 	service, _ := services.NewShortener(repo, cfg)
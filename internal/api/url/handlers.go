@@ -2,6 +2,7 @@
 package url
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,12 +10,15 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/RomanAgaltsev/urlcut/internal/api/middleware"
+	"github.com/RomanAgaltsev/urlcut/internal/buildinfo"
 	"github.com/RomanAgaltsev/urlcut/internal/config"
-	"github.com/RomanAgaltsev/urlcut/internal/database"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
 	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
@@ -28,8 +32,14 @@ const (
 
 	// ContentTypeText используется для установки значений заголовков http-ответов.
 	ContentTypeText = "text/plain; charset=utf-8"
+
+	// ContentTypeJWKS используется для установки заголовка ответа с публичными ключами JWK Set.
+	ContentTypeJWKS = "application/jwk-set+json"
 )
 
+// healthCheckTimeout - таймаут проверки зависимостей при запросе готовности.
+const healthCheckTimeout = 2 * time.Second
+
 // ErrNoUserID ошибка отсутствия идентификатора пользователя в полученном запросе (в куке или заголовке).
 var ErrNoUserID = fmt.Errorf("no user ID provided")
 
@@ -37,6 +47,8 @@ var ErrNoUserID = fmt.Errorf("no user ID provided")
 type Handlers struct {
 	shortener interfaces.Service // сервис сокращателя ссылок
 	cfg       *config.Config     // конфигурация приложения
+
+	draining atomic.Bool // начато выключение сервера, сервис не готов принимать запросы
 }
 
 // NewHandlers - функция-конструктор Handlers.
@@ -61,8 +73,11 @@ func (h *Handlers) Shorten(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Читаем оригинальный URL из тела запроса
-	longURL, _ := io.ReadAll(r.Body)
+	longURL, err := io.ReadAll(r.Body)
 	defer func() { _ = r.Body.Close() }()
+	if bodyTooLarge(w, err) {
+		return
+	}
 
 	// Если оригинального URL нет, считаем, что запрос плохой
 	if len(longURL) == 0 {
@@ -72,8 +87,11 @@ func (h *Handlers) Shorten(w http.ResponseWriter, r *http.Request) {
 
 	// Выполняем сокращение полученного оригинального URL
 	url, err := h.shortener.Shorten(ctx, string(longURL), uid)
+	if quotaExceeded(w, err) {
+		return
+	}
 	if err != nil && !errors.Is(err, repository.ErrConflict) {
-		slog.Info("failed to short URL", "error", err.Error())
+		slog.InfoContext(ctx, "failed to short URL", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -96,7 +114,7 @@ func (h *Handlers) Shorten(w http.ResponseWriter, r *http.Request) {
 	// Пишем сокращенный URL в тело ответа
 	_, err = w.Write([]byte(shortURL))
 	if err != nil {
-		slog.Info("failed to write shorten URL to response", "error", err.Error())
+		slog.InfoContext(ctx, "failed to write shorten URL to response", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 	}
 }
@@ -121,7 +139,10 @@ func (h *Handlers) ShortenAPI(w http.ResponseWriter, r *http.Request) {
 	// Читаем тело запроса
 	var req model.URLDTO
 	if err = dec.Decode(&req); err != nil {
-		slog.Info("failed to unmarshal long URL", "error", err.Error())
+		if bodyTooLarge(w, err) {
+			return
+		}
+		slog.InfoContext(ctx, "failed to unmarshal long URL", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -135,8 +156,11 @@ func (h *Handlers) ShortenAPI(w http.ResponseWriter, r *http.Request) {
 
 	// Выполняем сокращение URL
 	url, errShort := h.shortener.Shorten(ctx, longURL, uid)
+	if quotaExceeded(w, errShort) {
+		return
+	}
 	if errShort != nil && !errors.Is(errShort, repository.ErrConflict) {
-		slog.Info("failed to short URL", "error", errShort.Error())
+		slog.InfoContext(ctx, "failed to short URL", "error", errShort.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -144,7 +168,7 @@ func (h *Handlers) ShortenAPI(w http.ResponseWriter, r *http.Request) {
 	// Сокращенный URL преобразуем в JSON
 	res, err := json.Marshal(model.ResultDTO{Result: url.Short()})
 	if err != nil {
-		slog.Info("failed to marshal shorten URL", "error", err.Error())
+		slog.InfoContext(ctx, "failed to marshal shorten URL", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -165,7 +189,7 @@ func (h *Handlers) ShortenAPI(w http.ResponseWriter, r *http.Request) {
 	// Пишем сокращенный URL в тело ответа
 	_, err = w.Write(res)
 	if err != nil {
-		slog.Info("failed to write shorten URL to response", "error", err.Error())
+		slog.InfoContext(ctx, "failed to write shorten URL to response", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 	}
 }
@@ -193,7 +217,10 @@ func (h *Handlers) ShortenAPIBatch(w http.ResponseWriter, r *http.Request) {
 	// Читаем открывающую скобку "["
 	_, err = dec.Token()
 	if err != nil {
-		slog.Info("failed to decode batch", "error", err.Error())
+		if bodyTooLarge(w, err) {
+			return
+		}
+		slog.InfoContext(ctx, "failed to decode batch", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -202,7 +229,10 @@ func (h *Handlers) ShortenAPIBatch(w http.ResponseWriter, r *http.Request) {
 	for dec.More() {
 		var batchReq model.IncomingBatchDTO
 		if err = dec.Decode(&batchReq); err != nil {
-			slog.Info("failed to decode batch element", "error", err.Error())
+			if bodyTooLarge(w, err) {
+				return
+			}
+			slog.InfoContext(ctx, "failed to decode batch element", "error", err.Error())
 			http.Error(w, "please look at logs", http.StatusInternalServerError)
 			return
 		}
@@ -212,15 +242,18 @@ func (h *Handlers) ShortenAPIBatch(w http.ResponseWriter, r *http.Request) {
 
 	// Если получили пустой батч, то и делать нечего...
 	if len(batch) == 0 {
-		slog.Info("got empty batch")
+		slog.InfoContext(ctx, "got empty batch")
 		http.Error(w, "please look at logs", http.StatusBadRequest)
 		return
 	}
 
 	// Сокращаем все URL батча, которые были прочитаны
 	batchShortened, err := h.shortener.ShortenBatch(ctx, batch, uid)
+	if quotaExceeded(w, err) {
+		return
+	}
 	if err != nil && !errors.Is(err, repository.ErrConflict) {
-		slog.Info("failed to short URL", "error", err.Error())
+		slog.InfoContext(ctx, "failed to short URL", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -242,7 +275,7 @@ func (h *Handlers) ShortenAPIBatch(w http.ResponseWriter, r *http.Request) {
 
 	err = enc.Encode(batchShortened)
 	if err != nil {
-		slog.Info("failed to encode batch", "error", err.Error())
+		slog.InfoContext(ctx, "failed to encode batch", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -267,7 +300,7 @@ func (h *Handlers) Expand(w http.ResponseWriter, r *http.Request) {
 	// Получаем URL по идентификатору
 	url, err := h.shortener.Expand(ctx, urlID)
 	if err != nil {
-		slog.Info("failed to expand URL", "error", err.Error())
+		slog.InfoContext(ctx, "failed to expand URL", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusNotFound)
 		return
 	}
@@ -289,27 +322,71 @@ func (h *Handlers) Expand(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusTemporaryRedirect)
 }
 
-// Ping выполняет обработку запроса на пинг хранилища.
-// Перед обработкой выполняется извлечение идентификатора пользователя из запроса.
-// При отсутствии идентификатора, обработка запроса прекращается и возвращается статус Unauthorized.
-func (h *Handlers) Ping(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// Livez выполняет обработку запроса проверки жизнеспособности.
+// Зависимости не проверяются: ответ означает, что процесс запущен и обрабатывает запросы.
+func (h *Handlers) Livez(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, &model.HealthDTO{Status: model.HealthUp})
+}
 
-	// Получаем идентификатор пользователя
-	_, err := getUserUID(r)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+// Readyz выполняет обработку запроса проверки готовности.
+// Проверяются уже открытые соединения хранилища, в ответе передается состояние каждой зависимости.
+// Сервис не готов, если не работает хотя бы одна обязательная зависимость или начато выключение сервера.
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, &model.HealthDTO{Status: model.HealthDown})
 		return
 	}
 
-	db, err := database.NewConnection(ctx, "pgx", h.cfg.DatabaseDSN)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	health := &model.HealthDTO{
+		Status: model.HealthUp,
+		Checks: h.shortener.Health(ctx),
+	}
+	for _, check := range health.Checks {
+		if !check.Up() && !check.Optional {
+			health.Status = model.HealthDown
+		}
 	}
-	defer func() { _ = db.Close() }()
 
+	status := http.StatusOK
+	if health.Status != model.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, health)
+}
+
+// Version выполняет обработку запроса информации о сборке и активном хранилище.
+func (h *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	info.Storage = repository.BackendName(h.cfg)
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
 	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		slog.InfoContext(r.Context(), "failed to encode build info", "error", err.Error())
+	}
+}
+
+// JWKS возвращает обработчик запроса публичных ключей, которыми проверяются токены пользователей.
+// Ключи кэшируются клиентами недолго, чтобы новый ключ после смены был получен ими до выпуска токенов с ним.
+func JWKS(a *auth.Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJWKS)
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := w.Write(a.JWKS()); err != nil {
+			slog.InfoContext(r.Context(), "failed to write JWKS", "error", err.Error())
+		}
+	}
+}
+
+// Drain выключает готовность сервиса. Вызывается при начале выключения HTTP сервера.
+func (h *Handlers) Drain() {
+	h.draining.Store(true)
 }
 
 // UserUrls выполняет обработку запроса на получение списка всех сохраненных URL пользователя.
@@ -328,7 +405,7 @@ func (h *Handlers) UserUrls(w http.ResponseWriter, r *http.Request) {
 	// Получаем URL-ы пользователя
 	urls, err := h.shortener.UserURLs(ctx, uid)
 	if err != nil {
-		slog.Info("failed to fetch user URLs", "error", err.Error())
+		slog.InfoContext(ctx, "failed to fetch user URLs", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -349,7 +426,7 @@ func (h *Handlers) UserUrls(w http.ResponseWriter, r *http.Request) {
 
 	err = enc.Encode(urls)
 	if err != nil {
-		slog.Info("failed to encode user URLs", "error", err.Error())
+		slog.InfoContext(ctx, "failed to encode user URLs", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -369,14 +446,17 @@ func (h *Handlers) UserUrlsDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Читаем массив идентификаторов URL из тела запроса
-	urlArray, _ := io.ReadAll(r.Body)
+	urlArray, err := io.ReadAll(r.Body)
 	defer func() { _ = r.Body.Close() }()
+	if bodyTooLarge(w, err) {
+		return
+	}
 
 	// Парсим JSON
 	var shortURLs []string
 	err = json.Unmarshal(urlArray, &shortURLs)
 	if err != nil {
-		slog.Info("failed to unmarshal URL ID array", "error", err.Error())
+		slog.InfoContext(ctx, "failed to unmarshal URL ID array", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -390,7 +470,7 @@ func (h *Handlers) UserUrlsDelete(w http.ResponseWriter, r *http.Request) {
 	// Устанавливаем пометки удаления
 	err = h.shortener.DeleteUserURLs(ctx, uid, &model.ShortURLsDTO{IDs: shortURLs})
 	if err != nil {
-		slog.Info("failed to delete user URLs", "error", err.Error())
+		slog.InfoContext(ctx, "failed to delete user URLs", "error", err.Error())
 		http.Error(w, "please look at logs", http.StatusInternalServerError)
 		return
 	}
@@ -398,6 +478,47 @@ func (h *Handlers) UserUrlsDelete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// bodyTooLarge отвечает статусом Request Entity Too Large, если тело запроса превысило
+// ограничение размера, и сообщает, что обработку запроса нужно прекратить.
+func bodyTooLarge(w http.ResponseWriter, err error) bool {
+	if err == nil || !middleware.IsBodyTooLarge(err) {
+		return false
+	}
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// quotaExceeded отвечает статусом Forbidden с описанием превышенной квоты, если сокращение
+// отклонено из-за квот пользователя, и сообщает, что обработку запроса нужно прекратить.
+func quotaExceeded(w http.ResponseWriter, err error) bool {
+	var quotaErr *model.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(http.StatusForbidden)
+
+	if err = json.NewEncoder(w).Encode(model.QuotaErrorDTO{
+		Error:      model.ErrQuotaExceeded.Error(),
+		QuotaError: *quotaErr,
+	}); err != nil {
+		slog.Info("failed to encode quota error", "error", err.Error())
+	}
+	return true
+}
+
+// writeHealth пишет в ответ результат проверки работоспособности.
+func writeHealth(w http.ResponseWriter, status int, health *model.HealthDTO) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		slog.Info("failed to encode health", "error", err.Error())
+	}
+}
+
 // getUserUid получает идентификатор пользователя из контекста запроса.
 func getUserUID(r *http.Request) (uuid.UUID, error) {
 	// Получаем идентификатор-интерфейс пользователя из контекста
@@ -5,55 +5,175 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/jwtauth/v5"
 
+	"github.com/RomanAgaltsev/urlcut/internal/api/admin"
 	"github.com/RomanAgaltsev/urlcut/internal/api/middleware"
 	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+	"github.com/RomanAgaltsev/urlcut/internal/ratelimit"
 )
 
 // ErrInitServerFailed ошибка инициализации HTTP сервера.
 var ErrInitServerFailed = fmt.Errorf("failed to init HTTP server")
 
 // NewServer создает новый HTTP сервер с установкой обработчиков и роутера.
-func NewServer(shortener interfaces.Service, cfg *config.Config) (*http.Server, error) {
+// Частота запросов ограничивается переданным ограничителем, nil - частота не ограничивается.
+func NewServer(shortener interfaces.Service, cfg *config.Config, limiter *ratelimit.Limiter) (*http.Server, error) {
 	// Если не передали, то ошибка - по умолчанию в конфиге должен быть
 	if cfg.ServerPort == "" {
 		return nil, ErrInitServerFailed
 	}
 
+	// Создаем выпускающего и проверяющего токены пользователей
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitServerFailed, err)
+	}
+
+	// Запросы с куками нельзя разрешать любым источникам
+	cors := corsOptions(cfg)
+	if err = cors.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitServerFailed, err)
+	}
+
 	// Создаем обработчики
 	handlers := NewHandlers(shortener, cfg)
+	accounts := newAccountHandlers(shortener, authenticator)
 
 	// Создаем роутер
 	router := chi.NewRouter()
 	// Включаем миддлаваре
+	router.Use(middleware.WithTracing)
+	router.Use(middleware.WithRequestID)
+	// Восстановление после паники охватывает все следующие миддлваре, а не только хендлеры
+	router.Use(middleware.WithRecovery)
+	router.Use(middleware.WithMetrics)
 	router.Use(middleware.WithLogging)
+	router.Use(middleware.WithSecurityHeaders(securityHeadersOptions(cfg)))
+	router.Use(middleware.WithCORS(cors))
+	router.Use(middleware.WithBodyLimit(int64(cfg.MaxBodySize)))
 	router.Use(middleware.WithGzip)
+	// Тело запроса на сокращение одного URL ограничено сильнее, чем тело батча
+	urlBodyLimit := middleware.WithBodyLimit(int64(cfg.MaxURLBodySize))
+	// Отдельные ограничения частоты запросов на создание, переход и удаление URL
+	createLimit := middleware.WithRateLimit(limiter, ratelimit.ClassCreate, cfg.RateLimitIPHeader)
+	redirectLimit := middleware.WithRateLimit(limiter, ratelimit.ClassRedirect, cfg.RateLimitIPHeader)
+	deleteLimit := middleware.WithRateLimit(limiter, ratelimit.ClassDelete, cfg.RateLimitIPHeader)
 	// Настраиваем роутинг
+	// -- проверки работоспособности без авторизации и куки
+	router.Get("/livez", handlers.Livez)
+	router.Get("/readyz", handlers.Readyz)
+	// -- информация о сборке без авторизации и куки
+	router.Get("/version", handlers.Version)
+	// -- публичные ключи проверки токенов без авторизации и куки
+	router.Get("/.well-known/jwks.json", JWKS(authenticator))
+	// -- вход пользователя без проверки токена - просроченный токен не мешает войти
+	router.With(createLimit, urlBodyLimit).Post("/api/user/login", accounts.Login)
 	// -- идентификатор пользователя не требуется - выдаем при отсутствии
-	tokenAuth := jwtauth.New("HS256", []byte(cfg.SecretKey), nil)
 	router.Group(func(r chi.Router) {
 		// Миддлваре, проверяющая и выдающая токен
-		r.Use(middleware.WithAuth(tokenAuth))
+		r.Use(middleware.WithAuth(authenticator))
 
-		r.Post("/", handlers.Shorten)
-		r.Post("/api/shorten", handlers.ShortenAPI)
-		r.Post("/api/shorten/batch", handlers.ShortenAPIBatch)
-		r.Get("/{id}", handlers.Expand)
-		r.Get("/ping", handlers.Ping)
+		r.With(createLimit, urlBodyLimit).Post("/", handlers.Shorten)
+		r.With(createLimit, urlBodyLimit).Post("/api/shorten", handlers.ShortenAPI)
+		r.With(createLimit).Post("/api/shorten/batch", handlers.ShortenAPIBatch)
+		r.With(redirectLimit).Get("/{id}", handlers.Expand)
 		r.Get("/api/user/urls", handlers.UserUrls)
+		// URL анонимного пользователя переходят к нему при регистрации
+		r.With(createLimit, urlBodyLimit).Post("/api/user/register", accounts.Register)
 	})
+	// -- служебные обработчики, если для них не задан отдельный адрес
+	if cfg.AdminAddress == "" {
+		admin.Mount(router, cfg, shortener)
+	}
 	// -- идентификатор требуется
 	router.Group(func(r chi.Router) {
 		// Миддвале, проверяющая наличие идентификтара
-		r.Use(middleware.WithID(tokenAuth))
+		r.Use(middleware.WithID(authenticator))
 
-		r.Delete("/api/user/urls", handlers.UserUrlsDelete)
+		r.With(deleteLimit).Delete("/api/user/urls", handlers.UserUrlsDelete)
 	})
 
-	return &http.Server{
-		Addr:    cfg.ServerPort,
-		Handler: router,
-	}, nil
+	server := &http.Server{
+		Addr:              cfg.ServerPort,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout.Duration,
+		ReadTimeout:       cfg.ServerReadTimeout.Duration,
+		WriteTimeout:      cfg.ServerWriteTimeout.Duration,
+		IdleTimeout:       cfg.ServerIdleTimeout.Duration,
+	}
+	// При выключении сервера сервис перестает быть готовым
+	server.RegisterOnShutdown(handlers.Drain)
+
+	return server, nil
+}
+
+// newAuthenticator создает выпускающего и проверяющего токены пользователей с параметрами из конфигурации.
+func newAuthenticator(cfg *config.Config) (*auth.Authenticator, error) {
+	sameSite, err := auth.ParseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewAuthenticator(auth.Options{
+		SecretKey:          cfg.SecretKey,
+		PreviousSecretKeys: cfg.JWTPreviousKeys,
+		SigningKeyFile:     cfg.JWTSigningKeyFile,
+		PreviousKeyFiles:   cfg.JWTPreviousKeyFiles,
+		TTL:                cfg.JWTTTL.Duration,
+		RefreshInterval:    cfg.JWTRefreshInterval.Duration,
+		Cookie: auth.CookieOptions{
+			Secure:   cfg.CookieSecure,
+			HTTPOnly: cfg.CookieHTTPOnly,
+			SameSite: sameSite,
+		},
+	})
+}
+
+// corsExposedHeaders - заголовки ответов сервиса, которые нужны скрипту на странице другого источника:
+// токен пользователя, идентификатор запроса и состояние ограничения частоты запросов.
+var corsExposedHeaders = []string{
+	"Authorization",
+	"X-Request-ID",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"Retry-After",
+}
+
+// corsOptions возвращает параметры CORS из конфигурации.
+// В запросах с куками токен передается в куке, поэтому заголовок с токеном скрипту не отдается.
+func corsOptions(cfg *config.Config) middleware.CORSOptions {
+	exposed := corsExposedHeaders
+	if cfg.CORSAllowCredentials {
+		exposed = make([]string, 0, len(corsExposedHeaders))
+		for _, header := range corsExposedHeaders {
+			if header != "Authorization" {
+				exposed = append(exposed, header)
+			}
+		}
+	}
+
+	return middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   exposed,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge.Duration,
+	}
+}
+
+// securityHeadersOptions возвращает параметры заголовков безопасности из конфигурации.
+// Strict-Transport-Security отправляется, только если сервер работает по HTTPS.
+func securityHeadersOptions(cfg *config.Config) middleware.SecurityHeadersOptions {
+	opts := middleware.SecurityHeadersOptions{
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+	}
+	if cfg.EnableHTTPS {
+		opts.HSTSMaxAge = cfg.HSTSMaxAge.Duration
+	}
+	return opts
 }
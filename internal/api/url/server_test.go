@@ -1,12 +1,42 @@
 package url
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"github.com/RomanAgaltsev/urlcut/internal/api/middleware"
+	"github.com/RomanAgaltsev/urlcut/internal/buildinfo"
 	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/logger"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/requestid"
+	"github.com/RomanAgaltsev/urlcut/internal/ratelimit"
 )
 
 func TestServer(t *testing.T) {
@@ -14,10 +44,495 @@ func TestServer(t *testing.T) {
 
 	cfg := &config.Config{}
 
-	_, err := NewServer(hlp.shortener, cfg)
+	_, err := NewServer(hlp.shortener, cfg, nil)
 	assert.Equal(t, ErrInitServerFailed, err)
 
-	server, err := NewServer(hlp.shortener, hlp.cfg)
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
 	require.NoError(t, err)
 	assert.Equal(t, hlp.cfg.ServerPort, server.Addr)
 }
+
+func TestServerMetrics(t *testing.T) {
+	hlp := newHelper(t)
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Запросы учитываются по шаблону маршрута, а не по пути
+	notFound := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "404"))
+	for _, id := range []string{"qwerty12", "asdfgh34"} {
+		resp, err := ts.Client().Get(ts.URL + "/" + id)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	assert.Equal(t, notFound+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "404")))
+
+	// Без отдельного служебного адреса метрики отдаются основным сервером
+	resp, err := ts.Client().Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `urlcut_http_requests_total{method="GET",route="/{id}",status="404"}`)
+}
+
+func TestServerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	hlp := newHelper(t)
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Запрос продолжает трассу вызывающего сервиса
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/", strings.NewReader("https://example.com/traced"))
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+		spans[span.Name()] = span
+	}
+
+	require.Contains(t, spans, "POST /")
+	require.Contains(t, spans, "Shortener.Shorten")
+	require.Contains(t, spans, "repository.Store")
+
+	// Спаны вложены друг в друга: запрос, сервис, хранилище
+	assert.Equal(t, spans["POST /"].SpanContext().SpanID(), spans["Shortener.Shorten"].Parent().SpanID())
+	assert.Equal(t, spans["Shortener.Shorten"].SpanContext().SpanID(), spans["repository.Store"].Parent().SpanID())
+}
+
+func TestServerRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	prevLogger := slog.Default()
+	slog.SetDefault(slog.New(logger.NewContextHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	hlp := newHelper(t)
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Идентификатор запроса создается, если клиент его не передал
+	resp, err := ts.Client().Get(ts.URL + "/qwerty12")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.True(t, requestid.Valid(resp.Header.Get(requestid.Header)))
+
+	// Идентификатор клиента возвращается в ответе и попадает во все записи лога запроса
+	buf.Reset()
+	const reqID = "req-42"
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/asdfgh34", nil)
+	require.NoError(t, err)
+	req.Header.Set(requestid.Header, reqID)
+
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, reqID, resp.Header.Get(requestid.Header))
+
+	records := make(map[string]map[string]any)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var record map[string]any
+		require.NoError(t, dec.Decode(&record))
+		records[record["msg"].(string)] = record
+	}
+
+	require.Contains(t, records, "failed to expand URL")
+	require.Contains(t, records, "got request")
+	assert.Equal(t, reqID, records["failed to expand URL"][logger.RequestIDKey])
+	assert.NotEmpty(t, records["failed to expand URL"][logger.UserIDKey])
+	assert.Equal(t, reqID, records["got request"][logger.RequestIDKey])
+}
+
+func TestServerVersion(t *testing.T) {
+	buildinfo.Set("v1.2.3", "2024-01-01", "abcdef0")
+	t.Cleanup(func() { buildinfo.Set("", "", "") })
+
+	hlp := newHelper(t)
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/version")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Cookies())
+
+	var info buildinfo.Info
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "2024-01-01", info.Date)
+	assert.Equal(t, "abcdef0", info.Commit)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, "file", info.Storage)
+}
+
+func TestServerJWKS(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	hlp := newHelper(t)
+	hlp.cfg.JWTSigningKeyFile = keyFile
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "/.well-known/jwks.json")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ContentTypeJWKS, resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Cookies())
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	set, err := jwk.Parse(body)
+	require.NoError(t, err)
+	require.Equal(t, 1, set.Len())
+
+	// Выданный сервером токен проверяется по опубликованным ключам
+	resp, err = ts.Client().Get(ts.URL + "/api/user/urls")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	_, err = jwt.ParseString(resp.Header.Get("Authorization"), jwt.WithKeySet(set))
+	assert.NoError(t, err)
+
+	// Неверный файл ключа не позволяет создать сервер
+	hlp.cfg.JWTSigningKeyFile = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = NewServer(hlp.shortener, hlp.cfg, nil)
+	assert.ErrorIs(t, err, ErrInitServerFailed)
+}
+
+func TestServerLimits(t *testing.T) {
+	hlp := newHelper(t)
+	hlp.cfg.ServerReadHeaderTimeout = config.Duration{Duration: 5 * time.Second}
+	hlp.cfg.ServerWriteTimeout = config.Duration{Duration: 30 * time.Second}
+	hlp.cfg.MaxBodySize = 1024
+	hlp.cfg.MaxURLBodySize = 64
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, server.ReadHeaderTimeout)
+	assert.Equal(t, 30*time.Second, server.WriteTimeout)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	post := func(path, encoding string, body []byte) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	longURL := []byte("https://practicum.yandex.ru/" + strings.Repeat("a", 100))
+	batch := []byte(`[` + strings.Repeat(`{"correlation_id":"1","original_url":"https://practicum.yandex.ru/"},`, 20) + `{}]`)
+	bomb := bytes.Repeat([]byte("a"), 256<<10)
+
+	assert.Equal(t, http.StatusCreated, post("/", "", []byte("https://practicum.yandex.ru/")))
+	// Ограничение отдельного маршрута строже общего
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/", "", longURL))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/", "gzip", gzipped(longURL)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/api/shorten", "", []byte(`{"url":"`+string(longURL)+`"}`)))
+	// Общее ограничение действует на все маршруты
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/api/shorten/batch", "", batch))
+	// Небольшое сжатое тело, распаковывающееся в огромное, отклоняется
+	compressedBomb := gzipped(bomb)
+	require.Less(t, len(compressedBomb), hlp.cfg.MaxBodySize)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("/api/shorten/batch", "gzip", compressedBomb))
+}
+
+func TestServerRateLimit(t *testing.T) {
+	hlp := newHelper(t)
+	hlp.cfg.RateLimitIPHeader = "X-Real-IP"
+	hlp.cfg.RateLimitCreateRate = 0.01
+	hlp.cfg.RateLimitCreateBurst = 2
+	hlp.cfg.RateLimitRedirectRate = 0.01
+	hlp.cfg.RateLimitRedirectBurst = 5
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), hlp.cfg)
+	server, err := NewServer(hlp.shortener, hlp.cfg, limiter)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	do := func(method, path, ip string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader("https://practicum.yandex.ru/"))
+		require.NoError(t, err)
+		req.Header.Set("X-Real-IP", ip)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	// Новые пользователи с одного IP делят корзину этого IP
+	resp := do(http.MethodPost, "/", "10.0.0.1")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "100", resp.Header.Get("RateLimit-Reset"))
+
+	resp = do(http.MethodPost, "/api/shorten/batch", "10.0.0.1")
+	assert.NotEqual(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+
+	limited := testutil.ToFloat64(metrics.HTTPRateLimited.WithLabelValues(ratelimit.ClassCreate))
+	resp = do(http.MethodPost, "/", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "100", resp.Header.Get("Retry-After"))
+	assert.Equal(t, limited+1, testutil.ToFloat64(metrics.HTTPRateLimited.WithLabelValues(ratelimit.ClassCreate)))
+
+	// У другого IP своя корзина, у переходов по ссылкам - свой запас
+	assert.NotEqual(t, http.StatusTooManyRequests, do(http.MethodPost, "/", "10.0.0.2").StatusCode)
+	resp = do(http.MethodGet, "/qwerty12", "10.0.0.1")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "4", resp.Header.Get("RateLimit-Remaining"))
+
+	// Удаление не ограничено - его параметры не заданы
+	resp = do(http.MethodDelete, "/api/user/urls", "10.0.0.1")
+	assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+}
+
+func TestServerRateLimitSpoofing(t *testing.T) {
+	hlp := newHelper(t)
+	hlp.cfg.RateLimitIPHeader = "X-Forwarded-For"
+	hlp.cfg.RateLimitCreateRate = 0.01
+	hlp.cfg.RateLimitCreateBurst = 2
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), hlp.cfg)
+	server, err := NewServer(hlp.shortener, hlp.cfg, limiter)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	// Клиент подставляет в заголовок свои адреса, доверенный прокси дописывает настоящий адрес клиента
+	do := func(forwarded ...string) int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/", strings.NewReader("https://practicum.yandex.ru/"))
+		require.NoError(t, err)
+		for _, value := range forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.NotEqual(t, http.StatusTooManyRequests, do("1.1.1.1, 10.0.0.1"))
+	assert.NotEqual(t, http.StatusTooManyRequests, do("2.2.2.2, 10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, do("3.3.3.3, 10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, do("4.4.4.4", "10.0.0.1"))
+
+	// У другого клиента своя корзина
+	assert.NotEqual(t, http.StatusTooManyRequests, do("3.3.3.3, 10.0.0.2"))
+}
+
+func TestServerCORS(t *testing.T) {
+	hlp := newHelper(t)
+	hlp.cfg.CORSAllowedOrigins = []string{"https://app.example.com", "https://*.example.org"}
+	hlp.cfg.CORSAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+	hlp.cfg.CORSAllowedHeaders = []string{"Content-Type", "Authorization"}
+	hlp.cfg.CORSAllowCredentials = true
+	hlp.cfg.CORSMaxAge = config.Duration{Duration: 10 * time.Minute}
+
+	server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(server.Handler)
+	defer ts.Close()
+
+	do := func(method, path string, header http.Header) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader("https://practicum.yandex.ru/cors"))
+		require.NoError(t, err)
+		req.Header = header
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		resp := do(http.MethodOptions, "/api/user/urls", http.Header{
+			"Origin":                         {"https://app.example.com"},
+			"Access-Control-Request-Method":  {http.MethodDelete},
+			"Access-Control-Request-Headers": {"content-type, authorization"},
+		})
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "GET, POST, DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, Authorization", resp.Header.Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+		assert.Contains(t, resp.Header.Values("Vary"), "Origin")
+		// Предварительный запрос не получает куку пользователя
+		assert.Empty(t, resp.Cookies())
+	})
+
+	t.Run("preflight rejected", func(t *testing.T) {
+		for name, header := range map[string]http.Header{
+			"origin": {"Origin": {"https://evil.example.com"}, "Access-Control-Request-Method": {http.MethodPost}},
+			"method": {"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {http.MethodPut}},
+			"header": {"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {http.MethodPost},
+				"Access-Control-Request-Headers": {"X-Custom"}},
+		} {
+			resp := do(http.MethodOptions, "/", header)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, name)
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"), name)
+		}
+	})
+
+	t.Run("request", func(t *testing.T) {
+		resp := do(http.MethodPost, "/", http.Header{"Origin": {"https://shop.example.org"}})
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "https://shop.example.org", resp.Header.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+		// С куками токен не нужен скрипту, поэтому заголовок с ним не отдается
+		assert.Contains(t, resp.Header.Get("Access-Control-Expose-Headers"), "X-Request-ID")
+		assert.NotContains(t, resp.Header.Get("Access-Control-Expose-Headers"), "Authorization")
+	})
+
+	t.Run("request from other origin", func(t *testing.T) {
+		for _, origin := range []string{"https://evil.com", "https://example.org", "http://shop.example.org"} {
+			resp := do(http.MethodGet, "/livez", http.Header{"Origin": {origin}})
+			assert.Equal(t, http.StatusOK, resp.StatusCode, origin)
+			assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"), origin)
+		}
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		hlp.cfg.CORSAllowedOrigins = []string{"*"}
+		hlp.cfg.CORSAllowCredentials = false
+
+		server, err := NewServer(hlp.shortener, hlp.cfg, nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+		req.Header.Set("Origin", "https://any.example.net")
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "Authorization")
+	})
+
+	t.Run("wildcard with credentials", func(t *testing.T) {
+		hlp.cfg.CORSAllowCredentials = true
+
+		for _, origin := range []string{"*", "https://*", "https://*.com", "*.example.com", "https://*.*.example.com"} {
+			hlp.cfg.CORSAllowedOrigins = []string{"https://app.example.com", origin}
+			_, err := NewServer(hlp.shortener, hlp.cfg, nil)
+			assert.ErrorIs(t, err, middleware.ErrCORSWildcardCredentials, origin)
+		}
+	})
+}
+
+func TestServerSecurityHeaders(t *testing.T) {
+	hlp := newHelper(t)
+	hlp.cfg.ReferrerPolicy = "no-referrer"
+	hlp.cfg.ContentSecurityPolicy = "default-src 'none'"
+	hlp.cfg.HSTSMaxAge = config.Duration{Duration: 24 * time.Hour}
+
+	get := func(cfg *config.Config) http.Header {
+		server, err := NewServer(hlp.shortener, cfg, nil)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+		return rec.Header()
+	}
+
+	header := get(hlp.cfg)
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "no-referrer", header.Get("Referrer-Policy"))
+	// HSTS только при включенном HTTPS, CSP только для HTML
+	assert.Empty(t, header.Get("Strict-Transport-Security"))
+	assert.Empty(t, header.Get("Content-Security-Policy"))
+
+	hlp.cfg.EnableHTTPS = true
+	header = get(hlp.cfg)
+	assert.Equal(t, "max-age=86400; includeSubDomains", header.Get("Strict-Transport-Security"))
+
+	// Политика безопасности содержимого добавляется в ответы HTML, в том числе сжатые
+	router := chi.NewRouter()
+	router.Use(middleware.WithSecurityHeaders(middleware.SecurityHeadersOptions{ContentSecurityPolicy: "default-src 'none'"}))
+	router.Use(middleware.WithGzip)
+	router.Get("/html", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<!DOCTYPE html><html><body>" + strings.Repeat("a", 2048) + "</body></html>"))
+	})
+	router.Get("/text", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("plain text"))
+	})
+
+	for _, encoding := range []string{"", "gzip"} {
+		req := httptest.NewRequest(http.MethodGet, "/html", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, "default-src 'none'", rec.Header().Get("Content-Security-Policy"), encoding)
+		assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"), encoding)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/text", nil))
+	assert.Empty(t, rec.Header().Get("Content-Security-Policy"))
+}
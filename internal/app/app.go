@@ -3,6 +3,7 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/RomanAgaltsev/urlcut/internal/pkg/cert"
 	"log/slog"
@@ -11,19 +12,29 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/RomanAgaltsev/urlcut/internal/api/admin"
 	"github.com/RomanAgaltsev/urlcut/internal/api/url"
+	"github.com/RomanAgaltsev/urlcut/internal/buildinfo"
 	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
 	"github.com/RomanAgaltsev/urlcut/internal/logger"
+	"github.com/RomanAgaltsev/urlcut/internal/profiler"
+	"github.com/RomanAgaltsev/urlcut/internal/ratelimit"
 	"github.com/RomanAgaltsev/urlcut/internal/repository"
 	"github.com/RomanAgaltsev/urlcut/internal/services"
+	"github.com/RomanAgaltsev/urlcut/internal/tracing"
 )
 
 // App является структурой всего приложения.
 type App struct {
-	cfg       *config.Config     // конфигурация приложения
-	server    *http.Server       // http-сервер
-	shortener interfaces.Service // сервис сокращателя ссылок
+	cfg       *config.Config      // конфигурация приложения
+	server    *http.Server        // http-сервер
+	admin     *http.Server        // служебный http-сервер, nil - служебные обработчики на основном сервере
+	shortener interfaces.Service  // сервис сокращателя ссылок
+	limiter   *ratelimit.Limiter  // ограничитель частоты запросов
+	profiler  *profiler.Scheduler // снятие профилей по расписанию, nil - профили не снимаются
+
+	shutdownTracing func(context.Context) error // выгрузка оставшихся спанов и остановка трассировки
 }
 
 // New создает новое приложение.
@@ -31,6 +42,7 @@ type App struct {
 // - конфигурация
 // - логер
 // - сервис сокращателя ссылок
+// - ограничение частоты запросов
 // - http-сервер
 func New() (*App, error) {
 	app := &App{}
@@ -41,24 +53,47 @@ func New() (*App, error) {
 		return nil, err
 	}
 
+	// С флагом -version приложение только выводит информацию о сборке
+	if app.cfg.ShowVersion {
+		return app, nil
+	}
+
 	// Инициализация логера
 	err = app.initLogger()
 	if err != nil {
 		return nil, err
 	}
 
+	// Инициализация трассировки
+	err = app.initTracing()
+	if err != nil {
+		return nil, err
+	}
+
 	// Инициализация сервиса сокращателя ссылок
 	err = app.initShortener()
 	if err != nil {
 		return nil, err
 	}
 
+	// Инициализация ограничения частоты запросов
+	err = app.initRateLimiter()
+	if err != nil {
+		return nil, err
+	}
+
 	// Инициализация HTTP сервера
 	err = app.initHTTPServer()
 	if err != nil {
 		return nil, err
 	}
 
+	// Инициализация снятия профилей
+	err = app.initProfiler()
+	if err != nil {
+		return nil, err
+	}
+
 	return app, nil
 }
 
@@ -75,7 +110,7 @@ func (a *App) initConfig() error {
 
 // initLogger инициализирует логер.
 func (a *App) initLogger() error {
-	err := logger.Initialize()
+	err := logger.Initialize(a.cfg)
 	if err != nil {
 		return err
 	}
@@ -83,6 +118,17 @@ func (a *App) initLogger() error {
 	return nil
 }
 
+// initTracing инициализирует трассировку OpenTelemetry.
+func (a *App) initTracing() error {
+	shutdown, err := tracing.Init(context.Background(), a.cfg)
+	if err != nil {
+		return err
+	}
+	a.shutdownTracing = shutdown
+
+	return nil
+}
+
 // initShortener инициализирует сервис сокращателя ссылок, включая хранилище.
 func (a *App) initShortener() error {
 	repo, err := repository.New(a.cfg)
@@ -100,22 +146,69 @@ func (a *App) initShortener() error {
 	return nil
 }
 
+// initRateLimiter инициализирует ограничение частоты запросов с хранилищем корзин из конфигурации.
+func (a *App) initRateLimiter() error {
+	store, err := ratelimit.NewStore(context.Background(), a.cfg)
+	if err != nil {
+		return err
+	}
+	a.limiter = ratelimit.NewLimiter(store, a.cfg)
+
+	return nil
+}
+
 // initHTTPServer инициализирует HTTP сервер.
 func (a *App) initHTTPServer() error {
-	server, err := url.NewServer(a.shortener, a.cfg)
+	server, err := url.NewServer(a.shortener, a.cfg, a.limiter)
 	if err != nil {
 		return err
 	}
 	a.server = server
 
+	// Служебный сервер нужен, только если для него задан отдельный адрес
+	if a.cfg.AdminAddress != "" {
+		a.admin, err = admin.NewServer(a.cfg, a.shortener)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// initProfiler инициализирует снятие профилей по расписанию, если задан каталог профилей.
+func (a *App) initProfiler() error {
+	if a.cfg.ProfileDir == "" {
+		return nil
+	}
+
+	scheduler, err := profiler.NewScheduler(a.cfg)
+	if err != nil {
+		return err
+	}
+	a.profiler = scheduler
+
 	return nil
 }
 
 // Run вызывает запуск приложения.
 func (a *App) Run() error {
+	if a.cfg.ShowVersion {
+		return a.printVersion()
+	}
 	return a.runShortenerApp()
 }
 
+// printVersion выводит в stdout информацию о сборке в формате JSON.
+func (a *App) printVersion() error {
+	info := buildinfo.Get()
+	info.Storage = repository.BackendName(a.cfg)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
+
 // runShortenerApp запускает приложение.
 func (a *App) runShortenerApp() error {
 	// Создаем каналы для Graceful Shutdown
@@ -138,14 +231,63 @@ func (a *App) runShortenerApp() error {
 			slog.Error("HTTP server shutdown error", slog.String("error", err.Error()))
 		}
 
+		// Выключаем служебный HTTP сервер
+		if a.admin != nil {
+			if err := a.admin.Shutdown(ctx); err != nil {
+				slog.Error("admin HTTP server shutdown error", slog.String("error", err.Error()))
+			}
+		}
+
+		// Останавливаем снятие профилей
+		if a.profiler != nil {
+			_ = a.profiler.Close()
+		}
+
+		// Закрываем хранилище корзин ограничения частоты запросов
+		if a.limiter != nil {
+			if err := a.limiter.Close(); err != nil {
+				slog.Error("failed to close rate limit store", slog.String("error", err.Error()))
+			}
+		}
+
 		// Выключаем сервис сокращателя, включая закрытие хранилища
 		if err := a.shortener.Close(); err != nil {
 			slog.Error("failed to close shortener service", slog.String("error", err.Error()))
 		}
 
+		// Выгружаем оставшиеся спаны
+		if err := a.shutdownTracing(ctx); err != nil {
+			slog.Error("failed to shut down tracing", slog.String("error", err.Error()))
+		}
+
 		close(done)
 	}()
 
+	// Запускаем снятие профилей
+	if a.profiler != nil {
+		slog.Info("starting profiler", "dir", a.cfg.ProfileDir, "interval", a.cfg.ProfileInterval.String())
+		a.profiler.Start()
+	}
+
+	// Запускаем служебный HTTP сервер
+	if a.admin != nil {
+		go func() {
+			slog.Info("starting admin HTTP server", "addr", a.admin.Addr)
+			if err := a.admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin HTTP server error", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	info := buildinfo.Get()
+	slog.Info("build info",
+		slog.String("version", info.Version),
+		slog.String("date", info.Date),
+		slog.String("commit", info.Commit),
+		slog.String("go_version", info.GoVersion),
+		slog.String("vcs_revision", info.VCSRevision),
+	)
+
 	slog.Info("starting HTTP server", "addr", a.server.Addr)
 
 	// Запускаем HTTP сервер
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -9,6 +10,9 @@ import (
 )
 
 func TestApp(t *testing.T) {
+	// Файловое хранилище во временном каталоге, а не в каталоге пакета
+	t.Setenv("FILE_STORAGE_PATH", filepath.Join(t.TempDir(), "storage.json"))
+
 	application, err := New()
 	require.NoError(t, err)
 
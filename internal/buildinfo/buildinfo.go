@@ -0,0 +1,85 @@
+// Пакет buildinfo хранит информацию о сборке приложения.
+//
+// Версия, дата и коммит сборки задаются при компоновке флагами -ldflags в пакете main и передаются в Set.
+// Версия Go и данные системы контроля версий берутся из информации, встроенной в бинарный файл.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// NotAvailable - значение, если данные о сборке не заданы.
+const NotAvailable = "N/A"
+
+// Данные сборки, переданные из пакета main.
+var (
+	mu      sync.RWMutex
+	version = NotAvailable
+	date    = NotAvailable
+	commit  = NotAvailable
+)
+
+// Info - информация о сборке приложения.
+type Info struct {
+	Version     string `json:"version"`                // Версия сборки
+	Date        string `json:"date"`                   // Дата сборки
+	Commit      string `json:"commit"`                 // Коммит сборки
+	GoVersion   string `json:"go_version"`             // Версия Go, которой собрано приложение
+	VCS         string `json:"vcs,omitempty"`          // Система контроля версий, например git
+	VCSRevision string `json:"vcs_revision,omitempty"` // Ревизия исходного кода
+	VCSTime     string `json:"vcs_time,omitempty"`     // Время ревизии исходного кода
+	VCSModified bool   `json:"vcs_modified,omitempty"` // Исходный код изменен относительно ревизии
+	Storage     string `json:"storage,omitempty"`      // Активное хранилище - схема строки соединения
+}
+
+// Set сохраняет версию, дату и коммит сборки. Пустые значения заменяются на NotAvailable.
+func Set(buildVersion, buildDate, buildCommit string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	version = orNotAvailable(buildVersion)
+	date = orNotAvailable(buildDate)
+	commit = orNotAvailable(buildCommit)
+}
+
+// Get возвращает информацию о сборке. Хранилище не заполняется - его знает только вызывающий код.
+func Get() Info {
+	mu.RLock()
+	info := Info{
+		Version:   version,
+		Date:      date,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+	mu.RUnlock()
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs":
+			info.VCS = setting.Value
+		case "vcs.revision":
+			info.VCSRevision = setting.Value
+		case "vcs.time":
+			info.VCSTime = setting.Value
+		case "vcs.modified":
+			info.VCSModified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
+
+// orNotAvailable возвращает NotAvailable вместо пустой строки.
+func orNotAvailable(s string) string {
+	if s == "" {
+		return NotAvailable
+	}
+	return s
+}
@@ -0,0 +1,25 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	t.Cleanup(func() { Set("", "", "") })
+
+	info := Get()
+	assert.Equal(t, NotAvailable, info.Version)
+	assert.Equal(t, NotAvailable, info.Date)
+	assert.Equal(t, NotAvailable, info.Commit)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+
+	Set("v1.2.3", "2024-01-01", "")
+
+	info = Get()
+	assert.Equal(t, "v1.2.3", info.Version)
+	assert.Equal(t, "2024-01-01", info.Date)
+	assert.Equal(t, NotAvailable, info.Commit)
+}
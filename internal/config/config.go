@@ -8,6 +8,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // ErrInitConfigFailed - ошибка инициации конфигурации.
@@ -22,8 +24,148 @@ type Config struct {
 	SecretKey       string `json:"secret_key"`        // Секретный ключ авторизации
 	EnableHTTPS     bool   `json:"enable_https"`      // Регулирует включение HTTPS на сервере
 	IDlength        int    `json:"id_length"`         // Длина идентификатора в сокращенном URL
+	RedisDSN        string `json:"redis_dsn"`         // Строка соединения с Redis
+	RedisMode       string `json:"redis_mode"`        // Режим использования Redis - кэш или хранилище
+	AdminAddress    string `json:"admin_address"`     // Адрес служебного HTTP сервера с метриками, пусто - метрики на основном сервере
+	AdminToken      string `json:"admin_token"`       // Токен доступа к защищенным служебным обработчикам, пусто - обработчики выключены
+
+	DatabaseReplicaDSNs []string `json:"database_replica_dsns"` // Строки соединения с репликами БД для чтения
+
+	FileSyncPolicy      string   `json:"file_sync_policy"`      // Политика fsync файлового хранилища
+	FileSyncInterval    Duration `json:"file_sync_interval"`    // Интервал fsync файлового хранилища
+	FileCompactInterval Duration `json:"file_compact_interval"` // Интервал уплотнения файлового хранилища
+	FileRepair          bool     `json:"file_repair"`           // Регулирует восстановление поврежденного файлового хранилища
+	FileReadOnly        bool     `json:"-"`                     // Открывать файловое хранилище только для чтения, задается утилитами экспорта
+
+	BloomFilter         bool `json:"bloom_filter"`          // Регулирует фильтр Блума перед хранилищем для отсеивания несуществующих URL
+	BloomFilterCapacity int  `json:"bloom_filter_capacity"` // Расчетное количество URL в фильтре Блума
+
+	TracingExporter    string  `json:"tracing_exporter"`     // Экспортер спанов: stdout, otlp или пусто - трассировка выключена
+	TracingEndpoint    string  `json:"tracing_endpoint"`     // Адрес коллектора OTLP/HTTP, например http://localhost:4318
+	TracingSampleRatio float64 `json:"tracing_sample_ratio"` // Доля записываемых трасс от 0 до 1
+
+	LogLevel              string   `json:"log_level"`               // Уровень логирования: debug, info, warn или error
+	LogFormat             string   `json:"log_format"`              // Формат записей лога: console или json
+	LogFile               string   `json:"log_file"`                // Путь к файлу лога, пусто - лог в stdout
+	LogMaxSize            int      `json:"log_max_size"`            // Размер файла лога в мегабайтах, после которого файл ротируется
+	LogMaxAge             Duration `json:"log_max_age"`             // Срок хранения ротированных файлов лога, 0 - хранятся всегда
+	LogSamplingInitial    int      `json:"log_sampling_initial"`    // Количество одинаковых записей лога в секунду, записываемых до сэмплирования, 0 - без сэмплирования
+	LogSamplingThereafter int      `json:"log_sampling_thereafter"` // После начала сэмплирования записывается каждая N-я одинаковая запись лога
+
+	ProfileDir         string   `json:"profile_dir"`          // Каталог профилей CPU и памяти, снимаемых по расписанию, пусто - профили не снимаются
+	ProfileInterval    Duration `json:"profile_interval"`     // Интервал снятия профилей
+	ProfileCPUDuration Duration `json:"profile_cpu_duration"` // Длительность снятия профиля CPU
+	ProfileRetention   int      `json:"profile_retention"`    // Количество хранимых профилей каждого вида, более старые удаляются
+
+	ServerReadHeaderTimeout Duration `json:"server_read_header_timeout"` // Таймаут чтения заголовков запроса
+	ServerReadTimeout       Duration `json:"server_read_timeout"`        // Таймаут чтения запроса целиком, вместе с телом
+	ServerWriteTimeout      Duration `json:"server_write_timeout"`       // Таймаут записи ответа
+	ServerIdleTimeout       Duration `json:"server_idle_timeout"`        // Таймаут простаивающего соединения keep-alive
+	MaxBodySize             int      `json:"max_body_size"`              // Размер тела запроса в байтах, в том числе распакованного, сверх которого запрос отклоняется
+	MaxURLBodySize          int      `json:"max_url_body_size"`          // Размер тела запроса на сокращение одного URL в байтах
+
+	RateLimitStore         string  `json:"rate_limit_store"`          // Хранилище корзин ограничения частоты запросов: memory или redis
+	RateLimitIPHeader      string  `json:"rate_limit_ip_header"`      // Заголовок с IP клиента от доверенного прокси, пусто - IP из адреса соединения
+	RateLimitCreateRate    float64 `json:"rate_limit_create_rate"`    // Запросов на сокращение URL в секунду, 0 - без ограничения
+	RateLimitCreateBurst   int     `json:"rate_limit_create_burst"`   // Запросов на сокращение URL подряд
+	RateLimitRedirectRate  float64 `json:"rate_limit_redirect_rate"`  // Переходов по сокращенным URL в секунду, 0 - без ограничения
+	RateLimitRedirectBurst int     `json:"rate_limit_redirect_burst"` // Переходов по сокращенным URL подряд
+	RateLimitDeleteRate    float64 `json:"rate_limit_delete_rate"`    // Запросов на удаление URL в секунду, 0 - без ограничения
+	RateLimitDeleteBurst   int     `json:"rate_limit_delete_burst"`   // Запросов на удаление URL подряд
+
+	QuotaMaxLinks     int `json:"quota_max_links"`      // Максимальное количество неудаленных URL пользователя, 0 - без ограничения
+	QuotaMaxBatchSize int `json:"quota_max_batch_size"` // Максимальное количество URL в батче, 0 - без ограничения
+	QuotaMaxURLLength int `json:"quota_max_url_length"` // Максимальная длина оригинального URL в байтах, 0 - без ограничения
+
+	CORSAllowedOrigins    []string `json:"cors_allowed_origins"`    // Источники, которым разрешены кросс-доменные запросы
+	CORSAllowedMethods    []string `json:"cors_allowed_methods"`    // Методы, разрешенные в кросс-доменных запросах
+	CORSAllowedHeaders    []string `json:"cors_allowed_headers"`    // Заголовки, разрешенные в кросс-доменных запросах
+	CORSAllowCredentials  bool     `json:"cors_allow_credentials"`  // Разрешить кросс-доменные запросы с куками
+	CORSMaxAge            Duration `json:"cors_max_age"`            // Время кэширования ответа на предварительный запрос
+	HSTSMaxAge            Duration `json:"hsts_max_age"`            // Срок Strict-Transport-Security при включенном HTTPS, 0 - без заголовка
+	ReferrerPolicy        string   `json:"referrer_policy"`         // Значение заголовка Referrer-Policy
+	ContentSecurityPolicy string   `json:"content_security_policy"` // Значение заголовка Content-Security-Policy для ответов HTML
+
+	JWTTTL             Duration `json:"jwt_ttl"`              // Срок действия JWT
+	JWTRefreshInterval Duration `json:"jwt_refresh_interval"` // Возраст JWT, после которого он перевыпускается с новым сроком действия
+	JWTPreviousKeys    []string `json:"jwt_previous_keys"`    // Прежние секретные ключи, JWT которых еще принимаются
+	CookieSecure       bool     `json:"cookie_secure"`        // Передавать куку с JWT только по HTTPS
+	CookieHTTPOnly     bool     `json:"cookie_http_only"`     // Скрывать куку с JWT от скриптов на странице
+	CookieSameSite     string   `json:"cookie_same_site"`     // Режим SameSite куки с JWT: lax, strict или none
+
+	JWTSigningKeyFile   string   `json:"jwt_signing_key_file"`   // Файл PEM с приватным ключом RSA или Ed25519, которым JWT подписываются вместо секретного ключа
+	JWTPreviousKeyFiles []string `json:"jwt_previous_key_files"` // Файлы PEM с прежними ключами RSA или Ed25519, JWT которых еще принимаются
+
+	PasswordHashAlgorithm string `json:"password_hash_algorithm"` // Алгоритм хэширования паролей зарегистрированных пользователей: argon2id или bcrypt
+
+	ShowVersion bool `json:"-"` // Вывести информацию о сборке и завершить работу
+}
+
+// Duration - длительность, которая в JSON задается строкой вида "1m30s".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON разбирает длительность из строки JSON.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+
+	return nil
+}
+
+// MarshalJSON записывает длительность в JSON строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
 }
 
+// Режимы использования Redis.
+const (
+	// RedisModeCache - Redis используется как общий кэш перед основным хранилищем.
+	RedisModeCache = "cache"
+
+	// RedisModeStorage - Redis используется как самостоятельное хранилище.
+	RedisModeStorage = "storage"
+)
+
+// Политики fsync файлового хранилища.
+const (
+	// FileSyncAlways - fsync после каждой записи.
+	FileSyncAlways = "always"
+
+	// FileSyncInterval - fsync с заданным интервалом.
+	FileSyncInterval = "interval"
+
+	// FileSyncNever - fsync выполняется только при уплотнении и закрытии хранилища.
+	FileSyncNever = "never"
+)
+
+// Форматы записей лога.
+const (
+	// LogFormatConsole - записи в читаемом текстовом виде.
+	LogFormatConsole = "console"
+
+	// LogFormatJSON - записи в формате JSON, по одной на строку.
+	LogFormatJSON = "json"
+)
+
+// Хранилища корзин ограничения частоты запросов.
+const (
+	// RateLimitStoreMemory - корзины в памяти процесса, у каждой реплики сервиса свои.
+	RateLimitStoreMemory = "memory"
+
+	// RateLimitStoreRedis - корзины в Redis, общие для всех реплик сервиса.
+	RateLimitStoreRedis = "redis"
+)
+
 // configBuilder - строитель конфигурации приложения.
 type configBuilder struct {
 	serverPort      string `env:"SERVER_ADDRESS"`
@@ -33,6 +175,80 @@ type configBuilder struct {
 	secretKey       string `env:"SECRET_KEY"`
 	enableHTTPS     bool   `env:"ENABLE_HTTPS"`
 	idLength        int
+	redisDSN        string `env:"REDIS_DSN"`
+	redisMode       string `env:"REDIS_MODE"`
+	adminAddress    string `env:"ADMIN_ADDRESS"`
+	adminToken      string `env:"ADMIN_TOKEN"`
+
+	databaseReplicaDSNs string `env:"DATABASE_REPLICA_DSNS"` // Строки соединения с репликами через запятую
+
+	fileSyncPolicy      string        `env:"FILE_SYNC_POLICY"`
+	fileSyncInterval    time.Duration `env:"FILE_SYNC_INTERVAL"`
+	fileCompactInterval time.Duration `env:"FILE_COMPACT_INTERVAL"`
+	fileRepair          bool          `env:"FILE_REPAIR"`
+
+	bloomFilter         bool `env:"BLOOM_FILTER"`
+	bloomFilterCapacity int  `env:"BLOOM_FILTER_CAPACITY"`
+
+	tracingExporter    string  `env:"TRACING_EXPORTER"`
+	tracingEndpoint    string  `env:"TRACING_ENDPOINT"`
+	tracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO"`
+
+	logLevel              string        `env:"LOG_LEVEL"`
+	logFormat             string        `env:"LOG_FORMAT"`
+	logFile               string        `env:"LOG_FILE"`
+	logMaxSize            int           `env:"LOG_MAX_SIZE"`
+	logMaxAge             time.Duration `env:"LOG_MAX_AGE"`
+	logSamplingInitial    int           `env:"LOG_SAMPLING_INITIAL"`
+	logSamplingThereafter int           `env:"LOG_SAMPLING_THEREAFTER"`
+
+	profileDir         string        `env:"PROFILE_DIR"`
+	profileInterval    time.Duration `env:"PROFILE_INTERVAL"`
+	profileCPUDuration time.Duration `env:"PROFILE_CPU_DURATION"`
+	profileRetention   int           `env:"PROFILE_RETENTION"`
+
+	serverReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT"`
+	serverReadTimeout       time.Duration `env:"SERVER_READ_TIMEOUT"`
+	serverWriteTimeout      time.Duration `env:"SERVER_WRITE_TIMEOUT"`
+	serverIdleTimeout       time.Duration `env:"SERVER_IDLE_TIMEOUT"`
+	maxBodySize             int           `env:"MAX_BODY_SIZE"`
+	maxURLBodySize          int           `env:"MAX_URL_BODY_SIZE"`
+
+	rateLimitStore         string  `env:"RATE_LIMIT_STORE"`
+	rateLimitIPHeader      string  `env:"RATE_LIMIT_IP_HEADER"`
+	rateLimitCreateRate    float64 `env:"RATE_LIMIT_CREATE_RATE"`
+	rateLimitCreateBurst   int     `env:"RATE_LIMIT_CREATE_BURST"`
+	rateLimitRedirectRate  float64 `env:"RATE_LIMIT_REDIRECT_RATE"`
+	rateLimitRedirectBurst int     `env:"RATE_LIMIT_REDIRECT_BURST"`
+	rateLimitDeleteRate    float64 `env:"RATE_LIMIT_DELETE_RATE"`
+	rateLimitDeleteBurst   int     `env:"RATE_LIMIT_DELETE_BURST"`
+
+	quotaMaxLinks     int `env:"QUOTA_MAX_LINKS"`
+	quotaMaxBatchSize int `env:"QUOTA_MAX_BATCH_SIZE"`
+	quotaMaxURLLength int `env:"QUOTA_MAX_URL_LENGTH"`
+
+	corsAllowedOrigins    string        `env:"CORS_ALLOWED_ORIGINS"`
+	corsAllowedMethods    string        `env:"CORS_ALLOWED_METHODS"`
+	corsAllowedHeaders    string        `env:"CORS_ALLOWED_HEADERS"`
+	corsAllowCredentials  bool          `env:"CORS_ALLOW_CREDENTIALS"`
+	corsMaxAge            time.Duration `env:"CORS_MAX_AGE"`
+	hstsMaxAge            time.Duration `env:"HSTS_MAX_AGE"`
+	referrerPolicy        string        `env:"REFERRER_POLICY"`
+	contentSecurityPolicy string        `env:"CONTENT_SECURITY_POLICY"`
+
+	jwtTTL             time.Duration `env:"JWT_TTL"`
+	jwtRefreshInterval time.Duration `env:"JWT_REFRESH_INTERVAL"`
+	jwtPreviousKeys    string        `env:"JWT_PREVIOUS_KEYS"`
+	cookieSecure       bool          `env:"COOKIE_SECURE"`
+	cookieHTTPOnly     bool          `env:"COOKIE_HTTP_ONLY"`
+	cookieSameSite     string        `env:"COOKIE_SAME_SITE"`
+
+	jwtSigningKeyFile   string `env:"JWT_SIGNING_KEY_FILE"`
+	jwtPreviousKeyFiles string `env:"JWT_PREVIOUS_KEY_FILES"`
+
+	passwordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM"`
+
+	showVersion bool
 }
 
 // newConfigBuilder создает нового строителя конфигурации приложения.
@@ -49,6 +265,66 @@ func (cb *configBuilder) setDefaults() error {
 	cb.secretKey = "secret"
 	cb.enableHTTPS = false
 	cb.idLength = 8
+	cb.redisDSN = ""
+	cb.redisMode = RedisModeCache
+	cb.adminAddress = ""
+	cb.adminToken = ""
+	cb.databaseReplicaDSNs = ""
+	cb.fileSyncPolicy = FileSyncInterval
+	cb.fileSyncInterval = 1 * time.Second
+	cb.fileCompactInterval = 10 * time.Minute
+	cb.fileRepair = false
+	cb.bloomFilter = false
+	cb.bloomFilterCapacity = 1_000_000
+	cb.tracingExporter = ""
+	cb.tracingEndpoint = ""
+	cb.tracingSampleRatio = 1
+	cb.logLevel = "info"
+	cb.logFormat = LogFormatConsole
+	cb.logFile = ""
+	cb.logMaxSize = 100
+	cb.logMaxAge = 7 * 24 * time.Hour
+	cb.logSamplingInitial = 0
+	cb.logSamplingThereafter = 0
+	cb.profileDir = ""
+	cb.profileInterval = 1 * time.Hour
+	cb.profileCPUDuration = 30 * time.Second
+	cb.profileRetention = 24
+	cb.serverReadHeaderTimeout = 5 * time.Second
+	cb.serverReadTimeout = 15 * time.Second
+	cb.serverWriteTimeout = 30 * time.Second
+	cb.serverIdleTimeout = 2 * time.Minute
+	cb.maxBodySize = 1 << 20
+	cb.maxURLBodySize = 16 << 10
+	cb.rateLimitStore = RateLimitStoreMemory
+	cb.rateLimitIPHeader = ""
+	cb.rateLimitCreateRate = 5
+	cb.rateLimitCreateBurst = 50
+	cb.rateLimitRedirectRate = 50
+	cb.rateLimitRedirectBurst = 200
+	cb.rateLimitDeleteRate = 1
+	cb.rateLimitDeleteBurst = 10
+	cb.quotaMaxLinks = 0
+	cb.quotaMaxBatchSize = 1000
+	cb.quotaMaxURLLength = 8192
+	cb.corsAllowedOrigins = ""
+	cb.corsAllowedMethods = "GET,POST,DELETE"
+	cb.corsAllowedHeaders = "Authorization,Content-Type,Content-Encoding,X-Request-ID"
+	cb.corsAllowCredentials = false
+	cb.corsMaxAge = 10 * time.Minute
+	cb.hstsMaxAge = 365 * 24 * time.Hour
+	cb.referrerPolicy = "strict-origin-when-cross-origin"
+	cb.contentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+	cb.jwtTTL = 24 * time.Hour
+	cb.jwtRefreshInterval = time.Hour
+	cb.jwtPreviousKeys = ""
+	cb.cookieSecure = false
+	cb.cookieHTTPOnly = true
+	cb.cookieSameSite = "lax"
+	cb.jwtSigningKeyFile = ""
+	cb.jwtPreviousKeyFiles = ""
+	cb.passwordHashAlgorithm = "argon2id"
+	cb.showVersion = false
 
 	return nil
 }
@@ -58,10 +334,70 @@ func (cb *configBuilder) setFlags() error {
 	flag.StringVar(&cb.serverPort, "a", cb.serverPort, "address and port to run server")
 	flag.StringVar(&cb.baseURL, "b", cb.baseURL, "basic address of shortened URL")
 	flag.StringVar(&cb.fileStoragePath, "f", cb.fileStoragePath, "path to the storage file")
-	flag.StringVar(&cb.databaseDSN, "d", cb.databaseDSN, "database connection string")
+	flag.StringVar(&cb.databaseDSN, "d", cb.databaseDSN, "storage connection string, scheme selects backend: memory://, file://, postgres://, sqlite://, redis://")
 	flag.StringVar(&cb.secretKey, "k", cb.secretKey, "secret authorization key")
 	flag.BoolVar(&cb.enableHTTPS, "s", cb.enableHTTPS, "enable HTTPS on server")
 	flag.IntVar(&cb.idLength, "l", cb.idLength, "URL ID default length")
+	flag.StringVar(&cb.redisDSN, "r", cb.redisDSN, "redis connection string")
+	flag.StringVar(&cb.redisMode, "rm", cb.redisMode, "redis mode: cache or storage")
+	flag.StringVar(&cb.adminAddress, "aa", cb.adminAddress, "admin server address for metrics, empty to serve them on the main server")
+	flag.StringVar(&cb.adminToken, "at", cb.adminToken, "bearer token for protected admin endpoints, empty to disable them")
+	flag.StringVar(&cb.databaseReplicaDSNs, "dr", cb.databaseReplicaDSNs, "comma-separated read replica connection strings")
+	flag.StringVar(&cb.fileSyncPolicy, "fs", cb.fileSyncPolicy, "storage file fsync policy: always, interval or never")
+	flag.DurationVar(&cb.fileSyncInterval, "fsi", cb.fileSyncInterval, "storage file fsync interval")
+	flag.DurationVar(&cb.fileCompactInterval, "fci", cb.fileCompactInterval, "storage file compaction interval")
+	flag.BoolVar(&cb.fileRepair, "fr", cb.fileRepair, "repair corrupted storage file on startup")
+	flag.BoolVar(&cb.bloomFilter, "bf", cb.bloomFilter, "enable Bloom filter of existing URL IDs, only for memory and file storages")
+	flag.IntVar(&cb.bloomFilterCapacity, "bfc", cb.bloomFilterCapacity, "expected number of URLs in Bloom filter")
+	flag.StringVar(&cb.tracingExporter, "te", cb.tracingExporter, "tracing exporter: stdout, otlp or empty to disable tracing")
+	flag.StringVar(&cb.tracingEndpoint, "tep", cb.tracingEndpoint, "OTLP/HTTP collector endpoint URL")
+	flag.Float64Var(&cb.tracingSampleRatio, "tsr", cb.tracingSampleRatio, "ratio of sampled traces from 0 to 1")
+	flag.StringVar(&cb.logLevel, "ll", cb.logLevel, "log level: debug, info, warn or error")
+	flag.StringVar(&cb.logFormat, "lf", cb.logFormat, "log format: console or json")
+	flag.StringVar(&cb.logFile, "lo", cb.logFile, "log file path, empty to log to stdout")
+	flag.IntVar(&cb.logMaxSize, "lms", cb.logMaxSize, "log file size in megabytes before rotation")
+	flag.DurationVar(&cb.logMaxAge, "lma", cb.logMaxAge, "max age of rotated log files, 0 to keep them forever")
+	flag.IntVar(&cb.logSamplingInitial, "lsi", cb.logSamplingInitial, "number of identical log records per second written before sampling, 0 to disable sampling")
+	flag.IntVar(&cb.logSamplingThereafter, "lst", cb.logSamplingThereafter, "write every Nth identical log record per second after sampling starts")
+	flag.StringVar(&cb.profileDir, "pd", cb.profileDir, "directory for scheduled CPU and heap profiles, empty to disable capture")
+	flag.DurationVar(&cb.profileInterval, "pi", cb.profileInterval, "interval between scheduled profile captures")
+	flag.DurationVar(&cb.profileCPUDuration, "pcd", cb.profileCPUDuration, "duration of each scheduled CPU profile")
+	flag.IntVar(&cb.profileRetention, "pr", cb.profileRetention, "number of scheduled profiles of each kind to keep")
+	flag.DurationVar(&cb.serverReadHeaderTimeout, "srh", cb.serverReadHeaderTimeout, "HTTP server timeout for reading request headers")
+	flag.DurationVar(&cb.serverReadTimeout, "srt", cb.serverReadTimeout, "HTTP server timeout for reading the whole request")
+	flag.DurationVar(&cb.serverWriteTimeout, "swt", cb.serverWriteTimeout, "HTTP server timeout for writing the response")
+	flag.DurationVar(&cb.serverIdleTimeout, "sit", cb.serverIdleTimeout, "HTTP server timeout for idle keep-alive connections")
+	flag.IntVar(&cb.maxBodySize, "mbs", cb.maxBodySize, "max request body size in bytes, also after decompression")
+	flag.IntVar(&cb.maxURLBodySize, "mus", cb.maxURLBodySize, "max request body size in bytes for shortening a single URL")
+	flag.StringVar(&cb.rateLimitStore, "rls", cb.rateLimitStore, "rate limit store: memory or redis")
+	flag.StringVar(&cb.rateLimitIPHeader, "rlh", cb.rateLimitIPHeader, "header with client IP set by a trusted proxy, e.g. X-Real-IP, the last address of a list is used")
+	flag.Float64Var(&cb.rateLimitCreateRate, "rlcr", cb.rateLimitCreateRate, "URL shortening requests per second, 0 - unlimited")
+	flag.IntVar(&cb.rateLimitCreateBurst, "rlcb", cb.rateLimitCreateBurst, "URL shortening requests in a burst")
+	flag.Float64Var(&cb.rateLimitRedirectRate, "rlrr", cb.rateLimitRedirectRate, "redirect requests per second, 0 - unlimited")
+	flag.IntVar(&cb.rateLimitRedirectBurst, "rlrb", cb.rateLimitRedirectBurst, "redirect requests in a burst")
+	flag.Float64Var(&cb.rateLimitDeleteRate, "rldr", cb.rateLimitDeleteRate, "URL deletion requests per second, 0 - unlimited")
+	flag.IntVar(&cb.rateLimitDeleteBurst, "rldb", cb.rateLimitDeleteBurst, "URL deletion requests in a burst")
+	flag.IntVar(&cb.quotaMaxLinks, "qml", cb.quotaMaxLinks, "max active URLs per user, 0 - unlimited")
+	flag.IntVar(&cb.quotaMaxBatchSize, "qmb", cb.quotaMaxBatchSize, "max URLs in a batch, 0 - unlimited")
+	flag.IntVar(&cb.quotaMaxURLLength, "qmu", cb.quotaMaxURLLength, "max original URL length in bytes, 0 - unlimited")
+	flag.StringVar(&cb.corsAllowedOrigins, "co", cb.corsAllowedOrigins, "comma-separated origins allowed to make cross-origin requests, * - any")
+	flag.StringVar(&cb.corsAllowedMethods, "cm", cb.corsAllowedMethods, "comma-separated methods allowed in cross-origin requests")
+	flag.StringVar(&cb.corsAllowedHeaders, "ch", cb.corsAllowedHeaders, "comma-separated headers allowed in cross-origin requests")
+	flag.BoolVar(&cb.corsAllowCredentials, "cc", cb.corsAllowCredentials, "allow cross-origin requests with cookies, only from origins without wildcards or from subdomains of a given domain")
+	flag.DurationVar(&cb.corsMaxAge, "cma", cb.corsMaxAge, "preflight response cache duration")
+	flag.DurationVar(&cb.hstsMaxAge, "hsts", cb.hstsMaxAge, "Strict-Transport-Security max age when HTTPS is enabled, 0 - disabled")
+	flag.StringVar(&cb.referrerPolicy, "rp", cb.referrerPolicy, "Referrer-Policy header value")
+	flag.StringVar(&cb.contentSecurityPolicy, "csp", cb.contentSecurityPolicy, "Content-Security-Policy header value for HTML responses")
+	flag.DurationVar(&cb.jwtTTL, "jt", cb.jwtTTL, "JWT lifetime")
+	flag.DurationVar(&cb.jwtRefreshInterval, "jri", cb.jwtRefreshInterval, "JWT age after which it is reissued with a new expiration")
+	flag.StringVar(&cb.jwtPreviousKeys, "jpk", cb.jwtPreviousKeys, "comma-separated previous secret keys, whose JWTs are still accepted")
+	flag.BoolVar(&cb.cookieSecure, "jcs", cb.cookieSecure, "send JWT cookie over HTTPS only")
+	flag.BoolVar(&cb.cookieHTTPOnly, "jch", cb.cookieHTTPOnly, "hide JWT cookie from page scripts")
+	flag.StringVar(&cb.cookieSameSite, "jcss", cb.cookieSameSite, "JWT cookie SameSite mode: lax, strict or none")
+	flag.StringVar(&cb.jwtSigningKeyFile, "jsk", cb.jwtSigningKeyFile, "PEM file with RSA or Ed25519 private key signing JWT instead of secret key")
+	flag.StringVar(&cb.jwtPreviousKeyFiles, "jpf", cb.jwtPreviousKeyFiles, "comma-separated PEM files with previous RSA or Ed25519 keys, whose JWTs are still accepted")
+	flag.StringVar(&cb.passwordHashAlgorithm, "pha", cb.passwordHashAlgorithm, "password hash algorithm of registered users: argon2id or bcrypt")
+	flag.BoolVar(&cb.showVersion, "version", cb.showVersion, "print build information and exit")
 	flag.Parse()
 
 	return nil
@@ -100,6 +436,183 @@ func (cb *configBuilder) setEnvs() error {
 			if fromFile.IDlength != 0 {
 				cb.idLength = fromFile.IDlength
 			}
+			if fromFile.RedisDSN != "" {
+				cb.redisDSN = fromFile.RedisDSN
+			}
+			if fromFile.RedisMode != "" {
+				cb.redisMode = fromFile.RedisMode
+			}
+			if fromFile.AdminAddress != "" {
+				cb.adminAddress = fromFile.AdminAddress
+			}
+			if fromFile.AdminToken != "" {
+				cb.adminToken = fromFile.AdminToken
+			}
+			if len(fromFile.DatabaseReplicaDSNs) != 0 {
+				cb.databaseReplicaDSNs = strings.Join(fromFile.DatabaseReplicaDSNs, ",")
+			}
+			if fromFile.FileSyncPolicy != "" {
+				cb.fileSyncPolicy = fromFile.FileSyncPolicy
+			}
+			if fromFile.FileSyncInterval.Duration != 0 {
+				cb.fileSyncInterval = fromFile.FileSyncInterval.Duration
+			}
+			if fromFile.FileCompactInterval.Duration != 0 {
+				cb.fileCompactInterval = fromFile.FileCompactInterval.Duration
+			}
+			if fromFile.FileRepair {
+				cb.fileRepair = fromFile.FileRepair
+			}
+			if fromFile.BloomFilter {
+				cb.bloomFilter = fromFile.BloomFilter
+			}
+			if fromFile.BloomFilterCapacity != 0 {
+				cb.bloomFilterCapacity = fromFile.BloomFilterCapacity
+			}
+			if fromFile.TracingExporter != "" {
+				cb.tracingExporter = fromFile.TracingExporter
+			}
+			if fromFile.TracingEndpoint != "" {
+				cb.tracingEndpoint = fromFile.TracingEndpoint
+			}
+			if fromFile.TracingSampleRatio != 0 {
+				cb.tracingSampleRatio = fromFile.TracingSampleRatio
+			}
+			if fromFile.LogLevel != "" {
+				cb.logLevel = fromFile.LogLevel
+			}
+			if fromFile.LogFormat != "" {
+				cb.logFormat = fromFile.LogFormat
+			}
+			if fromFile.LogFile != "" {
+				cb.logFile = fromFile.LogFile
+			}
+			if fromFile.LogMaxSize != 0 {
+				cb.logMaxSize = fromFile.LogMaxSize
+			}
+			if fromFile.LogMaxAge.Duration != 0 {
+				cb.logMaxAge = fromFile.LogMaxAge.Duration
+			}
+			if fromFile.LogSamplingInitial != 0 {
+				cb.logSamplingInitial = fromFile.LogSamplingInitial
+			}
+			if fromFile.LogSamplingThereafter != 0 {
+				cb.logSamplingThereafter = fromFile.LogSamplingThereafter
+			}
+			if fromFile.ProfileDir != "" {
+				cb.profileDir = fromFile.ProfileDir
+			}
+			if fromFile.ProfileInterval.Duration != 0 {
+				cb.profileInterval = fromFile.ProfileInterval.Duration
+			}
+			if fromFile.ProfileCPUDuration.Duration != 0 {
+				cb.profileCPUDuration = fromFile.ProfileCPUDuration.Duration
+			}
+			if fromFile.ProfileRetention != 0 {
+				cb.profileRetention = fromFile.ProfileRetention
+			}
+			if fromFile.ServerReadHeaderTimeout.Duration != 0 {
+				cb.serverReadHeaderTimeout = fromFile.ServerReadHeaderTimeout.Duration
+			}
+			if fromFile.ServerReadTimeout.Duration != 0 {
+				cb.serverReadTimeout = fromFile.ServerReadTimeout.Duration
+			}
+			if fromFile.ServerWriteTimeout.Duration != 0 {
+				cb.serverWriteTimeout = fromFile.ServerWriteTimeout.Duration
+			}
+			if fromFile.ServerIdleTimeout.Duration != 0 {
+				cb.serverIdleTimeout = fromFile.ServerIdleTimeout.Duration
+			}
+			if fromFile.MaxBodySize != 0 {
+				cb.maxBodySize = fromFile.MaxBodySize
+			}
+			if fromFile.MaxURLBodySize != 0 {
+				cb.maxURLBodySize = fromFile.MaxURLBodySize
+			}
+			if fromFile.RateLimitStore != "" {
+				cb.rateLimitStore = fromFile.RateLimitStore
+			}
+			if fromFile.RateLimitIPHeader != "" {
+				cb.rateLimitIPHeader = fromFile.RateLimitIPHeader
+			}
+			if fromFile.RateLimitCreateRate != 0 {
+				cb.rateLimitCreateRate = fromFile.RateLimitCreateRate
+			}
+			if fromFile.RateLimitCreateBurst != 0 {
+				cb.rateLimitCreateBurst = fromFile.RateLimitCreateBurst
+			}
+			if fromFile.RateLimitRedirectRate != 0 {
+				cb.rateLimitRedirectRate = fromFile.RateLimitRedirectRate
+			}
+			if fromFile.RateLimitRedirectBurst != 0 {
+				cb.rateLimitRedirectBurst = fromFile.RateLimitRedirectBurst
+			}
+			if fromFile.RateLimitDeleteRate != 0 {
+				cb.rateLimitDeleteRate = fromFile.RateLimitDeleteRate
+			}
+			if fromFile.RateLimitDeleteBurst != 0 {
+				cb.rateLimitDeleteBurst = fromFile.RateLimitDeleteBurst
+			}
+			if fromFile.QuotaMaxLinks != 0 {
+				cb.quotaMaxLinks = fromFile.QuotaMaxLinks
+			}
+			if fromFile.QuotaMaxBatchSize != 0 {
+				cb.quotaMaxBatchSize = fromFile.QuotaMaxBatchSize
+			}
+			if fromFile.QuotaMaxURLLength != 0 {
+				cb.quotaMaxURLLength = fromFile.QuotaMaxURLLength
+			}
+			if len(fromFile.CORSAllowedOrigins) != 0 {
+				cb.corsAllowedOrigins = strings.Join(fromFile.CORSAllowedOrigins, ",")
+			}
+			if len(fromFile.CORSAllowedMethods) != 0 {
+				cb.corsAllowedMethods = strings.Join(fromFile.CORSAllowedMethods, ",")
+			}
+			if len(fromFile.CORSAllowedHeaders) != 0 {
+				cb.corsAllowedHeaders = strings.Join(fromFile.CORSAllowedHeaders, ",")
+			}
+			if fromFile.CORSAllowCredentials {
+				cb.corsAllowCredentials = fromFile.CORSAllowCredentials
+			}
+			if fromFile.CORSMaxAge.Duration != 0 {
+				cb.corsMaxAge = fromFile.CORSMaxAge.Duration
+			}
+			if fromFile.HSTSMaxAge.Duration != 0 {
+				cb.hstsMaxAge = fromFile.HSTSMaxAge.Duration
+			}
+			if fromFile.ReferrerPolicy != "" {
+				cb.referrerPolicy = fromFile.ReferrerPolicy
+			}
+			if fromFile.ContentSecurityPolicy != "" {
+				cb.contentSecurityPolicy = fromFile.ContentSecurityPolicy
+			}
+			if fromFile.JWTTTL.Duration != 0 {
+				cb.jwtTTL = fromFile.JWTTTL.Duration
+			}
+			if fromFile.JWTRefreshInterval.Duration != 0 {
+				cb.jwtRefreshInterval = fromFile.JWTRefreshInterval.Duration
+			}
+			if len(fromFile.JWTPreviousKeys) != 0 {
+				cb.jwtPreviousKeys = strings.Join(fromFile.JWTPreviousKeys, ",")
+			}
+			if fromFile.CookieSecure {
+				cb.cookieSecure = fromFile.CookieSecure
+			}
+			if fromFile.CookieHTTPOnly {
+				cb.cookieHTTPOnly = fromFile.CookieHTTPOnly
+			}
+			if fromFile.CookieSameSite != "" {
+				cb.cookieSameSite = fromFile.CookieSameSite
+			}
+			if fromFile.JWTSigningKeyFile != "" {
+				cb.jwtSigningKeyFile = fromFile.JWTSigningKeyFile
+			}
+			if len(fromFile.JWTPreviousKeyFiles) != 0 {
+				cb.jwtPreviousKeyFiles = strings.Join(fromFile.JWTPreviousKeyFiles, ",")
+			}
+			if fromFile.PasswordHashAlgorithm != "" {
+				cb.passwordHashAlgorithm = fromFile.PasswordHashAlgorithm
+			}
 		}
 	}
 
@@ -133,6 +646,406 @@ func (cb *configBuilder) setEnvs() error {
 		}
 	}
 
+	rdsn := os.Getenv("REDIS_DSN")
+	if rdsn != "" {
+		cb.redisDSN = rdsn
+	}
+
+	rm := os.Getenv("REDIS_MODE")
+	if rm != "" {
+		cb.redisMode = rm
+	}
+
+	aa := os.Getenv("ADMIN_ADDRESS")
+	if aa != "" {
+		cb.adminAddress = aa
+	}
+
+	at := os.Getenv("ADMIN_TOKEN")
+	if at != "" {
+		cb.adminToken = at
+	}
+
+	drdsn := os.Getenv("DATABASE_REPLICA_DSNS")
+	if drdsn != "" {
+		cb.databaseReplicaDSNs = drdsn
+	}
+
+	fsyp := os.Getenv("FILE_SYNC_POLICY")
+	if fsyp != "" {
+		cb.fileSyncPolicy = fsyp
+	}
+
+	fsi := os.Getenv("FILE_SYNC_INTERVAL")
+	if fsi != "" {
+		fileSyncInterval, errConv := time.ParseDuration(fsi)
+		if errConv == nil {
+			cb.fileSyncInterval = fileSyncInterval
+		}
+	}
+
+	fci := os.Getenv("FILE_COMPACT_INTERVAL")
+	if fci != "" {
+		fileCompactInterval, errConv := time.ParseDuration(fci)
+		if errConv == nil {
+			cb.fileCompactInterval = fileCompactInterval
+		}
+	}
+
+	fr := os.Getenv("FILE_REPAIR")
+	if fr != "" {
+		fileRepair, errConv := strconv.ParseBool(fr)
+		if errConv == nil {
+			cb.fileRepair = fileRepair
+		}
+	}
+
+	bf := os.Getenv("BLOOM_FILTER")
+	if bf != "" {
+		bloomFilter, errConv := strconv.ParseBool(bf)
+		if errConv == nil {
+			cb.bloomFilter = bloomFilter
+		}
+	}
+
+	bfc := os.Getenv("BLOOM_FILTER_CAPACITY")
+	if bfc != "" {
+		bloomFilterCapacity, errConv := strconv.Atoi(bfc)
+		if errConv == nil {
+			cb.bloomFilterCapacity = bloomFilterCapacity
+		}
+	}
+
+	te := os.Getenv("TRACING_EXPORTER")
+	if te != "" {
+		cb.tracingExporter = te
+	}
+
+	tep := os.Getenv("TRACING_ENDPOINT")
+	if tep != "" {
+		cb.tracingEndpoint = tep
+	}
+
+	tsr := os.Getenv("TRACING_SAMPLE_RATIO")
+	if tsr != "" {
+		tracingSampleRatio, errConv := strconv.ParseFloat(tsr, 64)
+		if errConv == nil {
+			cb.tracingSampleRatio = tracingSampleRatio
+		}
+	}
+
+	ll := os.Getenv("LOG_LEVEL")
+	if ll != "" {
+		cb.logLevel = ll
+	}
+
+	lf := os.Getenv("LOG_FORMAT")
+	if lf != "" {
+		cb.logFormat = lf
+	}
+
+	lo := os.Getenv("LOG_FILE")
+	if lo != "" {
+		cb.logFile = lo
+	}
+
+	lms := os.Getenv("LOG_MAX_SIZE")
+	if lms != "" {
+		logMaxSize, errConv := strconv.Atoi(lms)
+		if errConv == nil {
+			cb.logMaxSize = logMaxSize
+		}
+	}
+
+	lma := os.Getenv("LOG_MAX_AGE")
+	if lma != "" {
+		logMaxAge, errConv := time.ParseDuration(lma)
+		if errConv == nil {
+			cb.logMaxAge = logMaxAge
+		}
+	}
+
+	lsi := os.Getenv("LOG_SAMPLING_INITIAL")
+	if lsi != "" {
+		logSamplingInitial, errConv := strconv.Atoi(lsi)
+		if errConv == nil {
+			cb.logSamplingInitial = logSamplingInitial
+		}
+	}
+
+	lst := os.Getenv("LOG_SAMPLING_THEREAFTER")
+	if lst != "" {
+		logSamplingThereafter, errConv := strconv.Atoi(lst)
+		if errConv == nil {
+			cb.logSamplingThereafter = logSamplingThereafter
+		}
+	}
+
+	pd := os.Getenv("PROFILE_DIR")
+	if pd != "" {
+		cb.profileDir = pd
+	}
+
+	pi := os.Getenv("PROFILE_INTERVAL")
+	if pi != "" {
+		profileInterval, errConv := time.ParseDuration(pi)
+		if errConv == nil {
+			cb.profileInterval = profileInterval
+		}
+	}
+
+	pcd := os.Getenv("PROFILE_CPU_DURATION")
+	if pcd != "" {
+		profileCPUDuration, errConv := time.ParseDuration(pcd)
+		if errConv == nil {
+			cb.profileCPUDuration = profileCPUDuration
+		}
+	}
+
+	pr := os.Getenv("PROFILE_RETENTION")
+	if pr != "" {
+		profileRetention, errConv := strconv.Atoi(pr)
+		if errConv == nil {
+			cb.profileRetention = profileRetention
+		}
+	}
+
+	srh := os.Getenv("SERVER_READ_HEADER_TIMEOUT")
+	if srh != "" {
+		serverReadHeaderTimeout, errConv := time.ParseDuration(srh)
+		if errConv == nil {
+			cb.serverReadHeaderTimeout = serverReadHeaderTimeout
+		}
+	}
+
+	srt := os.Getenv("SERVER_READ_TIMEOUT")
+	if srt != "" {
+		serverReadTimeout, errConv := time.ParseDuration(srt)
+		if errConv == nil {
+			cb.serverReadTimeout = serverReadTimeout
+		}
+	}
+
+	swt := os.Getenv("SERVER_WRITE_TIMEOUT")
+	if swt != "" {
+		serverWriteTimeout, errConv := time.ParseDuration(swt)
+		if errConv == nil {
+			cb.serverWriteTimeout = serverWriteTimeout
+		}
+	}
+
+	sit := os.Getenv("SERVER_IDLE_TIMEOUT")
+	if sit != "" {
+		serverIdleTimeout, errConv := time.ParseDuration(sit)
+		if errConv == nil {
+			cb.serverIdleTimeout = serverIdleTimeout
+		}
+	}
+
+	mbs := os.Getenv("MAX_BODY_SIZE")
+	if mbs != "" {
+		maxBodySize, errConv := strconv.Atoi(mbs)
+		if errConv == nil {
+			cb.maxBodySize = maxBodySize
+		}
+	}
+
+	mus := os.Getenv("MAX_URL_BODY_SIZE")
+	if mus != "" {
+		maxURLBodySize, errConv := strconv.Atoi(mus)
+		if errConv == nil {
+			cb.maxURLBodySize = maxURLBodySize
+		}
+	}
+
+	rls := os.Getenv("RATE_LIMIT_STORE")
+	if rls != "" {
+		cb.rateLimitStore = rls
+	}
+
+	rlh := os.Getenv("RATE_LIMIT_IP_HEADER")
+	if rlh != "" {
+		cb.rateLimitIPHeader = rlh
+	}
+
+	rlcr := os.Getenv("RATE_LIMIT_CREATE_RATE")
+	if rlcr != "" {
+		rateLimitCreateRate, errConv := strconv.ParseFloat(rlcr, 64)
+		if errConv == nil {
+			cb.rateLimitCreateRate = rateLimitCreateRate
+		}
+	}
+
+	rlcb := os.Getenv("RATE_LIMIT_CREATE_BURST")
+	if rlcb != "" {
+		rateLimitCreateBurst, errConv := strconv.Atoi(rlcb)
+		if errConv == nil {
+			cb.rateLimitCreateBurst = rateLimitCreateBurst
+		}
+	}
+
+	rlrr := os.Getenv("RATE_LIMIT_REDIRECT_RATE")
+	if rlrr != "" {
+		rateLimitRedirectRate, errConv := strconv.ParseFloat(rlrr, 64)
+		if errConv == nil {
+			cb.rateLimitRedirectRate = rateLimitRedirectRate
+		}
+	}
+
+	rlrb := os.Getenv("RATE_LIMIT_REDIRECT_BURST")
+	if rlrb != "" {
+		rateLimitRedirectBurst, errConv := strconv.Atoi(rlrb)
+		if errConv == nil {
+			cb.rateLimitRedirectBurst = rateLimitRedirectBurst
+		}
+	}
+
+	rldr := os.Getenv("RATE_LIMIT_DELETE_RATE")
+	if rldr != "" {
+		rateLimitDeleteRate, errConv := strconv.ParseFloat(rldr, 64)
+		if errConv == nil {
+			cb.rateLimitDeleteRate = rateLimitDeleteRate
+		}
+	}
+
+	rldb := os.Getenv("RATE_LIMIT_DELETE_BURST")
+	if rldb != "" {
+		rateLimitDeleteBurst, errConv := strconv.Atoi(rldb)
+		if errConv == nil {
+			cb.rateLimitDeleteBurst = rateLimitDeleteBurst
+		}
+	}
+
+	qml := os.Getenv("QUOTA_MAX_LINKS")
+	if qml != "" {
+		quotaMaxLinks, errConv := strconv.Atoi(qml)
+		if errConv == nil {
+			cb.quotaMaxLinks = quotaMaxLinks
+		}
+	}
+
+	qmb := os.Getenv("QUOTA_MAX_BATCH_SIZE")
+	if qmb != "" {
+		quotaMaxBatchSize, errConv := strconv.Atoi(qmb)
+		if errConv == nil {
+			cb.quotaMaxBatchSize = quotaMaxBatchSize
+		}
+	}
+
+	qmu := os.Getenv("QUOTA_MAX_URL_LENGTH")
+	if qmu != "" {
+		quotaMaxURLLength, errConv := strconv.Atoi(qmu)
+		if errConv == nil {
+			cb.quotaMaxURLLength = quotaMaxURLLength
+		}
+	}
+
+	co := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if co != "" {
+		cb.corsAllowedOrigins = co
+	}
+
+	cm := os.Getenv("CORS_ALLOWED_METHODS")
+	if cm != "" {
+		cb.corsAllowedMethods = cm
+	}
+
+	ch := os.Getenv("CORS_ALLOWED_HEADERS")
+	if ch != "" {
+		cb.corsAllowedHeaders = ch
+	}
+
+	cc := os.Getenv("CORS_ALLOW_CREDENTIALS")
+	if cc != "" {
+		corsAllowCredentials, errConv := strconv.ParseBool(cc)
+		if errConv == nil {
+			cb.corsAllowCredentials = corsAllowCredentials
+		}
+	}
+
+	cma := os.Getenv("CORS_MAX_AGE")
+	if cma != "" {
+		corsMaxAge, errConv := time.ParseDuration(cma)
+		if errConv == nil {
+			cb.corsMaxAge = corsMaxAge
+		}
+	}
+
+	hsts := os.Getenv("HSTS_MAX_AGE")
+	if hsts != "" {
+		hstsMaxAge, errConv := time.ParseDuration(hsts)
+		if errConv == nil {
+			cb.hstsMaxAge = hstsMaxAge
+		}
+	}
+
+	rp := os.Getenv("REFERRER_POLICY")
+	if rp != "" {
+		cb.referrerPolicy = rp
+	}
+
+	csp := os.Getenv("CONTENT_SECURITY_POLICY")
+	if csp != "" {
+		cb.contentSecurityPolicy = csp
+	}
+
+	jt := os.Getenv("JWT_TTL")
+	if jt != "" {
+		jwtTTL, errConv := time.ParseDuration(jt)
+		if errConv == nil {
+			cb.jwtTTL = jwtTTL
+		}
+	}
+
+	jri := os.Getenv("JWT_REFRESH_INTERVAL")
+	if jri != "" {
+		jwtRefreshInterval, errConv := time.ParseDuration(jri)
+		if errConv == nil {
+			cb.jwtRefreshInterval = jwtRefreshInterval
+		}
+	}
+
+	jpk := os.Getenv("JWT_PREVIOUS_KEYS")
+	if jpk != "" {
+		cb.jwtPreviousKeys = jpk
+	}
+
+	jcs := os.Getenv("COOKIE_SECURE")
+	if jcs != "" {
+		cookieSecure, errConv := strconv.ParseBool(jcs)
+		if errConv == nil {
+			cb.cookieSecure = cookieSecure
+		}
+	}
+
+	jch := os.Getenv("COOKIE_HTTP_ONLY")
+	if jch != "" {
+		cookieHTTPOnly, errConv := strconv.ParseBool(jch)
+		if errConv == nil {
+			cb.cookieHTTPOnly = cookieHTTPOnly
+		}
+	}
+
+	jcss := os.Getenv("COOKIE_SAME_SITE")
+	if jcss != "" {
+		cb.cookieSameSite = jcss
+	}
+
+	jsk := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if jsk != "" {
+		cb.jwtSigningKeyFile = jsk
+	}
+
+	jpf := os.Getenv("JWT_PREVIOUS_KEY_FILES")
+	if jpf != "" {
+		cb.jwtPreviousKeyFiles = jpf
+	}
+
+	pha := os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if pha != "" {
+		cb.passwordHashAlgorithm = pha
+	}
+
 	sk := os.Getenv("SECRET_KEY")
 	if dsn != "" {
 		cb.secretKey = sk
@@ -151,7 +1064,92 @@ func (cb *configBuilder) build() *Config {
 		SecretKey:       cb.secretKey,
 		EnableHTTPS:     cb.enableHTTPS,
 		IDlength:        cb.idLength,
+		RedisDSN:        cb.redisDSN,
+		RedisMode:       cb.redisMode,
+		AdminAddress:    cb.adminAddress,
+		AdminToken:      cb.adminToken,
+
+		DatabaseReplicaDSNs: splitList(cb.databaseReplicaDSNs),
+
+		FileSyncPolicy:      cb.fileSyncPolicy,
+		FileSyncInterval:    Duration{cb.fileSyncInterval},
+		FileCompactInterval: Duration{cb.fileCompactInterval},
+		FileRepair:          cb.fileRepair,
+
+		BloomFilter:         cb.bloomFilter,
+		BloomFilterCapacity: cb.bloomFilterCapacity,
+
+		TracingExporter:    cb.tracingExporter,
+		TracingEndpoint:    cb.tracingEndpoint,
+		TracingSampleRatio: cb.tracingSampleRatio,
+
+		LogLevel:              cb.logLevel,
+		LogFormat:             cb.logFormat,
+		LogFile:               cb.logFile,
+		LogMaxSize:            cb.logMaxSize,
+		LogMaxAge:             Duration{cb.logMaxAge},
+		LogSamplingInitial:    cb.logSamplingInitial,
+		LogSamplingThereafter: cb.logSamplingThereafter,
+
+		ProfileDir:         cb.profileDir,
+		ProfileInterval:    Duration{cb.profileInterval},
+		ProfileCPUDuration: Duration{cb.profileCPUDuration},
+		ProfileRetention:   cb.profileRetention,
+
+		ServerReadHeaderTimeout: Duration{cb.serverReadHeaderTimeout},
+		ServerReadTimeout:       Duration{cb.serverReadTimeout},
+		ServerWriteTimeout:      Duration{cb.serverWriteTimeout},
+		ServerIdleTimeout:       Duration{cb.serverIdleTimeout},
+		MaxBodySize:             cb.maxBodySize,
+		MaxURLBodySize:          cb.maxURLBodySize,
+
+		RateLimitStore:         cb.rateLimitStore,
+		RateLimitIPHeader:      cb.rateLimitIPHeader,
+		RateLimitCreateRate:    cb.rateLimitCreateRate,
+		RateLimitCreateBurst:   cb.rateLimitCreateBurst,
+		RateLimitRedirectRate:  cb.rateLimitRedirectRate,
+		RateLimitRedirectBurst: cb.rateLimitRedirectBurst,
+		RateLimitDeleteRate:    cb.rateLimitDeleteRate,
+		RateLimitDeleteBurst:   cb.rateLimitDeleteBurst,
+
+		QuotaMaxLinks:     cb.quotaMaxLinks,
+		QuotaMaxBatchSize: cb.quotaMaxBatchSize,
+		QuotaMaxURLLength: cb.quotaMaxURLLength,
+
+		CORSAllowedOrigins:    splitList(cb.corsAllowedOrigins),
+		CORSAllowedMethods:    splitList(cb.corsAllowedMethods),
+		CORSAllowedHeaders:    splitList(cb.corsAllowedHeaders),
+		CORSAllowCredentials:  cb.corsAllowCredentials,
+		CORSMaxAge:            Duration{cb.corsMaxAge},
+		HSTSMaxAge:            Duration{cb.hstsMaxAge},
+		ReferrerPolicy:        cb.referrerPolicy,
+		ContentSecurityPolicy: cb.contentSecurityPolicy,
+
+		JWTTTL:             Duration{cb.jwtTTL},
+		JWTRefreshInterval: Duration{cb.jwtRefreshInterval},
+		JWTPreviousKeys:    splitList(cb.jwtPreviousKeys),
+		CookieSecure:       cb.cookieSecure,
+		CookieHTTPOnly:     cb.cookieHTTPOnly,
+		CookieSameSite:     cb.cookieSameSite,
+
+		JWTSigningKeyFile:   cb.jwtSigningKeyFile,
+		JWTPreviousKeyFiles: splitList(cb.jwtPreviousKeyFiles),
+
+		PasswordHashAlgorithm: cb.passwordHashAlgorithm,
+
+		ShowVersion: cb.showVersion,
+	}
+}
+
+// splitList разбирает список значений через запятую. Пустая строка дает пустой список.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
 	}
+	return list
 }
 
 // configFromFile читает и возвращает конфигурацию приложения из JSON файла.
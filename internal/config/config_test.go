@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -33,6 +35,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 
@@ -60,6 +106,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key1",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 
@@ -87,6 +177,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 		{"envs and flags #1",
@@ -111,6 +245,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key1",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 		{"envs and flags #2",
@@ -132,6 +310,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 		{"envs and flags #3",
@@ -152,6 +374,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 		{"envs and flags #4",
@@ -174,6 +440,50 @@ func TestGet(t *testing.T) {
 				SecretKey:       "secret_key1",
 				EnableHTTPS:     true,
 				IDlength:        8,
+				RedisMode:       RedisModeCache,
+
+				FileSyncPolicy:      FileSyncInterval,
+				FileSyncInterval:    Duration{1 * time.Second},
+				FileCompactInterval: Duration{10 * time.Minute},
+
+				BloomFilterCapacity: 1_000_000,
+
+				TracingSampleRatio: 1,
+
+				LogLevel:   "info",
+				LogFormat:  LogFormatConsole,
+				LogMaxSize: 100,
+				LogMaxAge:  Duration{7 * 24 * time.Hour},
+
+				ProfileInterval:         Duration{1 * time.Hour},
+				ProfileCPUDuration:      Duration{30 * time.Second},
+				ProfileRetention:        24,
+				ServerReadHeaderTimeout: Duration{5 * time.Second},
+				ServerReadTimeout:       Duration{15 * time.Second},
+				ServerWriteTimeout:      Duration{30 * time.Second},
+				ServerIdleTimeout:       Duration{2 * time.Minute},
+				MaxBodySize:             1 << 20,
+				MaxURLBodySize:          16 << 10,
+				RateLimitStore:          RateLimitStoreMemory,
+				RateLimitCreateRate:     5,
+				RateLimitCreateBurst:    50,
+				RateLimitRedirectRate:   50,
+				RateLimitRedirectBurst:  200,
+				RateLimitDeleteRate:     1,
+				RateLimitDeleteBurst:    10,
+				QuotaMaxBatchSize:       1000,
+				QuotaMaxURLLength:       8192,
+				CORSAllowedMethods:      []string{"GET", "POST", "DELETE"},
+				CORSAllowedHeaders:      []string{"Authorization", "Content-Type", "Content-Encoding", "X-Request-ID"},
+				CORSMaxAge:              Duration{10 * time.Minute},
+				HSTSMaxAge:              Duration{365 * 24 * time.Hour},
+				ReferrerPolicy:          "strict-origin-when-cross-origin",
+				ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+				JWTTTL:                  Duration{24 * time.Hour},
+				JWTRefreshInterval:      Duration{time.Hour},
+				CookieHTTPOnly:          true,
+				CookieSameSite:          "lax",
+				PasswordHashAlgorithm:   "argon2id",
 			},
 		},
 	}
@@ -204,3 +514,23 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestDuration(t *testing.T) {
+	var d Duration
+
+	err := json.Unmarshal([]byte(`"1m30s"`), &d)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, d.Duration)
+
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.Equal(t, `"1m30s"`, string(data))
+
+	err = json.Unmarshal([]byte(`90`), &d)
+	assert.Error(t, err)
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Nil(t, splitList(""))
+	assert.Equal(t, []string{"postgres://r1/db", "postgres://r2/db"}, splitList("postgres://r1/db, postgres://r2/db,"))
+}
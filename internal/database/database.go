@@ -26,10 +26,7 @@ func NewConnection(ctx context.Context, driver string, databaseDSN string) (*sql
 	}
 
 	// Устанавливаем параметры соединений
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(5)
-	db.SetConnMaxIdleTime(1 * time.Second)
-	db.SetConnMaxLifetime(30 * time.Second)
+	setPool(db)
 
 	// Делаем пинг
 	if err = db.PingContext(ctx); err != nil {
@@ -43,6 +40,29 @@ func NewConnection(ctx context.Context, driver string, databaseDSN string) (*sql
 	return db, err
 }
 
+// NewReplicaConnection создает новое соединение с репликой базы данных только для чтения.
+// Пинг и миграции не выполняются - реплика может быть недоступна при старте,
+// её доступность проверяется уже при работе хранилища.
+func NewReplicaConnection(driver string, databaseDSN string) (*sql.DB, error) {
+	db, err := sql.Open(driver, databaseDSN)
+	if err != nil {
+		slog.Error("failed to open DB replica connection", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	setPool(db)
+
+	return db, nil
+}
+
+// setPool устанавливает параметры пула соединений с БД.
+func setPool(db *sql.DB) {
+	db.SetMaxIdleConns(5)
+	db.SetMaxOpenConns(5)
+	db.SetConnMaxIdleTime(1 * time.Second)
+	db.SetConnMaxLifetime(30 * time.Second)
+}
+
 // Migrate выполняет миграции базы данных.
 func Migrate(ctx context.Context, databaseDSN string) {
 	// Тут открываем своё соединение
@@ -24,31 +24,81 @@ func New(db DBTX) *Queries {
 func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	q := Queries{db: db}
 	var err error
+	if q.countUserURLsStmt, err = db.PrepareContext(ctx, countUserURLs); err != nil {
+		return nil, fmt.Errorf("error preparing query CountUserURLs: %w", err)
+	}
+	if q.createUserStmt, err = db.PrepareContext(ctx, createUser); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateUser: %w", err)
+	}
+	if q.deleteAllURLsStmt, err = db.PrepareContext(ctx, deleteAllURLs); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteAllURLs: %w", err)
+	}
 	if q.deleteURLStmt, err = db.PrepareContext(ctx, deleteURL); err != nil {
 		return nil, fmt.Errorf("error preparing query DeleteURL: %w", err)
 	}
+	if q.deleteUserQuotaStmt, err = db.PrepareContext(ctx, deleteUserQuota); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteUserQuota: %w", err)
+	}
 	if q.getURLStmt, err = db.PrepareContext(ctx, getURL); err != nil {
 		return nil, fmt.Errorf("error preparing query GetURL: %w", err)
 	}
 	if q.getURLByLongStmt, err = db.PrepareContext(ctx, getURLByLong); err != nil {
 		return nil, fmt.Errorf("error preparing query GetURLByLong: %w", err)
 	}
+	if q.getUserStmt, err = db.PrepareContext(ctx, getUser); err != nil {
+		return nil, fmt.Errorf("error preparing query GetUser: %w", err)
+	}
+	if q.getUserByEmailStmt, err = db.PrepareContext(ctx, getUserByEmail); err != nil {
+		return nil, fmt.Errorf("error preparing query GetUserByEmail: %w", err)
+	}
+	if q.getUserQuotaStmt, err = db.PrepareContext(ctx, getUserQuota); err != nil {
+		return nil, fmt.Errorf("error preparing query GetUserQuota: %w", err)
+	}
 	if q.getUserURLsStmt, err = db.PrepareContext(ctx, getUserURLs); err != nil {
 		return nil, fmt.Errorf("error preparing query GetUserURLs: %w", err)
 	}
+	if q.scanURLsStmt, err = db.PrepareContext(ctx, scanURLs); err != nil {
+		return nil, fmt.Errorf("error preparing query ScanURLs: %w", err)
+	}
 	if q.storeURLStmt, err = db.PrepareContext(ctx, storeURL); err != nil {
 		return nil, fmt.Errorf("error preparing query StoreURL: %w", err)
 	}
+	if q.transferUserURLsStmt, err = db.PrepareContext(ctx, transferUserURLs); err != nil {
+		return nil, fmt.Errorf("error preparing query TransferUserURLs: %w", err)
+	}
+	if q.upsertUserQuotaStmt, err = db.PrepareContext(ctx, upsertUserQuota); err != nil {
+		return nil, fmt.Errorf("error preparing query UpsertUserQuota: %w", err)
+	}
 	return &q, nil
 }
 
 func (q *Queries) Close() error {
 	var err error
+	if q.countUserURLsStmt != nil {
+		if cerr := q.countUserURLsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing countUserURLsStmt: %w", cerr)
+		}
+	}
+	if q.createUserStmt != nil {
+		if cerr := q.createUserStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createUserStmt: %w", cerr)
+		}
+	}
+	if q.deleteAllURLsStmt != nil {
+		if cerr := q.deleteAllURLsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteAllURLsStmt: %w", cerr)
+		}
+	}
 	if q.deleteURLStmt != nil {
 		if cerr := q.deleteURLStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing deleteURLStmt: %w", cerr)
 		}
 	}
+	if q.deleteUserQuotaStmt != nil {
+		if cerr := q.deleteUserQuotaStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteUserQuotaStmt: %w", cerr)
+		}
+	}
 	if q.getURLStmt != nil {
 		if cerr := q.getURLStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getURLStmt: %w", cerr)
@@ -59,16 +109,46 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing getURLByLongStmt: %w", cerr)
 		}
 	}
+	if q.getUserStmt != nil {
+		if cerr := q.getUserStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getUserStmt: %w", cerr)
+		}
+	}
+	if q.getUserByEmailStmt != nil {
+		if cerr := q.getUserByEmailStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getUserByEmailStmt: %w", cerr)
+		}
+	}
+	if q.getUserQuotaStmt != nil {
+		if cerr := q.getUserQuotaStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getUserQuotaStmt: %w", cerr)
+		}
+	}
 	if q.getUserURLsStmt != nil {
 		if cerr := q.getUserURLsStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getUserURLsStmt: %w", cerr)
 		}
 	}
+	if q.scanURLsStmt != nil {
+		if cerr := q.scanURLsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing scanURLsStmt: %w", cerr)
+		}
+	}
 	if q.storeURLStmt != nil {
 		if cerr := q.storeURLStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing storeURLStmt: %w", cerr)
 		}
 	}
+	if q.transferUserURLsStmt != nil {
+		if cerr := q.transferUserURLsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing transferUserURLsStmt: %w", cerr)
+		}
+	}
+	if q.upsertUserQuotaStmt != nil {
+		if cerr := q.upsertUserQuotaStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing upsertUserQuotaStmt: %w", cerr)
+		}
+	}
 	return err
 }
 
@@ -106,23 +186,43 @@ func (q *Queries) queryRow(ctx context.Context, stmt *sql.Stmt, query string, ar
 }
 
 type Queries struct {
-	db               DBTX
-	tx               *sql.Tx
-	deleteURLStmt    *sql.Stmt
-	getURLStmt       *sql.Stmt
-	getURLByLongStmt *sql.Stmt
-	getUserURLsStmt  *sql.Stmt
-	storeURLStmt     *sql.Stmt
+	db                   DBTX
+	tx                   *sql.Tx
+	countUserURLsStmt    *sql.Stmt
+	createUserStmt       *sql.Stmt
+	deleteAllURLsStmt    *sql.Stmt
+	deleteURLStmt        *sql.Stmt
+	deleteUserQuotaStmt  *sql.Stmt
+	getURLStmt           *sql.Stmt
+	getURLByLongStmt     *sql.Stmt
+	getUserStmt          *sql.Stmt
+	getUserByEmailStmt   *sql.Stmt
+	getUserQuotaStmt     *sql.Stmt
+	getUserURLsStmt      *sql.Stmt
+	scanURLsStmt         *sql.Stmt
+	storeURLStmt         *sql.Stmt
+	transferUserURLsStmt *sql.Stmt
+	upsertUserQuotaStmt  *sql.Stmt
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db:               tx,
-		tx:               tx,
-		deleteURLStmt:    q.deleteURLStmt,
-		getURLStmt:       q.getURLStmt,
-		getURLByLongStmt: q.getURLByLongStmt,
-		getUserURLsStmt:  q.getUserURLsStmt,
-		storeURLStmt:     q.storeURLStmt,
+		db:                   tx,
+		tx:                   tx,
+		countUserURLsStmt:    q.countUserURLsStmt,
+		createUserStmt:       q.createUserStmt,
+		deleteAllURLsStmt:    q.deleteAllURLsStmt,
+		deleteURLStmt:        q.deleteURLStmt,
+		deleteUserQuotaStmt:  q.deleteUserQuotaStmt,
+		getURLStmt:           q.getURLStmt,
+		getURLByLongStmt:     q.getURLByLongStmt,
+		getUserStmt:          q.getUserStmt,
+		getUserByEmailStmt:   q.getUserByEmailStmt,
+		getUserQuotaStmt:     q.getUserQuotaStmt,
+		getUserURLsStmt:      q.getUserURLsStmt,
+		scanURLsStmt:         q.scanURLsStmt,
+		storeURLStmt:         q.storeURLStmt,
+		transferUserURLsStmt: q.transferUserURLsStmt,
+		upsertUserQuotaStmt:  q.upsertUserQuotaStmt,
 	}
 }
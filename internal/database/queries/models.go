@@ -19,3 +19,17 @@ type Url struct {
 	Uid       uuid.UUID
 	IsDeleted bool
 }
+
+type User struct {
+	ID           uuid.UUID
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+type UserQuota struct {
+	Uid          uuid.UUID
+	MaxLinks     int32
+	MaxBatchSize int32
+	MaxUrlLength int32
+}
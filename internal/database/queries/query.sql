@@ -10,8 +10,8 @@ WHERE long_url = $1
   AND is_deleted = FALSE LIMIT 1;
 
 -- name: StoreURL :one
-INSERT INTO urls (long_url, base_url, url_id, uid)
-VALUES ($1, $2, $3, $4) RETURNING *;
+INSERT INTO urls (long_url, base_url, url_id, uid, is_deleted)
+VALUES ($1, $2, $3, $4, $5) RETURNING *;
 
 -- name: GetUserURLs :many
 SELECT *
@@ -19,8 +19,63 @@ FROM urls
 WHERE uid = $1
   AND is_deleted = FALSE;
 
+-- name: CountUserURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE uid = $1
+  AND is_deleted = FALSE;
+
 -- name: DeleteURL :exec
 UPDATE urls
 SET is_deleted = TRUE
 WHERE url_id = $1
-  AND uid = $2;
\ No newline at end of file
+  AND uid = $2;
+
+-- name: ScanURLs :many
+SELECT *
+FROM urls
+WHERE url_id > $1
+ORDER BY url_id LIMIT $2;
+
+-- name: TransferUserURLs :exec
+UPDATE urls
+SET uid = sqlc.arg(new_uid)
+WHERE uid = sqlc.arg(old_uid)
+  AND is_deleted = FALSE
+  AND NOT EXISTS (SELECT 1 FROM users WHERE id = sqlc.arg(old_uid));
+
+-- name: DeleteAllURLs :exec
+DELETE
+FROM urls;
+
+-- name: GetUserQuota :one
+SELECT *
+FROM user_quotas
+WHERE uid = $1 LIMIT 1;
+
+-- name: UpsertUserQuota :exec
+INSERT INTO user_quotas (uid, max_links, max_batch_size, max_url_length)
+VALUES ($1, $2, $3, $4) ON CONFLICT (uid) DO
+UPDATE
+SET max_links      = EXCLUDED.max_links,
+    max_batch_size = EXCLUDED.max_batch_size,
+    max_url_length = EXCLUDED.max_url_length;
+
+-- name: DeleteUserQuota :exec
+DELETE
+FROM user_quotas
+WHERE uid = $1;
+
+-- name: CreateUser :exec
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetUser :one
+SELECT *
+FROM users
+WHERE id = $1 LIMIT 1;
+
+-- name: GetUserByEmail :one
+SELECT *
+FROM users
+WHERE email = $1 LIMIT 1;
\ No newline at end of file
@@ -7,10 +7,57 @@ package queries
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countUserURLs = `-- name: CountUserURLs :one
+SELECT COUNT(*)
+FROM urls
+WHERE uid = $1
+  AND is_deleted = FALSE
+`
+
+func (q *Queries) CountUserURLs(ctx context.Context, uid uuid.UUID) (int64, error) {
+	row := q.queryRow(ctx, q.countUserURLsStmt, countUserURLs, uid)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createUser = `-- name: CreateUser :exec
+INSERT INTO users (id, email, password_hash, created_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateUserParams struct {
+	ID           uuid.UUID
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) error {
+	_, err := q.exec(ctx, q.createUserStmt, createUser,
+		arg.ID,
+		arg.Email,
+		arg.PasswordHash,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const deleteAllURLs = `-- name: DeleteAllURLs :exec
+DELETE
+FROM urls
+`
+
+func (q *Queries) DeleteAllURLs(ctx context.Context) error {
+	_, err := q.exec(ctx, q.deleteAllURLsStmt, deleteAllURLs)
+	return err
+}
+
 const deleteURL = `-- name: DeleteURL :exec
 UPDATE urls
 SET is_deleted = TRUE
@@ -28,6 +75,17 @@ func (q *Queries) DeleteURL(ctx context.Context, arg DeleteURLParams) error {
 	return err
 }
 
+const deleteUserQuota = `-- name: DeleteUserQuota :exec
+DELETE
+FROM user_quotas
+WHERE uid = $1
+`
+
+func (q *Queries) DeleteUserQuota(ctx context.Context, uid uuid.UUID) error {
+	_, err := q.exec(ctx, q.deleteUserQuotaStmt, deleteUserQuota, uid)
+	return err
+}
+
 const getURL = `-- name: GetURL :one
 SELECT id, long_url, base_url, url_id, created_at, uid, is_deleted
 FROM urls
@@ -71,6 +129,60 @@ func (q *Queries) GetURLByLong(ctx context.Context, longUrl string) (Url, error)
 	return i, err
 }
 
+const getUser = `-- name: GetUser :one
+SELECT id, email, password_hash, created_at
+FROM users
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.queryRow(ctx, q.getUserStmt, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, email, password_hash, created_at
+FROM users
+WHERE email = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.queryRow(ctx, q.getUserByEmailStmt, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUserQuota = `-- name: GetUserQuota :one
+SELECT uid, max_links, max_batch_size, max_url_length
+FROM user_quotas
+WHERE uid = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserQuota(ctx context.Context, uid uuid.UUID) (UserQuota, error) {
+	row := q.queryRow(ctx, q.getUserQuotaStmt, getUserQuota, uid)
+	var i UserQuota
+	err := row.Scan(
+		&i.Uid,
+		&i.MaxLinks,
+		&i.MaxBatchSize,
+		&i.MaxUrlLength,
+	)
+	return i, err
+}
+
 const getUserURLs = `-- name: GetUserURLs :many
 SELECT id, long_url, base_url, url_id, created_at, uid, is_deleted
 FROM urls
@@ -109,16 +221,60 @@ func (q *Queries) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]Url, error)
 	return items, nil
 }
 
+const scanURLs = `-- name: ScanURLs :many
+SELECT id, long_url, base_url, url_id, created_at, uid, is_deleted
+FROM urls
+WHERE url_id > $1
+ORDER BY url_id LIMIT $2
+`
+
+type ScanURLsParams struct {
+	UrlID string
+	Limit int32
+}
+
+func (q *Queries) ScanURLs(ctx context.Context, arg ScanURLsParams) ([]Url, error) {
+	rows, err := q.query(ctx, q.scanURLsStmt, scanURLs, arg.UrlID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Url
+	for rows.Next() {
+		var i Url
+		if err := rows.Scan(
+			&i.ID,
+			&i.LongUrl,
+			&i.BaseUrl,
+			&i.UrlID,
+			&i.CreatedAt,
+			&i.Uid,
+			&i.IsDeleted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const storeURL = `-- name: StoreURL :one
-INSERT INTO urls (long_url, base_url, url_id, uid)
-VALUES ($1, $2, $3, $4) RETURNING id, long_url, base_url, url_id, created_at, uid, is_deleted
+INSERT INTO urls (long_url, base_url, url_id, uid, is_deleted)
+VALUES ($1, $2, $3, $4, $5) RETURNING id, long_url, base_url, url_id, created_at, uid, is_deleted
 `
 
 type StoreURLParams struct {
-	LongUrl string
-	BaseUrl string
-	UrlID   string
-	Uid     uuid.UUID
+	LongUrl   string
+	BaseUrl   string
+	UrlID     string
+	Uid       uuid.UUID
+	IsDeleted bool
 }
 
 func (q *Queries) StoreURL(ctx context.Context, arg StoreURLParams) (Url, error) {
@@ -127,6 +283,7 @@ func (q *Queries) StoreURL(ctx context.Context, arg StoreURLParams) (Url, error)
 		arg.BaseUrl,
 		arg.UrlID,
 		arg.Uid,
+		arg.IsDeleted,
 	)
 	var i Url
 	err := row.Scan(
@@ -140,3 +297,47 @@ func (q *Queries) StoreURL(ctx context.Context, arg StoreURLParams) (Url, error)
 	)
 	return i, err
 }
+
+const transferUserURLs = `-- name: TransferUserURLs :exec
+UPDATE urls
+SET uid = $1
+WHERE uid = $2
+  AND is_deleted = FALSE
+  AND NOT EXISTS (SELECT 1 FROM users WHERE id = $2)
+`
+
+type TransferUserURLsParams struct {
+	NewUid uuid.UUID
+	OldUid uuid.UUID
+}
+
+func (q *Queries) TransferUserURLs(ctx context.Context, arg TransferUserURLsParams) error {
+	_, err := q.exec(ctx, q.transferUserURLsStmt, transferUserURLs, arg.NewUid, arg.OldUid)
+	return err
+}
+
+const upsertUserQuota = `-- name: UpsertUserQuota :exec
+INSERT INTO user_quotas (uid, max_links, max_batch_size, max_url_length)
+VALUES ($1, $2, $3, $4) ON CONFLICT (uid) DO
+UPDATE
+SET max_links      = EXCLUDED.max_links,
+    max_batch_size = EXCLUDED.max_batch_size,
+    max_url_length = EXCLUDED.max_url_length
+`
+
+type UpsertUserQuotaParams struct {
+	Uid          uuid.UUID
+	MaxLinks     int32
+	MaxBatchSize int32
+	MaxUrlLength int32
+}
+
+func (q *Queries) UpsertUserQuota(ctx context.Context, arg UpsertUserQuotaParams) error {
+	_, err := q.exec(ctx, q.upsertUserQuotaStmt, upsertUserQuota,
+		arg.Uid,
+		arg.MaxLinks,
+		arg.MaxBatchSize,
+		arg.MaxUrlLength,
+	)
+	return err
+}
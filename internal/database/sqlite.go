@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"log/slog"
+
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+
+	"github.com/RomanAgaltsev/urlcut/migrations"
+)
+
+// sqlitePragmas содержит параметры соединения с БД SQLite:
+//   - журнал в режиме WAL - читатели не блокируют писателя
+//   - ожидание снятия блокировки вместо немедленной ошибки SQLITE_BUSY
+//   - транзакции сразу берут блокировку на запись
+const sqlitePragmas = "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+
+// NewSQLiteConnection создает новое соединение с базой данных SQLite.
+// Выполняются следующие действия:
+//   - открывается соединение с БД в режиме WAL
+//   - выполняется пинг БД
+//   - запускаются миграции
+func NewSQLiteConnection(ctx context.Context, path string) (*sql.DB, error) {
+	// Открываем соединение
+	db, err := sql.Open("sqlite", path+sqlitePragmas)
+	if err != nil {
+		slog.Error("failed to open SQLite DB", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	// Делаем пинг
+	if err = db.PingContext(ctx); err != nil {
+		slog.Error("failed to ping SQLite DB", slog.String("error", err.Error()))
+		_ = db.Close()
+		return nil, err
+	}
+
+	// Запускаем миграции
+	if err = MigrateSQLite(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// MigrateSQLite выполняет миграции базы данных SQLite.
+func MigrateSQLite(ctx context.Context, db *sql.DB) error {
+	// Миграции SQLite лежат в отдельной папке
+	fsys, err := fs.Sub(migrations.SQLiteMigrations, "sqlite")
+	if err != nil {
+		return err
+	}
+
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, fsys)
+	if err != nil {
+		slog.Error("goose: failed to create SQLite provider", slog.String("error", err.Error()))
+		return err
+	}
+
+	// Накатываем миграции
+	if _, err = provider.Up(ctx); err != nil {
+		slog.Error("goose: failed to run SQLite migrations", slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
@@ -26,6 +26,25 @@ type Service interface {
 	// DeleteUserURLs удаляет URL пользователя по переданным идентификаторам сокращенных URL.
 	DeleteUserURLs(ctx context.Context, uid uuid.UUID, shortURLs *model.ShortURLsDTO) error
 
+	// UserQuota возвращает переопределенные и действующие квоты пользователя.
+	UserQuota(ctx context.Context, uid uuid.UUID) (*model.UserQuotaDTO, error)
+
+	// SetUserQuota переопределяет квоты пользователя.
+	SetUserQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error
+
+	// DeleteUserQuota удаляет переопределение квот пользователя - начинают действовать глобальные квоты.
+	DeleteUserQuota(ctx context.Context, uid uuid.UUID) error
+
+	// Register регистрирует пользователя с переданными адресом почты и паролем.
+	// URL, сокращенные под переданным анонимным идентификатором, переходят зарегистрированному пользователю.
+	Register(ctx context.Context, email, password string, uid uuid.UUID) (*model.User, error)
+
+	// Login возвращает зарегистрированного пользователя по адресу почты и паролю.
+	Login(ctx context.Context, email, password string) (*model.User, error)
+
+	// Health возвращает состояние зависимостей сервиса по их именам.
+	Health(ctx context.Context) map[string]model.Health
+
 	// Close закрывает сервис. Используется в текущей реализации graceful shutdown.
 	Close() error
 }
@@ -33,6 +52,7 @@ type Service interface {
 // Repository интерфейс хранилища сокращенных URL.
 type Repository interface {
 	// Store сохраняет переданные URL в базе данных.
+	// URL с пометкой удаления сохраняются удаленными и не конфликтуют с неудаленными.
 	Store(ctx context.Context, urls []*model.URL) (*model.URL, error)
 
 	// Get возвращает из базы данных URL по переданному идентификатору сокращенного URL.
@@ -44,6 +64,68 @@ type Repository interface {
 	// DeleteURLs удаляет в БД переданные URL.
 	DeleteURLs(ctx context.Context, urls []*model.URL) error
 
+	// ScanURLs возвращает не более limit URL, включая удаленные, с идентификаторами больше afterID
+	// в порядке возрастания идентификаторов. Используется для постраничного обхода всего хранилища.
+	ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error)
+
+	// Health проверяет уже открытые соединения хранилища и возвращает состояние каждой его зависимости
+	// по имени, например "postgres" или "redis_cache".
+	Health(ctx context.Context) map[string]model.Health
+
 	// Close - закрывает соединения с БД. Используется в текущей реализации graceful shutdown.
 	Close() error
 }
+
+// Exporter необязательный интерфейс хранилища, умеющего выгружать согласованный снимок всех URL.
+type Exporter interface {
+	// ExportURLs вызывает переданную функцию для каждого URL, включая удаленные, на один момент времени.
+	ExportURLs(ctx context.Context, fn func(url *model.URL) error) error
+}
+
+// Truncater необязательный интерфейс хранилища, умеющего удалять все URL.
+type Truncater interface {
+	// Truncate безвозвратно удаляет из хранилища все URL.
+	Truncate(ctx context.Context) error
+}
+
+// Replacer необязательный интерфейс хранилища, умеющего атомарно заменять все URL.
+type Replacer interface {
+	// ReplaceURLs заменяет все URL хранилища URL, включая удаленные, которые функция load
+	// передает пакетами в функцию store, - так замена не требует держать все URL в памяти.
+	// Функция store не сохраняет переданный слайс. При ошибке в хранилище остаются прежние URL.
+	ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error
+}
+
+// QuotaStorer необязательный интерфейс хранилища, умеющего хранить переопределенные квоты пользователей.
+type QuotaStorer interface {
+	// GetQuota возвращает переопределенные квоты пользователя.
+	GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error)
+
+	// SetQuota сохраняет переопределенные квоты пользователя.
+	SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error
+
+	// DeleteQuota удаляет переопределенные квоты пользователя.
+	DeleteQuota(ctx context.Context, uid uuid.UUID) error
+}
+
+// LimitedStorer необязательный интерфейс хранилища, умеющего сохранять URL с ограничением количества URL пользователя.
+type LimitedStorer interface {
+	// StoreLimited сохраняет URL пользователя uid так же, как Store, если после сохранения у пользователя
+	// будет не больше limit неудаленных URL. Иначе не сохраняется ни один URL и возвращается *model.QuotaError.
+	// Квота проверяется до конфликтов, подсчет и сохранение атомарны относительно других вызовов StoreLimited.
+	StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error)
+}
+
+// UserStorer необязательный интерфейс хранилища, умеющего хранить зарегистрированных пользователей.
+type UserStorer interface {
+	// CreateUser сохраняет нового пользователя и в том же изменении передает ему неудаленные URL
+	// анонимного пользователя anonymous. URL зарегистрированного пользователя не передаются.
+	// Адрес почты и идентификатор пользователя уникальны.
+	CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error
+
+	// GetUser возвращает пользователя по идентификатору.
+	GetUser(ctx context.Context, id uuid.UUID) (*model.User, error)
+
+	// GetUserByEmail возвращает пользователя по адресу электронной почты.
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+}
@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/requestid"
+)
+
+// Ключи атрибутов записей, добавляемых из контекста.
+const (
+	// RequestIDKey содержит ключ идентификатора запроса.
+	RequestIDKey = "request_id"
+
+	// UserIDKey содержит ключ идентификатора пользователя.
+	UserIDKey = "uid"
+)
+
+// ContextHandler дополняет записи лога идентификаторами запроса и пользователя из контекста.
+// Записи, созданные без контекста или вне запроса, передаются без изменений.
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler создает обработчик, передающий дополненные записи переданному обработчику.
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+// Handle добавляет в запись атрибуты из контекста и передает ее основному обработчику.
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	if uid := ctx.Value(auth.UserIDClaimName); uid != nil {
+		record.AddAttrs(slog.String(UserIDKey, fmt.Sprint(uid)))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs возвращает обработчик с дополнительными атрибутами, сохраняя атрибуты из контекста.
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup возвращает обработчик с группой атрибутов, сохраняя атрибуты из контекста.
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
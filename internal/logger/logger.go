@@ -2,15 +2,35 @@
 package logger
 
 import (
+	"fmt"
 	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/exp/zapslog"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
 )
 
-// Initialize инициализирует логер slog+zap.
-func Initialize() error {
+// ErrUnknownFormat ошибка неизвестного формата записей лога.
+var ErrUnknownFormat = fmt.Errorf("unknown log format")
+
+// level - уровень логирования, который можно изменить во время работы приложения.
+var level = zap.NewAtomicLevel()
+
+// Initialize инициализирует логер slog+zap с уровнем, форматом, выводом и сэмплированием из конфигурации.
+// При заданном файле лога файл ротируется по размеру, а ротированные файлы удаляются по сроку хранения.
+func Initialize(cfg *config.Config) error {
+	lvl, err := zapcore.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:        "timestamp",
 		LevelKey:       "level",
@@ -24,22 +44,53 @@ func Initialize() error {
 		EncodeDuration: zapcore.StringDurationEncoder,
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 	}
-	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
-		Development:      true,
-		Encoding:         "console",
-		EncoderConfig:    encoderConfig,
-		OutputPaths:      []string{"stdout"},
-		ErrorOutputPaths: []string{"stderr"},
+
+	var encoder zapcore.Encoder
+	switch cfg.LogFormat {
+	case "", config.LogFormatConsole:
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case config.LogFormatJSON:
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownFormat, cfg.LogFormat)
 	}
 
-	logger, err := config.Build()
-	if err != nil {
-		return err
+	// По умолчанию пишем в stdout, при заданном файле - в файл с ротацией
+	output := zapcore.Lock(os.Stdout)
+	if cfg.LogFile != "" {
+		output = zapcore.AddSync(&lumberjack.Logger{
+			Filename: cfg.LogFile,
+			MaxSize:  cfg.LogMaxSize,
+			MaxAge:   days(cfg.LogMaxAge.Duration),
+		})
 	}
-	defer func() { _ = logger.Sync() }()
 
-	slog.SetDefault(slog.New(zapslog.NewHandler(logger.Core(), nil)))
+	level.SetLevel(lvl)
+	core := zapcore.NewCore(encoder, output, level)
+
+	// Одинаковые записи сверх заданного количества в секунду сэмплируются
+	if cfg.LogSamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.LogSamplingInitial, cfg.LogSamplingThereafter)
+	}
+
+	logger := zap.New(core, zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+
+	// Записи дополняются идентификаторами запроса и пользователя из контекста
+	slog.SetDefault(slog.New(NewContextHandler(zapslog.NewHandler(logger.Core(), nil))))
 
 	return nil
 }
+
+// LevelHandler возвращает обработчик, который отдает текущий уровень логирования по GET
+// и изменяет его по PUT с телом вида {"level":"debug"}.
+func LevelHandler() http.Handler {
+	return level
+}
+
+// days переводит срок хранения в целое число дней с округлением вверх, как его принимает ротация.
+func days(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Hours() / 24))
+}
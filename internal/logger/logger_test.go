@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/auth"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/requestid"
+)
+
+func TestInitialize(t *testing.T) {
+	prevLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	assert.ErrorIs(t, Initialize(&config.Config{LogFormat: "xml"}), ErrUnknownFormat)
+	assert.Error(t, Initialize(&config.Config{LogLevel: "verbose"}))
+
+	logFile := filepath.Join(t.TempDir(), "urlcut.log")
+	require.NoError(t, Initialize(&config.Config{
+		LogLevel:   "warn",
+		LogFormat:  config.LogFormatJSON,
+		LogFile:    logFile,
+		LogMaxSize: 1,
+	}))
+
+	ctx := requestid.NewContext(context.Background(), "req-42")
+	ctx = context.WithValue(ctx, auth.UserIDClaimName, "7657a298-1632-4315-b77b-57d0a1fa1eb4")
+
+	slog.InfoContext(ctx, "below level")
+	slog.WarnContext(ctx, "written")
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 1)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "written", record["message"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "req-42", record[RequestIDKey])
+	assert.Equal(t, "7657a298-1632-4315-b77b-57d0a1fa1eb4", record[UserIDKey])
+}
@@ -0,0 +1,164 @@
+// Пакет metrics содержит метрики сервиса сокращателя ссылок в формате Prometheus.
+//
+// Метрики регистрируются в реестре Registry при загрузке пакета и отдаются обработчиком Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace - общий префикс имен метрик сервиса.
+const namespace = "urlcut"
+
+// Registry - реестр метрик сервиса, включая метрики процесса и рантайма Go.
+var Registry = prometheus.NewRegistry()
+
+// Метрики HTTP запросов.
+var (
+	// HTTPRequests - количество HTTP запросов по методу, шаблону маршрута и статусу ответа.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration - длительность обработки HTTP запросов по методу и шаблону маршрута.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// HTTPRateLimited - количество запросов, отклоненных ограничением частоты, по классу маршрутов.
+	HTTPRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Number of HTTP requests rejected by rate limiting by route class.",
+	}, []string{"class"})
+)
+
+// Метрики сервиса сокращателя.
+var (
+	// URLsCreated - количество созданных сокращенных ссылок.
+	URLsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "urls_created_total",
+		Help:      "Number of shortened URLs created.",
+	})
+
+	// URLsExpanded - количество найденных по идентификатору ссылок.
+	URLsExpanded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "urls_expanded_total",
+		Help:      "Number of shortened URLs expanded.",
+	})
+
+	// URLsDeleted - количество ссылок, переданных хранилищу на пометку удаления.
+	URLsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "urls_deleted_total",
+		Help:      "Number of URLs flushed to storage for deletion.",
+	})
+
+	// URLsDeleteDropped - количество ссылок, пометку удаления которых не удалось сохранить после всех попыток.
+	URLsDeleteDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "urls_delete_dropped_total",
+		Help:      "Number of queued URL deletions dropped after failed flush attempts.",
+	})
+
+	// Conflicts - количество попыток сократить уже сокращенный оригинальный URL.
+	Conflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "url_conflicts_total",
+		Help:      "Number of attempts to shorten an already shortened URL.",
+	})
+
+	// DeleteQueueDepth - количество URL, ожидающих пометки удаления.
+	DeleteQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delete_queue_depth",
+		Help:      "Number of URLs waiting to be flushed for deletion.",
+	})
+
+	// DeleteFlushDuration - длительность пометки удаления накопленных URL в хранилище.
+	DeleteFlushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delete_flush_duration_seconds",
+		Help:      "Latency of flushing queued URL deletions to storage.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Метрики хранилища.
+var (
+	// RepositoryDuration - длительность операций хранилища по типу хранилища и операции.
+	RepositoryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "repository",
+		Name:      "operation_duration_seconds",
+		Help:      "Repository operation latency by backend and operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"backend", "operation"})
+
+	// RepositoryErrors - количество ошибок операций хранилища по типу хранилища и операции.
+	// Отсутствие URL и конфликт данных ошибками хранилища не считаются.
+	RepositoryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "repository",
+		Name:      "errors_total",
+		Help:      "Number of failed repository operations by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	// BloomLookups - количество запросов URL через фильтр Блума по результату:
+	// rejected - отсеян фильтром, found - найден в хранилище, false_positive - пропущен, но не найден.
+	// Наблюдаемая доля ложных срабатываний - false_positive / (false_positive + rejected).
+	BloomLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bloom",
+		Name:      "lookups_total",
+		Help:      "Number of URL lookups through the Bloom filter by result.",
+	}, []string{"result"})
+
+	// BloomEstimatedFalsePositiveRate - расчетная доля ложных срабатываний фильтра Блума при текущем заполнении.
+	BloomEstimatedFalsePositiveRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "bloom",
+		Name:      "estimated_false_positive_rate",
+		Help:      "Estimated false positive rate of the Bloom filter at its current fill.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		HTTPRateLimited,
+		URLsCreated,
+		URLsExpanded,
+		URLsDeleted,
+		URLsDeleteDropped,
+		Conflicts,
+		DeleteQueueDepth,
+		DeleteFlushDuration,
+		RepositoryDuration,
+		RepositoryErrors,
+		BloomLookups,
+		BloomEstimatedFalsePositiveRate,
+	)
+}
+
+// Handler возвращает обработчик, отдающий метрики в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,419 @@
+// Пакет migrator переносит данные URL из одного хранилища в другое.
+// Перенос работает для любой пары хранилищ, реализующих interfaces.Repository,
+// идемпотентен и может быть продолжен с контрольной точки после прерывания.
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// DefaultBatchSize - размер страницы URL, переносимой за один шаг, по умолчанию.
+const DefaultBatchSize = 500
+
+// Переменные ошибок.
+var (
+	// ErrVerificationFailed ошибка проверки перенесенных данных.
+	ErrVerificationFailed = fmt.Errorf("verification failed")
+
+	// ErrCheckpointMismatch ошибка контрольной точки, сохраненной при переносе между другими хранилищами.
+	ErrCheckpointMismatch = fmt.Errorf("checkpoint belongs to another migration")
+)
+
+// Options содержит параметры переноса данных.
+type Options struct {
+	BatchSize      int         // Размер страницы URL, переносимой за один шаг
+	CheckpointPath string      // Путь к файлу контрольной точки, пустой - перенос без контрольной точки
+	Source         string      // Строка соединения исходного хранилища, защищает контрольную точку
+	Target         string      // Строка соединения целевого хранилища, защищает контрольную точку
+	Progress       func(Stats) // Вызывается после каждого шага переноса, может быть nil
+}
+
+// Stats содержит счетчики переноса данных.
+type Stats struct {
+	Scanned   int    `json:"scanned"`   // Прочитано URL из исходного хранилища
+	Stored    int    `json:"stored"`    // Сохранено URL в целевое хранилище
+	Existing  int    `json:"existing"`  // URL, уже присутствовавших в целевом хранилище
+	Deleted   int    `json:"deleted"`   // URL, помеченных удаленными в целевом хранилище
+	Conflicts int    `json:"conflicts"` // URL, оригинальный адрес которых уже сокращен в целевом хранилище под другим идентификатором
+	LastID    string `json:"last_id"`   // Идентификатор последнего перенесенного URL
+}
+
+// checkpoint - содержимое файла контрольной точки.
+type checkpoint struct {
+	Pair  string `json:"pair"`  // Хэш строк соединения исходного и целевого хранилищ
+	Stats Stats  `json:"stats"` // Счетчики переноса
+}
+
+// Report содержит результат проверки перенесенных данных.
+type Report struct {
+	SourceCount    int    // Количество URL в исходном хранилище
+	SourceChecksum string // Контрольная сумма URL исходного хранилища
+	TargetCount    int    // Количество URL в целевом хранилище
+	TargetChecksum string // Контрольная сумма URL целевого хранилища
+	Missing        int    // URL исходного хранилища, отсутствующие в целевом
+	Mismatched     int    // URL, данные которых в хранилищах различаются
+}
+
+// OK сообщает, совпадают ли данные исходного и целевого хранилищ.
+func (r Report) OK() bool {
+	return r.Missing == 0 && r.Mismatched == 0 &&
+		r.SourceCount == r.TargetCount && r.SourceChecksum == r.TargetChecksum
+}
+
+// Migrator переносит URL из исходного хранилища в целевое.
+type Migrator struct {
+	src  interfaces.Repository // Исходное хранилище
+	dst  interfaces.Repository // Целевое хранилище
+	opts Options               // Параметры переноса
+}
+
+// NewMigrator создает новый перенос данных между переданными хранилищами.
+func NewMigrator(src, dst interfaces.Repository, opts Options) *Migrator {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	return &Migrator{
+		src:  src,
+		dst:  dst,
+		opts: opts,
+	}
+}
+
+// Run переносит все URL исходного хранилища, включая удаленные, в целевое хранилище.
+// URL обходятся постранично в порядке возрастания идентификаторов. После каждой страницы
+// сохраняется контрольная точка, с которой перенос продолжится при следующем запуске.
+// Уже перенесенные URL пропускаются, поэтому повторный запуск безопасен.
+// После успешного переноса контрольная точка удаляется.
+func (m *Migrator) Run(ctx context.Context) (Stats, error) {
+	stats, err := m.loadCheckpoint()
+	if err != nil {
+		return stats, err
+	}
+
+	for {
+		// Прерванный перенос продолжится с сохраненной контрольной точки
+		if err = ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		urls, err := m.src.ScanURLs(ctx, stats.LastID, m.opts.BatchSize)
+		if err != nil {
+			return stats, fmt.Errorf("scan source after %q: %w", stats.LastID, err)
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		if err = CopyBatch(ctx, m.dst, urls, &stats); err != nil {
+			return stats, err
+		}
+
+		stats.Scanned += len(urls)
+		stats.LastID = urls[len(urls)-1].ID
+
+		if err = m.saveCheckpoint(stats); err != nil {
+			return stats, err
+		}
+
+		if m.opts.Progress != nil {
+			m.opts.Progress(stats)
+		}
+	}
+
+	return stats, m.removeCheckpoint()
+}
+
+// CopyBatch переносит страницу URL в целевое хранилище и обновляет счетчики переноса.
+// URL, уже присутствующие в целевом хранилище, пропускаются, поэтому повторный перенос безопасен.
+// Неудаленные URL страницы сохраняются раньше удаленных, а удаленные сохраняются по одному
+// сразу с пометкой удаления - удаленный и неудаленный URL с одним оригинальным адресом не конфликтуют.
+func CopyBatch(ctx context.Context, dst interfaces.Repository, urls []*model.URL, stats *Stats) error {
+	// Отбираем URL, которых еще нет в целевом хранилище
+	live := make([]*model.URL, 0, len(urls))
+	deleted := make([]*model.URL, 0)
+	toDelete := make([]*model.URL, 0)
+
+	for _, url := range urls {
+		dstURL, err := dst.Get(ctx, url.ID)
+		switch {
+		case errors.Is(err, repository.ErrIDNotFound) && url.Deleted:
+			deleted = append(deleted, url)
+		case errors.Is(err, repository.ErrIDNotFound):
+			live = append(live, url)
+		case err != nil:
+			return fmt.Errorf("get %q from target: %w", url.ID, err)
+		default:
+			stats.Existing++
+			// Пометка удаления могла не дойти до целевого хранилища при прерванном переносе
+			if url.Deleted && !dstURL.Deleted {
+				toDelete = append(toDelete, url)
+			}
+		}
+	}
+
+	if err := store(ctx, dst, live, stats); err != nil {
+		return err
+	}
+
+	for _, url := range deleted {
+		ok, err := storeOne(ctx, dst, url, stats)
+		if err != nil {
+			return err
+		}
+		if ok {
+			stats.Deleted++
+		}
+	}
+
+	if len(toDelete) > 0 {
+		if err := dst.DeleteURLs(ctx, toDelete); err != nil {
+			return fmt.Errorf("delete URLs in target: %w", err)
+		}
+		stats.Deleted += len(toDelete)
+	}
+
+	return nil
+}
+
+// store сохраняет URL в целевое хранилище. Сначала URL сохраняются одним пакетом.
+// Пакет с конфликтом или повтором оригинального адреса не сохраняется целиком,
+// поэтому в этом случае URL сохраняются по одному, а конфликтные пропускаются.
+func store(ctx context.Context, dst interfaces.Repository, urls []*model.URL, stats *Stats) error {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	_, err := dst.Store(ctx, storable(urls))
+	if err == nil {
+		stats.Stored += len(urls)
+		return nil
+	}
+	if !errors.Is(err, repository.ErrConflict) && !errors.Is(err, repository.ErrDuplicateURL) {
+		return fmt.Errorf("store URLs in target: %w", err)
+	}
+
+	for _, url := range urls {
+		if _, err = storeOne(ctx, dst, url, stats); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeOne сохраняет один URL в целевое хранилище и сообщает, сохранен ли он.
+// Конфликтующий с данными целевого хранилища URL пропускается.
+func storeOne(ctx context.Context, dst interfaces.Repository, url *model.URL, stats *Stats) (bool, error) {
+	conflictURL, err := dst.Store(ctx, storable([]*model.URL{url}))
+	switch {
+	case errors.Is(err, repository.ErrConflict):
+		stats.Conflicts++
+		slog.Warn("URL conflicts with target URL",
+			slog.String("id", url.ID),
+			slog.String("long", url.Long),
+			slog.String("target_id", conflictURL.ID),
+		)
+		return false, nil
+	case errors.Is(err, repository.ErrIntegrity):
+		stats.Conflicts++
+		slog.Warn("URL violates target storage constraint",
+			slog.String("id", url.ID),
+			slog.String("long", url.Long),
+			slog.Bool("deleted", url.Deleted),
+		)
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("store %q in target: %w", url.ID, err)
+	}
+
+	stats.Stored++
+	return true, nil
+}
+
+// Verify сравнивает количество и контрольные суммы URL в исходном и целевом хранилищах
+// и проверяет, что каждый URL исходного хранилища присутствует в целевом с теми же данными.
+func (m *Migrator) Verify(ctx context.Context) (Report, error) {
+	var report Report
+
+	count, checksum, err := m.checksum(ctx, m.src, func(urls []*model.URL) error {
+		for _, url := range urls {
+			dstURL, err := m.dst.Get(ctx, url.ID)
+			if errors.Is(err, repository.ErrIDNotFound) {
+				report.Missing++
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("get %q from target: %w", url.ID, err)
+			}
+			if record(url) != record(dstURL) {
+				report.Mismatched++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("verify source: %w", err)
+	}
+	report.SourceCount, report.SourceChecksum = count, checksum
+
+	count, checksum, err = m.checksum(ctx, m.dst, nil)
+	if err != nil {
+		return report, fmt.Errorf("verify target: %w", err)
+	}
+	report.TargetCount, report.TargetChecksum = count, checksum
+
+	return report, nil
+}
+
+// checksum обходит хранилище и возвращает количество URL и контрольную сумму их данных.
+// Контрольная сумма не зависит от порядка обхода, поэтому суммы разных хранилищ сравнимы.
+// Переданная функция, если она есть, вызывается для каждой страницы URL.
+func (m *Migrator) checksum(ctx context.Context, repo interfaces.Repository, page func([]*model.URL) error) (int, string, error) {
+	var (
+		count  int
+		sum    [sha256.Size]byte
+		lastID string
+	)
+
+	for {
+		urls, err := repo.ScanURLs(ctx, lastID, m.opts.BatchSize)
+		if err != nil {
+			return 0, "", err
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		for _, url := range urls {
+			h := sha256.Sum256([]byte(record(url)))
+			for i := range sum {
+				sum[i] ^= h[i]
+			}
+		}
+
+		if page != nil {
+			if err = page(urls); err != nil {
+				return 0, "", err
+			}
+		}
+
+		count += len(urls)
+		lastID = urls[len(urls)-1].ID
+	}
+
+	return count, hex.EncodeToString(sum[:]), nil
+}
+
+// record возвращает каноническое представление всех переносимых данных URL.
+func record(url *model.URL) string {
+	return url.ID + "\t" + url.Long + "\t" + url.Base + "\t" + url.UID.String() + "\t" + strconv.FormatBool(url.Deleted)
+}
+
+// storable возвращает копии URL для сохранения - без идентификатора корреляции.
+func storable(urls []*model.URL) []*model.URL {
+	result := make([]*model.URL, 0, len(urls))
+	for _, url := range urls {
+		result = append(result, &model.URL{
+			Long:    url.Long,
+			Base:    url.Base,
+			ID:      url.ID,
+			UID:     url.UID,
+			Deleted: url.Deleted,
+		})
+	}
+	return result
+}
+
+// loadCheckpoint загружает счетчики переноса из файла контрольной точки, если он есть.
+func (m *Migrator) loadCheckpoint() (Stats, error) {
+	var stats Stats
+
+	if m.opts.CheckpointPath == "" {
+		return stats, nil
+	}
+
+	data, err := os.ReadFile(m.opts.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err = json.Unmarshal(data, &cp); err != nil {
+		return stats, fmt.Errorf("parse checkpoint %s: %w", m.opts.CheckpointPath, err)
+	}
+
+	// Контрольная точка другой пары хранилищ пропустила бы еще не перенесенные URL
+	if cp.Pair != m.pair() {
+		return stats, fmt.Errorf("%w: %s was written for another source or target, remove it to start over",
+			ErrCheckpointMismatch, m.opts.CheckpointPath)
+	}
+	stats = cp.Stats
+
+	slog.Info("resuming migration from checkpoint",
+		slog.String("path", m.opts.CheckpointPath),
+		slog.String("last_id", stats.LastID),
+	)
+
+	return stats, nil
+}
+
+// saveCheckpoint атомарно записывает счетчики переноса в файл контрольной точки.
+func (m *Migrator) saveCheckpoint(stats Stats) error {
+	if m.opts.CheckpointPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(checkpoint{Pair: m.pair(), Stats: stats})
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(m.opts.CheckpointPath), "."+filepath.Base(m.opts.CheckpointPath)+".tmp")
+	if err = os.WriteFile(tmp, data, 0666); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	if err = os.Rename(tmp, m.opts.CheckpointPath); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// pair возвращает хэш строк соединения исходного и целевого хранилищ.
+// В контрольной точке хранится хэш, а не сами строки - они могут содержать пароли.
+func (m *Migrator) pair() string {
+	sum := sha256.Sum256([]byte(m.opts.Source + "\x00" + m.opts.Target))
+	return hex.EncodeToString(sum[:])
+}
+
+// removeCheckpoint удаляет файл контрольной точки после завершения переноса.
+func (m *Migrator) removeCheckpoint() error {
+	if m.opts.CheckpointPath == "" {
+		return nil
+	}
+
+	err := os.Remove(m.opts.CheckpointPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+func openRepository(t *testing.T, dsn string) interfaces.Repository {
+	repo, err := repository.Open(context.TODO(), dsn, &config.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = repo.Close() })
+	return repo
+}
+
+// fillSource сохраняет в хранилище count URL, каждый третий из которых удален.
+func fillSource(t *testing.T, repo interfaces.Repository, count int) []*model.URL {
+	uid := uuid.New()
+
+	urls := make([]*model.URL, 0, count)
+	for i := 0; i < count; i++ {
+		urls = append(urls, &model.URL{
+			Long: fmt.Sprintf("https://example.com/%d", i),
+			Base: "http://localhost:8080",
+			ID:   fmt.Sprintf("id%04d", i),
+			UID:  uid,
+		})
+	}
+	_, err := repo.Store(context.TODO(), urls)
+	require.NoError(t, err)
+
+	deleted := make([]*model.URL, 0)
+	for i := 0; i < count; i += 3 {
+		deleted = append(deleted, &model.URL{ID: urls[i].ID, UID: uid})
+	}
+	require.NoError(t, repo.DeleteURLs(context.TODO(), deleted))
+
+	return urls
+}
+
+func TestMigrator(t *testing.T) {
+	src := openRepository(t, "file://"+filepath.Join(t.TempDir(), "storage.json"))
+	dst := openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))
+
+	urls := fillSource(t, src, 25)
+
+	progress := 0
+	m := NewMigrator(src, dst, Options{
+		BatchSize:      10,
+		CheckpointPath: filepath.Join(t.TempDir(), "checkpoint"),
+		Progress:       func(Stats) { progress++ },
+	})
+
+	stats, err := m.Run(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 25, Stored: 25, Deleted: 9, LastID: "id0024"}, stats)
+	assert.Equal(t, 3, progress)
+
+	// Все данные перенесены, включая пометки удаления и владельцев
+	for i, url := range urls {
+		dstURL, err := dst.Get(context.TODO(), url.ID)
+		require.NoError(t, err)
+		assert.Equal(t, url.Long, dstURL.Long)
+		assert.Equal(t, url.UID, dstURL.UID)
+		assert.Equal(t, i%3 == 0, dstURL.Deleted)
+	}
+
+	report, err := m.Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+	assert.Equal(t, 25, report.SourceCount)
+
+	// Повторный перенос ничего не меняет
+	stats, err = m.Run(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Scanned: 25, Existing: 25, LastID: "id0024"}, stats)
+}
+
+func TestMigratorResume(t *testing.T) {
+	src := openRepository(t, "memory://")
+	dst := openRepository(t, "memory://")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+	fillSource(t, src, 25)
+
+	// Прерываем перенос после первой страницы
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMigrator(src, dst, Options{
+		BatchSize:      10,
+		CheckpointPath: checkpoint,
+		Source:         "memory://source",
+		Target:         "memory://target",
+		Progress:       func(Stats) { cancel() },
+	})
+	stats, err := m.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 10, stats.Scanned)
+	assert.FileExists(t, checkpoint)
+
+	// Контрольная точка другой пары хранилищ не используется
+	other := NewMigrator(src, dst, Options{BatchSize: 10, CheckpointPath: checkpoint, Source: "memory://source", Target: "memory://other"})
+	_, err = other.Run(context.TODO())
+	require.ErrorIs(t, err, ErrCheckpointMismatch)
+	assert.FileExists(t, checkpoint)
+
+	// Перенос продолжается с контрольной точки
+	m = NewMigrator(src, dst, Options{BatchSize: 10, CheckpointPath: checkpoint, Source: "memory://source", Target: "memory://target"})
+	stats, err = m.Run(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 25, stats.Scanned)
+	assert.Equal(t, 25, stats.Stored)
+	assert.Equal(t, 0, stats.Existing)
+	assert.NoFileExists(t, checkpoint)
+
+	report, err := m.Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+}
+
+func TestMigratorConflicts(t *testing.T) {
+	src := openRepository(t, "memory://")
+	dst := openRepository(t, "memory://")
+
+	urls := fillSource(t, src, 5)
+
+	// Оригинальный адрес уже сокращен в целевом хранилище под другим идентификатором
+	_, err := dst.Store(context.TODO(), []*model.URL{{Long: urls[1].Long, Base: urls[1].Base, ID: "other", UID: uuid.New()}})
+	require.NoError(t, err)
+
+	m := NewMigrator(src, dst, Options{})
+	stats, err := m.Run(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Conflicts)
+	assert.Equal(t, 4, stats.Stored)
+
+	report, err := m.Verify(context.TODO())
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, 5, report.TargetCount)
+}
+
+func TestMigratorReshortened(t *testing.T) {
+	// Страница целиком и страницы по одному URL - удаленный URL идет раньше и позже неудаленного
+	for _, batchSize := range []int{10, 1} {
+		t.Run(fmt.Sprint(batchSize), func(t *testing.T) {
+			src := openRepository(t, "memory://")
+			dst := openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))
+			uid := uuid.New()
+
+			// Удаленный URL и его повторное сокращение с тем же оригинальным адресом
+			for _, pair := range [][2]string{{"a-deleted", "b-again"}, {"d-deleted", "c-again"}} {
+				long := "https://example.com/" + pair[0]
+				deleted := &model.URL{Long: long, Base: "http://localhost:8080", ID: pair[0], UID: uid}
+				_, err := src.Store(context.TODO(), []*model.URL{deleted})
+				require.NoError(t, err)
+				require.NoError(t, src.DeleteURLs(context.TODO(), []*model.URL{deleted}))
+
+				_, err = src.Store(context.TODO(), []*model.URL{{Long: long, Base: "http://localhost:8080", ID: pair[1], UID: uid}})
+				require.NoError(t, err)
+			}
+
+			m := NewMigrator(src, dst, Options{BatchSize: batchSize})
+			stats, err := m.Run(context.TODO())
+			require.NoError(t, err)
+			assert.Equal(t, 4, stats.Stored)
+			assert.Equal(t, 2, stats.Deleted)
+			assert.Zero(t, stats.Conflicts)
+
+			report, err := m.Verify(context.TODO())
+			require.NoError(t, err)
+			assert.True(t, report.OK(), report)
+		})
+	}
+}
@@ -101,6 +101,35 @@ func (mr *MockRepositoryMockRecorder) GetUserURLs(ctx, uid any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserURLs", reflect.TypeOf((*MockRepository)(nil).GetUserURLs), ctx, uid)
 }
 
+// Health mocks base method.
+func (m *MockRepository) Health(ctx context.Context) map[string]model.Health {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health", ctx)
+	ret0, _ := ret[0].(map[string]model.Health)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockRepositoryMockRecorder) Health(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockRepository)(nil).Health), ctx)
+}
+
+// ScanURLs mocks base method.
+func (m *MockRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanURLs", ctx, afterID, limit)
+	ret0, _ := ret[0].([]*model.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScanURLs indicates an expected call of ScanURLs.
+func (mr *MockRepositoryMockRecorder) ScanURLs(ctx, afterID, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanURLs", reflect.TypeOf((*MockRepository)(nil).ScanURLs), ctx, afterID, limit)
+}
+
 // Store mocks base method.
 func (m *MockRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
 	m.ctrl.T.Helper()
@@ -1,6 +1,8 @@
 // Пакет model содержит структуры данных, используемые приложением в работе.
 package model
 
+import "github.com/google/uuid"
+
 // Структуры, используемые приложением.
 type (
 	// URLDTO - структура тела запроса с оригинальным URL.
@@ -35,4 +37,34 @@ type (
 	ShortURLsDTO struct {
 		IDs []string
 	}
+
+	// UserQuotaDTO - структура тела ответа с квотами пользователя.
+	UserQuotaDTO struct {
+		Override  *Quota `json:"override"`  // Квоты, переопределенные для пользователя, nil - не переопределены
+		Effective Quota  `json:"effective"` // Действующие квоты пользователя
+	}
+
+	// QuotaErrorDTO - структура тела ответа на запрос, отклоненный из-за превышения квоты пользователя.
+	QuotaErrorDTO struct {
+		Error string `json:"error"`
+		QuotaError
+	}
+
+	// CredentialsDTO - структура тела запроса регистрации и входа пользователя.
+	CredentialsDTO struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	// AccountDTO - структура тела ответа с зарегистрированным пользователем.
+	AccountDTO struct {
+		UID   uuid.UUID `json:"uid"`
+		Email string    `json:"email"`
+	}
+
+	// HealthDTO - структура тела ответа проверки работоспособности с состоянием каждой зависимости.
+	HealthDTO struct {
+		Status string            `json:"status"`
+		Checks map[string]Health `json:"checks,omitempty"`
+	}
 )
@@ -0,0 +1,30 @@
+package model
+
+// Состояния зависимостей сервиса.
+const (
+	// HealthUp - зависимость работает.
+	HealthUp = "up"
+
+	// HealthDown - зависимость не работает.
+	HealthDown = "down"
+)
+
+// Health - состояние зависимости сервиса, например БД или кэша.
+type Health struct {
+	Status   string `json:"status"`             // Состояние зависимости: HealthUp или HealthDown
+	Error    string `json:"error,omitempty"`    // Ошибка проверки зависимости
+	Optional bool   `json:"optional,omitempty"` // Необязательная зависимость не влияет на готовность сервиса
+}
+
+// NewHealth создает состояние зависимости по результату её проверки.
+func NewHealth(err error, optional bool) Health {
+	if err != nil {
+		return Health{Status: HealthDown, Error: err.Error(), Optional: optional}
+	}
+	return Health{Status: HealthUp, Optional: optional}
+}
+
+// Up сообщает, работает ли зависимость.
+func (h Health) Up() bool {
+	return h.Status == HealthUp
+}
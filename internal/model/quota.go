@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Квоты пользователя.
+const (
+	// QuotaLinks - количество неудаленных URL пользователя.
+	QuotaLinks = "links"
+
+	// QuotaBatchSize - количество URL в одном батче.
+	QuotaBatchSize = "batch_size"
+
+	// QuotaURLLength - длина оригинального URL в байтах.
+	QuotaURLLength = "url_length"
+)
+
+// Переменные ошибок квот.
+var (
+	// ErrQuotaExceeded ошибка превышения квоты пользователя.
+	ErrQuotaExceeded = fmt.Errorf("quota exceeded")
+
+	// ErrInvalidQuota ошибка недопустимого значения квоты.
+	ErrInvalidQuota = fmt.Errorf("invalid quota value")
+)
+
+// Quota - квоты пользователя.
+// В глобальных квотах 0 означает отсутствие ограничения. В переопределении квот пользователя
+// 0 означает, что действует глобальная квота, а отрицательное значение снимает ограничение.
+type Quota struct {
+	MaxLinks     int `json:"max_links"`      // Количество неудаленных URL пользователя
+	MaxBatchSize int `json:"max_batch_size"` // Количество URL в одном батче
+	MaxURLLength int `json:"max_url_length"` // Длина оригинального URL в байтах
+}
+
+// Validate проверяет, что значения квот помещаются в хранилище.
+func (q Quota) Validate() error {
+	for _, v := range []int{q.MaxLinks, q.MaxBatchSize, q.MaxURLLength} {
+		if v > math.MaxInt32 || v < math.MinInt32 {
+			return fmt.Errorf("%w %d", ErrInvalidQuota, v)
+		}
+	}
+	return nil
+}
+
+// Override возвращает квоты, переопределенные квотами пользователя.
+func (q Quota) Override(o Quota) Quota {
+	override := func(global, user int) int {
+		switch {
+		case user < 0:
+			return 0
+		case user > 0:
+			return user
+		default:
+			return global
+		}
+	}
+
+	return Quota{
+		MaxLinks:     override(q.MaxLinks, o.MaxLinks),
+		MaxBatchSize: override(q.MaxBatchSize, o.MaxBatchSize),
+		MaxURLLength: override(q.MaxURLLength, o.MaxURLLength),
+	}
+}
+
+// QuotaError - ошибка превышения квоты с указанием превышенной квоты.
+type QuotaError struct {
+	Quota  string `json:"quota"`  // Превышенная квота, например QuotaLinks
+	Limit  int    `json:"limit"`  // Значение квоты
+	Actual int    `json:"actual"` // Значение, которое превысило бы квоту
+}
+
+// Error возвращает текст ошибки.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s limit is %d, got %d", ErrQuotaExceeded, e.Quota, e.Limit, e.Actual)
+}
+
+// Unwrap позволяет проверять ошибку через errors.Is(err, ErrQuotaExceeded).
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// CheckQuota возвращает ошибку превышения квоты, если значение больше квоты. Квота 0 не ограничивает значение.
+func CheckQuota(quota string, limit, actual int) error {
+	if limit > 0 && actual > limit {
+		return &QuotaError{Quota: quota, Limit: limit, Actual: actual}
+	}
+	return nil
+}
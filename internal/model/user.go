@@ -0,0 +1,61 @@
+package model
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Ограничения длины пароля.
+const (
+	// MinPasswordLength - минимальная длина пароля в символах.
+	MinPasswordLength = 8
+
+	// MaxPasswordLength - максимальная длина пароля в байтах, больше bcrypt не учитывает.
+	MaxPasswordLength = 72
+)
+
+// Переменные ошибок.
+var (
+	// ErrInvalidEmail ошибка неверного адреса электронной почты.
+	ErrInvalidEmail = fmt.Errorf("invalid email")
+
+	// ErrInvalidPassword ошибка пароля недопустимой длины.
+	ErrInvalidPassword = fmt.Errorf("password must be from %d characters to %d bytes long", MinPasswordLength, MaxPasswordLength)
+
+	// ErrInvalidCredentials ошибка неверного адреса электронной почты или пароля при входе.
+	ErrInvalidCredentials = fmt.Errorf("invalid email or password")
+)
+
+// User - зарегистрированный пользователь.
+// Идентификатор пользователя тот же, что и в токене, поэтому сокращенные им URL принадлежат ему.
+type User struct {
+	ID           uuid.UUID `json:"id"`            // Идентификатор пользователя
+	Email        string    `json:"email"`         // Адрес электронной почты - логин пользователя
+	PasswordHash string    `json:"password_hash"` // Хэш пароля
+	CreatedAt    time.Time `json:"created_at"`    // Время регистрации
+}
+
+// NormalizeEmail проверяет адрес электронной почты и приводит его к нижнему регистру,
+// чтобы один адрес, набранный по-разному, не регистрировался дважды.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// ValidatePassword проверяет длину пароля.
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return ErrInvalidPassword
+	}
+	return nil
+}
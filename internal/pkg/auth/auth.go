@@ -2,10 +2,24 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
@@ -20,25 +34,366 @@ const (
 	// DefaultCookiePath содержит путь куки по умолчанию.
 	DefaultCookiePath = "/"
 
-	// DefaultCookieMaxAge содержит возраст куки по умолчанию.
-	DefaultCookieMaxAge = 3600
-
 	// UserIDClaimName содержит имя ключа идентификатора пользователя в контексте.
 	UserIDClaimName UserIDKey = "uid"
 )
 
-// NewJWTToken создает новый JWT токен.
-func NewJWTToken(ja *jwtauth.JWTAuth) (token jwt.Token, tokenString string, err error) {
-	return ja.Encode(map[string]interface{}{string(UserIDClaimName): uuid.New().String()})
+// Параметры токенов по умолчанию.
+const (
+	// DefaultTokenTTL содержит срок действия токена по умолчанию.
+	DefaultTokenTTL = 24 * time.Hour
+
+	// DefaultRefreshInterval содержит возраст токена, после которого он перевыпускается.
+	DefaultRefreshInterval = time.Hour
+)
+
+// Переменные ошибок.
+var (
+	// ErrNoSigningKey ошибка отсутствия ключа подписи токенов.
+	ErrNoSigningKey = fmt.Errorf("no JWT signing key")
+
+	// ErrUnknownKey ошибка токена, подписанного неизвестным ключом.
+	ErrUnknownKey = fmt.Errorf("unknown JWT key")
+
+	// ErrNoUserID ошибка токена без идентификатора пользователя.
+	ErrNoUserID = fmt.Errorf("no user ID in JWT")
+
+	// ErrUnsupportedKey ошибка ключа неподдерживаемого типа: поддерживаются ключи RSA и Ed25519.
+	ErrUnsupportedKey = fmt.Errorf("unsupported JWT key, expected RSA or Ed25519")
+
+	// ErrNotPrivateKey ошибка файла ключа подписи, содержащего только публичный ключ.
+	ErrNotPrivateKey = fmt.Errorf("JWT signing key is not a private key")
+)
+
+// MinRSAKeySize содержит минимальный размер ключа RSA в битах.
+const MinRSAKeySize = 2048
+
+// Options - параметры выпуска и проверки токенов.
+type Options struct {
+	SecretKey          string        // Текущий ключ подписи HS256
+	PreviousSecretKeys []string      // Прежние ключи HS256, токены которых еще принимаются
+	SigningKeyFile     string        // Файл PEM с приватным ключом RS256 или EdDSA, заменяющим ключ HS256 для подписи
+	PreviousKeyFiles   []string      // Файлы PEM с прежними ключами RS256 или EdDSA, токены которых еще принимаются
+	TTL                time.Duration // Срок действия токена
+	RefreshInterval    time.Duration // Возраст токена, после которого он перевыпускается, 0 - при каждом запросе
+	Cookie             CookieOptions // Параметры куки с токеном
 }
 
-// NewCookieWithDefaults создает новую куку со значениями по умолчанию и переданным в параметре значением.
-func NewCookieWithDefaults(value string) *http.Cookie {
+// CookieOptions - параметры куки с токеном.
+type CookieOptions struct {
+	Secure   bool          // Куку передавать только по HTTPS
+	HTTPOnly bool          // Кука недоступна скриптам на странице
+	SameSite http.SameSite // Передача куки в кросс-доменных запросах
+}
+
+// key - ключ подписи токенов.
+type key struct {
+	id  string                 // Идентификатор ключа - заголовок kid токена
+	alg jwa.SignatureAlgorithm // Алгоритм подписи
+	key interface{}            // Ключ подписи и проверки
+	pub jwk.Key                // Публичный ключ для JWKS, nil - ключ симметричный и не публикуется
+}
+
+// Authenticator выпускает и проверяет JWT токены пользователей.
+// Токены подписываются текущим ключом, идентификатор которого записывается в заголовок kid.
+// Проверяются токены, подписанные текущим и прежними ключами, поэтому ключ можно сменить,
+// не отзывая выданные токены: они перевыпускаются с новым ключом при очередном запросе.
+// Публичные ключи RS256 и EdDSA публикуются в JWKS, чтобы токены могли проверять другие сервисы.
+type Authenticator struct {
+	signing *key            // Текущий ключ подписи
+	legacy  *key            // Ключ HS256 для токенов без заголовка kid
+	keys    map[string]*key // Ключи проверки по идентификаторам
+	jwks    []byte          // Опубликованные публичные ключи в формате JWKS
+
+	ttl             time.Duration
+	refreshInterval time.Duration
+	cookie          CookieOptions
+
+	now func() time.Time // Текущее время, подменяется в тестах
+}
+
+// NewAuthenticator создает выпускающего и проверяющего токены с переданными параметрами.
+// Если задан файл ключа подписи, токены подписываются им, а ключи HS256 только проверяют выданные ранее токены.
+func NewAuthenticator(opts Options) (*Authenticator, error) {
+	if opts.SecretKey == "" && opts.SigningKeyFile == "" {
+		return nil, ErrNoSigningKey
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTokenTTL
+	}
+
+	a := &Authenticator{
+		keys:            make(map[string]*key),
+		ttl:             opts.TTL,
+		refreshInterval: opts.RefreshInterval,
+		cookie:          opts.Cookie,
+		now:             time.Now,
+	}
+
+	if opts.SecretKey != "" {
+		a.legacy = newHMACKey(opts.SecretKey)
+		a.signing = a.legacy
+		a.addKey(a.legacy)
+	}
+	for _, secret := range opts.PreviousSecretKeys {
+		a.addKey(newHMACKey(secret))
+	}
+
+	if opts.SigningKeyFile != "" {
+		k, private, err := loadKeyFile(opts.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if !private {
+			return nil, fmt.Errorf("%w: %s", ErrNotPrivateKey, opts.SigningKeyFile)
+		}
+		a.signing = k
+		a.keys[k.id] = k
+	}
+	for _, path := range opts.PreviousKeyFiles {
+		k, _, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		a.addKey(k)
+	}
+
+	jwks, err := a.publicKeySet()
+	if err != nil {
+		return nil, err
+	}
+	a.jwks = jwks
+
+	return a, nil
+}
+
+// addKey добавляет ключ проверки, если ключа с тем же идентификатором еще нет.
+func (a *Authenticator) addKey(k *key) {
+	if _, ok := a.keys[k.id]; !ok {
+		a.keys[k.id] = k
+	}
+}
+
+// publicKeySet формирует JWKS из публичных ключей: сначала текущий ключ подписи, затем прежние.
+func (a *Authenticator) publicKeySet() ([]byte, error) {
+	set := jwk.NewSet()
+	if a.signing.pub != nil {
+		if err := set.AddKey(a.signing.pub); err != nil {
+			return nil, err
+		}
+	}
+	previous := make([]string, 0, len(a.keys))
+	for id, k := range a.keys {
+		if k.pub != nil && k != a.signing {
+			previous = append(previous, id)
+		}
+	}
+	// Порядок прежних ключей постоянный, чтобы ответ не менялся между запросами
+	sort.Strings(previous)
+	for _, id := range previous {
+		if err := set.AddKey(a.keys[id].pub); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(set)
+}
+
+// JWKS возвращает опубликованные публичные ключи проверки токенов в формате JWK Set (RFC 7517).
+// Ключи HS256 не публикуются.
+func (a *Authenticator) JWKS() []byte {
+	return a.jwks
+}
+
+// NewToken выпускает новый токен пользователя с переданным идентификатором.
+// Пустой идентификатор означает нового пользователя - идентификатор генерируется.
+func (a *Authenticator) NewToken(uid string) (token jwt.Token, tokenString string, err error) {
+	if uid == "" {
+		uid = uuid.New().String()
+	}
+
+	now := a.now().Truncate(time.Second)
+	token, err = jwt.NewBuilder().
+		IssuedAt(now).
+		Expiration(now.Add(a.ttl)).
+		Claim(string(UserIDClaimName), uid).
+		Build()
+	if err != nil {
+		return nil, "", err
+	}
+
+	headers := jws.NewHeaders()
+	if err = headers.Set(jws.KeyIDKey, a.signing.id); err != nil {
+		return nil, "", err
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(a.signing.alg, a.signing.key, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, string(signed), nil
+}
+
+// Verify проверяет подпись и срок действия токена и возвращает его.
+// Токен без заголовка kid, выпущенный до появления ключей с идентификаторами, проверяется текущим ключом HS256.
+func (a *Authenticator) Verify(tokenString string) (jwt.Token, error) {
+	msg, err := jws.ParseString(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, fmt.Errorf("expected one JWT signature, got %d", len(msg.Signatures()))
+	}
+
+	k := a.legacy
+	if kid := msg.Signatures()[0].ProtectedHeaders().KeyID(); kid != "" {
+		var ok bool
+		if k, ok = a.keys[kid]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+		}
+	}
+	if k == nil {
+		return nil, fmt.Errorf("%w: no key ID in JWT", ErrUnknownKey)
+	}
+
+	token, err := jwt.ParseString(tokenString,
+		jwt.WithKey(k.alg, k.key),
+		jwt.WithValidate(true),
+		jwt.WithClock(jwt.ClockFunc(a.now)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if UserID(token) == "" {
+		return nil, ErrNoUserID
+	}
+
+	return token, nil
+}
+
+// NeedsRefresh сообщает, нужно ли перевыпустить токен: он выпущен раньше интервала перевыпуска
+// или без срока действия, либо подписан прежним ключом.
+func (a *Authenticator) NeedsRefresh(token jwt.Token, tokenString string) bool {
+	if token.IssuedAt().IsZero() || token.Expiration().IsZero() {
+		return true
+	}
+	if a.now().Sub(token.IssuedAt()) >= a.refreshInterval {
+		return true
+	}
+
+	msg, err := jws.ParseString(tokenString)
+	return err != nil || msg.Signatures()[0].ProtectedHeaders().KeyID() != a.signing.id
+}
+
+// Cookie создает куку с переданным токеном, которая живет, пока действует токен.
+func (a *Authenticator) Cookie(token jwt.Token, tokenString string) *http.Cookie {
+	maxAge := int(a.ttl.Seconds())
+	if exp := token.Expiration(); !exp.IsZero() {
+		maxAge = int(exp.Sub(a.now()).Seconds())
+	}
+
 	return &http.Cookie{
 		Name:     DefaultCookieName,
-		Value:    value,
+		Value:    tokenString,
 		Path:     DefaultCookiePath,
-		MaxAge:   DefaultCookieMaxAge,
-		SameSite: http.SameSiteDefaultMode,
+		MaxAge:   maxAge,
+		Secure:   a.cookie.Secure,
+		HttpOnly: a.cookie.HTTPOnly,
+		SameSite: a.cookie.SameSite,
+	}
+}
+
+// UserID возвращает идентификатор пользователя из токена.
+func UserID(token jwt.Token) string {
+	uid, _ := token.PrivateClaims()[string(UserIDClaimName)].(string)
+	return uid
+}
+
+// ParseSameSite разбирает значение атрибута SameSite куки: lax, strict, none или пустое значение.
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown cookie SameSite mode %q", s)
+	}
+}
+
+// newHMACKey создает ключ HS256. Идентификатор ключа - начало хэша секрета,
+// поэтому он меняется вместе с секретом и не требует отдельной настройки.
+func newHMACKey(secret string) *key {
+	sum := sha256.Sum256([]byte(secret))
+	return &key{
+		id:  "hs-" + hex.EncodeToString(sum[:8]),
+		alg: jwa.HS256,
+		key: []byte(secret),
+	}
+}
+
+// loadKeyFile загружает ключ RS256 или EdDSA из файла PEM - приватный или только публичный.
+// Идентификатор ключа - его отпечаток JWK (RFC 7638), поэтому он одинаков у приватного и публичного ключа.
+func loadKeyFile(path string) (k *key, private bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
 	}
+
+	parsed, err := jwk.ParseKey(data, jwk.WithPEM(true))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse JWT key %s: %w", path, err)
+	}
+
+	var raw interface{}
+	if err = parsed.Raw(&raw); err != nil {
+		return nil, false, err
+	}
+
+	var alg jwa.SignatureAlgorithm
+	switch raw := raw.(type) {
+	case *rsa.PrivateKey:
+		alg, private = jwa.RS256, true
+		if raw.N.BitLen() < MinRSAKeySize {
+			return nil, false, fmt.Errorf("%w: RSA key %s is shorter than %d bits", ErrUnsupportedKey, path, MinRSAKeySize)
+		}
+	case *rsa.PublicKey:
+		alg = jwa.RS256
+		if raw.N.BitLen() < MinRSAKeySize {
+			return nil, false, fmt.Errorf("%w: RSA key %s is shorter than %d bits", ErrUnsupportedKey, path, MinRSAKeySize)
+		}
+	case ed25519.PrivateKey:
+		alg, private = jwa.EdDSA, true
+	case ed25519.PublicKey:
+		alg = jwa.EdDSA
+	default:
+		return nil, false, fmt.Errorf("%w: %s", ErrUnsupportedKey, path)
+	}
+
+	pub, err := jwk.PublicKeyOf(parsed)
+	if err != nil {
+		return nil, false, err
+	}
+	thumbprint, err := pub.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, false, err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	for name, value := range map[string]interface{}{
+		jwk.KeyIDKey:     kid,
+		jwk.AlgorithmKey: alg,
+		jwk.KeyUsageKey:  jwk.ForSignature,
+	} {
+		if err = pub.Set(name, value); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return &key{id: kid, alg: alg, key: raw, pub: pub}, private, nil
 }
@@ -0,0 +1,105 @@
+// Пакет bloom реализует потокобезопасный фильтр Блума для строковых ключей.
+//
+// Фильтр отвечает на вопрос "мог ли ключ быть добавлен": отрицательный ответ точен,
+// положительный может оказаться ложным с вероятностью, заданной при создании фильтра.
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter - фильтр Блума. Добавление и проверка ключей выполняются без блокировок.
+type Filter struct {
+	bits []atomic.Uint64 // Битовый массив фильтра
+	m    uint64          // Количество бит
+	k    uint64          // Количество хеш-функций
+
+	seed1 maphash.Seed // Затравки двух независимых хешей,
+	seed2 maphash.Seed // из которых получаются все k хешей ключа
+
+	count atomic.Uint64 // Количество добавленных ключей
+}
+
+// New создает фильтр, рассчитанный на capacity ключей с долей ложных срабатываний fpRate.
+// При добавлении большего количества ключей доля ложных срабатываний растет.
+func New(capacity int, fpRate float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	// Оптимальные размер фильтра и количество хеш-функций
+	n := float64(capacity)
+	m := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/n*math.Ln2)))
+
+	words := (m + 63) / 64
+
+	return &Filter{
+		bits:  make([]atomic.Uint64, words),
+		m:     words * 64,
+		k:     k,
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+// Add добавляет ключ в фильтр.
+func (f *Filter) Add(key string) {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		word, mask := &f.bits[bit/64], uint64(1)<<(bit%64)
+		// Устанавливаем бит, не затирая биты, установленные параллельно
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+	f.count.Add(1)
+}
+
+// Test проверяет, мог ли ключ быть добавлен в фильтр. false означает, что ключа точно нет.
+func (f *Filter) Test(key string) bool {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reset удаляет из фильтра все ключи.
+func (f *Filter) Reset() {
+	for i := range f.bits {
+		f.bits[i].Store(0)
+	}
+	f.count.Store(0)
+}
+
+// Count возвращает количество добавленных ключей, повторные добавления учитываются.
+func (f *Filter) Count() uint64 {
+	return f.count.Load()
+}
+
+// EstimatedFalsePositiveRate возвращает расчетную долю ложных срабатываний
+// при текущем количестве добавленных ключей.
+func (f *Filter) EstimatedFalsePositiveRate() float64 {
+	n := float64(f.Count())
+	k := float64(f.k)
+	return math.Pow(1-math.Exp(-k*n/float64(f.m)), k)
+}
+
+// hash возвращает два независимых хеша ключа. Остальные хеши получаются их линейной комбинацией.
+func (f *Filter) hash(key string) (uint64, uint64) {
+	// Второй хеш нечетный, чтобы последовательность битов не зацикливалась раньше времени
+	return maphash.String(f.seed1, key), maphash.String(f.seed2, key) | 1
+}
@@ -0,0 +1,63 @@
+package bloom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	const (
+		capacity = 10000
+		fpRate   = 0.01
+	)
+
+	f := New(capacity, fpRate)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < capacity; i += 4 {
+				f.Add("id" + strconv.Itoa(i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(capacity), f.Count())
+
+	// Добавленные ключи находятся всегда
+	for i := 0; i < capacity; i++ {
+		assert.True(t, f.Test("id"+strconv.Itoa(i)))
+	}
+
+	// Доля ложных срабатываний близка к заданной
+	var falsePositives int
+	for i := 0; i < capacity; i++ {
+		if f.Test("missing" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/capacity, 2*fpRate)
+	assert.InDelta(t, fpRate, f.EstimatedFalsePositiveRate(), fpRate/2)
+
+	f.Reset()
+	assert.Zero(t, f.Count())
+	assert.False(t, f.Test("id0"))
+}
+
+func BenchmarkFilterTest(b *testing.B) {
+	f := New(1_000_000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add("id" + strconv.Itoa(i))
+	}
+
+	b.ResetTimer()
+	for i := range b.N {
+		_ = f.Test("id" + strconv.Itoa(i%2000))
+	}
+}
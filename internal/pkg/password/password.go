@@ -0,0 +1,143 @@
+// Пакет password хэширует и проверяет пароли пользователей с помощью argon2id или bcrypt.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Алгоритмы хэширования паролей.
+const (
+	// Argon2id - алгоритм argon2id (RFC 9106), хэш хранится в формате PHC.
+	Argon2id = "argon2id"
+
+	// Bcrypt - алгоритм bcrypt.
+	Bcrypt = "bcrypt"
+)
+
+// Переменные ошибок.
+var (
+	// ErrUnknownAlgorithm ошибка неизвестного алгоритма хэширования паролей.
+	ErrUnknownAlgorithm = fmt.Errorf("unknown password hash algorithm")
+
+	// ErrInvalidHash ошибка хэша пароля в неизвестном формате.
+	ErrInvalidHash = fmt.Errorf("invalid password hash")
+)
+
+// argon2Params - параметры argon2id.
+type argon2Params struct {
+	memory  uint32 // Память в КиБ
+	time    uint32 // Количество проходов
+	threads uint8  // Количество потоков
+	saltLen int    // Длина соли в байтах
+	keyLen  uint32 // Длина хэша в байтах
+}
+
+// defaultArgon2Params - параметры argon2id, рекомендованные RFC 9106 при ограниченной памяти.
+var defaultArgon2Params = argon2Params{
+	memory:  64 * 1024,
+	time:    3,
+	threads: 4,
+	saltLen: 16,
+	keyLen:  32,
+}
+
+// Hasher хэширует пароли выбранным алгоритмом.
+type Hasher struct {
+	algorithm  string       // Алгоритм хэширования
+	argon2     argon2Params // Параметры argon2id
+	bcryptCost int          // Стоимость bcrypt
+}
+
+// NewHasher создает хэширующего пароли переданным алгоритмом, пустой алгоритм - argon2id.
+func NewHasher(algorithm string) (*Hasher, error) {
+	switch algorithm {
+	case "":
+		algorithm = Argon2id
+	case Argon2id, Bcrypt:
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownAlgorithm, algorithm)
+	}
+
+	return &Hasher{
+		algorithm:  algorithm,
+		argon2:     defaultArgon2Params,
+		bcryptCost: bcrypt.DefaultCost,
+	}, nil
+}
+
+// Hash возвращает хэш пароля со случайной солью.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, h.argon2.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.time, h.argon2.memory, h.argon2.threads, h.argon2.keyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.argon2.memory, h.argon2.time, h.argon2.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify сообщает, соответствует ли пароль хэшу. Алгоритм и параметры берутся из самого хэша,
+// поэтому пароли проверяются и после смены алгоритма хэширования.
+func Verify(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %w", ErrInvalidHash, err)
+	}
+}
+
+// verifyArgon2id проверяет пароль по хэшу argon2id в формате PHC.
+func verifyArgon2id(hash, password string) (bool, error) {
+	// $argon2id$v=19$m=65536,t=3,p=4$<соль>$<хэш>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return false, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, ErrInvalidHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,60 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher(t *testing.T) {
+	for _, algorithm := range []string{Argon2id, Bcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h, err := NewHasher(algorithm)
+			require.NoError(t, err)
+			h.bcryptCost = bcrypt.MinCost
+
+			hash, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			assert.NotContains(t, hash, "correct horse")
+
+			// Соль случайная - хэши одного пароля различаются
+			other, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other)
+
+			ok, err := Verify(hash, "correct horse")
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = Verify(hash, "battery staple")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+
+	h, err := NewHasher("")
+	require.NoError(t, err)
+	hash, err := h.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$"))
+
+	_, err = NewHasher("md5")
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain text",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA",
+		"$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=x,t=3,p=4$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=4$!!!$aGFzaA",
+	} {
+		_, err := Verify(hash, "correct horse")
+		assert.ErrorIs(t, err, ErrInvalidHash, hash)
+	}
+}
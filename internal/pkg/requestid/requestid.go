@@ -0,0 +1,47 @@
+// Пакет requestid предоставляет инструменты для работы с идентификаторами запросов.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header содержит имя заголовка с идентификатором запроса.
+const Header = "X-Request-ID"
+
+// MaxLength содержит максимальную длину идентификатора запроса, принимаемого от клиента.
+const MaxLength = 128
+
+// contextKey используется для хранения идентификатора запроса в контексте.
+type contextKey struct{}
+
+// New создает новый идентификатор запроса.
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid проверяет, что переданный клиентом идентификатор запроса можно использовать:
+// он не пустой, не длиннее MaxLength и состоит из видимых ASCII символов.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext возвращает копию контекста с идентификатором запроса.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса из контекста или пустую строку, если его нет.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,219 @@
+// Пакет profiler снимает профили CPU и памяти работающего сервиса по расписанию.
+//
+// Профили пишутся в каталог из конфигурации в формате pprof, в именах файлов - вид профиля
+// и время снятия, например cpu-20240101T000000.000Z.pprof. Старые профили удаляются, хранится
+// заданное количество последних профилей каждого вида. Профили можно сравнивать
+// с базовыми профилями из каталога profiles репозитория:
+//
+//	go tool pprof -diff_base=profiles/base.pprof /var/lib/urlcut/profiles/heap-20240101T000000.000Z.pprof
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+)
+
+// Виды снимаемых профилей.
+const (
+	// KindCPU - профиль CPU.
+	KindCPU = "cpu"
+
+	// KindHeap - профиль памяти.
+	KindHeap = "heap"
+)
+
+// fileExt - расширение файлов профилей.
+const fileExt = ".pprof"
+
+// timeLayout - формат времени снятия профиля в имени файла. Имена файлов сортируются по времени.
+const timeLayout = "20060102T150405.000Z"
+
+// ErrInitProfilerFailed ошибка инициализации планировщика профилей.
+var ErrInitProfilerFailed = fmt.Errorf("failed to init profiler")
+
+// Scheduler снимает профили CPU и памяти с заданным интервалом.
+type Scheduler struct {
+	dir         string        // Каталог профилей
+	interval    time.Duration // Интервал снятия профилей
+	cpuDuration time.Duration // Длительность снятия профиля CPU
+	retention   int           // Количество хранимых профилей каждого вида
+
+	done      chan struct{}  // Канал остановки планировщика
+	wg        sync.WaitGroup // Ожидание завершения горутины планировщика
+	closeOnce sync.Once      // Однократная остановка планировщика
+}
+
+// NewScheduler создает планировщик профилей с параметрами из конфигурации и создает каталог профилей.
+// Профиль CPU должен сниматься быстрее, чем наступает время снятия следующих профилей.
+func NewScheduler(cfg *config.Config) (*Scheduler, error) {
+	if cfg.ProfileDir == "" || cfg.ProfileInterval.Duration <= 0 || cfg.ProfileRetention <= 0 {
+		return nil, ErrInitProfilerFailed
+	}
+	if cfg.ProfileCPUDuration.Duration <= 0 || cfg.ProfileCPUDuration.Duration >= cfg.ProfileInterval.Duration {
+		return nil, fmt.Errorf("%w: CPU profile duration must be positive and less than interval", ErrInitProfilerFailed)
+	}
+
+	if err := os.MkdirAll(cfg.ProfileDir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Scheduler{
+		dir:         cfg.ProfileDir,
+		interval:    cfg.ProfileInterval.Duration,
+		cpuDuration: cfg.ProfileCPUDuration.Duration,
+		retention:   cfg.ProfileRetention,
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Start запускает снятие профилей в фоне. Первые профили снимаются через интервал после запуска.
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Close останавливает планировщик, прерывая снятие профиля CPU, и дожидается его завершения.
+func (s *Scheduler) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+	return nil
+}
+
+// Capture снимает профили CPU и памяти и удаляет устаревшие профили.
+// Снятие профиля CPU прерывается при отмене контекста или остановке планировщика.
+func (s *Scheduler) Capture(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	if err := s.captureCPU(ctx, now); err != nil {
+		return err
+	}
+	if err := s.captureHeap(now); err != nil {
+		return err
+	}
+
+	for _, kind := range []string{KindCPU, KindHeap} {
+		if err := s.prune(kind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run снимает профили с заданным интервалом до остановки планировщика.
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Capture(context.Background()); err != nil {
+				slog.Error("failed to capture profiles", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// captureCPU снимает профиль CPU заданной длительности.
+// Если профиль CPU уже снимается, например через /debug/pprof/profile, возвращается ошибка.
+func (s *Scheduler) captureCPU(ctx context.Context, now time.Time) error {
+	return s.writeFile(KindCPU, now, func(f *os.File) error {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+
+		timer := time.NewTimer(s.cpuDuration)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		return nil
+	})
+}
+
+// captureHeap снимает профиль памяти. Перед снятием выполняется сборка мусора,
+// чтобы профиль отражал актуальное состояние памяти.
+func (s *Scheduler) captureHeap(now time.Time) error {
+	return s.writeFile(KindHeap, now, func(f *os.File) error {
+		runtime.GC()
+		return pprof.Lookup(KindHeap).WriteTo(f, 0)
+	})
+}
+
+// writeFile записывает профиль во временный файл и переименовывает его в файл профиля,
+// чтобы в каталоге не оставались недописанные профили.
+func (s *Scheduler) writeFile(kind string, now time.Time, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(s.dir, kind+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err = write(tmp); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("%s profile: %w", kind, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, kind+"-"+now.Format(timeLayout)+fileExt))
+}
+
+// prune удаляет профили переданного вида сверх заданного количества, начиная с самых старых.
+func (s *Scheduler) prune(kind string) error {
+	files, err := Files(s.dir, kind)
+	if err != nil {
+		return err
+	}
+
+	for len(files) > s.retention {
+		if err = os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+// Files возвращает пути к профилям переданного вида в каталоге, от самого старого к самому новому.
+func Files(dir, kind string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, kind+"-") && strings.HasSuffix(name, fileExt) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+)
+
+// newConfig возвращает конфигурацию планировщика с каталогом профилей во временном каталоге теста.
+func newConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		ProfileDir:         filepath.Join(t.TempDir(), "profiles"),
+		ProfileInterval:    config.Duration{Duration: time.Hour},
+		ProfileCPUDuration: config.Duration{Duration: 10 * time.Millisecond},
+		ProfileRetention:   2,
+	}
+}
+
+func TestNewScheduler(t *testing.T) {
+	_, err := NewScheduler(&config.Config{})
+	assert.ErrorIs(t, err, ErrInitProfilerFailed)
+
+	cfg := newConfig(t)
+	cfg.ProfileCPUDuration = cfg.ProfileInterval
+	_, err = NewScheduler(cfg)
+	assert.ErrorIs(t, err, ErrInitProfilerFailed)
+
+	cfg = newConfig(t)
+	_, err = NewScheduler(cfg)
+	require.NoError(t, err)
+	assert.DirExists(t, cfg.ProfileDir)
+}
+
+func TestCapture(t *testing.T) {
+	cfg := newConfig(t)
+
+	s, err := NewScheduler(cfg)
+	require.NoError(t, err)
+
+	for range 3 {
+		require.NoError(t, s.Capture(context.Background()))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// Хранятся только последние профили каждого вида, временные файлы не остаются
+	for _, kind := range []string{KindCPU, KindHeap} {
+		files, err := Files(cfg.ProfileDir, kind)
+		require.NoError(t, err)
+		require.Len(t, files, cfg.ProfileRetention)
+
+		// Профили pprof сжаты gzip
+		data, err := os.ReadFile(files[len(files)-1])
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x1f, 0x8b}, data[:2])
+	}
+
+	entries, err := os.ReadDir(cfg.ProfileDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2*cfg.ProfileRetention)
+}
+
+func TestScheduler(t *testing.T) {
+	cfg := newConfig(t)
+	cfg.ProfileInterval = config.Duration{Duration: 50 * time.Millisecond}
+
+	s, err := NewScheduler(cfg)
+	require.NoError(t, err)
+
+	s.Start()
+	assert.Eventually(t, func() bool {
+		files, err := Files(cfg.ProfileDir, KindHeap)
+		return err == nil && len(files) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+}
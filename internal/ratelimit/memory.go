@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища корзин.
+var _ Store = (*MemoryStore)(nil)
+
+// memorySweepInterval - интервал удаления полных корзин, которые не отличаются от новых.
+const memorySweepInterval = time.Minute
+
+// bucket - состояние корзины.
+type bucket struct {
+	tokens  float64   // Количество токенов на момент обновления
+	updated time.Time // Время обновления
+	fullAt  time.Time // Время полного пополнения корзины
+}
+
+// MemoryStore хранит корзины в памяти процесса.
+// Полные корзины периодически удаляются при очередном запросе, поэтому память не растет
+// с количеством клиентов, обращавшихся к сервису когда-либо.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	now func() time.Time // Текущее время, подменяется в тестах
+}
+
+// NewMemoryStore создает новое хранилище корзин в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take забирает токены из корзины ключа.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, cost int) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = refill(limit, b.tokens, now.Sub(b.updated))
+	if now.After(b.updated) {
+		b.updated = now
+	}
+
+	allowed := b.tokens >= float64(cost)
+	if allowed {
+		b.tokens -= float64(cost)
+	}
+
+	result := newResult(limit, b.tokens, allowed, cost)
+	b.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// Close ничего не делает - корзины в памяти не требуют закрытия.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sweep удаляет полные корзины не чаще раза в memorySweepInterval.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Пакет ratelimit ограничивает частоту запросов к сервису по алгоритму token bucket.
+//
+// У каждого ключа, например IP адреса клиента или идентификатора пользователя, есть корзина
+// на Burst токенов, которая пополняется со скоростью Rate токенов в секунду. Каждый запрос
+// забирает токен, запрос при пустой корзине отклоняется. Состояние корзин хранится в Store:
+// в памяти процесса или в Redis, общем для всех реплик сервиса.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// Классы маршрутов с отдельными ограничениями.
+const (
+	// ClassCreate - сокращение URL, в том числе батчем.
+	ClassCreate = "create"
+
+	// ClassRedirect - переход по сокращенному URL.
+	ClassRedirect = "redirect"
+
+	// ClassDelete - удаление URL пользователя.
+	ClassDelete = "delete"
+)
+
+// ErrUnknownStore ошибка неизвестного хранилища состояния корзин.
+var ErrUnknownStore = fmt.Errorf("unknown rate limit store")
+
+// Limit - параметры корзины.
+type Limit struct {
+	Rate  float64 // Скорость пополнения корзины в токенах в секунду
+	Burst int     // Емкость корзины - количество запросов, которые можно выполнить подряд
+}
+
+// Enabled сообщает, ограничена ли частота запросов.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result - результат попытки забрать токен из корзины.
+type Result struct {
+	Allowed    bool          // Запрос разрешен
+	Limit      int           // Емкость корзины
+	Remaining  int           // Количество оставшихся в корзине целых токенов
+	Reset      time.Duration // Время до полного пополнения корзины
+	RetryAfter time.Duration // Время до появления токена, если запрос отклонен
+}
+
+// Store хранит состояние корзин.
+type Store interface {
+	// Take забирает cost токенов из корзины ключа с переданными параметрами.
+	// Если токенов недостаточно, корзина не изменяется, а запрос отклоняется.
+	Take(ctx context.Context, key string, limit Limit, cost int) (Result, error)
+
+	// Close закрывает хранилище.
+	Close() error
+}
+
+// NewStore создает хранилище состояния корзин, заданное в конфигурации.
+// Хранилище Redis использует строку соединения с Redis из конфигурации.
+func NewStore(ctx context.Context, cfg *config.Config) (Store, error) {
+	switch cfg.RateLimitStore {
+	case "", config.RateLimitStoreMemory:
+		return NewMemoryStore(), nil
+	case config.RateLimitStoreRedis:
+		client, err := repository.NewRedisClient(ctx, cfg.RedisDSN)
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownStore, cfg.RateLimitStore)
+	}
+}
+
+// Limiter ограничивает частоту запросов по классам маршрутов.
+type Limiter struct {
+	store  Store            // Хранилище состояния корзин
+	limits map[string]Limit // Параметры корзин по классам маршрутов
+}
+
+// NewLimiter создает ограничитель с параметрами корзин классов маршрутов из конфигурации.
+func NewLimiter(store Store, cfg *config.Config) *Limiter {
+	return &Limiter{
+		store: store,
+		limits: map[string]Limit{
+			ClassCreate:   {Rate: cfg.RateLimitCreateRate, Burst: cfg.RateLimitCreateBurst},
+			ClassRedirect: {Rate: cfg.RateLimitRedirectRate, Burst: cfg.RateLimitRedirectBurst},
+			ClassDelete:   {Rate: cfg.RateLimitDeleteRate, Burst: cfg.RateLimitDeleteBurst},
+		},
+	}
+}
+
+// Limit возвращает параметры корзины класса маршрутов.
+func (l *Limiter) Limit(class string) Limit {
+	return l.limits[class]
+}
+
+// Allow забирает токен из корзин класса маршрутов для каждого из переданных ключей по порядку.
+// Запрос разрешен, только если токен есть во всех корзинах, - возвращается результат самой пустой корзины.
+// Если частота запросов класса не ограничена, запрос разрешается, а Result.Limit равен нулю.
+func (l *Limiter) Allow(ctx context.Context, class string, keys ...string) (Result, error) {
+	limit := l.limits[class]
+	if !limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+
+	var result Result
+	for i, key := range keys {
+		res, err := l.store.Take(ctx, class+":"+key, limit, 1)
+		if err != nil {
+			return Result{}, err
+		}
+		if i == 0 || !res.Allowed || res.Remaining < result.Remaining {
+			result = res
+		}
+		if !res.Allowed {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// Close закрывает хранилище состояния корзин.
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
+
+// newResult формирует результат попытки по количеству токенов в корзине после нее.
+func newResult(limit Limit, tokens float64, allowed bool, cost int) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((float64(cost) - tokens) / limit.Rate)
+	}
+	return result
+}
+
+// refill возвращает количество токенов в корзине, пополненной за время с последнего обновления.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// seconds переводит количество секунд в длительность.
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
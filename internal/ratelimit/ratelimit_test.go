@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// clock - управляемые часы для тестов.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newMemoryStore(c *clock) Store {
+	store := NewMemoryStore()
+	store.now = c.Now
+	return store
+}
+
+func newRedisStore(t *testing.T, c *clock) Store {
+	mr := miniredis.RunT(t)
+
+	client, err := repository.NewRedisClient(context.TODO(), "redis://"+mr.Addr())
+	require.NoError(t, err)
+
+	store := NewRedisStore(client)
+	store.now = c.Now
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T, c *clock) Store{
+		"memory": func(_ *testing.T, c *clock) Store { return newMemoryStore(c) },
+		"redis":  newRedisStore,
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c := &clock{now: time.Unix(1_700_000_000, 0)}
+			store := newStore(t, c)
+
+			limit := Limit{Rate: 2, Burst: 3}
+
+			// Полная корзина позволяет выполнить Burst запросов подряд
+			for i := 2; i >= 0; i-- {
+				res, err := store.Take(ctx, "ip:127.0.0.1", limit, 1)
+				require.NoError(t, err)
+				assert.True(t, res.Allowed)
+				assert.Equal(t, 3, res.Limit)
+				assert.Equal(t, i, res.Remaining)
+			}
+
+			res, err := store.Take(ctx, "ip:127.0.0.1", limit, 1)
+			require.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+			assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+			assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+			// Корзины ключей независимы
+			res, err = store.Take(ctx, "ip:127.0.0.2", limit, 1)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+
+			// За полсекунды в корзину добавляется токен
+			c.Advance(500 * time.Millisecond)
+			res, err = store.Take(ctx, "ip:127.0.0.1", limit, 1)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+
+			// Корзина не пополняется сверх емкости
+			c.Advance(time.Hour)
+			res, err = store.Take(ctx, "ip:127.0.0.1", limit, 1)
+			require.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 2, res.Remaining)
+
+			// Время, идущее назад, не пополняет корзину
+			c.Advance(-time.Minute)
+			res, err = store.Take(ctx, "ip:127.0.0.1", limit, 1)
+			require.NoError(t, err)
+			assert.Equal(t, 1, res.Remaining)
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	store := NewMemoryStore()
+	store.now = c.Now
+
+	limit := Limit{Rate: 1, Burst: 10}
+	for _, key := range []string{"a", "b"} {
+		_, err := store.Take(context.Background(), key, limit, 1)
+		require.NoError(t, err)
+	}
+	assert.Len(t, store.buckets, 2)
+
+	// Полные корзины удаляются при очередном запросе
+	c.Advance(memorySweepInterval)
+	_, err := store.Take(context.Background(), "c", limit, 1)
+	require.NoError(t, err)
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "c")
+}
+
+func TestLimiter(t *testing.T) {
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	limiter := NewLimiter(newMemoryStore(c), &config.Config{
+		RateLimitCreateRate:  1,
+		RateLimitCreateBurst: 2,
+	})
+	defer func() { _ = limiter.Close() }()
+
+	ctx := context.Background()
+
+	// Класс без заданных параметров не ограничен
+	assert.False(t, limiter.Limit(ClassRedirect).Enabled())
+	res, err := limiter.Allow(ctx, ClassRedirect, "ip:127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Zero(t, res.Limit)
+
+	// Возвращается результат самой пустой корзины
+	res, err = limiter.Allow(ctx, ClassCreate, "ip:127.0.0.1", "uid:1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res, err = limiter.Allow(ctx, ClassCreate, "ip:127.0.0.1", "uid:2")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// Пустая корзина IP отклоняет запрос нового пользователя
+	res, err = limiter.Allow(ctx, ClassCreate, "ip:127.0.0.1", "uid:3")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// Пользователь с другого IP ограничен своей корзиной
+	res, err = limiter.Allow(ctx, ClassCreate, "ip:127.0.0.2", "uid:1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	_, err = NewStore(ctx, &config.Config{RateLimitStore: "memcached"})
+	assert.ErrorIs(t, err, ErrUnknownStore)
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища корзин.
+var _ Store = (*RedisStore)(nil)
+
+// redisKeyPrefix - префикс ключа хэша с состоянием корзины.
+const redisKeyPrefix = "urlcut:ratelimit:"
+
+// redisTakeScript атомарно пополняет корзину и забирает из нее токены.
+// Время передается клиентом в микросекундах, время корзины не сдвигается назад,
+// если часы реплик немного расходятся. Корзина удаляется, когда полностью пополнится.
+// Количество токенов возвращается строкой - числа Lua при возврате округляются до целых.
+var redisTakeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) / 1000000 * rate)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore хранит корзины в Redis, общем для всех реплик сервиса.
+type RedisStore struct {
+	client *redis.Client // Клиент Redis
+
+	now func() time.Time // Текущее время, подменяется в тестах
+}
+
+// NewRedisStore создает новое хранилище корзин в Redis.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Take забирает токены из корзины ключа.
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, cost int) (Result, error) {
+	res, err := redisTakeScript.Run(ctx, s.client, []string{redisKeyPrefix + key},
+		limit.Rate, limit.Burst, s.now().UnixMicro(), cost).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, tokens, allowed == 1, cost), nil
+}
+
+// Close закрывает клиент Redis.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
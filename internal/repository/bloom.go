@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/bloom"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища репозиторием с фильтром Блума.
+var _ interfaces.Repository = (*FilteredRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*FilteredRepository)(nil)
+	_ interfaces.Truncater     = (*FilteredRepository)(nil)
+	_ interfaces.Replacer      = (*FilteredRepository)(nil)
+	_ interfaces.QuotaStorer   = (*FilteredRepository)(nil)
+	_ interfaces.LimitedStorer = (*FilteredRepository)(nil)
+	_ interfaces.UserStorer    = (*FilteredRepository)(nil)
+)
+
+// bloomFalsePositiveRate - расчетная доля ложных срабатываний фильтра Блума.
+const bloomFalsePositiveRate = 0.01
+
+// FilterStats - статистика запросов URL через фильтр Блума.
+type FilterStats struct {
+	Lookups        uint64 // Всего запросов URL по идентификатору
+	Rejected       uint64 // Запросы, отсеянные фильтром без обращения к хранилищу
+	FalsePositives uint64 // Запросы, пропущенные фильтром, но не найденные в хранилище
+
+	Items                      uint64  // Количество идентификаторов в фильтре
+	EstimatedFalsePositiveRate float64 // Расчетная доля ложных срабатываний при текущем заполнении
+}
+
+// FalsePositiveRate возвращает наблюдаемую долю ложных срабатываний фильтра -
+// долю пропущенных фильтром запросов среди всех запросов несуществующих URL.
+func (s FilterStats) FalsePositiveRate() float64 {
+	misses := s.Rejected + s.FalsePositives
+	if misses == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(misses)
+}
+
+// FilteredRepository - фильтр Блума идентификаторов URL перед основным хранилищем.
+// Запросы заведомо несуществующих URL завершаются ошибкой ErrIDNotFound без обращения к хранилищу.
+// Фильтр видит только URL, сохраненные через него, поэтому подходит только для хранилищ,
+// которые не меняют другие процессы, - New не включает его перед общими хранилищами.
+type FilteredRepository struct {
+	repo   interfaces.Repository // Основное хранилище
+	filter *bloom.Filter         // Фильтр Блума идентификаторов сохраненных URL
+
+	// Сохранения берут мьютекс на чтение на время добавления в фильтр и сохранения, а очистка - на запись,
+	// чтобы URL, сохраненный между очисткой хранилища и сбросом фильтра, не пропал из фильтра
+	mu sync.RWMutex
+
+	lookups        atomic.Uint64
+	rejected       atomic.Uint64
+	falsePositives atomic.Uint64
+}
+
+// NewFilteredRepository создает фильтр Блума перед переданным основным хранилищем и заполняет его
+// идентификаторами всех URL хранилища, включая удаленные. Фильтр рассчитывается на capacity URL,
+// но не меньше чем на удвоенное количество URL в хранилище.
+func NewFilteredRepository(ctx context.Context, repo interfaces.Repository, capacity int) (*FilteredRepository, error) {
+	ids := make([]string, 0)
+	err := ExportURLs(ctx, repo, func(url *model.URL) error {
+		ids = append(ids, url.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if capacity < 2*len(ids) {
+		capacity = 2 * len(ids)
+	}
+
+	filter := bloom.New(capacity, bloomFalsePositiveRate)
+	for _, id := range ids {
+		filter.Add(id)
+	}
+
+	metrics.BloomEstimatedFalsePositiveRate.Set(filter.EstimatedFalsePositiveRate())
+
+	slog.Info("Bloom filter of URL IDs is built", slog.Int("urls", len(ids)), slog.Int("capacity", capacity))
+
+	return &FilteredRepository{
+		repo:   repo,
+		filter: filter,
+	}, nil
+}
+
+// Store добавляет идентификаторы URL в фильтр и сохраняет URL в основном хранилище.
+// Идентификаторы добавляются до сохранения, чтобы сохраненный URL не был отсеян ни в какой момент.
+func (r *FilteredRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.add(urls)
+
+	return r.repo.Store(ctx, urls)
+}
+
+// Get возвращает данные URL из основного хранилища, если фильтр не отсеял идентификатор.
+func (r *FilteredRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	r.lookups.Add(1)
+
+	if !r.filter.Test(id) {
+		r.rejected.Add(1)
+		metrics.BloomLookups.WithLabelValues("rejected").Inc()
+		return nil, ErrIDNotFound
+	}
+
+	url, err := r.repo.Get(ctx, id)
+	switch {
+	case errors.Is(err, ErrIDNotFound):
+		r.falsePositives.Add(1)
+		metrics.BloomLookups.WithLabelValues("false_positive").Inc()
+	case err == nil:
+		metrics.BloomLookups.WithLabelValues("found").Inc()
+	}
+
+	return url, err
+}
+
+// GetUserURLs возвращает URL пользователя из основного хранилища.
+func (r *FilteredRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	return r.repo.GetUserURLs(ctx, uid)
+}
+
+// ScanURLs возвращает страницу URL из основного хранилища.
+func (r *FilteredRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	return r.repo.ScanURLs(ctx, afterID, limit)
+}
+
+// DeleteURLs помечает URL удаленными в основном хранилище.
+// Удаленные URL остаются в фильтре - запрос удаленного URL возвращает его с пометкой удаления.
+func (r *FilteredRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	return r.repo.DeleteURLs(ctx, urls)
+}
+
+// ExportURLs выгружает все URL из основного хранилища.
+func (r *FilteredRepository) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	return ExportURLs(ctx, r.repo, fn)
+}
+
+// Truncate удаляет все URL из основного хранилища и очищает фильтр.
+// Сохранения ждут окончания очистки, а при ошибке очистки фильтр не сбрасывается.
+func (r *FilteredRepository) Truncate(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := Truncate(ctx, r.repo); err != nil {
+		return err
+	}
+	r.filter.Reset()
+	metrics.BloomEstimatedFalsePositiveRate.Set(0)
+	return nil
+}
+
+// ReplaceURLs заменяет все URL основного хранилища. Идентификаторы новых URL добавляются
+// в фильтр до передачи каждого пакета в хранилище, чтобы они не отсеивались ни на мгновение.
+func (r *FilteredRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return ReplaceURLs(ctx, r.repo, func(store func(urls []*model.URL) error) error {
+		return load(func(urls []*model.URL) error {
+			r.add(urls)
+			return store(urls)
+		})
+	})
+}
+
+// GetQuota возвращает переопределенные квоты пользователя из основного хранилища.
+func (r *FilteredRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	return GetQuota(ctx, r.repo, uid)
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя в основное хранилище.
+func (r *FilteredRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	return SetQuota(ctx, r.repo, uid, quota)
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя из основного хранилища.
+func (r *FilteredRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	return DeleteQuota(ctx, r.repo, uid)
+}
+
+// StoreLimited сохраняет URL пользователя в основное хранилище с проверкой квоты количества URL.
+// Идентификаторы добавляются в фильтр до сохранения так же, как в Store.
+func (r *FilteredRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.add(urls)
+
+	return StoreLimited(ctx, r.repo, urls, uid, limit)
+}
+
+// add добавляет идентификаторы URL в фильтр. Вызывающий должен держать мьютекс на чтение.
+func (r *FilteredRepository) add(urls []*model.URL) {
+	for _, url := range urls {
+		r.filter.Add(url.ID)
+	}
+	metrics.BloomEstimatedFalsePositiveRate.Set(r.filter.EstimatedFalsePositiveRate())
+}
+
+// CreateUser сохраняет нового пользователя в основное хранилище и передает ему URL анонимного пользователя.
+func (r *FilteredRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	return CreateUser(ctx, r.repo, user, anonymous)
+}
+
+// GetUser возвращает пользователя по идентификатору из основного хранилища.
+func (r *FilteredRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return GetUser(ctx, r.repo, id)
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты из основного хранилища.
+func (r *FilteredRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return GetUserByEmail(ctx, r.repo, email)
+}
+
+// Stats возвращает статистику запросов через фильтр.
+func (r *FilteredRepository) Stats() FilterStats {
+	return FilterStats{
+		Lookups:                    r.lookups.Load(),
+		Rejected:                   r.rejected.Load(),
+		FalsePositives:             r.falsePositives.Load(),
+		Items:                      r.filter.Count(),
+		EstimatedFalsePositiveRate: r.filter.EstimatedFalsePositiveRate(),
+	}
+}
+
+// Health возвращает состояние основного хранилища.
+func (r *FilteredRepository) Health(ctx context.Context) map[string]model.Health {
+	return r.repo.Health(ctx)
+}
+
+// Close записывает в лог итоговую статистику фильтра и закрывает основное хранилище.
+func (r *FilteredRepository) Close() error {
+	stats := r.Stats()
+	slog.Info("Bloom filter stats",
+		slog.Uint64("lookups", stats.Lookups),
+		slog.Uint64("rejected", stats.Rejected),
+		slog.Uint64("false_positives", stats.FalsePositives),
+		slog.Float64("false_positive_rate", stats.FalsePositiveRate()),
+		slog.Float64("estimated_false_positive_rate", stats.EstimatedFalsePositiveRate),
+	)
+
+	return r.repo.Close()
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/random"
+)
+
+func TestFilteredRepository(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	base, err := NewInMemoryRepository("", FileStorageOptions{})
+	require.NoError(t, err)
+
+	// URL, сохраненный до создания фильтра, попадает в фильтр при его построении
+	_, err = base.Store(ctx, []*model.URL{{Long: "https://example.com/before", ID: "before", UID: uid}})
+	require.NoError(t, err)
+
+	repo, err := NewFilteredRepository(ctx, base, 100)
+	require.NoError(t, err)
+
+	_, err = repo.Store(ctx, []*model.URL{{Long: "https://example.com/after", ID: "after", UID: uid}})
+	require.NoError(t, err)
+
+	for _, id := range []string{"before", "after"} {
+		url, err := repo.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, id, url.ID)
+	}
+
+	// Удаленный URL не отсеивается - его запрос возвращает пометку удаления
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{{ID: "after", UID: uid}}))
+	url, err := repo.Get(ctx, "after")
+	require.NoError(t, err)
+	assert.True(t, url.Deleted)
+
+	const misses = 1000
+	for i := 0; i < misses; i++ {
+		_, err = repo.Get(ctx, random.String(8))
+		assert.ErrorIs(t, err, ErrIDNotFound)
+	}
+
+	stats := repo.Stats()
+	assert.Equal(t, uint64(3+misses), stats.Lookups)
+	assert.Equal(t, uint64(misses), stats.Rejected+stats.FalsePositives)
+	assert.Equal(t, uint64(2), stats.Items)
+	assert.Less(t, stats.FalsePositiveRate(), 0.05)
+
+	require.NoError(t, repo.Truncate(ctx))
+	_, err = repo.Get(ctx, "before")
+	assert.ErrorIs(t, err, ErrIDNotFound)
+	assert.Zero(t, repo.Stats().Items)
+
+	require.NoError(t, repo.Close())
+}
+
+// slowTruncater задерживает очистку основного хранилища до сигнала теста.
+type slowTruncater struct {
+	*InMemoryRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *slowTruncater) Truncate(ctx context.Context) error {
+	close(r.started)
+	<-r.release
+	return r.InMemoryRepository.Truncate(ctx)
+}
+
+func TestFilteredRepositoryTruncateConcurrentStore(t *testing.T) {
+	ctx := context.Background()
+
+	base, err := NewInMemoryRepository("", FileStorageOptions{})
+	require.NoError(t, err)
+
+	slow := &slowTruncater{InMemoryRepository: base, started: make(chan struct{}), release: make(chan struct{})}
+	repo, err := NewFilteredRepository(ctx, slow, 100)
+	require.NoError(t, err)
+
+	truncated := make(chan error)
+	go func() { truncated <- repo.Truncate(ctx) }()
+	<-slow.started
+
+	// URL, сохраняемый во время очистки, сохраняется после нее и не пропадает из фильтра
+	url := &model.URL{Long: "https://example.com/during", ID: "during", UID: uuid.New()}
+	stored := make(chan error)
+	go func() {
+		_, errs := repo.Store(ctx, []*model.URL{url})
+		stored <- errs
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(slow.release)
+
+	require.NoError(t, <-truncated)
+	require.NoError(t, <-stored)
+
+	got, err := repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	assert.Equal(t, url.Long, got.Long)
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища кэширующим репозиторием.
+var _ interfaces.Repository = (*CachedRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*CachedRepository)(nil)
+	_ interfaces.Truncater     = (*CachedRepository)(nil)
+	_ interfaces.Replacer      = (*CachedRepository)(nil)
+	_ interfaces.QuotaStorer   = (*CachedRepository)(nil)
+	_ interfaces.LimitedStorer = (*CachedRepository)(nil)
+	_ interfaces.UserStorer    = (*CachedRepository)(nil)
+)
+
+// Параметры кэша.
+const (
+	// redisCachePrefix - префикс ключа закэшированного URL.
+	redisCachePrefix = "urlcut:cache:"
+
+	// redisTombstonePrefix - префикс ключа отметки об удалении URL, запрещающей заполнять кэш.
+	redisTombstonePrefix = "urlcut:tombstone:"
+
+	// DefaultCacheTTL - время жизни закэшированного URL.
+	DefaultCacheTTL = 1 * time.Hour
+
+	// cacheTombstoneTTL - время жизни отметки об удалении URL. Оно больше времени, за которое
+	// запрос успевает прочитать URL из основного хранилища и заполнить кэш: чтение из базы данных
+	// повторяется с задержкой не дольше backoff.DefaultMaxElapsedTime.
+	cacheTombstoneTTL = backoff.DefaultMaxElapsedTime + 1*time.Minute
+)
+
+// redisCacheFillScript сохраняет URL в кэш, если URL не был удален после чтения из основного хранилища.
+var redisCacheFillScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// CachedRepository является общим для всех реплик сервиса Redis кэшем перед основным хранилищем URL.
+// Кэшируются только URL, полученные по идентификатору. При удалении URL записи кэша сбрасываются,
+// поэтому все реплики сразу видят пометку удаления. Отметка об удалении не дает запросу, прочитавшему
+// URL до удаления, вернуть в кэш неудаленный URL.
+type CachedRepository struct {
+	repo   interfaces.Repository // Основное хранилище
+	client *redis.Client         // Клиент Redis
+	ttl    time.Duration         // Время жизни записей кэша
+}
+
+// NewCachedRepository создает новый кэширующий репозиторий перед переданным основным хранилищем.
+func NewCachedRepository(repo interfaces.Repository, client *redis.Client, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		repo:   repo,
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Store сохраняет URL в основном хранилище.
+func (r *CachedRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	return r.repo.Store(ctx, urls)
+}
+
+// Get возвращает данные URL из кэша, а при их отсутствии - из основного хранилища с сохранением в кэш.
+// Недоступность кэша не является ошибкой - запрос выполняется к основному хранилищу.
+func (r *CachedRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	key := redisCachePrefix + id
+
+	// Пробуем получить URL из кэша
+	fields, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		slog.InfoContext(ctx, "failed to get URL from cache", "error", err.Error())
+	}
+	if err == nil && len(fields) != 0 {
+		url, errp := redisParseURL(id, fields)
+		if errp == nil {
+			return url, nil
+		}
+	}
+
+	// В кэше нет, идем в основное хранилище
+	url, err := r.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сохраняем URL в кэш, если его не удалили после чтения
+	values := redisURLFields(url)
+	args := make([]interface{}, 0, 1+2*len(values))
+	args = append(args, int(r.ttl.Seconds()))
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	err = redisCacheFillScript.Run(ctx, r.client, []string{key, redisTombstonePrefix + id}, args...).Err()
+	if err != nil {
+		slog.InfoContext(ctx, "failed to put URL to cache", "error", err.Error())
+	}
+
+	return url, nil
+}
+
+// GetUserURLs возвращает URL пользователя из основного хранилища.
+func (r *CachedRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	return r.repo.GetUserURLs(ctx, uid)
+}
+
+// ScanURLs возвращает страницу URL из основного хранилища.
+func (r *CachedRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	return r.repo.ScanURLs(ctx, afterID, limit)
+}
+
+// DeleteURLs помечает URL удаленными в основном хранилище и сбрасывает их записи в кэше.
+func (r *CachedRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	if err := r.repo.DeleteURLs(ctx, urls); err != nil {
+		return err
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	// Отметки об удалении ставятся до сброса записей кэша в одной транзакции
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		keys := make([]string, 0, len(urls))
+		for _, url := range urls {
+			pipe.Set(ctx, redisTombstonePrefix+url.ID, 1, cacheTombstoneTTL)
+			keys = append(keys, redisCachePrefix+url.ID)
+		}
+		pipe.Del(ctx, keys...)
+		return nil
+	})
+	return err
+}
+
+// ExportURLs выгружает все URL из основного хранилища.
+func (r *CachedRepository) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	return ExportURLs(ctx, r.repo, fn)
+}
+
+// Truncate удаляет все URL из основного хранилища и сбрасывает кэш.
+func (r *CachedRepository) Truncate(ctx context.Context) error {
+	if err := Truncate(ctx, r.repo); err != nil {
+		return err
+	}
+	return redisDeleteKeys(ctx, r.client, redisCachePrefix+"*")
+}
+
+// ReplaceURLs заменяет все URL основного хранилища и сбрасывает кэш.
+func (r *CachedRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	if err := ReplaceURLs(ctx, r.repo, load); err != nil {
+		return err
+	}
+	return redisDeleteKeys(ctx, r.client, redisCachePrefix+"*")
+}
+
+// GetQuota возвращает переопределенные квоты пользователя из основного хранилища.
+func (r *CachedRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	return GetQuota(ctx, r.repo, uid)
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя в основное хранилище.
+func (r *CachedRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	return SetQuota(ctx, r.repo, uid, quota)
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя из основного хранилища.
+func (r *CachedRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	return DeleteQuota(ctx, r.repo, uid)
+}
+
+// StoreLimited сохраняет URL пользователя в основное хранилище с проверкой квоты количества URL.
+func (r *CachedRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	return StoreLimited(ctx, r.repo, urls, uid, limit)
+}
+
+// CreateUser сохраняет нового пользователя в основное хранилище, передает ему URL анонимного
+// пользователя и удаляет из кэша переданные URL со старым владельцем.
+func (r *CachedRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	urls, err := r.repo.GetUserURLs(ctx, anonymous)
+	if err != nil {
+		return err
+	}
+
+	if err = CreateUser(ctx, r.repo, user, anonymous); err != nil {
+		return err
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		keys = append(keys, redisCachePrefix+url.ID)
+	}
+
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// GetUser возвращает пользователя по идентификатору из основного хранилища.
+func (r *CachedRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return GetUser(ctx, r.repo, id)
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты из основного хранилища.
+func (r *CachedRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return GetUserByEmail(ctx, r.repo, email)
+}
+
+// Health возвращает состояние основного хранилища и кэша. Кэш необязателен -
+// при его недоступности запросы выполняются к основному хранилищу.
+func (r *CachedRepository) Health(ctx context.Context) map[string]model.Health {
+	health := r.repo.Health(ctx)
+	health["redis_cache"] = model.NewHealth(r.client.Ping(ctx).Err(), true)
+	return health
+}
+
+// Close закрывает основное хранилище и соединение с Redis.
+func (r *CachedRepository) Close() error {
+	err := r.repo.Close()
+	if err != nil {
+		_ = r.client.Close()
+		return err
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+	"github.com/RomanAgaltsev/urlcut/internal/repository/repositorytest"
+)
+
+// openRepository открывает хранилище по строке соединения и закрывает его по окончании теста.
+func openRepository(t *testing.T, dsn string) interfaces.Repository {
+	repo, err := repository.Open(context.Background(), dsn, &config.Config{})
+	require.NoError(t, err)
+
+	// Повторное закрытие в тесте Close допустимо - ошибку игнорируем
+	t.Cleanup(func() { _ = repo.Close() })
+
+	return repo
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			return openRepository(t, "memory://")
+		})
+	})
+
+	t.Run("file", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			return openRepository(t, "file://"+filepath.Join(t.TempDir(), "storage.log"))
+		})
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			return openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))
+		})
+	})
+
+	t.Run("redis", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			return openRepository(t, "redis://"+miniredis.RunT(t).Addr())
+		})
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			client, err := repository.NewRedisClient(context.Background(), "redis://"+miniredis.RunT(t).Addr())
+			require.NoError(t, err)
+
+			repo := repository.NewCachedRepository(openRepository(t, "memory://"), client, repository.DefaultCacheTTL)
+			t.Cleanup(func() { _ = client.Close() })
+
+			return repo
+		})
+	})
+
+	t.Run("bloom", func(t *testing.T) {
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			repo, err := repository.NewFilteredRepository(context.Background(), openRepository(t, "memory://"), 1000)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		// Тесты с реальной БД выполняются, только если задана строка соединения
+		dsn := os.Getenv("TEST_DATABASE_DSN")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_DSN is not set")
+		}
+
+		repositorytest.Run(t, func(t *testing.T) interfaces.Repository {
+			return openRepository(t, dsn)
+		})
+	})
+}
@@ -8,6 +8,8 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -41,14 +43,24 @@ func TestDBRepository(t *testing.T) {
 	rowsSel := sqlmock.NewRows([]string{"id", "long_url", "base_url", "url_id", "created_at", "uid", "is_deleted"}).
 		AddRow(1, longURL, BaseURL, urlID, time.Now(), uid, false)
 
+	mock.ExpectPrepare("(.*)SELECT(.*)")
+	mock.ExpectPrepare("(.*)INSERT(.*)")
+	mock.ExpectPrepare("(.*)DELETE(.*)")
 	mock.ExpectPrepare("(.*)UPDATE(.*)")
+	mock.ExpectPrepare("(.*)DELETE(.*)")
+	mock.ExpectPrepare("(.*)SELECT(.*)")
+	mock.ExpectPrepare("(.*)SELECT(.*)")
+	mock.ExpectPrepare("(.*)SELECT(.*)")
+	mock.ExpectPrepare("(.*)SELECT(.*)")
 	mock.ExpectPrepare("(.*)SELECT(.*)")
 	mock.ExpectPrepare("(.*)SELECT(.*)")
 	mock.ExpectPrepare("(.*)SELECT(.*)")
 	mock.ExpectPrepare("(.*)INSERT(.*)")
+	mock.ExpectPrepare("(.*)UPDATE(.*)")
+	mock.ExpectPrepare("(.*)INSERT(.*)")
 	mock.ExpectBegin()
 	mock.ExpectQuery("(.*)INSERT(.*)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(rowsIns)
 	mock.ExpectCommit()
 	mock.ExpectQuery("(.*)SELECT(.*)").
@@ -92,3 +104,37 @@ func TestDBRepository(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
 }
+
+func TestDBRepositoryStoreIntegrity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	url := &model.URL{Long: "https://practicum.yandex.ru", Base: "http://localhost:8080", ID: random.String(8), UID: uuid.New()}
+
+	// Нарушение уникальности без конфликтного URL: совпал идентификатор
+	mock.ExpectBegin()
+	mock.ExpectQuery("(.*)INSERT(.*)").
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation})
+	mock.ExpectRollback()
+	mock.ExpectQuery("(.*)SELECT(.*)").
+		WithArgs(url.Long).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "long_url", "base_url", "url_id", "created_at", "uid", "is_deleted"}))
+
+	dbRepository, err := NewDBRepository(db)
+	require.NoError(t, err)
+
+	// Ошибка возвращается сразу, без повторных попыток
+	start := time.Now()
+	_, err = dbRepository.Store(context.TODO(), []*model.URL{url})
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Повторы оригинального URL внутри пакета отклоняются до обращения к БД
+	dup := *url
+	dup.ID = random.String(8)
+	_, err = dbRepository.Store(context.TODO(), []*model.URL{url, &dup})
+	assert.ErrorIs(t, err, ErrDuplicateURL)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package repository
+
+import "os"
+
+// lockFile на платформах без flock не блокирует файл - защита от открытия
+// файлового хранилища несколькими процессами доступна только в unix системах.
+func lockFile(_ *os.File, _ bool) error {
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package repository
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile без ожидания ставит на файл исключительную или разделяемую блокировку flock.
+// Блокировка снимается при закрытии файла, в том числе при завершении процесса.
+func lockFile(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrStorageLocked
+	}
+	return err
+}
@@ -2,66 +2,586 @@ package repository
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
 )
 
-// readFromFile считывает данные с URL из файла в мапу и возвращает её.
-func readFromFile(fileStoragePath string) (map[string]*model.URL, error) {
-	// Открываем файл на чтение
-	file, err := os.OpenFile(fileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
+// Параметры формата файлового хранилища.
+const (
+	// fileLogFormat - идентификатор формата в заголовке файла.
+	fileLogFormat = "urlcut-log"
+
+	// fileLogVersion - текущая версия формата файла.
+	fileLogVersion = 1
+)
+
+// Операции, записываемые в файловое хранилище.
+const (
+	fileLogOpStore  = "store"
+	fileLogOpDelete = "delete"
+)
+
+// Переменные ошибок файлового хранилища.
+var (
+	// ErrStorageCorrupted ошибка повреждения файлового хранилища.
+	ErrStorageCorrupted = fmt.Errorf("storage file is corrupted")
+
+	// ErrStorageVersion ошибка неподдерживаемой версии формата файлового хранилища.
+	ErrStorageVersion = fmt.Errorf("unsupported storage file version")
+
+	// ErrUnknownSyncPolicy ошибка неизвестной политики fsync файлового хранилища.
+	ErrUnknownSyncPolicy = fmt.Errorf("unknown storage file sync policy")
+
+	// ErrStorageLocked ошибка открытия файлового хранилища, которое открыто другим процессом.
+	ErrStorageLocked = fmt.Errorf("storage file is locked by another process")
+
+	// ErrStorageReadOnly ошибка изменения файлового хранилища, открытого только для чтения.
+	ErrStorageReadOnly = fmt.Errorf("storage file is opened read-only")
+)
+
+// FileStorageOptions содержит параметры файлового хранилища.
+type FileStorageOptions struct {
+	SyncPolicy      string        // Политика fsync: always, interval или never
+	SyncInterval    time.Duration // Интервал fsync для политики interval
+	CompactInterval time.Duration // Интервал уплотнения файла, 0 - уплотнение только при закрытии
+	Repair          bool          // Отбрасывать поврежденный хвост файла вместо ошибки
+	ReadOnly        bool          // Открыть только для чтения - для экспорта и резервного копирования
+}
+
+// FileStorageOptionsFromConfig возвращает параметры файлового хранилища из конфигурации приложения.
+func FileStorageOptionsFromConfig(cfg *config.Config) FileStorageOptions {
+	return FileStorageOptions{
+		SyncPolicy:      cfg.FileSyncPolicy,
+		SyncInterval:    cfg.FileSyncInterval.Duration,
+		CompactInterval: cfg.FileCompactInterval.Duration,
+		Repair:          cfg.FileRepair,
+		ReadOnly:        cfg.FileReadOnly,
+	}
+}
+
+// withDefaults возвращает параметры файлового хранилища с установленными значениями по умолчанию.
+func (o FileStorageOptions) withDefaults() FileStorageOptions {
+	if o.SyncPolicy == "" {
+		o.SyncPolicy = config.FileSyncInterval
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = 1 * time.Second
+	}
+	return o
+}
+
+// fileLogHeader - заголовок файлового хранилища, первая строка файла.
+type fileLogHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// fileLogRecord - запись журнала файлового хранилища.
+// Для операции store в записи хранятся все данные URL, для delete - только идентификаторы URL и пользователя.
+type fileLogRecord struct {
+	Op  string     `json:"op"`
+	URL *model.URL `json:"url"`
+}
+
+// fileLog реализует файловое хранилище в виде журнала, в который только дописываются записи.
+// Каждая запись - строка JSON, за которой через табуляцию следует её контрольная сумма CRC32.
+// Журнал периодически уплотняется: текущее состояние пишется во временный файл, который затем
+// атомарно переименовывается в файл журнала.
+// Открытый на запись журнал исключительно блокирует файл блокировки, поэтому его не откроет
+// другой процесс. Журнал только для чтения блокирует его совместно с другими читателями,
+// никогда не пишет в файл журнала и не обрезает его, а незавершенный хвост только пропускает.
+type fileLog struct {
+	mu       sync.Mutex
+	path     string             // путь к файлу журнала
+	opts     FileStorageOptions // параметры хранилища
+	lock     *os.File           // файл блокировки, удерживаемой до закрытия журнала
+	file     *os.File           // файл журнала, открытый на дозапись
+	dirty    bool               // есть записи, не сброшенные на диск
+	appended int                // количество записей с момента последнего уплотнения
+}
+
+// openFileLog открывает журнал по переданному пути, проигрывает его и возвращает восстановленное состояние.
+func openFileLog(path string, opts FileStorageOptions) (*fileLog, map[string]*model.URL, error) {
+	opts = opts.withDefaults()
+
+	switch opts.SyncPolicy {
+	case config.FileSyncAlways, config.FileSyncInterval, config.FileSyncNever:
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownSyncPolicy, opts.SyncPolicy)
+	}
+
+	lock, err := os.OpenFile(path+lockFileSuffix, os.O_RDONLY|os.O_CREATE, 0666)
 	if err != nil {
+		return nil, nil, err
+	}
+	if err = lockFile(lock, !opts.ReadOnly); err != nil {
+		_ = lock.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	flag := os.O_RDWR | os.O_CREATE
+	if opts.ReadOnly {
+		flag = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		_ = lock.Close()
+		return nil, nil, err
+	}
+
+	l := &fileLog{
+		path: path,
+		opts: opts,
+		lock: lock,
+		file: file,
+	}
+
+	m, legacy, err := l.replay()
+	if err != nil {
+		_ = file.Close()
+		_ = lock.Close()
+		return nil, nil, err
+	}
+
+	// Файл старого формата сразу переписываем в новом, если журнал открыт на запись
+	if legacy && !opts.ReadOnly {
+		slog.Info("converting storage file to the log format", slog.String("path", path))
+		if err = l.compact(mapValues(m)); err != nil {
+			_ = l.close()
+			return nil, nil, err
+		}
+	}
+
+	return l, m, nil
+}
+
+// replay читает журнал с начала, проверяет записи и применяет их к состоянию.
+// Незавершенная последняя запись, оставшаяся от прерванной записи, отбрасывается.
+// Поврежденная запись приводит к ошибке, а в режиме восстановления отбрасывается вместе с хвостом файла.
+// Возвращает признак файла старого формата - строк с URL без заголовка.
+func (l *fileLog) replay() (map[string]*model.URL, bool, error) {
+	m := make(map[string]*model.URL)
+
+	reader := bufio.NewReader(l.file)
+
+	// Пустой файл - пишем заголовок
+	header, err := reader.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(header) == 0 {
+		if l.opts.ReadOnly {
+			return m, false, nil
+		}
+		return m, false, l.writeHeader()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+
+	var h fileLogHeader
+	if errh := json.Unmarshal(header, &h); errh != nil || h.Format != fileLogFormat {
+		// Заголовка нет - это файл старого формата
+		m, err = l.replayLegacy()
+		return m, true, err
+	}
+	if h.Version > fileLogVersion {
+		return nil, false, fmt.Errorf("%w: %d", ErrStorageVersion, h.Version)
+	}
+
+	offset := int64(len(header))
+	lineNum := 1
+
+	for {
+		line, errr := reader.ReadBytes('\n')
+		if errors.Is(errr, io.EOF) {
+			if len(line) != 0 {
+				// Прерванная запись - отбрасываем
+				slog.Warn("discarding incomplete storage file record",
+					slog.String("path", l.path),
+					slog.Int64("offset", offset))
+				return m, false, l.truncate(offset)
+			}
+			break
+		}
+		if errr != nil {
+			return nil, false, errr
+		}
+		lineNum++
+
+		record, errp := parseFileLogRecord(line)
+		if errp != nil {
+			if !l.opts.Repair {
+				return nil, false, fmt.Errorf("%w: %s line %d: %s", ErrStorageCorrupted, l.path, lineNum, errp.Error())
+			}
+			slog.Warn("repairing storage file: discarding corrupted tail",
+				slog.String("path", l.path),
+				slog.Int("line", lineNum),
+				slog.String("error", errp.Error()))
+			return m, false, l.truncate(offset)
+		}
+
+		applyFileLogRecord(m, record)
+		offset += int64(len(line))
+	}
+
+	// Дальше будем только дописывать
+	_, err = l.file.Seek(0, io.SeekEnd)
+	return m, false, err
+}
+
+// replayLegacy читает файл старого формата - по одному URL в формате JSON на строку.
+func (l *fileLog) replayLegacy() (map[string]*model.URL, error) {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
-	defer func() { _ = file.Close() }()
 
-	// Создаем мапу
 	m := make(map[string]*model.URL)
 
-	// Читаем данные файла сканером
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(l.file)
+	lineNum := 0
 	for scanner.Scan() {
-		data := scanner.Bytes()
+		lineNum++
 		var u model.URL
-		if err := json.Unmarshal(data, &u); err != nil {
-			return nil, err
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			return nil, fmt.Errorf("%w: %s line %d: %s", ErrStorageCorrupted, l.path, lineNum, err.Error())
 		}
 		m[u.ID] = &u
 	}
 
-	// Возвращаем мапу
-	return m, nil
+	return m, scanner.Err()
+}
+
+// appendStore дописывает в журнал записи сохранения URL.
+func (l *fileLog) appendStore(urls []*model.URL) error {
+	return l.append(fileLogOpStore, urls)
 }
 
-// writeToFile сохраняет переданную мапу с URL в файл по переданному пути.
-func writeToFile(fileStoragePath string, m map[string]*model.URL) error {
-	// Открываем файл на запись
-	file, err := os.OpenFile(fileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+// appendDelete дописывает в журнал записи удаления URL.
+func (l *fileLog) appendDelete(urls []*model.URL) error {
+	deleted := make([]*model.URL, 0, len(urls))
+	for _, url := range urls {
+		deleted = append(deleted, &model.URL{ID: url.ID, UID: url.UID})
+	}
+	return l.append(fileLogOpDelete, deleted)
+}
+
+// append дописывает в журнал записи переданной операции одним вызовом записи в файл.
+func (l *fileLog) append(op string, urls []*model.URL) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	if l.opts.ReadOnly {
+		return ErrStorageReadOnly
+	}
+
+	var buf bytes.Buffer
+	for _, url := range urls {
+		if err := writeFileLogRecord(&buf, fileLogRecord{Op: op, URL: url}); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	l.appended += len(urls)
+
+	if l.opts.SyncPolicy == config.FileSyncAlways {
+		return l.file.Sync()
+	}
+	l.dirty = true
+
+	return nil
+}
+
+// sync сбрасывает на диск записи журнала, если они есть.
+func (l *fileLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+
+	return l.file.Sync()
+}
+
+// needsCompaction сообщает, были ли записи в журнал с момента последнего уплотнения.
+func (l *fileLog) needsCompaction() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.appended != 0
+}
+
+// compact уплотняет журнал: переданное состояние пишется во временный файл,
+// который сбрасывается на диск и переименовывается в файл журнала.
+// Вызывающий должен гарантировать, что между снятием состояния и уплотнением журнал не пополняется.
+func (l *fileLog) compact(urls []*model.URL) error {
+	if l.opts.ReadOnly {
+		return ErrStorageReadOnly
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tmpPath := l.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
+	// Если что-то пойдет не так, временный файл не нужен
+	defer func() { _ = os.Remove(tmpPath) }()
 
-	// Писать в файл будем через буфер
-	writer := bufio.NewWriter(file)
-	for _, v := range m {
-		data, errj := json.Marshal(*v)
-		if errj != nil {
-			return errj
+	writer := bufio.NewWriter(tmp)
+	err = writeFileLogHeader(writer)
+	for _, url := range urls {
+		if err != nil {
+			break
 		}
-		if _, err = writer.Write(data); err != nil {
-			return err
-		}
-		if err = writer.WriteByte('\n'); err != nil {
-			return err
+		err = writeFileLogRecord(writer, fileLogRecord{Op: fileLogOpStore, URL: url})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errc := tmp.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		return err
+	}
+
+	// Атомарно подменяем файл журнала
+	if err = os.Rename(tmpPath, l.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(l.path))
+
+	// Старый файл больше не нужен, открываем новый на дозапись
+	_ = l.file.Close()
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	l.appended = 0
+	l.dirty = false
+
+	return nil
+}
+
+// health проверяет, что файл журнала открыт и доступен.
+func (l *fileLog) health() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.file.Stat()
+	return err
+}
+
+// close сбрасывает записи журнала на диск, закрывает файл и снимает блокировку.
+func (l *fileLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Блокировка снимается закрытием файла блокировки после закрытия журнала
+	defer func() { _ = l.lock.Close() }()
+
+	if l.opts.ReadOnly {
+		return l.file.Close()
+	}
+	if err := l.file.Sync(); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// writeHeader пишет заголовок в пустой файл журнала.
+func (l *fileLog) writeHeader() error {
+	if err := writeFileLogHeader(l.file); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// truncate обрезает файл журнала по переданному смещению и переходит в его конец.
+// Журнал только для чтения не обрезается - отброшенный хвост просто не читается.
+func (l *fileLog) truncate(offset int64) error {
+	if l.opts.ReadOnly {
+		return nil
+	}
+	if err := l.file.Truncate(offset); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	_, err := l.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// writeFileLogHeader пишет заголовок журнала.
+func writeFileLogHeader(w io.Writer) error {
+	data, err := json.Marshal(fileLogHeader{Format: fileLogFormat, Version: fileLogVersion})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeFileLogRecord пишет запись журнала вместе с контрольной суммой.
+func writeFileLogRecord(w io.Writer, record fileLogRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\t%08x\n", data, crc32.ChecksumIEEE(data))
+	return err
+}
+
+// parseFileLogRecord разбирает строку журнала и проверяет её контрольную сумму.
+func parseFileLogRecord(line []byte) (fileLogRecord, error) {
+	var record fileLogRecord
+
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+
+	i := bytes.LastIndexByte(line, '\t')
+	if i < 0 {
+		return record, fmt.Errorf("no checksum")
+	}
+	data, sum := line[:i], line[i+1:]
+
+	expected, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil {
+		return record, fmt.Errorf("bad checksum: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != uint32(expected) {
+		return record, fmt.Errorf("checksum mismatch")
+	}
+
+	if err = json.Unmarshal(data, &record); err != nil {
+		return record, err
+	}
+	if record.URL == nil {
+		return record, fmt.Errorf("no URL in record")
+	}
+
+	return record, nil
+}
+
+// applyFileLogRecord применяет запись журнала к состоянию.
+func applyFileLogRecord(m map[string]*model.URL, record fileLogRecord) {
+	switch record.Op {
+	case fileLogOpStore:
+		m[record.URL.ID] = record.URL
+	case fileLogOpDelete:
+		u, ok := m[record.URL.ID]
+		if ok && u.UID == record.URL.UID {
+			u.Deleted = true
 		}
 	}
+}
+
+// Суффиксы файлов, которые хранятся рядом с файлом журнала. Квоты и пользователи меняются редко,
+// поэтому файлы каждый раз переписываются целиком.
+const (
+	// quotaFileSuffix - суффикс файла квот пользователей.
+	quotaFileSuffix = ".quotas"
+
+	// userFileSuffix - суффикс файла зарегистрированных пользователей.
+	userFileSuffix = ".users"
+
+	// lockFileSuffix - суффикс файла блокировки журнала. Блокируется отдельный файл,
+	// потому что уплотнение подменяет файл журнала новым.
+	lockFileSuffix = ".lock"
+)
 
-	if err = writer.Flush(); err != nil {
+// readJSONFile читает значение из файла JSON. Отсутствующий файл оставляет значение без изменений.
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
 
-	// Закрываем файл
-	return file.Close()
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to read file %q: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile атомарно переписывает файл JSON с переданными правами через временный файл.
+func writeJSONFile(path string, v any, perm os.FileMode) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errc := tmp.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+
+	return nil
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла пережило сбой питания.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// mapValues возвращает слайс значений мапы URL.
+func mapValues(m map[string]*model.URL) []*model.URL {
+	urls := make([]*model.URL, 0, len(m))
+	for _, url := range m {
+		urls = append(urls, url)
+	}
+	return urls
 }
@@ -2,52 +2,450 @@ package repository
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
 )
 
+func readLines(t *testing.T, path string) [][]byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return bytes.SplitAfter(data, []byte{'\n'})
+}
+
 func TestFileStorage(t *testing.T) {
-	const fileStoragePath = "test.json"
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	uid := uuid.New()
 
 	urlS := &model.URL{
 		Long: "https://app.pachca.com",
 		Base: "http://localhost:8080",
 		ID:   "1q2w3e4r",
+		UID:  uid,
 	}
-	state := map[string]*model.URL{
-		"1q2w3e4r": urlS,
+	urlS2 := &model.URL{
+		Long: "https://practicum.yandex.ru",
+		Base: "http://localhost:8080",
+		ID:   "5t6y7u8i",
+		UID:  uid,
 	}
 
-	err := writeToFile(fileStoragePath, state)
+	opts := FileStorageOptions{SyncPolicy: config.FileSyncAlways}
+
+	log, state, err := openFileLog(fileStoragePath, opts)
+	require.NoError(t, err)
+	assert.Empty(t, state)
+
+	err = log.appendStore([]*model.URL{urlS, urlS2})
+	require.NoError(t, err)
+
+	err = log.appendDelete([]*model.URL{{ID: urlS2.ID, UID: uid}})
+	require.NoError(t, err)
+
+	// Журнал не закрываем - как будто процесс был убит и система сняла его блокировку
+	require.NoError(t, log.lock.Close())
+	restoredLog, restoredState, err := openFileLog(fileStoragePath, opts)
+	require.NoError(t, err)
+	require.Len(t, restoredState, 2)
+	assert.Equal(t, urlS, restoredState[urlS.ID])
+	assert.True(t, restoredState[urlS2.ID].Deleted)
+
+	_ = log.close()
+
+	// Заголовок и три записи
+	lines := readLines(t, fileStoragePath)
+	assert.Len(t, lines, 5)
+
+	var header fileLogHeader
+	err = json.Unmarshal(lines[0], &header)
+	require.NoError(t, err)
+	assert.Equal(t, fileLogHeader{Format: fileLogFormat, Version: fileLogVersion}, header)
+
+	// Уплотнение оставляет по одной записи на URL
+	err = restoredLog.compact(mapValues(restoredState))
+	require.NoError(t, err)
+	assert.False(t, restoredLog.needsCompaction())
+
+	lines = readLines(t, fileStoragePath)
+	assert.Len(t, lines, 4)
+
+	_, err = os.Stat(fileStoragePath + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	err = restoredLog.close()
+	require.NoError(t, err)
+
+	_, restoredState, err = openFileLog(fileStoragePath, opts)
+	require.NoError(t, err)
+	assert.Equal(t, urlS, restoredState[urlS.ID])
+	assert.True(t, restoredState[urlS2.ID].Deleted)
+}
+
+func TestFileStorageTornWrite(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	urlS := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r"}
+
+	log, _, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	require.NoError(t, log.appendStore([]*model.URL{urlS}))
+	require.NoError(t, log.close())
+
+	// Запись оборвалась на середине
+	file, err := os.OpenFile(fileStoragePath, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"store","url":{"Long":"https://pract`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	log, state, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*model.URL{urlS.ID: urlS}, state)
+
+	// Незавершенная запись отброшена, дописывание продолжается с корректного места
+	urlS2 := &model.URL{Long: "https://practicum.yandex.ru", Base: "http://localhost:8080", ID: "5t6y7u8i"}
+	require.NoError(t, log.appendStore([]*model.URL{urlS2}))
+	require.NoError(t, log.close())
+
+	_, state, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	assert.Len(t, state, 2)
+}
+
+func TestFileStorageCorruption(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	urlS := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r"}
+	urlS2 := &model.URL{Long: "https://practicum.yandex.ru", Base: "http://localhost:8080", ID: "5t6y7u8i"}
+
+	log, _, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	require.NoError(t, log.appendStore([]*model.URL{urlS}))
+	require.NoError(t, log.appendStore([]*model.URL{urlS2}))
+	require.NoError(t, log.close())
+
+	// Портим вторую запись
+	data, err := os.ReadFile(fileStoragePath)
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte("practicum"), []byte("practikum"), 1)
+	require.NoError(t, os.WriteFile(fileStoragePath, data, 0666))
+
+	_, _, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	assert.ErrorIs(t, err, ErrStorageCorrupted)
+
+	_, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	assert.ErrorIs(t, err, ErrStorageCorrupted)
+
+	// В режиме восстановления поврежденный хвост отбрасывается
+	log, state, err := openFileLog(fileStoragePath, FileStorageOptions{Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*model.URL{urlS.ID: urlS}, state)
+	require.NoError(t, log.close())
+
+	_, state, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	assert.Len(t, state, 1)
+}
+
+func TestFileStorageLegacy(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	urlS := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r"}
+
+	// Файл старого формата - URL построчно без заголовка
+	file, err := os.Create(fileStoragePath)
+	require.NoError(t, err)
+	writer := bufio.NewWriter(file)
+	data, err := json.Marshal(urlS)
+	require.NoError(t, err)
+	_, _ = writer.Write(append(data, '\n'))
+	require.NoError(t, writer.Flush())
+	require.NoError(t, file.Close())
+
+	log, state, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*model.URL{urlS.ID: urlS}, state)
+	require.NoError(t, log.close())
+
+	// Файл переписан в новом формате
+	var header fileLogHeader
+	err = json.Unmarshal(readLines(t, fileStoragePath)[0], &header)
+	require.NoError(t, err)
+	assert.Equal(t, fileLogFormat, header.Format)
+}
+
+func TestFileStorageLock(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	log, _, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+
+	// Открытый на запись журнал не открыть ни на запись, ни на чтение
+	_, _, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	assert.ErrorIs(t, err, ErrStorageLocked)
+	_, _, err = openFileLog(fileStoragePath, FileStorageOptions{ReadOnly: true})
+	assert.ErrorIs(t, err, ErrStorageLocked)
+
+	require.NoError(t, log.close())
+
+	// Читателей может быть несколько, но пока они открыты, журнал не открыть на запись
+	reader, _, err := openFileLog(fileStoragePath, FileStorageOptions{ReadOnly: true})
+	require.NoError(t, err)
+	reader2, _, err := openFileLog(fileStoragePath, FileStorageOptions{ReadOnly: true})
+	require.NoError(t, err)
+
+	_, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	assert.ErrorIs(t, err, ErrStorageLocked)
+
+	require.NoError(t, reader.close())
+	require.NoError(t, reader2.close())
+
+	log, _, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	require.NoError(t, log.close())
+}
+
+func TestFileStorageReadOnly(t *testing.T) {
+	ctx := context.Background()
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	urlS := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r"}
+
+	// Файл только для чтения не создается
+	_, _, err := openFileLog(fileStoragePath, FileStorageOptions{ReadOnly: true})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	log, _, err := openFileLog(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	require.NoError(t, log.appendStore([]*model.URL{urlS}))
+	require.NoError(t, log.close())
+
+	// Незавершенная запись пропускается, но файл не обрезается
+	file, err := os.OpenFile(fileStoragePath, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"store","url":{"Long":"https://pract`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	data, err := os.ReadFile(fileStoragePath)
+	require.NoError(t, err)
+
+	repo, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{ReadOnly: true})
+	require.NoError(t, err)
+
+	urlGet, err := repo.Get(ctx, urlS.ID)
+	require.NoError(t, err)
+	assert.Equal(t, urlS.Long, urlGet.Long)
+
+	// Изменения отклоняются
+	_, err = repo.Store(ctx, []*model.URL{{Long: "https://practicum.yandex.ru", Base: "http://localhost:8080", ID: "5t6y7u8i"}})
+	assert.ErrorIs(t, err, ErrStorageReadOnly)
+	assert.ErrorIs(t, repo.DeleteURLs(ctx, []*model.URL{urlS}), ErrStorageReadOnly)
+	assert.ErrorIs(t, repo.Truncate(ctx), ErrStorageReadOnly)
+	assert.ErrorIs(t, repo.SetQuota(ctx, uuid.New(), model.Quota{MaxLinks: 1}), ErrStorageReadOnly)
+	require.NoError(t, repo.Close())
+
+	dataAfter, err := os.ReadFile(fileStoragePath)
 	require.NoError(t, err)
+	assert.Equal(t, data, dataAfter)
 
-	restoredState, err := readFromFile(fileStoragePath)
+	// Файл старого формата читается, но не конвертируется
+	legacy, err := json.Marshal(urlS)
 	require.NoError(t, err)
-	assert.Equal(t, state, restoredState)
+	require.NoError(t, os.WriteFile(fileStoragePath, append(legacy, '\n'), 0666))
 
-	file, err := os.OpenFile(fileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
+	log, state, err := openFileLog(fileStoragePath, FileStorageOptions{ReadOnly: true})
 	require.NoError(t, err)
+	assert.Equal(t, map[string]*model.URL{urlS.ID: urlS}, state)
+	require.NoError(t, log.close())
+
+	dataAfter, err = os.ReadFile(fileStoragePath)
+	require.NoError(t, err)
+	assert.Equal(t, append(legacy, '\n'), dataAfter)
+}
+
+func TestFileStorageVersion(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+
+	err := os.WriteFile(fileStoragePath, []byte(`{"format":"urlcut-log","version":100}`+"\n"), 0666)
+	require.NoError(t, err)
+
+	_, _, err = openFileLog(fileStoragePath, FileStorageOptions{})
+	assert.ErrorIs(t, err, ErrStorageVersion)
 
-	scanner := bufio.NewScanner(file)
-	scanner.Scan()
+	_, _, err = openFileLog(filepath.Join(t.TempDir(), "test.json"), FileStorageOptions{SyncPolicy: "sometimes"})
+	assert.ErrorIs(t, err, ErrUnknownSyncPolicy)
+}
 
-	data := scanner.Bytes()
+func TestInMemoryRepositoryCompaction(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
 
-	var urlU model.URL
-	err = json.Unmarshal(data, &urlU)
+	inMemoryRepository, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{
+		SyncPolicy:      config.FileSyncNever,
+		CompactInterval: 10 * time.Millisecond,
+	})
 	require.NoError(t, err)
-	assert.Equal(t, *urlS, urlU)
 
-	err = file.Close()
+	uid := uuid.New()
+	url := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r", UID: uid}
+
+	_, err = inMemoryRepository.Store(context.TODO(), []*model.URL{url})
+	require.NoError(t, err)
+	err = inMemoryRepository.DeleteURLs(context.TODO(), []*model.URL{{ID: url.ID, UID: uid}})
 	require.NoError(t, err)
 
-	err = os.Remove(fileStoragePath)
+	// Фоновое уплотнение сворачивает две записи в одну
+	assert.Eventually(t, func() bool {
+		return len(readLines(t, fileStoragePath)) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	err = inMemoryRepository.Close()
 	require.NoError(t, err)
+}
 
+func TestInMemoryRepositoryQuotaFile(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+	ctx := context.Background()
+	uid := uuid.New()
+	quota := model.Quota{MaxLinks: 5, MaxURLLength: -1}
+
+	repo, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	require.NoError(t, repo.SetQuota(ctx, uid, quota))
+	require.NoError(t, repo.Close())
+
+	// Квоты восстанавливаются из файла квот
+	repo, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+
+	got, err := repo.GetQuota(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, quota, *got)
+
+	require.NoError(t, repo.DeleteQuota(ctx, uid))
+	require.NoError(t, repo.Close())
+
+	repo, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	defer func() { _ = repo.Close() }()
+
+	_, err = repo.GetQuota(ctx, uid)
+	assert.ErrorIs(t, err, ErrQuotaNotFound)
+
+	// Поврежденный файл квот не позволяет открыть хранилище
+	require.NoError(t, os.WriteFile(fileStoragePath+quotaFileSuffix, []byte("{"), 0666))
+	_, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	assert.Error(t, err)
+}
+
+func TestInMemoryRepositoryUserFile(t *testing.T) {
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+	ctx := context.Background()
+	user := &model.User{
+		ID:           uuid.New(),
+		Email:        "user@example.com",
+		PasswordHash: "$2a$10$hash",
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	anonymous := uuid.New()
+	url := &model.URL{Long: "https://example.com", Base: "http://localhost:8080", ID: "qwerty12", UID: anonymous}
+
+	repo, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	_, err = repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateUser(ctx, user, anonymous))
+	require.NoError(t, repo.Close())
+
+	// Файл пользователей содержит хэши паролей и доступен только владельцу
+	info, err := os.Stat(fileStoragePath + userFileSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Пользователи восстанавливаются из файла пользователей
+	repo, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+	defer func() { _ = repo.Close() }()
+
+	got, err := repo.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.Equal(t, user.PasswordHash, got.PasswordHash)
+	assert.True(t, user.CreatedAt.Equal(got.CreatedAt))
+
+	// Переданные пользователю URL восстанавливаются из журнала
+	urls, err := repo.GetUserURLs(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, url.ID, urls[0].ID)
+
+	assert.ErrorIs(t, repo.CreateUser(ctx, user, anonymous), ErrUserExists)
+
+	// Поврежденный файл пользователей не позволяет открыть хранилище
+	require.NoError(t, os.WriteFile(fileStoragePath+userFileSuffix, []byte("{"), 0600))
+	_, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	assert.Error(t, err)
+}
+
+func TestInMemoryRepositoryCreateUserFailure(t *testing.T) {
+	ctx := context.Background()
+
+	for name, fail := range map[string]func(t *testing.T, repo *InMemoryRepository, path string){
+		// Файл пользователей нельзя заменить каталогом
+		"users": func(t *testing.T, _ *InMemoryRepository, path string) {
+			require.NoError(t, os.Remove(path+userFileSuffix))
+			require.NoError(t, os.Mkdir(path+userFileSuffix, 0700))
+		},
+		// В закрытый журнал нельзя дописать передачу URL
+		"log": func(t *testing.T, repo *InMemoryRepository, _ string) {
+			require.NoError(t, repo.log.close())
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fileStoragePath := filepath.Join(t.TempDir(), "test.json")
+			anonymous := uuid.New()
+			url := &model.URL{Long: "https://example.com", Base: "http://localhost:8080", ID: "qwerty12", UID: anonymous}
+
+			repo, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = repo.Close() })
+			_, err = repo.Store(ctx, []*model.URL{url})
+			require.NoError(t, err)
+			require.NoError(t, repo.CreateUser(ctx, &model.User{ID: uuid.New(), Email: "first@example.com"}, uuid.New()))
+
+			fail(t, repo, fileStoragePath)
+
+			user := &model.User{ID: uuid.New(), Email: "user@example.com"}
+			require.Error(t, repo.CreateUser(ctx, user, anonymous))
+
+			// Пользователь не создан, URL остаются у анонимного пользователя
+			_, err = repo.GetUser(ctx, user.ID)
+			assert.ErrorIs(t, err, ErrUserNotFound)
+
+			got, err := repo.Get(ctx, url.ID)
+			require.NoError(t, err)
+			assert.Equal(t, anonymous, got.UID)
+
+			urls, err := repo.GetUserURLs(ctx, anonymous)
+			require.NoError(t, err)
+			assert.Equal(t, []string{url.ID}, []string{urls[0].ID})
+
+			urls, err = repo.GetUserURLs(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Empty(t, urls)
+		})
+	}
 }
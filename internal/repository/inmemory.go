@@ -3,10 +3,15 @@ package repository
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
 )
@@ -14,6 +19,16 @@ import (
 // Неиспользуемая переменная для проверки реализации интерфейса хранилища in memory репозиторием.
 var _ interfaces.Repository = (*InMemoryRepository)(nil)
 
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*InMemoryRepository)(nil)
+	_ interfaces.Truncater     = (*InMemoryRepository)(nil)
+	_ interfaces.Replacer      = (*InMemoryRepository)(nil)
+	_ interfaces.QuotaStorer   = (*InMemoryRepository)(nil)
+	_ interfaces.LimitedStorer = (*InMemoryRepository)(nil)
+	_ interfaces.UserStorer    = (*InMemoryRepository)(nil)
+)
+
 // Переменные ошибок.
 var (
 	// ErrIDNotFound ошибка отсутствия URL в хранилище.
@@ -23,55 +38,223 @@ var (
 	ErrStorageUnavailable = fmt.Errorf("storage unavailable")
 )
 
+// Схемы строк соединения in memory хранилища.
+const (
+	// memoryScheme - хранилище только в памяти: memory://
+	memoryScheme = "memory"
+
+	// fileScheme - хранилище в памяти с файловым хранилищем: file:///var/lib/urlcut.log
+	fileScheme = "file"
+)
+
+func init() {
+	Register(memoryScheme, Backend{
+		Open: func(_ context.Context, _ string, _ *config.Config) (interfaces.Repository, error) {
+			return NewInMemoryRepository("", FileStorageOptions{})
+		},
+	})
+	Register(fileScheme, Backend{
+		Open: func(_ context.Context, dsn string, cfg *config.Config) (interfaces.Repository, error) {
+			path := strings.TrimPrefix(dsn, fileScheme+"://")
+			if path == "" {
+				return nil, fmt.Errorf("no storage file path in %q", dsn)
+			}
+			return NewInMemoryRepository(path, FileStorageOptionsFromConfig(cfg))
+		},
+	})
+}
+
 // InMemoryRepository реализует in memory репозиторий.
+// URL хранятся в сегментированной мапе с индексами по оригинальному адресу и по пользователю,
+// поэтому конкурентные запросы к разным URL не блокируют друг друга.
+// Если задан путь к файловому хранилищу, все изменения сразу дописываются в журнал на диске.
 type InMemoryRepository struct {
-	m  map[string]*model.URL // мапа для хранения URL
-	f  string                // адрес файлового хранилища - путь к файлу
-	mu sync.RWMutex          // мьютекс хранилища
+	s   *shardedURLs // сегментированная мапа для хранения URL
+	log *fileLog     // журнал файлового хранилища, nil - без файлового хранилища
+
+	quotasMu   sync.Mutex                // мьютекс квот пользователей
+	quotas     map[uuid.UUID]model.Quota // переопределенные квоты пользователей
+	quotasPath string                    // файл квот рядом с файловым хранилищем, пустой - без файла
+
+	usersMu   sync.Mutex                // мьютекс зарегистрированных пользователей
+	users     map[uuid.UUID]*model.User // зарегистрированные пользователи по идентификаторам
+	userIDs   map[string]uuid.UUID      // индекс пользователей по адресам почты
+	usersPath string                    // файл пользователей рядом с файловым хранилищем, пустой - без файла
+
+	// Сохранения с проверкой квоты пользователей одного сегмента выполняются по очереди
+	limitMu [shardCount]sync.Mutex
+
+	// Изменения берут мьютекс на чтение и выполняются параллельно,
+	// уплотнение и очистка берут его на запись, чтобы видеть согласованное состояние
+	mu sync.RWMutex
+
+	done      chan struct{}  // канал остановки фоновой горутины обслуживания журнала
+	wg        sync.WaitGroup // ожидание завершения фоновой горутины
+	closeOnce sync.Once      // однократное закрытие файлового хранилища
+	closeErr  error          // результат закрытия файлового хранилища
 }
 
 // NewInMemoryRepository создает новый in memory репозиторий.
-func NewInMemoryRepository(fileStoragePath string) *InMemoryRepository {
-	m, _ := readFromFile(fileStoragePath)
+// Состояние восстанавливается из файлового хранилища по переданному пути, если он не пустой.
+// Поврежденное файловое хранилище приводит к ошибке, если не включен режим восстановления.
+// Файловое хранилище, открытое только для чтения, не меняется, а изменения репозитория возвращают ErrStorageReadOnly.
+func NewInMemoryRepository(fileStoragePath string, opts FileStorageOptions) (*InMemoryRepository, error) {
+	r := &InMemoryRepository{
+		quotas:  make(map[uuid.UUID]model.Quota),
+		users:   make(map[uuid.UUID]*model.User),
+		userIDs: make(map[string]uuid.UUID),
+		done:    make(chan struct{}),
+	}
+
+	if fileStoragePath == "" {
+		r.s = newShardedURLs(nil)
+		return r, nil
+	}
+
+	r.quotasPath = fileStoragePath + quotaFileSuffix
+	if err := readJSONFile(r.quotasPath, &r.quotas); err != nil {
+		return nil, err
+	}
 
-	return &InMemoryRepository{
-		m: m,
-		f: fileStoragePath,
+	r.usersPath = fileStoragePath + userFileSuffix
+	if err := readJSONFile(r.usersPath, &r.users); err != nil {
+		return nil, err
 	}
+	for id, user := range r.users {
+		r.userIDs[user.Email] = id
+	}
+
+	log, m, err := openFileLog(fileStoragePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	r.log = log
+
+	// Раскладываем восстановленные URL по сегментам и строим индексы
+	r.s = newShardedURLs(m)
+
+	// Запускаем фоновое обслуживание журнала
+	r.wg.Add(1)
+	go r.maintainLog(log.opts)
+
+	return r, nil
 }
 
 // Store сохраняет данные URL в in memory репозитории.
+// Данные сначала дописываются в файловое хранилище, а затем попадают в память.
+// Если какой-либо из оригинальных URL уже сохранен, не сохраняется ни один URL,
+// а возвращается сохраненный ранее URL и ошибка конфликта - так же, как в БД хранилище.
 func (r *InMemoryRepository) Store(_ context.Context, urls []*model.URL) (*model.URL, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := checkDuplicateLong(urls); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Блокируем оригинальные адреса пакета до конца сохранения
+	unlock := r.s.lockLong(urls)
+	defer unlock()
+
+	// Проверяем наличие конфликтов - удаленные URL не конфликтуют
+	for _, url := range urls {
+		if url.Deleted {
+			continue
+		}
+		if id, ok := r.s.longID(url.Long); ok {
+			if conflictURL, ok := r.s.get(id); ok {
+				return conflictURL, ErrConflict
+			}
+		}
+	}
+
+	// Блокируем идентификаторы пакета до конца сохранения - занятый идентификатор
+	// не перезаписывается так же, как в БД хранилище
+	unlockIDs := r.s.lockIDs(urls)
+	defer unlockIDs()
 
+	seen := make(map[string]struct{}, len(urls))
 	for _, url := range urls {
-		r.m[url.ID] = url
+		if _, ok := seen[url.ID]; ok || r.s.exists(url.ID) {
+			return nil, fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+		}
+		seen[url.ID] = struct{}{}
+	}
+
+	// Храним копии, чтобы изменения переданных URL не затрагивали хранилище
+	stored := make([]*model.URL, 0, len(urls))
+	for _, url := range urls {
+		u := *url
+		u.CorrID = ""
+		stored = append(stored, &u)
+	}
+
+	if r.log != nil {
+		if err := r.log.appendStore(stored); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, url := range stored {
+		r.s.put(url)
+		if !url.Deleted {
+			r.s.setLongID(url.Long, url.ID)
+		}
 	}
 
 	return nil, nil
 }
 
+// StoreLimited сохраняет URL пользователя в in memory репозитории, если количество его неудаленных URL
+// не превысит limit. Подсчет и сохранение выполняются под мьютексом сегмента пользователя.
+func (r *InMemoryRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	if err := checkDuplicateLong(urls); err != nil {
+		return nil, err
+	}
+
+	mu := &r.limitMu[uuidShard(uid)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := checkLinksQuota(r.s.userCount(uid), urls, uid, limit); err != nil {
+		return nil, err
+	}
+
+	return r.Store(ctx, urls)
+}
+
 // Get возвращает данные URL из in memory репозитория.
 func (r *InMemoryRepository) Get(_ context.Context, id string) (*model.URL, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if url, ok := r.m[id]; ok {
+	if url, ok := r.s.get(id); ok {
 		return url, nil
-	} else {
-		return url, ErrIDNotFound
 	}
+	return nil, ErrIDNotFound
 }
 
-// GetUserURLs возвращает URL пользователя из репозитория.
+// GetUserURLs возвращает неудаленные URL пользователя из репозитория по индексу пользователей.
 func (r *InMemoryRepository) GetUserURLs(_ context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	ids := r.s.userIDs(uid)
+
 	// Создаем слайс для возврата ссылок пользователя
-	urls := make([]*model.URL, 0)
+	urls := make([]*model.URL, 0, len(ids))
 
-	// Отбираем URL пользователя простым перебором
-	for _, url := range r.m {
-		if url.UID == uid {
+	for _, id := range ids {
+		// URL мог быть удален после чтения индекса
+		if url, ok := r.s.get(id); ok && !url.Deleted {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, nil
+}
+
+// ScanURLs возвращает страницу URL, включая удаленные, после переданного идентификатора.
+func (r *InMemoryRepository) ScanURLs(_ context.Context, afterID string, limit int) ([]*model.URL, error) {
+	ids := r.s.ids(afterID, limit)
+
+	urls := make([]*model.URL, 0, len(ids))
+	for _, id := range ids {
+		if url, ok := r.s.get(id); ok {
 			urls = append(urls, url)
 		}
 	}
@@ -80,19 +263,360 @@ func (r *InMemoryRepository) GetUserURLs(_ context.Context, uid uuid.UUID) ([]*m
 }
 
 // DeleteURLs удаляет URL пользователя из репозитория.
+// В файловое хранилище записываются только URL, которые действительно принадлежат пользователю.
 func (r *InMemoryRepository) DeleteURLs(_ context.Context, urls []*model.URL) error {
-	// Перебираем URL в цикле и устанавливаем пометки удаления
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Отбираем URL, которые принадлежат пользователям
+	deleted := make([]*model.URL, 0, len(urls))
+	for _, url := range urls {
+		if u, ok := r.s.owned(url.ID, url.UID); ok {
+			deleted = append(deleted, u)
+		}
+	}
+
+	if r.log != nil {
+		if err := r.log.appendDelete(deleted); err != nil {
+			return err
+		}
+	}
+
+	// Устанавливаем пометки удаления
+	for _, url := range deleted {
+		r.s.markDeleted(url)
+	}
+
+	return nil
+}
+
+// ExportURLs выгружает копию всех URL репозитория, сделанную под блокировкой, в порядке возрастания идентификаторов.
+func (r *InMemoryRepository) ExportURLs(_ context.Context, fn func(url *model.URL) error) error {
+	r.mu.Lock()
+	urls := r.s.values()
+	r.mu.Unlock()
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+
 	for _, url := range urls {
-		u, ok := r.m[url.ID]
-		if ok && u.UID == url.UID {
-			u.Deleted = true
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Truncate удаляет все URL из репозитория. Файловое хранилище уплотняется до пустого.
+func (r *InMemoryRepository) Truncate(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log != nil {
+		if err := r.log.compact(nil); err != nil {
+			return err
+		}
+	}
+
+	r.s.reset()
+
+	return nil
+}
+
+// ReplaceURLs заменяет все URL репозитория URL, переданными функцией load. Файловое хранилище уплотняется
+// до переданных URL через временный файл, поэтому при ошибке в нем остаются прежние URL.
+func (r *InMemoryRepository) ReplaceURLs(_ context.Context, load func(store func(urls []*model.URL) error) error) error {
+	// Храним копии, чтобы изменения переданных URL не затрагивали хранилище.
+	// Ограничения проверяются по всем пакетам так же, как в БД хранилище
+	stored := make([]*model.URL, 0)
+	ids := make(map[string]struct{})
+	longs := make(map[string]struct{})
+	err := load(func(urls []*model.URL) error {
+		for _, url := range urls {
+			if _, ok := ids[url.ID]; ok {
+				return fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+			}
+			if _, ok := longs[url.Long]; ok && !url.Deleted {
+				return fmt.Errorf("%w: %q", ErrDuplicateURL, url.Long)
+			}
+			ids[url.ID] = struct{}{}
+			if !url.Deleted {
+				longs[url.Long] = struct{}{}
+			}
+
+			u := *url
+			u.CorrID = ""
+			stored = append(stored, &u)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log != nil {
+		if err := r.log.compact(stored); err != nil {
+			return err
+		}
+	}
+
+	r.s.reset()
+
+	unlock := r.s.lockLong(stored)
+	defer unlock()
+
+	for _, url := range stored {
+		r.s.put(url)
+		if !url.Deleted {
+			r.s.setLongID(url.Long, url.ID)
 		}
 	}
 
 	return nil
 }
 
-// Close сохраняет данные из in memory репозитория в файловое хранилище.
+// GetQuota возвращает переопределенные квоты пользователя.
+func (r *InMemoryRepository) GetQuota(_ context.Context, uid uuid.UUID) (*model.Quota, error) {
+	r.quotasMu.Lock()
+	defer r.quotasMu.Unlock()
+
+	quota, ok := r.quotas[uid]
+	if !ok {
+		return nil, ErrQuotaNotFound
+	}
+	return &quota, nil
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя.
+// При наличии файлового хранилища квоты сначала записываются в файл квот.
+func (r *InMemoryRepository) SetQuota(_ context.Context, uid uuid.UUID, quota model.Quota) error {
+	r.quotasMu.Lock()
+	defer r.quotasMu.Unlock()
+
+	prev, existed := r.quotas[uid]
+	r.quotas[uid] = quota
+	if err := r.saveQuotas(); err != nil {
+		if existed {
+			r.quotas[uid] = prev
+		} else {
+			delete(r.quotas, uid)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя.
+func (r *InMemoryRepository) DeleteQuota(_ context.Context, uid uuid.UUID) error {
+	r.quotasMu.Lock()
+	defer r.quotasMu.Unlock()
+
+	prev, existed := r.quotas[uid]
+	if !existed {
+		return nil
+	}
+	delete(r.quotas, uid)
+	if err := r.saveQuotas(); err != nil {
+		r.quotas[uid] = prev
+		return err
+	}
+	return nil
+}
+
+// saveQuotas записывает квоты пользователей в файл квот, если он задан.
+// Вызывающий должен держать мьютекс квот.
+func (r *InMemoryRepository) saveQuotas() error {
+	if r.quotasPath == "" {
+		return nil
+	}
+	if r.log.opts.ReadOnly {
+		return ErrStorageReadOnly
+	}
+	return writeJSONFile(r.quotasPath, r.quotas, 0666)
+}
+
+// CreateUser сохраняет нового пользователя и передает ему неудаленные URL анонимного пользователя.
+// При наличии файлового хранилища пользователи сначала записываются в файл пользователей,
+// а переданные URL - в журнал записями сохранения с новым владельцем.
+func (r *InMemoryRepository) CreateUser(_ context.Context, user *model.User, anonymous uuid.UUID) error {
+	r.usersMu.Lock()
+	defer r.usersMu.Unlock()
+
+	if _, ok := r.users[user.ID]; ok {
+		return ErrUserExists
+	}
+	if _, ok := r.userIDs[user.Email]; ok {
+		return ErrUserExists
+	}
+
+	// URL передаются под блокировкой на запись, чтобы не разойтись с их параллельным удалением
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// URL зарегистрированного пользователя не передаются.
+	// Передаваемые URL - новые копии с новым владельцем, хранимые URL меняются только после сохранения изменений
+	moved := make([]*model.URL, 0)
+	if _, ok := r.users[anonymous]; !ok {
+		for _, id := range r.s.userIDs(anonymous) {
+			url, ok := r.s.get(id)
+			if !ok || url.Deleted {
+				continue
+			}
+			moved = append(moved, &model.URL{
+				Long: url.Long,
+				Base: url.Base,
+				ID:   url.ID,
+				UID:  user.ID,
+			})
+		}
+	}
+
+	u := *user
+	r.users[u.ID] = &u
+	if err := r.saveUsers(); err != nil {
+		delete(r.users, u.ID)
+		return err
+	}
+
+	if r.log != nil {
+		if err := r.log.appendStore(moved); err != nil {
+			delete(r.users, u.ID)
+			_ = r.saveUsers()
+			return err
+		}
+	}
+
+	// Изменения сохранены - передаем URL новому владельцу
+	r.userIDs[u.Email] = u.ID
+	for _, url := range moved {
+		r.s.reown(url, anonymous)
+	}
+
+	return nil
+}
+
+// saveUsers записывает пользователей в файл пользователей, если он задан.
+// Вызывающий должен держать мьютекс пользователей.
+func (r *InMemoryRepository) saveUsers() error {
+	if r.usersPath == "" {
+		return nil
+	}
+	if r.log.opts.ReadOnly {
+		return ErrStorageReadOnly
+	}
+	// Файл содержит хэши паролей, поэтому доступен только владельцу
+	return writeJSONFile(r.usersPath, r.users, 0600)
+}
+
+// GetUser возвращает пользователя по идентификатору.
+func (r *InMemoryRepository) GetUser(_ context.Context, id uuid.UUID) (*model.User, error) {
+	r.usersMu.Lock()
+	defer r.usersMu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты.
+func (r *InMemoryRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	r.usersMu.Lock()
+	id, ok := r.userIDs[email]
+	r.usersMu.Unlock()
+
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return r.GetUser(ctx, id)
+}
+
+// Health возвращает состояние репозитория. Хранилище в памяти работоспособно всегда,
+// а файловое хранилище - пока файл журнала открыт.
+func (r *InMemoryRepository) Health(_ context.Context) map[string]model.Health {
+	if r.log == nil {
+		return map[string]model.Health{
+			"memory": model.NewHealth(nil, false),
+		}
+	}
+	return map[string]model.Health{
+		"file": model.NewHealth(r.log.health(), false),
+	}
+}
+
+// Close останавливает обслуживание файлового хранилища, уплотняет и закрывает его.
+// Повторные вызовы возвращают результат первого закрытия.
 func (r *InMemoryRepository) Close() error {
-	return writeToFile(r.f, r.m)
+	if r.log == nil {
+		return nil
+	}
+
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+
+		if r.log.needsCompaction() {
+			if err := r.compact(); err != nil {
+				_ = r.log.close()
+				r.closeErr = err
+				return
+			}
+		}
+
+		r.closeErr = r.log.close()
+	})
+
+	return r.closeErr
+}
+
+// compact уплотняет файловое хранилище текущим состоянием репозитория.
+// На время уплотнения запись в репозиторий блокируется, чтобы журнал не пополнялся.
+func (r *InMemoryRepository) compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.log.compact(r.s.values())
+}
+
+// maintainLog выполняет периодические fsync и уплотнение файлового хранилища.
+func (r *InMemoryRepository) maintainLog(opts FileStorageOptions) {
+	defer r.wg.Done()
+
+	// Отключенные тикеры не срабатывают никогда
+	var syncC, compactC <-chan time.Time
+
+	if opts.SyncPolicy == config.FileSyncInterval && opts.SyncInterval > 0 {
+		syncTicker := time.NewTicker(opts.SyncInterval)
+		defer syncTicker.Stop()
+		syncC = syncTicker.C
+	}
+
+	if opts.CompactInterval > 0 {
+		compactTicker := time.NewTicker(opts.CompactInterval)
+		defer compactTicker.Stop()
+		compactC = compactTicker.C
+	}
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-syncC:
+			if err := r.log.sync(); err != nil {
+				slog.Error("failed to sync storage file", slog.String("error", err.Error()))
+			}
+		case <-compactC:
+			if !r.log.needsCompaction() {
+				continue
+			}
+			if err := r.compact(); err != nil {
+				slog.Error("failed to compact storage file", slog.String("error", err.Error()))
+			}
+		}
+	}
 }
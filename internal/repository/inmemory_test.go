@@ -2,7 +2,9 @@ package repository
 
 import (
 	"context"
-
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
@@ -13,7 +15,7 @@ import (
 )
 
 func TestInMemoryRepository(t *testing.T) {
-	const fileStoragePath = "test.json"
+	fileStoragePath := filepath.Join(t.TempDir(), "test.json")
 
 	const (
 		longURL = "https://app.pachca.com"
@@ -33,7 +35,8 @@ func TestInMemoryRepository(t *testing.T) {
 
 	urls := []*model.URL{url}
 
-	inMemoryRepository := NewInMemoryRepository(fileStoragePath)
+	inMemoryRepository, err := NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
 
 	urlStore, err := inMemoryRepository.Store(context.TODO(), urls)
 	require.NoError(t, err)
@@ -53,4 +56,169 @@ func TestInMemoryRepository(t *testing.T) {
 
 	err = inMemoryRepository.Close()
 	require.NoError(t, err)
+
+	// Состояние восстанавливается из файлового хранилища
+	inMemoryRepository, err = NewInMemoryRepository(fileStoragePath, FileStorageOptions{})
+	require.NoError(t, err)
+
+	urlGet, err = inMemoryRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.Equal(t, url.Long, urlGet.Long)
+	assert.True(t, urlGet.Deleted)
+
+	err = inMemoryRepository.Close()
+	require.NoError(t, err)
+}
+
+func TestInMemoryRepositoryStress(t *testing.T) {
+	const (
+		workers = 16
+		users   = 8
+		perUser = 200
+		BaseURL = "http://localhost:8080"
+	)
+
+	inMemoryRepository, err := NewInMemoryRepository(filepath.Join(t.TempDir(), "test.json"), FileStorageOptions{})
+	require.NoError(t, err)
+
+	uids := make([]uuid.UUID, users)
+	for i := range uids {
+		uids[i] = uuid.New()
+	}
+
+	// Пользователи параллельно сохраняют, читают и удаляют свои URL, а уплотнение и выгрузка
+	// идут одновременно с ними. Гонки отлавливаются при запуске тестов с флагом -race.
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			ctx := context.Background()
+			uid := uids[w%users]
+
+			for i := 0; i < perUser; i++ {
+				url := &model.URL{
+					Long: fmt.Sprintf("https://example.com/%d/%d", w, i),
+					Base: BaseURL,
+					ID:   fmt.Sprintf("w%02di%04d", w, i),
+					UID:  uid,
+				}
+
+				_, errs := inMemoryRepository.Store(ctx, []*model.URL{url})
+				assert.NoError(t, errs)
+
+				// Все воркеры сокращают один и тот же адрес - сохраняется только один
+				_, _ = inMemoryRepository.Store(ctx, []*model.URL{{
+					Long: "https://example.com/shared",
+					ID:   fmt.Sprintf("s%02di%04d", w, i),
+					UID:  uid,
+				}})
+
+				got, errg := inMemoryRepository.Get(ctx, url.ID)
+				assert.NoError(t, errg)
+				assert.Equal(t, url.Long, got.Long)
+
+				_, errg = inMemoryRepository.GetUserURLs(ctx, uid)
+				assert.NoError(t, errg)
+
+				if i%2 == 0 {
+					assert.NoError(t, inMemoryRepository.DeleteURLs(ctx, []*model.URL{url}))
+				}
+
+				switch i % 50 {
+				case 0:
+					assert.NoError(t, inMemoryRepository.compact())
+				case 25:
+					_, errg = inMemoryRepository.ScanURLs(ctx, "", 10)
+					assert.NoError(t, errg)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// У каждого пользователя остались неудаленные URL его воркеров
+	for _, uid := range uids {
+		userURLs, err := inMemoryRepository.GetUserURLs(context.TODO(), uid)
+		require.NoError(t, err)
+
+		var shared int
+		for _, url := range userURLs {
+			assert.False(t, url.Deleted)
+			if url.Long == "https://example.com/shared" {
+				shared++
+			}
+		}
+		assert.Len(t, userURLs, workers/users*perUser/2+shared)
+	}
+
+	var shared int
+	err = inMemoryRepository.ExportURLs(context.TODO(), func(url *model.URL) error {
+		if url.Long == "https://example.com/shared" {
+			shared++
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, shared)
+
+	require.NoError(t, inMemoryRepository.Close())
+}
+
+func TestInMemoryRepositoryScanURLs(t *testing.T) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	repo, err := NewInMemoryRepository("", FileStorageOptions{})
+	require.NoError(t, err)
+
+	store := func(from, to int) {
+		urls := make([]*model.URL, 0, to-from)
+		for i := from; i < to; i++ {
+			// Идентификаторы добавляются не по порядку
+			urls = append(urls, &model.URL{
+				Long: fmt.Sprintf("https://example.com/%d", i),
+				ID:   fmt.Sprintf("%04d", (i*7919)%10000),
+				UID:  uid,
+			})
+		}
+		_, errs := repo.Store(ctx, urls)
+		require.NoError(t, errs)
+	}
+
+	// Часть идентификаторов уже влита в отсортированную часть индекса, часть - еще нет
+	store(0, idIndexMergeSize+100)
+
+	// Обход страницами, во время которого добавляются новые URL: каждая страница отсортирована
+	// и продолжает предыдущую
+	var ids []string
+	afterID := ""
+	added := idIndexMergeSize + 100
+	for {
+		page, errs := repo.ScanURLs(ctx, afterID, 100)
+		require.NoError(t, errs)
+		if len(page) == 0 {
+			break
+		}
+		for _, url := range page {
+			require.Greater(t, url.ID, afterID)
+			afterID = url.ID
+			ids = append(ids, url.ID)
+		}
+		if added < 3000 {
+			store(added, min(added+150, 3000))
+			added = min(added+150, 3000)
+		}
+	}
+
+	assert.Greater(t, len(ids), idIndexMergeSize+100)
+
+	// Полный обход возвращает все URL по возрастанию идентификаторов
+	all, err := repo.ScanURLs(ctx, "", 10000)
+	require.NoError(t, err)
+	require.Len(t, all, 3000)
+	for i := 1; i < len(all); i++ {
+		assert.Less(t, all[i-1].ID, all[i].ID)
+	}
 }
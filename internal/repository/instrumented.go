@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища репозиторием с метриками.
+var _ interfaces.Repository = (*InstrumentedRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*InstrumentedRepository)(nil)
+	_ interfaces.Truncater     = (*InstrumentedRepository)(nil)
+	_ interfaces.Replacer      = (*InstrumentedRepository)(nil)
+	_ interfaces.QuotaStorer   = (*InstrumentedRepository)(nil)
+	_ interfaces.LimitedStorer = (*InstrumentedRepository)(nil)
+	_ interfaces.UserStorer    = (*InstrumentedRepository)(nil)
+)
+
+// InstrumentedRepository собирает метрики длительности и ошибок операций основного хранилища.
+type InstrumentedRepository struct {
+	repo    interfaces.Repository // Основное хранилище
+	backend string                // Тип хранилища - метка метрик
+}
+
+// NewInstrumentedRepository создает репозиторий, собирающий метрики операций переданного хранилища.
+// В качестве типа хранилища обычно передается схема строки соединения.
+func NewInstrumentedRepository(repo interfaces.Repository, backend string) *InstrumentedRepository {
+	return &InstrumentedRepository{
+		repo:    repo,
+		backend: backend,
+	}
+}
+
+// Store сохраняет URL в основном хранилище.
+func (r *InstrumentedRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	defer r.observe("store", time.Now())
+	url, err := r.repo.Store(ctx, urls)
+	r.countError("store", err)
+	return url, err
+}
+
+// Get возвращает данные URL из основного хранилища.
+func (r *InstrumentedRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	defer r.observe("get", time.Now())
+	url, err := r.repo.Get(ctx, id)
+	r.countError("get", err)
+	return url, err
+}
+
+// GetUserURLs возвращает URL пользователя из основного хранилища.
+func (r *InstrumentedRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	defer r.observe("get_user_urls", time.Now())
+	urls, err := r.repo.GetUserURLs(ctx, uid)
+	r.countError("get_user_urls", err)
+	return urls, err
+}
+
+// ScanURLs возвращает страницу URL из основного хранилища.
+func (r *InstrumentedRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	defer r.observe("scan_urls", time.Now())
+	urls, err := r.repo.ScanURLs(ctx, afterID, limit)
+	r.countError("scan_urls", err)
+	return urls, err
+}
+
+// DeleteURLs помечает URL удаленными в основном хранилище.
+func (r *InstrumentedRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	defer r.observe("delete_urls", time.Now())
+	err := r.repo.DeleteURLs(ctx, urls)
+	r.countError("delete_urls", err)
+	return err
+}
+
+// ExportURLs выгружает все URL из основного хранилища.
+func (r *InstrumentedRepository) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	defer r.observe("export_urls", time.Now())
+	err := ExportURLs(ctx, r.repo, fn)
+	r.countError("export_urls", err)
+	return err
+}
+
+// Truncate удаляет все URL из основного хранилища.
+func (r *InstrumentedRepository) Truncate(ctx context.Context) error {
+	defer r.observe("truncate", time.Now())
+	err := Truncate(ctx, r.repo)
+	r.countError("truncate", err)
+	return err
+}
+
+// ReplaceURLs заменяет все URL основного хранилища.
+func (r *InstrumentedRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	defer r.observe("replace_urls", time.Now())
+	err := ReplaceURLs(ctx, r.repo, load)
+	r.countError("replace_urls", err)
+	return err
+}
+
+// GetQuota возвращает переопределенные квоты пользователя из основного хранилища.
+func (r *InstrumentedRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	defer r.observe("get_quota", time.Now())
+	quota, err := GetQuota(ctx, r.repo, uid)
+	r.countError("get_quota", err)
+	return quota, err
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя в основное хранилище.
+func (r *InstrumentedRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	defer r.observe("set_quota", time.Now())
+	err := SetQuota(ctx, r.repo, uid, quota)
+	r.countError("set_quota", err)
+	return err
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя из основного хранилища.
+func (r *InstrumentedRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	defer r.observe("delete_quota", time.Now())
+	err := DeleteQuota(ctx, r.repo, uid)
+	r.countError("delete_quota", err)
+	return err
+}
+
+// StoreLimited сохраняет URL пользователя в основном хранилище с проверкой квоты количества URL.
+func (r *InstrumentedRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	defer r.observe("store_limited", time.Now())
+	url, err := StoreLimited(ctx, r.repo, urls, uid, limit)
+	r.countError("store_limited", err)
+	return url, err
+}
+
+// CreateUser сохраняет нового пользователя в основное хранилище и передает ему URL анонимного пользователя.
+func (r *InstrumentedRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	defer r.observe("create_user", time.Now())
+	err := CreateUser(ctx, r.repo, user, anonymous)
+	r.countError("create_user", err)
+	return err
+}
+
+// GetUser возвращает пользователя по идентификатору из основного хранилища.
+func (r *InstrumentedRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	defer r.observe("get_user", time.Now())
+	user, err := GetUser(ctx, r.repo, id)
+	r.countError("get_user", err)
+	return user, err
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты из основного хранилища.
+func (r *InstrumentedRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	defer r.observe("get_user_by_email", time.Now())
+	user, err := GetUserByEmail(ctx, r.repo, email)
+	r.countError("get_user_by_email", err)
+	return user, err
+}
+
+// Health возвращает состояние основного хранилища.
+func (r *InstrumentedRepository) Health(ctx context.Context) map[string]model.Health {
+	return r.repo.Health(ctx)
+}
+
+// Close закрывает основное хранилище.
+func (r *InstrumentedRepository) Close() error {
+	return r.repo.Close()
+}
+
+// observe учитывает длительность операции, начатой в переданный момент.
+func (r *InstrumentedRepository) observe(operation string, start time.Time) {
+	metrics.RepositoryDuration.WithLabelValues(r.backend, operation).Observe(time.Since(start).Seconds())
+}
+
+// countError учитывает ошибку операции. Отсутствие URL, квот и пользователя, конфликт данных и занятый адрес почты -
+// штатные ответы хранилища.
+func (r *InstrumentedRepository) countError(operation string, err error) {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrIDNotFound), errors.Is(err, ErrConflict), errors.Is(err, ErrQuotaNotFound),
+		errors.Is(err, ErrUserNotFound), errors.Is(err, ErrUserExists), errors.Is(err, model.ErrQuotaExceeded):
+		return
+	}
+	metrics.RepositoryErrors.WithLabelValues(r.backend, operation).Inc()
+}
@@ -0,0 +1,789 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища Redis репозиторием.
+var _ interfaces.Repository = (*RedisRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Truncater     = (*RedisRepository)(nil)
+	_ interfaces.Replacer      = (*RedisRepository)(nil)
+	_ interfaces.QuotaStorer   = (*RedisRepository)(nil)
+	_ interfaces.LimitedStorer = (*RedisRepository)(nil)
+	_ interfaces.UserStorer    = (*RedisRepository)(nil)
+)
+
+// redisScheme - схема строки соединения с Redis: redis://host:6379/0
+const redisScheme = "redis"
+
+func init() {
+	backend := Backend{
+		Open: func(ctx context.Context, dsn string, _ *config.Config) (interfaces.Repository, error) {
+			client, err := NewRedisClient(ctx, dsn)
+			if err != nil {
+				return nil, err
+			}
+			return NewRedisRepository(client), nil
+		},
+		Health: pingHealth,
+		Shared: true,
+	}
+	Register(redisScheme, backend)
+	Register("rediss", backend)
+}
+
+// Префиксы ключей Redis.
+const (
+	// redisURLPrefix - префикс ключа хэша с данными URL.
+	redisURLPrefix = "urlcut:url:"
+
+	// redisLongPrefix - префикс ключа индекса оригинальных URL.
+	redisLongPrefix = "urlcut:long:"
+
+	// redisUserPrefix - префикс ключа множества идентификаторов URL пользователя.
+	redisUserPrefix = "urlcut:user:"
+
+	// redisLinksPrefix - префикс ключа счетчика неудаленных URL пользователя.
+	// Счетчик создается при первом сохранении с проверкой квоты, остальные изменения сбрасывают или поправляют его.
+	redisLinksPrefix = "urlcut:links:"
+
+	// redisQuotaPrefix - префикс ключа хэша с переопределенными квотами пользователя.
+	redisQuotaPrefix = "urlcut:quota:"
+
+	// redisAccountPrefix - префикс ключа хэша с данными зарегистрированного пользователя.
+	redisAccountPrefix = "urlcut:account:"
+
+	// redisEmailPrefix - префикс ключа индекса зарегистрированных пользователей по адресам почты.
+	redisEmailPrefix = "urlcut:email:"
+
+	// redisIDsKey - ключ упорядоченного множества всех идентификаторов URL для постраничного обхода.
+	redisIDsKey = "urlcut:ids"
+)
+
+// redisURLKeyPatterns - шаблоны всех ключей с данными URL, включая записи кэша.
+var redisURLKeyPatterns = []string{
+	redisURLPrefix + "*",
+	redisLongPrefix + "*",
+	redisUserPrefix + "*",
+	redisLinksPrefix + "*",
+	redisIDsKey,
+	redisCachePrefix + "*",
+}
+
+// Ключи замены всех URL. Пакеты замены пишутся под префиксом замены с уникальным токеном,
+// а ключи замены, оставшиеся от прерванной замены, Redis удаляет по истечении их времени жизни.
+const (
+	// redisReplacePrefix - префикс ключей замены.
+	redisReplacePrefix = "urlcut:replace:"
+
+	// redisReplaceIDs - ключ упорядоченного множества идентификаторов URL замены.
+	redisReplaceIDs = "ids"
+
+	// redisReplaceURLs - префикс ключа хэша с данными URL замены.
+	redisReplaceURLs = "url:"
+
+	// redisReplaceLongs - префикс ключа оригинальных адресов неудаленных URL замены.
+	redisReplaceLongs = "long:"
+
+	// redisReplaceTTL - время жизни ключей замены.
+	redisReplaceTTL = 1 * time.Hour
+)
+
+// Поля хэша с данными URL.
+const (
+	redisFieldLong    = "long"
+	redisFieldBase    = "base"
+	redisFieldUID     = "uid"
+	redisFieldDeleted = "deleted"
+)
+
+// Поля хэша с квотами пользователя.
+const (
+	redisFieldMaxLinks     = "max_links"
+	redisFieldMaxBatchSize = "max_batch_size"
+	redisFieldMaxURLLength = "max_url_length"
+)
+
+// Поля хэша с данными зарегистрированного пользователя.
+const (
+	redisFieldEmail        = "email"
+	redisFieldPasswordHash = "password_hash"
+	redisFieldCreatedAt    = "created_at"
+)
+
+// redisCreateUserScript атомарно сохраняет пользователя, если ни его идентификатор, ни адрес почты не заняты,
+// и передает ему неудаленные URL анонимного пользователя, если тот не зарегистрирован.
+// Счетчики URL обоих пользователей сбрасываются и будут пересчитаны при следующей проверке квоты.
+var redisCreateUserScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'email', ARGV[1], 'password_hash', ARGV[2], 'created_at', ARGV[3])
+redis.call('SET', KEYS[2], ARGV[4])
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return 1
+end
+redis.call('DEL', KEYS[6], KEYS[7])
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[4])) do
+	local urlKey = ARGV[5] .. id
+	if redis.call('EXISTS', urlKey) == 1 and redis.call('HGET', urlKey, 'deleted') ~= '1' then
+		redis.call('HSET', urlKey, 'uid', ARGV[4])
+		redis.call('SREM', KEYS[4], id)
+		redis.call('SADD', KEYS[5], id)
+	end
+end
+return 1
+`)
+
+// redisDeleteScript атомарно помечает URL удаленным, если он принадлежит пользователю,
+// уменьшает счетчик URL пользователя и удаляет запись индекса оригинальных URL, если она указывает на этот URL.
+var redisDeleteScript = redis.NewScript(`
+local uid = redis.call('HGET', KEYS[1], 'uid')
+if uid ~= ARGV[1] then
+	return 0
+end
+if redis.call('HGET', KEYS[1], 'deleted') == '1' then
+	return 1
+end
+redis.call('HSET', KEYS[1], 'deleted', '1')
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('DECR', KEYS[2])
+end
+local long = redis.call('HGET', KEYS[1], 'long')
+local longKey = ARGV[2] .. long
+if redis.call('GET', longKey) == ARGV[3] then
+	redis.call('DEL', longKey)
+end
+return 1
+`)
+
+// redisCountLinksScript возвращает счетчик неудаленных URL пользователя, а если его нет -
+// атомарно подсчитывает URL по множеству пользователя и создает счетчик.
+var redisCountLinksScript = redis.NewScript(`
+local count = redis.call('GET', KEYS[1])
+if count then
+	return tonumber(count)
+end
+count = 0
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[2])) do
+	local deleted = redis.call('HGET', ARGV[1] .. id, 'deleted')
+	if deleted and deleted ~= '1' then
+		count = count + 1
+	end
+end
+redis.call('SET', KEYS[1], count)
+return count
+`)
+
+// redisReplaceScript атомарно удаляет все URL, их индексы и счетчики URL пользователей
+// по множеству идентификаторов KEYS[1], а затем переименовывает записанные ключи замены
+// из множества KEYS[2] в ключи URL и строит для них индексы.
+// Множества обходятся частями, чтобы не копировать их в память скрипта целиком.
+var redisReplaceScript = redis.NewScript(`
+local urlPrefix, longPrefix, userPrefix, linksPrefix = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+local start = 0
+while true do
+	local ids = redis.call('ZRANGE', KEYS[1], start, start + 999)
+	if #ids == 0 then
+		break
+	end
+	for _, id in ipairs(ids) do
+		local url = redis.call('HMGET', urlPrefix .. id, 'long', 'uid')
+		if url[1] then
+			redis.call('DEL', longPrefix .. url[1])
+		end
+		if url[2] then
+			redis.call('DEL', userPrefix .. url[2], linksPrefix .. url[2])
+		end
+		redis.call('DEL', urlPrefix .. id)
+	end
+	start = start + 1000
+end
+redis.call('DEL', KEYS[1])
+start = 0
+while true do
+	local ids = redis.call('ZRANGE', KEYS[2], start, start + 999)
+	if #ids == 0 then
+		break
+	end
+	for _, id in ipairs(ids) do
+		local urlKey = urlPrefix .. id
+		redis.call('RENAME', ARGV[5] .. id, urlKey)
+		redis.call('PERSIST', urlKey)
+		local url = redis.call('HMGET', urlKey, 'long', 'uid', 'deleted')
+		if url[3] ~= '1' then
+			redis.call('SET', longPrefix .. url[1], id)
+			redis.call('DEL', ARGV[6] .. url[1])
+		end
+		redis.call('SADD', userPrefix .. url[2], id)
+		redis.call('DEL', linksPrefix .. url[2])
+	end
+	start = start + 1000
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('RENAME', KEYS[2], KEYS[1])
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`)
+
+// RedisRepository является Redis хранилищем URL.
+// Данные URL хранятся в хэшах, идентификаторы URL пользователя - в множествах.
+type RedisRepository struct {
+	client *redis.Client // Клиент Redis
+}
+
+// NewRedisRepository создает новое Redis хранилище URL.
+func NewRedisRepository(client *redis.Client) *RedisRepository {
+	return &RedisRepository{
+		client: client,
+	}
+}
+
+// NewRedisClient создает нового клиента Redis по переданной строке соединения и проверяет соединение.
+func NewRedisClient(ctx context.Context, redisDSN string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(redisDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+
+	// Делаем пинг
+	if err = client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Store сохраняет слайс переданных URL в Redis хранилище.
+// Если какой-либо из оригинальных URL уже сохранен, не сохраняется ни один URL,
+// а возвращается сохраненный ранее URL и ошибка конфликта.
+func (r *RedisRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	return r.store(ctx, urls, uuid.Nil, 0)
+}
+
+// StoreLimited сохраняет URL пользователя в Redis хранилище, если количество его неудаленных URL не превысит limit.
+// Счетчик URL пользователя отслеживается в той же транзакции, что и оригинальные URL, и увеличивается вместе
+// с записью URL - конкурентные сохранения повторяют транзакцию с новым значением счетчика.
+func (r *RedisRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	return r.store(ctx, urls, uid, limit)
+}
+
+// store сохраняет URL в транзакции, предварительно проверяя квоту количества URL пользователя,
+// если limit положителен.
+func (r *RedisRepository) store(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	if err := checkDuplicateLong(urls); err != nil {
+		return nil, err
+	}
+
+	linksKey := redisLinksPrefix + uid.String()
+
+	// Ключи URL пакета - занятый идентификатор не перезаписывается так же, как в БД хранилище
+	idKeys := make([]string, 0, len(urls))
+	seen := make(map[string]struct{}, len(urls))
+	for _, url := range urls {
+		if _, ok := seen[url.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+		}
+		seen[url.ID] = struct{}{}
+		idKeys = append(idKeys, redisURLPrefix+url.ID)
+	}
+
+	// Ключи индекса оригинальных URL, за которыми будем следить в транзакции
+	// Удаленные URL не конфликтуют и не попадают в индекс
+	longKeys := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if !url.Deleted {
+			longKeys = append(longKeys, redisLongPrefix+url.Long)
+		}
+	}
+	watchKeys := append(append(make([]string, 0, len(longKeys)+len(idKeys)+1), longKeys...), idKeys...)
+	if limit > 0 {
+		watchKeys = append(watchKeys, linksKey)
+	}
+
+	// Счетчики URL других пользователей пакета сбрасываются - их пересчитает следующая проверка квоты
+	resetKeys := make([]string, 0)
+	added := 0
+	for _, url := range urls {
+		switch {
+		case url.Deleted:
+		case limit > 0 && url.UID == uid:
+			added++
+		default:
+			resetKeys = append(resetKeys, redisLinksPrefix+url.UID.String())
+		}
+	}
+
+	var conflictURL *model.URL
+
+	// Транзакция повторяется, если кто-то успел изменить отслеживаемые ключи
+	txf := func(tx *redis.Tx) error {
+		conflictURL = nil
+
+		// Проверяем квоту до конфликтов. Счетчика нет, если его успели сбросить - пересоздаем его
+		if limit > 0 {
+			count, err := tx.Get(ctx, linksKey).Int()
+			if errors.Is(err, redis.Nil) {
+				return redis.TxFailedErr
+			}
+			if err != nil {
+				return err
+			}
+			if err = checkLinksQuota(count, urls, uid, limit); err != nil {
+				return err
+			}
+		}
+
+		// Проверяем наличие конфликтов
+		for _, longKey := range longKeys {
+			id, err := tx.Get(ctx, longKey).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			conflictURL, err = r.get(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			return nil
+		}
+
+		// Проверяем, что идентификаторы пакета свободны
+		for i, idKey := range idKeys {
+			exists, err := tx.Exists(ctx, idKey).Result()
+			if err != nil {
+				return err
+			}
+			if exists > 0 {
+				return fmt.Errorf("%w: %q", ErrIntegrity, urls[i].ID)
+			}
+		}
+
+		// Конфликтов нет, пишем все URL
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, url := range urls {
+				pipe.HSet(ctx, redisURLPrefix+url.ID, redisURLFields(url))
+				if !url.Deleted {
+					pipe.Set(ctx, redisLongPrefix+url.Long, url.ID, 0)
+				}
+				pipe.SAdd(ctx, redisUserPrefix+url.UID.String(), url.ID)
+				pipe.ZAdd(ctx, redisIDsKey, redis.Z{Member: url.ID})
+			}
+			if added > 0 {
+				pipe.IncrBy(ctx, linksKey, int64(added))
+			}
+			if len(resetKeys) > 0 {
+				pipe.Del(ctx, resetKeys...)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for {
+		if limit > 0 {
+			if err := redisCountLinksScript.Run(ctx, r.client,
+				[]string{linksKey, redisUserPrefix + uid.String()}, redisURLPrefix).Err(); err != nil {
+				return nil, err
+			}
+		}
+		err := r.client.Watch(ctx, txf, watchKeys...)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if conflictURL != nil {
+		return conflictURL, ErrConflict
+	}
+
+	return nil, nil
+}
+
+// Get возвращает из Redis хранилища данные URL по переданному идентификатору.
+func (r *RedisRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	return r.get(ctx, r.client, id)
+}
+
+// GetUserURLs возвращает из Redis хранилища неудаленные URL пользователя по переданному идентификатору.
+func (r *RedisRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	// Получаем идентификаторы URL пользователя
+	ids, err := r.client.SMembers(ctx, redisUserPrefix+uid.String()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Получаем данные всех URL одним конвейером
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			cmds = append(cmds, pipe.HGetAll(ctx, redisURLPrefix+id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Создаем слайс для возврата ссылок пользователя
+	urls := make([]*model.URL, 0, len(ids))
+
+	for i, cmd := range cmds {
+		url, errp := redisParseURL(ids[i], cmd.Val())
+		if errp != nil {
+			continue
+		}
+		if url.Deleted {
+			continue
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// ScanURLs возвращает из Redis хранилища страницу URL, включая удаленные, после переданного идентификатора.
+// Все идентификаторы имеют одинаковый вес в упорядоченном множестве, поэтому сортируются лексикографически.
+func (r *RedisRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	start := "-"
+	if afterID != "" {
+		start = "(" + afterID
+	}
+
+	ids, err := r.client.ZRangeByLex(ctx, redisIDsKey, &redis.ZRangeBy{
+		Min:   start,
+		Max:   "+",
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Получаем данные всех URL страницы одним конвейером
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			cmds = append(cmds, pipe.HGetAll(ctx, redisURLPrefix+id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*model.URL, 0, len(ids))
+	for i, cmd := range cmds {
+		url, errp := redisParseURL(ids[i], cmd.Val())
+		if errp != nil {
+			return nil, errp
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// DeleteURLs помечает удаленными переданные URL, если они принадлежат указанным в них пользователям.
+func (r *RedisRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, url := range urls {
+			redisDeleteScript.Eval(ctx, pipe,
+				[]string{redisURLPrefix + url.ID, redisLinksPrefix + url.UID.String()},
+				url.UID.String(), redisLongPrefix, url.ID)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Truncate удаляет все ключи URL из Redis, включая записи кэша.
+// Зарегистрированные пользователи и квоты не удаляются - так же, как в БД хранилище.
+func (r *RedisRepository) Truncate(ctx context.Context) error {
+	for _, pattern := range redisURLKeyPatterns {
+		if err := redisDeleteKeys(ctx, r.client, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceURLs заменяет все URL в Redis URL, переданными функцией load. Пакеты URL записываются
+// под префиксом замены, невидимым остальным запросам, и проверяются на повторы идентификаторов
+// и оригинальных адресов. После загрузки всех пакетов скрипт атомарно удаляет прежние URL
+// и переименовывает ключи замены - при любой ошибке до переключения прежние URL остаются.
+func (r *RedisRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	staging := redisReplacePrefix + uuid.NewString() + ":"
+
+	err := load(func(urls []*model.URL) error {
+		return r.stageURLs(ctx, staging, urls)
+	})
+	if err == nil {
+		err = redisReplaceScript.Run(ctx, r.client, []string{redisIDsKey, staging + redisReplaceIDs},
+			redisURLPrefix, redisLongPrefix, redisUserPrefix, redisLinksPrefix,
+			staging+redisReplaceURLs, staging+redisReplaceLongs).Err()
+	}
+	if err != nil {
+		// Ключи замены не нужны, а если удалить их не выйдет, они истекут сами
+		_ = redisDeleteKeys(context.WithoutCancel(ctx), r.client, staging+"*")
+		return err
+	}
+
+	// Записи кэша прежних URL больше не нужны
+	return redisDeleteKeys(ctx, r.client, redisCachePrefix+"*")
+}
+
+// stageURLs записывает пакет URL под префиксом замены. Повтор идентификатора среди всех пакетов
+// замены приводит к ошибке ErrIntegrity, а повтор оригинального адреса неудаленного URL - к ErrDuplicateURL.
+func (r *RedisRepository) stageURLs(ctx context.Context, staging string, urls []*model.URL) error {
+	if err := checkDuplicateLong(urls); err != nil {
+		return err
+	}
+
+	idsKey := staging + redisReplaceIDs
+	added := make([]*redis.IntCmd, len(urls))
+	longs := make([]*redis.BoolCmd, len(urls))
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, url := range urls {
+			added[i] = pipe.ZAddNX(ctx, idsKey, redis.Z{Member: url.ID})
+			if !url.Deleted {
+				longs[i] = pipe.SetNX(ctx, staging+redisReplaceLongs+url.Long, url.ID, redisReplaceTTL)
+			}
+			urlKey := staging + redisReplaceURLs + url.ID
+			pipe.HSet(ctx, urlKey, redisURLFields(url))
+			pipe.Expire(ctx, urlKey, redisReplaceTTL)
+		}
+		pipe.Expire(ctx, idsKey, redisReplaceTTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, url := range urls {
+		if added[i].Val() == 0 {
+			return fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+		}
+		if longs[i] != nil && !longs[i].Val() {
+			return fmt.Errorf("%w: %q", ErrDuplicateURL, url.Long)
+		}
+	}
+
+	return nil
+}
+
+// GetQuota возвращает переопределенные квоты пользователя.
+func (r *RedisRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	fields, err := r.client.HGetAll(ctx, redisQuotaPrefix+uid.String()).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrQuotaNotFound
+	}
+
+	var quota model.Quota
+	for field, dst := range map[string]*int{
+		redisFieldMaxLinks:     &quota.MaxLinks,
+		redisFieldMaxBatchSize: &quota.MaxBatchSize,
+		redisFieldMaxURLLength: &quota.MaxURLLength,
+	} {
+		if *dst, err = strconv.Atoi(fields[field]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &quota, nil
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя.
+func (r *RedisRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	return r.client.HSet(ctx, redisQuotaPrefix+uid.String(), map[string]interface{}{
+		redisFieldMaxLinks:     quota.MaxLinks,
+		redisFieldMaxBatchSize: quota.MaxBatchSize,
+		redisFieldMaxURLLength: quota.MaxURLLength,
+	}).Err()
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя.
+func (r *RedisRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	return r.client.Del(ctx, redisQuotaPrefix+uid.String()).Err()
+}
+
+// CreateUser сохраняет нового пользователя и передает ему неудаленные URL анонимного пользователя.
+func (r *RedisRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	created, err := redisCreateUserScript.Run(ctx, r.client,
+		[]string{
+			redisAccountPrefix + user.ID.String(),
+			redisEmailPrefix + user.Email,
+			redisAccountPrefix + anonymous.String(),
+			redisUserPrefix + anonymous.String(),
+			redisUserPrefix + user.ID.String(),
+			redisLinksPrefix + anonymous.String(),
+			redisLinksPrefix + user.ID.String(),
+		},
+		user.Email, user.PasswordHash, user.CreatedAt.UTC().Format(time.RFC3339Nano), user.ID.String(),
+		redisURLPrefix,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if created == 0 {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// GetUser возвращает пользователя по идентификатору.
+func (r *RedisRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	fields, err := r.client.HGetAll(ctx, redisAccountPrefix+id.String()).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, fields[redisFieldCreatedAt])
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.User{
+		ID:           id,
+		Email:        fields[redisFieldEmail],
+		PasswordHash: fields[redisFieldPasswordHash],
+		CreatedAt:    createdAt,
+	}, nil
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты.
+func (r *RedisRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	idString, err := r.client.Get(ctx, redisEmailPrefix+email).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetUser(ctx, id)
+}
+
+// Health проверяет соединение с Redis.
+func (r *RedisRepository) Health(ctx context.Context) map[string]model.Health {
+	return map[string]model.Health{
+		"redis": model.NewHealth(r.Ping(ctx), false),
+	}
+}
+
+// Ping проверяет соединение с Redis.
+func (r *RedisRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Close закрывает соединение с Redis.
+func (r *RedisRepository) Close() error {
+	return r.client.Close()
+}
+
+// get получает данные URL по идентификатору при помощи переданного клиента - обычного или транзакционного.
+func (r *RedisRepository) get(ctx context.Context, c redis.Cmdable, id string) (*model.URL, error) {
+	fields, err := c.HGetAll(ctx, redisURLPrefix+id).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return redisParseURL(id, fields)
+}
+
+// redisDeleteKeys удаляет все ключи, подходящие под шаблон. Ключи перебираются курсором SCAN,
+// чтобы не блокировать Redis на больших объемах данных.
+func redisDeleteKeys(ctx context.Context, client *redis.Client, pattern string) error {
+	iter := client.Scan(ctx, 0, pattern, 1000).Iterator()
+
+	keys := make([]string, 0, 1000)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			if err := client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return client.Del(ctx, keys...).Err()
+}
+
+// redisURLFields формирует поля хэша Redis из данных URL.
+func redisURLFields(url *model.URL) map[string]interface{} {
+	return map[string]interface{}{
+		redisFieldLong:    url.Long,
+		redisFieldBase:    url.Base,
+		redisFieldUID:     url.UID.String(),
+		redisFieldDeleted: url.Deleted,
+	}
+}
+
+// redisParseURL формирует данные URL из полей хэша Redis.
+func redisParseURL(id string, fields map[string]string) (*model.URL, error) {
+	// Пустой хэш - URL нет
+	if len(fields) == 0 {
+		return nil, ErrIDNotFound
+	}
+
+	uid, err := uuid.Parse(fields[redisFieldUID])
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := strconv.ParseBool(fields[redisFieldDeleted])
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.URL{
+		Long:    fields[redisFieldLong],
+		Base:    fields[redisFieldBase],
+		ID:      id,
+		UID:     uid,
+		Deleted: deleted,
+	}, nil
+}
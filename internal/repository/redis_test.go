@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+func newRedisRepository(t *testing.T) (*RedisRepository, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+
+	client, err := NewRedisClient(context.TODO(), "redis://"+mr.Addr())
+	require.NoError(t, err)
+
+	return NewRedisRepository(client), mr
+}
+
+func TestRedisRepository(t *testing.T) {
+	const (
+		longURL = "https://app.pachca.com"
+		BaseURL = "http://localhost:8080"
+		urlID   = "1q2w3e4r"
+	)
+
+	uid, _ := uuid.NewRandom()
+	otherUID, _ := uuid.NewRandom()
+
+	url := &model.URL{
+		Long: longURL,
+		Base: BaseURL,
+		ID:   urlID,
+		UID:  uid,
+	}
+
+	redisRepository, _ := newRedisRepository(t)
+
+	urlStore, err := redisRepository.Store(context.TODO(), []*model.URL{url})
+	require.NoError(t, err)
+	assert.Nil(t, urlStore)
+
+	// Повторное сохранение того же оригинального URL - конфликт
+	urlConflict, err := redisRepository.Store(context.TODO(), []*model.URL{{
+		Long: longURL,
+		Base: BaseURL,
+		ID:   "5t6y7u8i",
+		UID:  otherUID,
+	}})
+	assert.ErrorIs(t, err, ErrConflict)
+	require.NotNil(t, urlConflict)
+	assert.Equal(t, urlID, urlConflict.ID)
+
+	urlGet, err := redisRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.Equal(t, url, urlGet)
+
+	_, err = redisRepository.Get(context.TODO(), "5t6y7u8i")
+	assert.ErrorIs(t, err, ErrIDNotFound)
+
+	userURLs, err := redisRepository.GetUserURLs(context.TODO(), uid)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.URL{url}, userURLs)
+
+	// Чужой пользователь не может удалить URL
+	err = redisRepository.DeleteURLs(context.TODO(), []*model.URL{{ID: urlID, UID: otherUID}})
+	require.NoError(t, err)
+
+	urlGet, err = redisRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.False(t, urlGet.Deleted)
+
+	err = redisRepository.DeleteURLs(context.TODO(), []*model.URL{{ID: urlID, UID: uid}})
+	require.NoError(t, err)
+
+	urlGet, err = redisRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	userURLs, err = redisRepository.GetUserURLs(context.TODO(), uid)
+	require.NoError(t, err)
+	assert.Empty(t, userURLs)
+
+	// После удаления оригинальный URL можно сократить заново
+	urlStore, err = redisRepository.Store(context.TODO(), []*model.URL{{
+		Long: longURL,
+		Base: BaseURL,
+		ID:   "5t6y7u8i",
+		UID:  otherUID,
+	}})
+	require.NoError(t, err)
+	assert.Nil(t, urlStore)
+
+	err = redisRepository.Close()
+	require.NoError(t, err)
+}
+
+func TestRedisRepositoryReplaceURLs(t *testing.T) {
+	const base = "http://localhost:8080"
+
+	uid, _ := uuid.NewRandom()
+
+	redisRepository, mr := newRedisRepository(t)
+
+	_, err := redisRepository.Store(context.TODO(), []*model.URL{
+		{Long: "https://old.example.com", Base: base, ID: "old", UID: uid},
+	})
+	require.NoError(t, err)
+
+	err = redisRepository.ReplaceURLs(context.TODO(), func(store func(urls []*model.URL) error) error {
+		if err := store([]*model.URL{{Long: "https://first.example.com", Base: base, ID: "first", UID: uid}}); err != nil {
+			return err
+		}
+
+		// URL, сохраненный во время замены, заменяется вместе с прежними
+		if _, err := redisRepository.Store(context.TODO(), []*model.URL{
+			{Long: "https://concurrent.example.com", Base: base, ID: "concurrent", UID: uid},
+		}); err != nil {
+			return err
+		}
+
+		// До переключения прежние URL остаются доступными
+		if _, err := redisRepository.Get(context.TODO(), "old"); err != nil {
+			return err
+		}
+
+		return store([]*model.URL{{Long: "https://second.example.com", Base: base, ID: "second", UID: uid, Deleted: true}})
+	})
+	require.NoError(t, err)
+
+	for _, id := range []string{"old", "concurrent"} {
+		_, err = redisRepository.Get(context.TODO(), id)
+		assert.ErrorIs(t, err, ErrIDNotFound)
+	}
+
+	userURLs, err := redisRepository.GetUserURLs(context.TODO(), uid)
+	require.NoError(t, err)
+	require.Len(t, userURLs, 1)
+	assert.Equal(t, "first", userURLs[0].ID)
+
+	urlGet, err := redisRepository.Get(context.TODO(), "second")
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	// Ключи замены удаляются при переключении и не получают времени жизни в ключах URL
+	for _, key := range mr.Keys() {
+		assert.NotContains(t, key, redisReplacePrefix)
+	}
+	assert.Zero(t, mr.TTL(redisURLPrefix+"first"))
+	assert.Zero(t, mr.TTL(redisIDsKey))
+
+	// При ошибке загрузки ключи замены удаляются, а прежние URL остаются
+	err = redisRepository.ReplaceURLs(context.TODO(), URLBatches(
+		[]*model.URL{{Long: "https://third.example.com", Base: base, ID: "third", UID: uid}},
+		[]*model.URL{{Long: "https://fourth.example.com", Base: base, ID: "third", UID: uid}},
+	))
+	assert.ErrorIs(t, err, ErrIntegrity)
+
+	_, err = redisRepository.Get(context.TODO(), "first")
+	require.NoError(t, err)
+	for _, key := range mr.Keys() {
+		assert.NotContains(t, key, redisReplacePrefix)
+	}
+}
+
+func TestCachedRepository(t *testing.T) {
+	const (
+		longURL = "https://app.pachca.com"
+		BaseURL = "http://localhost:8080"
+		urlID   = "1q2w3e4r"
+	)
+
+	uid, _ := uuid.NewRandom()
+
+	url := &model.URL{
+		Long: longURL,
+		Base: BaseURL,
+		ID:   urlID,
+		UID:  uid,
+	}
+
+	mr := miniredis.RunT(t)
+
+	newCachedRepository := func(repo *RedisRepository) *CachedRepository {
+		client, err := NewRedisClient(context.TODO(), "redis://"+mr.Addr())
+		require.NoError(t, err)
+		return NewCachedRepository(repo, client, DefaultCacheTTL)
+	}
+
+	// Две реплики сервиса с общим кэшем и общим основным хранилищем
+	baseRepository, _ := newRedisRepository(t)
+	replica1 := newCachedRepository(baseRepository)
+	replica2 := newCachedRepository(baseRepository)
+
+	_, err := replica1.Store(context.TODO(), []*model.URL{url})
+	require.NoError(t, err)
+
+	// Обе реплики кэшируют URL
+	urlGet, err := replica1.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.Equal(t, url, urlGet)
+	assert.True(t, mr.Exists(redisCachePrefix+urlID))
+
+	urlGet, err = replica2.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.Equal(t, url, urlGet)
+
+	// Удаление через одну реплику видно другой
+	err = replica1.DeleteURLs(context.TODO(), []*model.URL{{ID: urlID, UID: uid}})
+	require.NoError(t, err)
+	assert.False(t, mr.Exists(redisCachePrefix+urlID))
+
+	urlGet, err = replica2.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	_, err = replica2.Get(context.TODO(), "5t6y7u8i")
+	assert.ErrorIs(t, err, ErrIDNotFound)
+
+	err = replica2.client.Close()
+	require.NoError(t, err)
+
+	err = replica1.Close()
+	require.NoError(t, err)
+}
+
+// slowGetRepository задерживает ответ Get основного хранилища до сигнала теста.
+type slowGetRepository struct {
+	interfaces.Repository
+	read    chan struct{} // URL прочитан из хранилища
+	release chan struct{} // можно вернуть прочитанный URL
+}
+
+func (r *slowGetRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	url, err := r.Repository.Get(ctx, id)
+	r.read <- struct{}{}
+	<-r.release
+	return url, err
+}
+
+func TestCachedRepositoryDeleteRace(t *testing.T) {
+	uid := uuid.New()
+	url := &model.URL{Long: "https://app.pachca.com", Base: "http://localhost:8080", ID: "1q2w3e4r", UID: uid}
+
+	base, mr := newRedisRepository(t)
+	_, err := base.Store(context.TODO(), []*model.URL{url})
+	require.NoError(t, err)
+
+	client, err := NewRedisClient(context.TODO(), "redis://"+mr.Addr())
+	require.NoError(t, err)
+	slow := &slowGetRepository{Repository: base, read: make(chan struct{}), release: make(chan struct{})}
+	repo := NewCachedRepository(slow, client, DefaultCacheTTL)
+
+	// Запрос читает URL до удаления, а заполняет кэш после него
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = repo.Get(context.TODO(), url.ID)
+	}()
+	<-slow.read
+	require.NoError(t, repo.DeleteURLs(context.TODO(), []*model.URL{{ID: url.ID, UID: uid}}))
+	close(slow.release)
+	<-done
+
+	// Неудаленный URL не вернулся в кэш
+	assert.False(t, mr.Exists(redisCachePrefix+url.ID))
+
+	// После отметки об удалении кэш заполняется снова
+	mr.FastForward(2 * cacheTombstoneTTL)
+	go func() { <-slow.read }()
+	got, err := repo.Get(context.TODO(), url.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Deleted)
+	assert.True(t, mr.Exists(redisCachePrefix+url.ID))
+	assert.Equal(t, DefaultCacheTTL, mr.TTL(redisCachePrefix+url.ID).Round(time.Second))
+}
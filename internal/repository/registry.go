@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+)
+
+// ErrUnknownBackend ошибка неизвестной схемы строки соединения с хранилищем.
+var ErrUnknownBackend = fmt.Errorf("unknown storage backend")
+
+// OpenFunc создает хранилище по переданной строке соединения.
+// Строка соединения передается целиком, вместе со схемой.
+type OpenFunc func(ctx context.Context, dsn string, cfg *config.Config) (interfaces.Repository, error)
+
+// HealthFunc проверяет работоспособность созданного хранилища.
+type HealthFunc func(ctx context.Context, repo interfaces.Repository) error
+
+// Backend описывает зарегистрированное хранилище.
+type Backend struct {
+	Open   OpenFunc   // Конструктор хранилища
+	Health HealthFunc // Проверка работоспособности хранилища, nil - хранилище всегда работоспособно
+	Shared bool       // Хранилище могут менять другие экземпляры сервиса и утилиты в обход этого процесса
+}
+
+// Реестр хранилищ по схемам строки соединения.
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Backend)
+)
+
+// Register регистрирует хранилище для переданной схемы строки соединения, например "postgres".
+// Повторная регистрация схемы или регистрация без конструктора приводит к панике,
+// так же как регистрация драйверов в database/sql.
+func Register(scheme string, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+
+	if backend.Open == nil {
+		panic("repository: Register backend constructor is nil for scheme " + scheme)
+	}
+	if _, dup := backends[scheme]; dup {
+		panic("repository: Register called twice for scheme " + scheme)
+	}
+
+	backends[scheme] = backend
+}
+
+// Backends возвращает отсортированный список зарегистрированных схем.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// Open создает хранилище, зарегистрированное для схемы переданной строки соединения,
+// и проверяет его работоспособность.
+func Open(ctx context.Context, dsn string, cfg *config.Config) (interfaces.Repository, error) {
+	scheme := Scheme(dsn)
+
+	backendsMu.RLock()
+	backend, ok := backends[scheme]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q, registered backends: %s", ErrUnknownBackend, scheme, strings.Join(Backends(), ", "))
+	}
+
+	repo, err := backend.Open(ctx, dsn, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInitRepositoryFailed, scheme, err)
+	}
+
+	if backend.Health != nil {
+		if err = backend.Health(ctx, repo); err != nil {
+			_ = repo.Close()
+			return nil, fmt.Errorf("%w: %s: health check: %w", ErrInitRepositoryFailed, scheme, err)
+		}
+	}
+
+	return repo, nil
+}
+
+// Shared сообщает, могут ли хранилище по переданной строке соединения менять другие процессы.
+// Неизвестные схемы считаются общими.
+func Shared(dsn string) bool {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	backend, ok := backends[Scheme(dsn)]
+	return !ok || backend.Shared
+}
+
+// Scheme возвращает схему строки соединения в нижнем регистре.
+// Строки соединения Postgres в формате "ключ=значение" схемы не имеют и считаются строками Postgres.
+func Scheme(dsn string) string {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return postgresScheme
+	}
+	return strings.ToLower(scheme)
+}
+
+// DSN возвращает строку соединения с основным хранилищем из конфигурации приложения.
+// Если строка соединения с БД не задана, используется файловое хранилище,
+// а если не задан и путь к нему - хранилище только в памяти.
+func DSN(cfg *config.Config) string {
+	switch {
+	case cfg.DatabaseDSN != "":
+		return cfg.DatabaseDSN
+	case cfg.FileStoragePath != "":
+		return fileScheme + "://" + cfg.FileStoragePath
+	default:
+		return memoryScheme + "://"
+	}
+}
+
+// pingHealth проверяет работоспособность хранилища, которое умеет отвечать на пинг.
+func pingHealth(ctx context.Context, repo interfaces.Repository) error {
+	pinger, ok := repo.(interface{ Ping(context.Context) error })
+	if !ok {
+		return nil
+	}
+	return pinger.Ping(ctx)
+}
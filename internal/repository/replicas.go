@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RomanAgaltsev/urlcut/internal/database/queries"
+)
+
+const (
+	// replicaProbeInterval - интервал повторной проверки недоступных реплик.
+	replicaProbeInterval = 5 * time.Second
+
+	// replicaProbeTimeout - таймаут пинга реплики при проверке.
+	replicaProbeTimeout = 2 * time.Second
+)
+
+// ErrReplicaUnavailable ошибка недоступной реплики БД.
+var ErrReplicaUnavailable = fmt.Errorf("DB replica is unavailable")
+
+// replica - реплика БД только для чтения.
+type replica struct {
+	db      *sql.DB          // Соединение с репликой
+	q       *queries.Queries // Запросы к реплике, без подготовки - реплика может быть недоступна
+	healthy atomic.Bool      // Признак доступности реплики
+}
+
+// replicaSet - набор реплик БД, между которыми по кругу распределяются читающие запросы.
+// Реплика, запрос к которой завершился ошибкой, исключается из распределения
+// и возвращается в него после успешной фоновой проверки.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64 // Счетчик для распределения запросов по кругу
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newReplicaSet создает набор реплик и запускает фоновую проверку недоступных реплик.
+// Если реплик нет, возвращается nil - все запросы выполняются на основной БД.
+func newReplicaSet(dbs []*sql.DB, probeInterval time.Duration) *replicaSet {
+	if len(dbs) == 0 {
+		return nil
+	}
+
+	s := &replicaSet{
+		replicas: make([]*replica, 0, len(dbs)),
+		done:     make(chan struct{}),
+	}
+	for _, db := range dbs {
+		rep := &replica{
+			db: db,
+			q:  queries.New(db),
+		}
+		// Реплика считается доступной, пока запрос к ней не завершится ошибкой
+		rep.healthy.Store(true)
+		s.replicas = append(s.replicas, rep)
+	}
+
+	s.wg.Add(1)
+	go s.probeLoop(probeInterval)
+
+	return s
+}
+
+// pick возвращает следующую по кругу доступную реплику или nil, если доступных реплик нет.
+func (s *replicaSet) pick() *replica {
+	if s == nil {
+		return nil
+	}
+
+	n := uint64(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		rep := s.replicas[(start+i)%n]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+
+	return nil
+}
+
+// markFailed исключает реплику из распределения запросов до успешной проверки.
+func (s *replicaSet) markFailed(ctx context.Context, rep *replica, err error) {
+	if rep.healthy.CompareAndSwap(true, false) {
+		slog.WarnContext(ctx, "DB replica is unavailable, reads fall back to primary", slog.String("error", err.Error()))
+	}
+}
+
+// health возвращает состояние реплик по их именам вида "postgres_replica_1".
+func (s *replicaSet) health() map[string]error {
+	if s == nil {
+		return nil
+	}
+
+	health := make(map[string]error, len(s.replicas))
+	for i, rep := range s.replicas {
+		var err error
+		if !rep.healthy.Load() {
+			err = ErrReplicaUnavailable
+		}
+		health[fmt.Sprintf("postgres_replica_%d", i+1)] = err
+	}
+	return health
+}
+
+// probe пингует недоступные реплики и возвращает в распределение ответившие.
+func (s *replicaSet) probe(ctx context.Context) {
+	for _, rep := range s.replicas {
+		if rep.healthy.Load() {
+			continue
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, replicaProbeTimeout)
+		err := rep.db.PingContext(pingCtx)
+		cancel()
+
+		if err == nil && rep.healthy.CompareAndSwap(false, true) {
+			slog.Info("DB replica is available again")
+		}
+	}
+}
+
+// probeLoop периодически проверяет недоступные реплики до закрытия набора.
+func (s *replicaSet) probeLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.probe(context.Background())
+		}
+	}
+}
+
+// close останавливает фоновую проверку и закрывает соединения с репликами.
+func (s *replicaSet) close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+
+		errs := make([]error, 0, len(s.replicas))
+		for _, rep := range s.replicas {
+			errs = append(errs, rep.db.Close())
+		}
+		s.closeErr = errors.Join(errs...)
+	})
+
+	return s.closeErr
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/random"
+)
+
+func TestDBRepositoryReplicas(t *testing.T) {
+	const BaseURL = "http://localhost:8080"
+
+	urlID := random.String(8)
+	longURL := fmt.Sprintf("https://%s.%s", random.String(20), random.String(3))
+	uid, _ := uuid.NewRandom()
+
+	columns := []string{"id", "long_url", "base_url", "url_id", "created_at", "uid", "is_deleted"}
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(columns).AddRow(1, longURL, BaseURL, urlID, time.Now(), uid, false)
+	}
+
+	// newMock создает мок БД, который проверяет и пинги
+	newMock := func(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		return db, mock
+	}
+
+	t.Run("round robin", func(t *testing.T) {
+		primary, primaryMock := newMock(t)
+		replica1, replica1Mock := newMock(t)
+		replica2, replica2Mock := newMock(t)
+
+		for _, mock := range []sqlmock.Sqlmock{replica1Mock, replica2Mock} {
+			mock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnRows(rows())
+			mock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnRows(rows())
+			mock.ExpectQuery("(.*)SELECT(.*)").WithArgs(uid).WillReturnRows(rows())
+			mock.ExpectClose()
+		}
+		primaryMock.ExpectClose()
+
+		repo, err := NewDBRepository(primary, replica1, replica2)
+		require.NoError(t, err)
+
+		// Запросы распределяются между репликами по очереди
+		for i := 0; i < 4; i++ {
+			url, err := repo.Get(context.TODO(), urlID)
+			require.NoError(t, err)
+			assert.Equal(t, longURL, url.Long)
+		}
+		for i := 0; i < 2; i++ {
+			urls, err := repo.GetUserURLs(context.TODO(), uid)
+			require.NoError(t, err)
+			assert.Len(t, urls, 1)
+		}
+
+		require.NoError(t, repo.Close())
+		require.NoError(t, primaryMock.ExpectationsWereMet())
+		require.NoError(t, replica1Mock.ExpectationsWereMet())
+		require.NoError(t, replica2Mock.ExpectationsWereMet())
+	})
+
+	t.Run("lagging replica", func(t *testing.T) {
+		primary, primaryMock := newMock(t)
+		replica, replicaMock := newMock(t)
+
+		replicaMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnError(sql.ErrNoRows)
+		primaryMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnRows(rows())
+
+		repo, err := NewDBRepository(primary, replica)
+		require.NoError(t, err)
+
+		url, err := repo.Get(context.TODO(), urlID)
+		require.NoError(t, err)
+		assert.Equal(t, urlID, url.ID)
+
+		// Отставание - не отказ реплики
+		assert.True(t, repo.replicas.replicas[0].healthy.Load())
+
+		require.NoError(t, primaryMock.ExpectationsWereMet())
+		require.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("failover and recovery", func(t *testing.T) {
+		primary, primaryMock := newMock(t)
+		replica, replicaMock := newMock(t)
+
+		replicaMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnError(sql.ErrConnDone)
+		primaryMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnRows(rows())
+		primaryMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(uid).WillReturnRows(rows())
+		replicaMock.ExpectPing().WillReturnError(sql.ErrConnDone)
+		replicaMock.ExpectPing()
+		replicaMock.ExpectQuery("(.*)SELECT(.*)").WithArgs(urlID).WillReturnRows(rows())
+
+		repo, err := NewDBRepository(primary, replica)
+		require.NoError(t, err)
+
+		// Ошибка реплики - запрос повторяется на основной БД, реплика исключается
+		url, err := repo.Get(context.TODO(), urlID)
+		require.NoError(t, err)
+		assert.Equal(t, urlID, url.ID)
+		assert.False(t, repo.replicas.replicas[0].healthy.Load())
+
+		// Пока реплика недоступна, чтение идет с основной БД
+		_, err = repo.GetUserURLs(context.TODO(), uid)
+		require.NoError(t, err)
+
+		// Реплика не ответила на проверку и осталась исключенной
+		repo.replicas.probe(context.TODO())
+		assert.False(t, repo.replicas.replicas[0].healthy.Load())
+
+		// Реплика ответила на проверку и вернулась в распределение
+		repo.replicas.probe(context.TODO())
+		assert.True(t, repo.replicas.replicas[0].healthy.Load())
+
+		_, err = repo.Get(context.TODO(), urlID)
+		require.NoError(t, err)
+
+		require.NoError(t, primaryMock.ExpectationsWereMet())
+		require.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+}
@@ -3,11 +3,14 @@ package repository
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/RomanAgaltsev/urlcut/internal/config"
-	"github.com/RomanAgaltsev/urlcut/internal/database"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
 )
 
 // Переменные ошибок.
@@ -15,28 +18,269 @@ var (
 	// ErrInitRepositoryFailed ошибка инициации репозитория.
 	ErrInitRepositoryFailed = fmt.Errorf("failed to init repository")
 
+	// ErrUnknownRedisMode ошибка неизвестного режима использования Redis.
+	ErrUnknownRedisMode = fmt.Errorf("unknown redis mode")
+
 	// ErrConflict ошибка конфликта данных в БД.
 	ErrConflict = fmt.Errorf("data conflict")
+
+	// ErrDuplicateURL ошибка пакета, в котором один оригинальный URL встречается несколько раз.
+	ErrDuplicateURL = fmt.Errorf("duplicate original URL in batch")
+
+	// ErrIntegrity ошибка нарушения ограничения хранилища, для которого нет конфликтного URL,
+	// например, при совпадении идентификатора сокращенного URL.
+	ErrIntegrity = fmt.Errorf("URL violates storage integrity constraint")
+
+	// ErrTruncateUnsupported ошибка хранилища, не умеющего удалять все URL.
+	ErrTruncateUnsupported = fmt.Errorf("storage does not support truncation")
+
+	// ErrReplaceUnsupported ошибка хранилища, не умеющего атомарно заменять все URL.
+	ErrReplaceUnsupported = fmt.Errorf("storage does not support atomic replacement")
+
+	// ErrQuotaUnsupported ошибка хранилища, не умеющего хранить квоты пользователей.
+	ErrQuotaUnsupported = fmt.Errorf("storage does not support user quotas")
+
+	// ErrQuotaNotFound ошибка отсутствия переопределенных квот пользователя в хранилище.
+	ErrQuotaNotFound = fmt.Errorf("user quota was not found in repository")
+
+	// ErrUserUnsupported ошибка хранилища, не умеющего хранить зарегистрированных пользователей.
+	ErrUserUnsupported = fmt.Errorf("storage does not support registered users")
+
+	// ErrUserNotFound ошибка отсутствия зарегистрированного пользователя в хранилище.
+	ErrUserNotFound = fmt.Errorf("user was not found in repository")
+
+	// ErrUserExists ошибка регистрации пользователя с занятым адресом почты или идентификатором.
+	ErrUserExists = fmt.Errorf("user already exists")
 )
 
+// exportPageSize - размер страницы URL при выгрузке хранилища.
+const exportPageSize = 1000
+
 // New создает и возвращает новый репозиторий в соответствии с переданной конфигурацией приложения.
+// Хранилище выбирается по схеме строки соединения среди зарегистрированных хранилищ.
 func New(cfg *config.Config) (interfaces.Repository, error) {
-	if cfg.DatabaseDSN == "" {
-		return NewInMemoryRepository(cfg.FileStoragePath), nil
+	// С неизвестным режимом Redis молча не использовался бы вовсе
+	if cfg.RedisDSN != "" && cfg.RedisMode != config.RedisModeCache && cfg.RedisMode != config.RedisModeStorage {
+		return nil, fmt.Errorf("%w: %w: %q", ErrInitRepositoryFailed, ErrUnknownRedisMode, cfg.RedisMode)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Открываем новое соединение
-	db, err := database.NewConnection(ctx, "pgx", cfg.DatabaseDSN)
+	repo, err := Open(ctx, storageDSN(cfg), cfg)
 	if err != nil {
-		return nil, ErrInitRepositoryFailed
+		return nil, err
 	}
 
-	dbRepository, err := NewDBRepository(db)
+	// Redis в качестве общего кэша перед основным хранилищем
+	if cfg.RedisDSN != "" && cfg.RedisMode == config.RedisModeCache {
+		client, err := NewRedisClient(ctx, cfg.RedisDSN)
+		if err != nil {
+			_ = repo.Close()
+			return nil, fmt.Errorf("%w: redis cache: %w", ErrInitRepositoryFailed, err)
+		}
+		repo = NewCachedRepository(repo, client, DefaultCacheTTL)
+	}
+
+	// Фильтр Блума перед хранилищем и кэшем - несуществующие URL не доходят ни до одного из них.
+	// Фильтр видит только URL, сохраненные этим процессом, поэтому перед общим хранилищем
+	// он отсеивал бы URL, сохраненные другими экземплярами сервиса, переносом или восстановлением
+	if cfg.BloomFilter && Shared(storageDSN(cfg)) {
+		slog.Warn("Bloom filter is disabled: storage is shared with other processes",
+			slog.String("backend", BackendName(cfg)))
+	}
+	if cfg.BloomFilter && !Shared(storageDSN(cfg)) {
+		filtered, err := NewFilteredRepository(ctx, repo, cfg.BloomFilterCapacity)
+		if err != nil {
+			_ = repo.Close()
+			return nil, fmt.Errorf("%w: bloom filter: %w", ErrInitRepositoryFailed, err)
+		}
+		repo = filtered
+	}
+
+	return repo, nil
+}
+
+// BackendName возвращает схему строки соединения основного хранилища, которое создает New.
+func BackendName(cfg *config.Config) string {
+	return Scheme(storageDSN(cfg))
+}
+
+// storageDSN возвращает строку соединения основного хранилища с учетом режима использования Redis.
+func storageDSN(cfg *config.Config) string {
+	// Redis в качестве самостоятельного хранилища
+	if cfg.RedisDSN != "" && cfg.RedisMode == config.RedisModeStorage {
+		return cfg.RedisDSN
+	}
+	return DSN(cfg)
+}
+
+// ExportURLs вызывает переданную функцию для каждого URL хранилища, включая удаленные.
+// Хранилища, реализующие interfaces.Exporter, выгружают согласованный снимок на один момент времени,
+// остальные обходятся постранично, и изменения во время обхода могут попасть в выгрузку частично.
+func ExportURLs(ctx context.Context, repo interfaces.Repository, fn func(url *model.URL) error) error {
+	if exporter, ok := repo.(interfaces.Exporter); ok {
+		return exporter.ExportURLs(ctx, fn)
+	}
+
+	lastID := ""
+	for {
+		urls, err := repo.ScanURLs(ctx, lastID, exportPageSize)
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+
+		for _, url := range urls {
+			if err = fn(url); err != nil {
+				return err
+			}
+		}
+
+		lastID = urls[len(urls)-1].ID
+	}
+}
+
+// Truncate удаляет все URL из хранилища, если оно реализует interfaces.Truncater.
+func Truncate(ctx context.Context, repo interfaces.Repository) error {
+	truncater, ok := repo.(interfaces.Truncater)
+	if !ok {
+		return ErrTruncateUnsupported
+	}
+	return truncater.Truncate(ctx)
+}
+
+// ReplaceURLs атомарно заменяет все URL хранилища URL, которые функция load передает пакетами
+// в функцию store, если хранилище реализует interfaces.Replacer.
+func ReplaceURLs(ctx context.Context, repo interfaces.Repository, load func(store func(urls []*model.URL) error) error) error {
+	replacer, ok := repo.(interfaces.Replacer)
+	if !ok {
+		return ErrReplaceUnsupported
+	}
+	return replacer.ReplaceURLs(ctx, load)
+}
+
+// URLBatches возвращает функцию загрузки для ReplaceURLs, передающую переданные пакеты URL.
+func URLBatches(batches ...[]*model.URL) func(store func(urls []*model.URL) error) error {
+	return func(store func(urls []*model.URL) error) error {
+		for _, urls := range batches {
+			if err := store(urls); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// GetQuota возвращает переопределенные квоты пользователя, если хранилище реализует interfaces.QuotaStorer.
+func GetQuota(ctx context.Context, repo interfaces.Repository, uid uuid.UUID) (*model.Quota, error) {
+	storer, ok := repo.(interfaces.QuotaStorer)
+	if !ok {
+		return nil, ErrQuotaUnsupported
+	}
+	return storer.GetQuota(ctx, uid)
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя, если хранилище реализует interfaces.QuotaStorer.
+func SetQuota(ctx context.Context, repo interfaces.Repository, uid uuid.UUID, quota model.Quota) error {
+	storer, ok := repo.(interfaces.QuotaStorer)
+	if !ok {
+		return ErrQuotaUnsupported
+	}
+	return storer.SetQuota(ctx, uid, quota)
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя, если хранилище реализует interfaces.QuotaStorer.
+func DeleteQuota(ctx context.Context, repo interfaces.Repository, uid uuid.UUID) error {
+	storer, ok := repo.(interfaces.QuotaStorer)
+	if !ok {
+		return ErrQuotaUnsupported
+	}
+	return storer.DeleteQuota(ctx, uid)
+}
+
+// StoreLimited сохраняет URL пользователя, если после сохранения количество его неудаленных URL
+// не превысит limit. Ограничение не проверяется, если limit не положителен.
+// Хранилища, не реализующие interfaces.LimitedStorer, проверяют квоту по списку URL пользователя
+// не атомарно с сохранением.
+func StoreLimited(ctx context.Context, repo interfaces.Repository, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	if limit <= 0 {
+		return repo.Store(ctx, urls)
+	}
+
+	if storer, ok := repo.(interfaces.LimitedStorer); ok {
+		return storer.StoreLimited(ctx, urls, uid, limit)
+	}
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
 	if err != nil {
-		return nil, ErrInitRepositoryFailed
+		return nil, err
+	}
+	if err = checkLinksQuota(len(userURLs), urls, uid, limit); err != nil {
+		return nil, err
+	}
+
+	return repo.Store(ctx, urls)
+}
+
+// CreateUser сохраняет нового пользователя и передает ему URL анонимного пользователя,
+// если хранилище реализует interfaces.UserStorer.
+func CreateUser(ctx context.Context, repo interfaces.Repository, user *model.User, anonymous uuid.UUID) error {
+	storer, ok := repo.(interfaces.UserStorer)
+	if !ok {
+		return ErrUserUnsupported
+	}
+	return storer.CreateUser(ctx, user, anonymous)
+}
+
+// GetUser возвращает пользователя по идентификатору, если хранилище реализует interfaces.UserStorer.
+func GetUser(ctx context.Context, repo interfaces.Repository, id uuid.UUID) (*model.User, error) {
+	storer, ok := repo.(interfaces.UserStorer)
+	if !ok {
+		return nil, ErrUserUnsupported
+	}
+	return storer.GetUser(ctx, id)
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты, если хранилище реализует interfaces.UserStorer.
+func GetUserByEmail(ctx context.Context, repo interfaces.Repository, email string) (*model.User, error) {
+	storer, ok := repo.(interfaces.UserStorer)
+	if !ok {
+		return nil, ErrUserUnsupported
 	}
-	return dbRepository, nil
+	return storer.GetUserByEmail(ctx, email)
+}
+
+// checkLinksQuota проверяет, что после сохранения пакета у пользователя с count неудаленными URL
+// их будет не больше limit.
+func checkLinksQuota(count int, urls []*model.URL, uid uuid.UUID, limit int) error {
+	for _, url := range urls {
+		if !url.Deleted && url.UID == uid {
+			count++
+		}
+	}
+	return model.CheckQuota(model.QuotaLinks, limit, count)
+}
+
+// checkDuplicateLong проверяет, что неудаленные URL пакета не повторяют оригинальные адреса друг друга.
+// Хранилища проверяют пакет до сохранения - конфликт внутри пакета не с чем сопоставить.
+func checkDuplicateLong(urls []*model.URL) error {
+	if len(urls) < 2 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(urls))
+	for _, url := range urls {
+		if url.Deleted {
+			continue
+		}
+		if _, ok := seen[url.Long]; ok {
+			return fmt.Errorf("%w: %q", ErrDuplicateURL, url.Long)
+		}
+		seen[url.Long] = struct{}{}
+	}
+
+	return nil
 }
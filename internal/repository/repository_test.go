@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RomanAgaltsev/urlcut/internal/config"
@@ -20,4 +22,60 @@ func TestNew(t *testing.T) {
 	repo, err = New(cfg)
 	assert.Error(t, err)
 	assert.Equal(t, repo, nil)
+
+	mr := miniredis.RunT(t)
+
+	cfg = &config.Config{
+		RedisDSN:  "redis://" + mr.Addr(),
+		RedisMode: config.RedisModeStorage,
+	}
+
+	repo, err = New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &RedisRepository{}, repo)
+
+	cfg.RedisMode = "storrage"
+
+	repo, err = New(cfg)
+	assert.ErrorIs(t, err, ErrUnknownRedisMode)
+	assert.Equal(t, repo, nil)
+
+	cfg.RedisMode = config.RedisModeCache
+
+	repo, err = New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &CachedRepository{}, repo)
+
+	cfg.RedisDSN = "redis://localhost:1"
+
+	repo, err = New(cfg)
+	assert.Error(t, err)
+	assert.Equal(t, repo, nil)
+
+	cfg = &config.Config{
+		DatabaseDSN: "sqlite://" + filepath.Join(t.TempDir(), "urlcut.db"),
+	}
+
+	repo, err = New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLiteRepository{}, repo)
+	assert.NoError(t, repo.Close())
+
+	// Фильтр Блума включается только перед хранилищами, которые не меняют другие процессы
+	cfg.BloomFilter = true
+
+	repo, err = New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &SQLiteRepository{}, repo)
+	assert.NoError(t, repo.Close())
+
+	cfg = &config.Config{
+		FileStoragePath: filepath.Join(t.TempDir(), "storage.json"),
+		BloomFilter:     true,
+	}
+
+	repo, err = New(cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &FilteredRepository{}, repo)
+	assert.NoError(t, repo.Close())
 }
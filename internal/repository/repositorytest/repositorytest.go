@@ -0,0 +1,847 @@
+// Пакет repositorytest содержит общий набор тестов контракта хранилища URL.
+// Каждое хранилище, реализующее interfaces.Repository, должно проходить его целиком.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/random"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// Factory создает новое хранилище для очередного теста.
+// Хранилище может быть общим для нескольких тестов - все данные тестов уникальны.
+// Закрытие хранилища, если оно требуется, фабрика регистрирует через t.Cleanup.
+type Factory func(t *testing.T) interfaces.Repository
+
+// baseURL - базовый адрес сокращенных URL в тестах.
+const baseURL = "http://localhost:8080"
+
+// Run выполняет набор тестов контракта для хранилища, создаваемого переданной фабрикой.
+func Run(t *testing.T, newRepo Factory) {
+	t.Run("Store", func(t *testing.T) { testStore(t, newRepo(t)) })
+	t.Run("GetNotFound", func(t *testing.T) { testGetNotFound(t, newRepo(t)) })
+	t.Run("Conflict", func(t *testing.T) { testConflict(t, newRepo(t)) })
+	t.Run("BatchConflict", func(t *testing.T) { testBatchConflict(t, newRepo(t)) })
+	t.Run("BatchDuplicate", func(t *testing.T) { testBatchDuplicate(t, newRepo(t)) })
+	t.Run("GetUserURLs", func(t *testing.T) { testGetUserURLs(t, newRepo(t)) })
+	t.Run("DeleteURLs", func(t *testing.T) { testDeleteURLs(t, newRepo(t)) })
+	t.Run("StoreDeleted", func(t *testing.T) { testStoreDeleted(t, newRepo(t)) })
+	t.Run("StoreMarkedDeleted", func(t *testing.T) { testStoreMarkedDeleted(t, newRepo(t)) })
+	t.Run("DeleteReshortened", func(t *testing.T) { testDeleteReshortened(t, newRepo(t)) })
+	t.Run("StoreDeletedSameLong", func(t *testing.T) { testStoreDeletedSameLong(t, newRepo(t)) })
+	t.Run("StoreExistingID", func(t *testing.T) { testStoreExistingID(t, newRepo(t)) })
+	t.Run("ScanURLs", func(t *testing.T) { testScanURLs(t, newRepo(t)) })
+	t.Run("Export", func(t *testing.T) { testExport(t, newRepo(t)) })
+	t.Run("Truncate", func(t *testing.T) { testTruncate(t, newRepo(t)) })
+	t.Run("Replace", func(t *testing.T) { testReplace(t, newRepo(t)) })
+	t.Run("Quotas", func(t *testing.T) { testQuotas(t, newRepo(t)) })
+	t.Run("StoreLimited", func(t *testing.T) { testStoreLimited(t, newRepo(t)) })
+	t.Run("StoreLimitedConcurrent", func(t *testing.T) { testStoreLimitedConcurrent(t, newRepo(t)) })
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newRepo(t)) })
+	t.Run("Health", func(t *testing.T) { testHealth(t, newRepo(t)) })
+	t.Run("Close", func(t *testing.T) { testClose(t, newRepo) })
+}
+
+// newURL создает URL со случайными оригинальным адресом и идентификатором.
+func newURL(uid uuid.UUID) *model.URL {
+	return &model.URL{
+		Long: fmt.Sprintf("https://%s.example.com/%s", random.String(8), random.String(16)),
+		Base: baseURL,
+		ID:   random.String(8),
+		UID:  uid,
+	}
+}
+
+// ids возвращает отсортированные идентификаторы переданных URL.
+func ids(urls []*model.URL) []string {
+	result := make([]string, 0, len(urls))
+	for _, url := range urls {
+		result = append(result, url.ID)
+	}
+	return result
+}
+
+func testStore(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	url := newURL(uuid.New())
+
+	urlStore, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+	assert.Nil(t, urlStore)
+
+	urlGet, err := repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	require.NotNil(t, urlGet)
+	assert.Equal(t, url.Long, urlGet.Long)
+	assert.Equal(t, url.Base, urlGet.Base)
+	assert.Equal(t, url.ID, urlGet.ID)
+	assert.Equal(t, url.UID, urlGet.UID)
+	assert.False(t, urlGet.Deleted)
+}
+
+func testGetNotFound(t *testing.T, repo interfaces.Repository) {
+	urlGet, err := repo.Get(context.Background(), random.String(8))
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+	assert.Nil(t, urlGet)
+}
+
+func testConflict(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	url := newURL(uuid.New())
+
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	// Тот же оригинальный URL от другого пользователя под другим идентификатором
+	dup := newURL(uuid.New())
+	dup.Long = url.Long
+
+	urlConflict, err := repo.Store(ctx, []*model.URL{dup})
+	require.ErrorIs(t, err, repository.ErrConflict)
+	require.NotNil(t, urlConflict)
+	assert.Equal(t, url.ID, urlConflict.ID)
+	assert.Equal(t, url.Long, urlConflict.Long)
+
+	_, err = repo.Get(ctx, dup.ID)
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+}
+
+func testBatchConflict(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+	url := newURL(uid)
+
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	// Конфликт в середине пакета отменяет сохранение всего пакета
+	first, last := newURL(uid), newURL(uid)
+	dup := newURL(uid)
+	dup.Long = url.Long
+
+	urlConflict, err := repo.Store(ctx, []*model.URL{first, dup, last})
+	require.ErrorIs(t, err, repository.ErrConflict)
+	require.NotNil(t, urlConflict)
+	assert.Equal(t, url.ID, urlConflict.ID)
+
+	for _, u := range []*model.URL{first, dup, last} {
+		_, err = repo.Get(ctx, u.ID)
+		assert.ErrorIs(t, err, repository.ErrIDNotFound, u.ID)
+	}
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{url.ID}, ids(userURLs))
+}
+
+func testBatchDuplicate(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	// Повтор оригинального URL внутри пакета отклоняет весь пакет
+	first, dup := newURL(uid), newURL(uid)
+	dup.Long = first.Long
+
+	_, err := repo.Store(ctx, []*model.URL{first, dup})
+	require.ErrorIs(t, err, repository.ErrDuplicateURL)
+
+	for _, u := range []*model.URL{first, dup} {
+		_, err = repo.Get(ctx, u.ID)
+		assert.ErrorIs(t, err, repository.ErrIDNotFound, u.ID)
+	}
+}
+
+func testGetUserURLs(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid, otherUID := uuid.New(), uuid.New()
+
+	urls := []*model.URL{newURL(uid), newURL(uid), newURL(uid)}
+	_, err := repo.Store(ctx, urls)
+	require.NoError(t, err)
+
+	_, err = repo.Store(ctx, []*model.URL{newURL(otherUID)})
+	require.NoError(t, err)
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, ids(urls), ids(userURLs))
+	for _, url := range userURLs {
+		assert.Equal(t, uid, url.UID)
+		assert.Equal(t, baseURL, url.Base)
+		assert.NotEmpty(t, url.Long)
+	}
+
+	// У нового пользователя ссылок нет, но это не ошибка
+	userURLs, err = repo.GetUserURLs(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, userURLs)
+}
+
+func testDeleteURLs(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url, kept := newURL(uid), newURL(uid)
+	_, err := repo.Store(ctx, []*model.URL{url, kept})
+	require.NoError(t, err)
+
+	// Чужой пользователь удалить URL не может
+	err = repo.DeleteURLs(ctx, []*model.URL{{ID: url.ID, UID: uuid.New()}})
+	require.NoError(t, err)
+
+	urlGet, err := repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	assert.False(t, urlGet.Deleted)
+
+	// Владелец удаляет, отсутствующие идентификаторы игнорируются
+	err = repo.DeleteURLs(ctx, []*model.URL{{ID: url.ID, UID: uid}, {ID: random.String(8), UID: uid}})
+	require.NoError(t, err)
+
+	urlGet, err = repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+	assert.Equal(t, url.Long, urlGet.Long)
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{kept.ID}, ids(userURLs))
+
+	// Пустой список на удаление допустим
+	err = repo.DeleteURLs(ctx, []*model.URL{})
+	require.NoError(t, err)
+}
+
+func testStoreDeleted(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url := newURL(uid)
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	err = repo.DeleteURLs(ctx, []*model.URL{{ID: url.ID, UID: uid}})
+	require.NoError(t, err)
+
+	// Удаленный оригинальный URL можно сократить заново
+	again := newURL(uid)
+	again.Long = url.Long
+
+	urlStore, err := repo.Store(ctx, []*model.URL{again})
+	require.NoError(t, err)
+	assert.Nil(t, urlStore)
+
+	urlGet, err := repo.Get(ctx, again.ID)
+	require.NoError(t, err)
+	assert.False(t, urlGet.Deleted)
+}
+
+func testDeleteReshortened(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url := newURL(uid)
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{{ID: url.ID, UID: uid}}))
+
+	again := newURL(uid)
+	again.Long = url.Long
+	_, err = repo.Store(ctx, []*model.URL{again})
+	require.NoError(t, err)
+
+	// Повторно сокращенный URL удаляется так же, как первый
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{{ID: again.ID, UID: uid}}))
+
+	for _, id := range []string{url.ID, again.ID} {
+		urlGet, err := repo.Get(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, urlGet.Deleted, id)
+	}
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Empty(t, userURLs)
+}
+
+func testStoreDeletedSameLong(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	// Удаленные URL с одним оригинальным адресом не конфликтуют друг с другом
+	first := newURL(uid)
+	first.Deleted = true
+	second := newURL(uid)
+	second.Long = first.Long
+	second.Deleted = true
+
+	_, err := repo.Store(ctx, []*model.URL{first})
+	require.NoError(t, err)
+	_, err = repo.Store(ctx, []*model.URL{second})
+	require.NoError(t, err)
+
+	for _, id := range []string{first.ID, second.ID} {
+		urlGet, err := repo.Get(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, urlGet.Deleted, id)
+	}
+
+	// Оригинальный адрес остается свободным
+	live := newURL(uid)
+	live.Long = first.Long
+	_, err = repo.Store(ctx, []*model.URL{live})
+	require.NoError(t, err)
+}
+
+func testStoreExistingID(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	owner := uuid.New()
+	other := uuid.New()
+
+	url := newURL(owner)
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	// Занятый идентификатор не перезаписывается URL другого пользователя
+	collision := newURL(other)
+	collision.ID = url.ID
+	_, err = repo.Store(ctx, []*model.URL{collision})
+	require.ErrorIs(t, err, repository.ErrIntegrity)
+
+	// Повтор идентификатора внутри пакета тоже отклоняется целиком
+	first := newURL(other)
+	second := newURL(other)
+	second.ID = first.ID
+	_, err = repo.Store(ctx, []*model.URL{first, second})
+	require.ErrorIs(t, err, repository.ErrIntegrity)
+
+	urlGet, err := repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	assert.Equal(t, url.Long, urlGet.Long)
+	assert.Equal(t, owner, urlGet.UID)
+
+	ownerURLs, err := repo.GetUserURLs(ctx, owner)
+	require.NoError(t, err)
+	assert.Equal(t, []string{url.ID}, ids(ownerURLs))
+
+	otherURLs, err := repo.GetUserURLs(ctx, other)
+	require.NoError(t, err)
+	assert.Empty(t, otherURLs)
+}
+
+func testStoreMarkedDeleted(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url := newURL(uid)
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	// URL с пометкой удаления сохраняется удаленным и не конфликтует с неудаленным
+	deleted := newURL(uid)
+	deleted.Long = url.Long
+	deleted.Deleted = true
+
+	_, err = repo.Store(ctx, []*model.URL{deleted})
+	require.NoError(t, err)
+
+	urlGet, err := repo.Get(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{url.ID}, ids(userURLs))
+
+	// Оригинальный URL по-прежнему занят неудаленным URL
+	dup := newURL(uuid.New())
+	dup.Long = url.Long
+
+	urlConflict, err := repo.Store(ctx, []*model.URL{dup})
+	require.ErrorIs(t, err, repository.ErrConflict)
+	assert.Equal(t, url.ID, urlConflict.ID)
+}
+
+func testScanURLs(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	urls := []*model.URL{newURL(uid), newURL(uid), newURL(uid), newURL(uid), newURL(uid)}
+	_, err := repo.Store(ctx, urls)
+	require.NoError(t, err)
+
+	err = repo.DeleteURLs(ctx, []*model.URL{{ID: urls[0].ID, UID: uid}})
+	require.NoError(t, err)
+
+	// Обходим хранилище маленькими страницами - каждый URL встречается ровно один раз
+	scanned := make(map[string]*model.URL)
+	lastID := ""
+	for {
+		page, err := repo.ScanURLs(ctx, lastID, 2)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 2)
+		if len(page) == 0 {
+			break
+		}
+		for _, url := range page {
+			require.NotContains(t, scanned, url.ID)
+			scanned[url.ID] = url
+		}
+		lastID = page[len(page)-1].ID
+	}
+
+	for i, url := range urls {
+		require.Contains(t, scanned, url.ID)
+		assert.Equal(t, url.Long, scanned[url.ID].Long)
+		assert.Equal(t, url.Base, scanned[url.ID].Base)
+		assert.Equal(t, uid, scanned[url.ID].UID)
+		// Удаленные URL тоже возвращаются
+		assert.Equal(t, i == 0, scanned[url.ID].Deleted)
+	}
+}
+
+func testExport(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	urls := []*model.URL{newURL(uid), newURL(uid), newURL(uid)}
+	_, err := repo.Store(ctx, urls)
+	require.NoError(t, err)
+
+	err = repo.DeleteURLs(ctx, []*model.URL{{ID: urls[0].ID, UID: uid}})
+	require.NoError(t, err)
+
+	exported := make(map[string]*model.URL)
+	err = repository.ExportURLs(ctx, repo, func(url *model.URL) error {
+		require.NotContains(t, exported, url.ID)
+		exported[url.ID] = url
+		return nil
+	})
+	require.NoError(t, err)
+
+	for i, url := range urls {
+		require.Contains(t, exported, url.ID)
+		assert.Equal(t, url.Long, exported[url.ID].Long)
+		assert.Equal(t, uid, exported[url.ID].UID)
+		assert.Equal(t, i == 0, exported[url.ID].Deleted)
+	}
+}
+
+func testTruncate(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.Truncater); !ok {
+		t.Skip("storage does not implement interfaces.Truncater")
+	}
+
+	ctx := context.Background()
+	url := newURL(uuid.New())
+
+	_, err := repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+
+	err = repository.Truncate(ctx, repo)
+	require.NoError(t, err)
+
+	_, err = repo.Get(ctx, url.ID)
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+
+	urls, err := repo.ScanURLs(ctx, "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	// После очистки оригинальный URL можно сохранить снова
+	_, err = repo.Store(ctx, []*model.URL{url})
+	require.NoError(t, err)
+}
+
+func testReplace(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.Replacer); !ok {
+		t.Skip("storage does not implement interfaces.Replacer")
+	}
+
+	ctx := context.Background()
+	uid := uuid.New()
+	old := newURL(uid)
+
+	_, err := repo.Store(ctx, []*model.URL{old})
+	require.NoError(t, err)
+
+	// Удаленный URL и его повторное сокращение с тем же оригинальным адресом
+	deleted := newURL(uid)
+	deleted.Deleted = true
+	again := newURL(uid)
+	again.Long = deleted.Long
+
+	err = repository.ReplaceURLs(ctx, repo, repository.URLBatches([]*model.URL{deleted}, []*model.URL{again}))
+	require.NoError(t, err)
+
+	_, err = repo.Get(ctx, old.ID)
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+
+	got, err := repo.Get(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.True(t, got.Deleted)
+
+	got, err = repo.Get(ctx, again.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Deleted)
+
+	// Неудачная замена оставляет прежние URL
+	dup := newURL(uid)
+	dup.Long = again.Long
+	err = repository.ReplaceURLs(ctx, repo, repository.URLBatches([]*model.URL{newURL(uid), dup, again}))
+	require.ErrorIs(t, err, repository.ErrDuplicateURL)
+
+	// Ограничения проверяются и между пакетами
+	err = repository.ReplaceURLs(ctx, repo, repository.URLBatches([]*model.URL{newURL(uid), again}, []*model.URL{dup}))
+	require.ErrorIs(t, err, repository.ErrDuplicateURL)
+
+	same := newURL(uid)
+	same.ID = again.ID
+	err = repository.ReplaceURLs(ctx, repo, repository.URLBatches([]*model.URL{again}, []*model.URL{same}))
+	require.ErrorIs(t, err, repository.ErrIntegrity)
+
+	// Ошибка загрузки тоже оставляет прежние URL
+	errLoad := errors.New("load failed")
+	err = repository.ReplaceURLs(ctx, repo, func(store func(urls []*model.URL) error) error {
+		if err := store([]*model.URL{newURL(uid)}); err != nil {
+			return err
+		}
+		return errLoad
+	})
+	require.ErrorIs(t, err, errLoad)
+
+	_, err = repo.Get(ctx, again.ID)
+	assert.NoError(t, err)
+	_, err = repo.Get(ctx, deleted.ID)
+	assert.NoError(t, err)
+}
+
+func testQuotas(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.QuotaStorer); !ok {
+		t.Skip("storage does not implement interfaces.QuotaStorer")
+	}
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	_, err := repository.GetQuota(ctx, repo, uid)
+	assert.ErrorIs(t, err, repository.ErrQuotaNotFound)
+
+	quota := model.Quota{MaxLinks: 10, MaxBatchSize: -1}
+	require.NoError(t, repository.SetQuota(ctx, repo, uid, quota))
+
+	got, err := repository.GetQuota(ctx, repo, uid)
+	require.NoError(t, err)
+	assert.Equal(t, quota, *got)
+
+	// Повторное сохранение заменяет квоты
+	quota = model.Quota{MaxURLLength: 100}
+	require.NoError(t, repository.SetQuota(ctx, repo, uid, quota))
+
+	got, err = repository.GetQuota(ctx, repo, uid)
+	require.NoError(t, err)
+	assert.Equal(t, quota, *got)
+
+	// Квоты других пользователей не затрагиваются
+	_, err = repository.GetQuota(ctx, repo, uuid.New())
+	assert.ErrorIs(t, err, repository.ErrQuotaNotFound)
+
+	require.NoError(t, repository.DeleteQuota(ctx, repo, uid))
+	_, err = repository.GetQuota(ctx, repo, uid)
+	assert.ErrorIs(t, err, repository.ErrQuotaNotFound)
+
+	// Удаление отсутствующих квот не является ошибкой
+	require.NoError(t, repository.DeleteQuota(ctx, repo, uid))
+}
+
+// storeLimited сохраняет один новый URL пользователя с ограничением количества URL.
+func storeLimited(repo interfaces.Repository, uid uuid.UUID, limit int) (*model.URL, error) {
+	url := newURL(uid)
+	_, err := repository.StoreLimited(context.Background(), repo, []*model.URL{url}, uid, limit)
+	return url, err
+}
+
+func testStoreLimited(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.LimitedStorer); !ok {
+		t.Skip("storage does not implement interfaces.LimitedStorer")
+	}
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	stored := []*model.URL{newURL(uid), newURL(uid)}
+	_, err := repository.StoreLimited(ctx, repo, stored, uid, 3)
+	require.NoError(t, err)
+
+	// Пакет, превышающий квоту, не сохраняется целиком
+	batch := []*model.URL{newURL(uid), newURL(uid)}
+	_, err = repository.StoreLimited(ctx, repo, batch, uid, 3)
+	var quotaErr *model.QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, model.QuotaError{Quota: model.QuotaLinks, Limit: 3, Actual: 4}, *quotaErr)
+	for _, url := range batch {
+		_, err = repo.Get(ctx, url.ID)
+		assert.ErrorIs(t, err, repository.ErrIDNotFound)
+	}
+
+	// URL, сохраненные без ограничения, тоже учитываются
+	plain := newURL(uid)
+	_, err = repo.Store(ctx, []*model.URL{plain})
+	require.NoError(t, err)
+	_, err = storeLimited(repo, uid, 3)
+	require.ErrorIs(t, err, model.ErrQuotaExceeded)
+
+	// Квота проверяется до конфликтов
+	_, err = repository.StoreLimited(ctx, repo, []*model.URL{{Long: plain.Long, Base: baseURL, ID: random.String(8), UID: uid}}, uid, 3)
+	require.ErrorIs(t, err, model.ErrQuotaExceeded)
+
+	// Удаленные URL освобождают квоту, повторное удаление ее не меняет
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{{ID: plain.ID, UID: uid}}))
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{{ID: plain.ID, UID: uid}}))
+	_, err = storeLimited(repo, uid, 3)
+	require.NoError(t, err)
+	_, err = storeLimited(repo, uid, 3)
+	require.ErrorIs(t, err, model.ErrQuotaExceeded)
+
+	// URL других пользователей не учитываются
+	_, err = storeLimited(repo, uuid.New(), 1)
+	require.NoError(t, err)
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Len(t, userURLs, 3)
+
+	// URL, переданные зарегистрированному пользователю, учитываются в его квоте
+	if _, ok := repo.(interfaces.UserStorer); !ok {
+		return
+	}
+	anonymous := uuid.New()
+	_, err = repository.StoreLimited(ctx, repo, []*model.URL{newURL(anonymous), newURL(anonymous)}, anonymous, 2)
+	require.NoError(t, err)
+
+	user := newUser()
+	_, err = storeLimited(repo, user.ID, 3)
+	require.NoError(t, err)
+	require.NoError(t, repository.CreateUser(ctx, repo, user, anonymous))
+
+	_, err = storeLimited(repo, user.ID, 3)
+	require.ErrorIs(t, err, model.ErrQuotaExceeded)
+	_, err = storeLimited(repo, anonymous, 1)
+	require.NoError(t, err)
+}
+
+func testStoreLimitedConcurrent(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.LimitedStorer); !ok {
+		t.Skip("storage does not implement interfaces.LimitedStorer")
+	}
+
+	uid := uuid.New()
+
+	const workers = 50
+	const limit = 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	// Все сохранения начинаются одновременно
+	start := make(chan struct{})
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := storeLimited(repo, uid, limit)
+			errs <- err
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	exceeded := 0
+	for err := range errs {
+		if errors.Is(err, model.ErrQuotaExceeded) {
+			exceeded++
+			continue
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, workers-limit, exceeded)
+
+	userURLs, err := repo.GetUserURLs(context.Background(), uid)
+	require.NoError(t, err)
+	assert.Len(t, userURLs, limit)
+}
+
+func testUsers(t *testing.T, repo interfaces.Repository) {
+	if _, ok := repo.(interfaces.UserStorer); !ok {
+		t.Skip("storage does not implement interfaces.UserStorer")
+	}
+
+	ctx := context.Background()
+	user := newUser()
+
+	_, err := repository.GetUser(ctx, repo, user.ID)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = repository.GetUserByEmail(ctx, repo, user.Email)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	require.NoError(t, repository.CreateUser(ctx, repo, user, uuid.New()))
+
+	got, err := repository.GetUser(ctx, repo, user.ID)
+	require.NoError(t, err)
+	assertUser(t, user, got)
+
+	got, err = repository.GetUserByEmail(ctx, repo, user.Email)
+	require.NoError(t, err)
+	assertUser(t, user, got)
+
+	// Адрес почты и идентификатор уникальны
+	other := *user
+	other.ID = uuid.New()
+	assert.ErrorIs(t, repository.CreateUser(ctx, repo, &other, uuid.New()), repository.ErrUserExists)
+
+	other = *user
+	other.Email = uuid.NewString() + "@example.com"
+	assert.ErrorIs(t, repository.CreateUser(ctx, repo, &other, uuid.New()), repository.ErrUserExists)
+	_, err = repository.GetUserByEmail(ctx, repo, other.Email)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Неудаленные URL анонимного пользователя передаются зарегистрированному
+	anonymous := uuid.New()
+	live, deleted := newURL(anonymous), newURL(anonymous)
+	_, err = repo.Store(ctx, []*model.URL{live, deleted})
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteURLs(ctx, []*model.URL{deleted}))
+	_, err = repo.Get(ctx, live.ID)
+	require.NoError(t, err)
+
+	account := newUser()
+	require.NoError(t, repository.CreateUser(ctx, repo, account, anonymous))
+
+	urls, err := repo.GetUserURLs(ctx, account.ID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, live.ID, urls[0].ID)
+
+	urls, err = repo.GetUserURLs(ctx, anonymous)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	url, err := repo.Get(ctx, live.ID)
+	require.NoError(t, err)
+	assert.Equal(t, account.ID, url.UID)
+
+	url, err = repo.Get(ctx, deleted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, anonymous, url.UID)
+
+	// URL зарегистрированного пользователя не передаются
+	require.NoError(t, repository.CreateUser(ctx, repo, newUser(), account.ID))
+	urls, err = repo.GetUserURLs(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 1)
+
+	// Пользователи переживают очистку хранилища URL
+	if _, ok := repo.(interfaces.Truncater); ok {
+		require.NoError(t, repository.Truncate(ctx, repo))
+		_, err = repository.GetUser(ctx, repo, user.ID)
+		assert.NoError(t, err)
+	}
+}
+
+// newUser возвращает нового пользователя с уникальными идентификатором и адресом почты.
+func newUser() *model.User {
+	id := uuid.New()
+	return &model.User{
+		ID:           id,
+		Email:        id.String() + "@example.com",
+		PasswordHash: "$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA",
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// assertUser сравнивает пользователей с точностью хранения времени создания.
+func assertUser(t *testing.T, want, got *model.User) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Email, got.Email)
+	assert.Equal(t, want.PasswordHash, got.PasswordHash)
+	assert.WithinDuration(t, want.CreatedAt, got.CreatedAt, time.Second)
+}
+
+func testConcurrent(t *testing.T, repo interfaces.Repository) {
+	ctx := context.Background()
+	uid := uuid.New()
+
+	const workers = 8
+	const perWorker = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*3)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				url := newURL(uid)
+				if _, err := repo.Store(ctx, []*model.URL{url}); err != nil {
+					errs <- err
+					continue
+				}
+				if _, err := repo.Get(ctx, url.ID); err != nil {
+					errs <- err
+				}
+				if _, err := repo.GetUserURLs(ctx, uid); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	userURLs, err := repo.GetUserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Len(t, userURLs, workers*perWorker)
+}
+
+func testHealth(t *testing.T, repo interfaces.Repository) {
+	health := repo.Health(context.TODO())
+	require.NotEmpty(t, health)
+
+	// Открытое хранилище работоспособно, необязательные зависимости могут быть не настроены
+	for name, check := range health {
+		if !check.Optional {
+			assert.True(t, check.Up(), "%s: %s", name, check.Error)
+		}
+	}
+}
+
+func testClose(t *testing.T, newRepo Factory) {
+	repo := newRepo(t)
+
+	_, err := repo.Store(context.Background(), []*model.URL{newURL(uuid.New())})
+	require.NoError(t, err)
+
+	assert.NoError(t, repo.Close())
+}
@@ -0,0 +1,405 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+// shardCount - количество сегментов мап in memory хранилища, должно быть степенью двойки.
+// Каждый сегмент защищен своим мьютексом, поэтому запросы к разным сегментам не блокируют друг друга.
+const shardCount = 64
+
+// idIndexMergeSize - количество новых идентификаторов, после которого они вливаются
+// в отсортированную часть индекса идентификаторов.
+const idIndexMergeSize = 1024
+
+// urlShard - сегмент мапы URL по идентификатору.
+type urlShard struct {
+	mu   sync.RWMutex
+	urls map[string]*model.URL
+}
+
+// longShard - сегмент индекса неудаленных URL по оригинальному адресу.
+type longShard struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// userShard - сегмент индекса идентификаторов неудаленных URL по пользователю.
+type userShard struct {
+	mu  sync.RWMutex
+	ids map[uuid.UUID]map[string]struct{}
+}
+
+// idIndex - индекс идентификаторов всех URL для постраничного обхода в порядке возрастания.
+// Новые идентификаторы копятся отдельно и вливаются в отсортированную часть пачками,
+// поэтому страница выбирается без сортировки всех идентификаторов.
+// Идентификаторы только добавляются - удаленные URL остаются в хранилище.
+type idIndex struct {
+	mu      sync.Mutex
+	sorted  []string // отсортированные идентификаторы
+	pending []string // идентификаторы, добавленные после последнего вливания
+}
+
+// add добавляет в индекс идентификатор нового URL.
+func (x *idIndex) add(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.pending = append(x.pending, id)
+	if len(x.pending) >= idIndexMergeSize {
+		x.merge()
+	}
+}
+
+// merge вливает новые идентификаторы в отсортированную часть индекса.
+// Вызывающий должен держать мьютекс индекса.
+func (x *idIndex) merge() {
+	if len(x.pending) == 0 {
+		return
+	}
+	sort.Strings(x.pending)
+
+	merged := make([]string, 0, len(x.sorted)+len(x.pending))
+	i, j := 0, 0
+	for i < len(x.sorted) && j < len(x.pending) {
+		if x.sorted[i] < x.pending[j] {
+			merged = append(merged, x.sorted[i])
+			i++
+		} else {
+			merged = append(merged, x.pending[j])
+			j++
+		}
+	}
+	merged = append(merged, x.sorted[i:]...)
+	merged = append(merged, x.pending[j:]...)
+
+	x.sorted = merged
+	x.pending = nil
+}
+
+// page возвращает не более limit идентификаторов больше переданного в порядке возрастания.
+func (x *idIndex) page(afterID string, limit int) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// Новых идентификаторов немного - достаточно отсортировать их самих
+	sort.Strings(x.pending)
+
+	i := sort.SearchStrings(x.sorted, afterID)
+	if i < len(x.sorted) && x.sorted[i] == afterID {
+		i++
+	}
+	j := sort.SearchStrings(x.pending, afterID)
+	if j < len(x.pending) && x.pending[j] == afterID {
+		j++
+	}
+
+	ids := make([]string, 0, limit)
+	for len(ids) < limit && (i < len(x.sorted) || j < len(x.pending)) {
+		if j == len(x.pending) || (i < len(x.sorted) && x.sorted[i] < x.pending[j]) {
+			ids = append(ids, x.sorted[i])
+			i++
+		} else {
+			ids = append(ids, x.pending[j])
+			j++
+		}
+	}
+
+	return ids
+}
+
+// reset очищает индекс.
+func (x *idIndex) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.sorted = nil
+	x.pending = nil
+}
+
+// shardedURLs - сегментированная мапа URL с индексами по оригинальному адресу, по пользователю
+// и отсортированным индексом идентификаторов.
+// Порядок блокировок: сегменты индекса по оригинальному адресу в порядке возрастания номеров,
+// затем сегменты идентификаторов в порядке возрастания номеров, затем сегмент URL,
+// затем сегмент индекса по пользователю. Мьютекс индекса идентификаторов берется последним.
+type shardedURLs struct {
+	urls  [shardCount]urlShard
+	long  [shardCount]longShard
+	users [shardCount]userShard
+	index idIndex
+
+	// Сохранение новых URL блокирует сегменты своих идентификаторов до конца сохранения,
+	// чтобы конкурентное сохранение того же идентификатора не перезаписало URL
+	idLocks [shardCount]sync.Mutex
+}
+
+// newShardedURLs создает сегментированную мапу, заполненную переданными URL.
+func newShardedURLs(m map[string]*model.URL) *shardedURLs {
+	s := &shardedURLs{}
+	s.reset()
+
+	for _, url := range m {
+		s.put(url)
+		if !url.Deleted {
+			s.long[stringShard(url.Long)].ids[url.Long] = url.ID
+		}
+	}
+
+	s.index.mu.Lock()
+	s.index.merge()
+	s.index.mu.Unlock()
+
+	return s
+}
+
+// reset удаляет все URL и очищает индексы.
+func (s *shardedURLs) reset() {
+	for i := range s.urls {
+		s.long[i].mu.Lock()
+		s.long[i].ids = make(map[string]string)
+		s.long[i].mu.Unlock()
+
+		s.urls[i].mu.Lock()
+		s.urls[i].urls = make(map[string]*model.URL)
+		s.urls[i].mu.Unlock()
+
+		s.users[i].mu.Lock()
+		s.users[i].ids = make(map[uuid.UUID]map[string]struct{})
+		s.users[i].mu.Unlock()
+	}
+
+	s.index.reset()
+}
+
+// get возвращает копию URL по идентификатору.
+func (s *shardedURLs) get(id string) (*model.URL, bool) {
+	shard := &s.urls[stringShard(id)]
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	url, ok := shard.urls[id]
+	if !ok {
+		return nil, false
+	}
+	u := *url
+	return &u, true
+}
+
+// exists проверяет наличие URL, включая удаленные, по идентификатору.
+func (s *shardedURLs) exists(id string) bool {
+	shard := &s.urls[stringShard(id)]
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	_, ok := shard.urls[id]
+	return ok
+}
+
+// put сохраняет URL, добавляет новый идентификатор в индекс идентификаторов,
+// а неудаленный URL - в индекс по пользователю.
+// Индекс по оригинальному адресу обновляется вызывающим под блокировкой его сегментов.
+func (s *shardedURLs) put(url *model.URL) {
+	shard := &s.urls[stringShard(url.ID)]
+	shard.mu.Lock()
+	_, existed := shard.urls[url.ID]
+	shard.urls[url.ID] = url
+	shard.mu.Unlock()
+
+	if !existed {
+		s.index.add(url.ID)
+	}
+
+	if url.Deleted {
+		return
+	}
+
+	users := &s.users[uuidShard(url.UID)]
+	users.mu.Lock()
+	ids, ok := users.ids[url.UID]
+	if !ok {
+		ids = make(map[string]struct{})
+		users.ids[url.UID] = ids
+	}
+	ids[url.ID] = struct{}{}
+	users.mu.Unlock()
+}
+
+// owned возвращает URL хранилища, если он принадлежит переданному пользователю.
+func (s *shardedURLs) owned(id string, uid uuid.UUID) (*model.URL, bool) {
+	shard := &s.urls[stringShard(id)]
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	url, ok := shard.urls[id]
+	if !ok || url.UID != uid {
+		return nil, false
+	}
+	return url, true
+}
+
+// markDeleted помечает URL удаленным и убирает его из индексов.
+// Удаленный оригинальный адрес можно сократить заново.
+func (s *shardedURLs) markDeleted(url *model.URL) {
+	long := &s.long[stringShard(url.Long)]
+	long.mu.Lock()
+	defer long.mu.Unlock()
+
+	shard := &s.urls[stringShard(url.ID)]
+	shard.mu.Lock()
+	url.Deleted = true
+	shard.mu.Unlock()
+
+	if long.ids[url.Long] == url.ID {
+		delete(long.ids, url.Long)
+	}
+
+	s.dropUserID(url.UID, url.ID)
+}
+
+// reown сохраняет неудаленный URL с новым владельцем и убирает его из индекса прежнего владельца.
+func (s *shardedURLs) reown(url *model.URL, from uuid.UUID) {
+	s.put(url)
+	s.dropUserID(from, url.ID)
+}
+
+// dropUserID убирает идентификатор URL из индекса по пользователю.
+func (s *shardedURLs) dropUserID(uid uuid.UUID, id string) {
+	users := &s.users[uuidShard(uid)]
+	users.mu.Lock()
+	defer users.mu.Unlock()
+
+	if ids, ok := users.ids[uid]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(users.ids, uid)
+		}
+	}
+}
+
+// lockLong блокирует сегменты индекса по оригинальному адресу, в которые попадают переданные URL,
+// и возвращает функцию снятия блокировок.
+func (s *shardedURLs) lockLong(urls []*model.URL) func() {
+	return lockShards(urls, func(url *model.URL) string { return url.Long }, func(i uint32) *sync.Mutex {
+		return &s.long[i].mu
+	})
+}
+
+// lockIDs блокирует сегменты идентификаторов, в которые попадают переданные URL,
+// и возвращает функцию снятия блокировок.
+func (s *shardedURLs) lockIDs(urls []*model.URL) func() {
+	return lockShards(urls, func(url *model.URL) string { return url.ID }, func(i uint32) *sync.Mutex {
+		return &s.idLocks[i]
+	})
+}
+
+// lockShards блокирует в порядке возрастания номеров мьютексы сегментов, в которые попадают ключи URL,
+// и возвращает функцию снятия блокировок.
+func lockShards(urls []*model.URL, key func(url *model.URL) string, mutex func(i uint32) *sync.Mutex) func() {
+	seen := make(map[uint32]struct{}, len(urls))
+	shards := make([]uint32, 0, len(urls))
+	for _, url := range urls {
+		i := stringShard(key(url))
+		if _, ok := seen[i]; !ok {
+			seen[i] = struct{}{}
+			shards = append(shards, i)
+		}
+	}
+	// Единый порядок блокировок исключает взаимные блокировки
+	sort.Slice(shards, func(i, j int) bool { return shards[i] < shards[j] })
+
+	for _, i := range shards {
+		mutex(i).Lock()
+	}
+
+	return func() {
+		for _, i := range shards {
+			mutex(i).Unlock()
+		}
+	}
+}
+
+// longID возвращает идентификатор неудаленного URL по оригинальному адресу.
+// Сегмент индекса должен быть заблокирован вызывающим.
+func (s *shardedURLs) longID(long string) (string, bool) {
+	id, ok := s.long[stringShard(long)].ids[long]
+	return id, ok
+}
+
+// setLongID добавляет URL в индекс по оригинальному адресу.
+// Сегмент индекса должен быть заблокирован вызывающим.
+func (s *shardedURLs) setLongID(long, id string) {
+	s.long[stringShard(long)].ids[long] = id
+}
+
+// userIDs возвращает идентификаторы неудаленных URL пользователя.
+func (s *shardedURLs) userIDs(uid uuid.UUID) []string {
+	users := &s.users[uuidShard(uid)]
+
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+
+	ids := make([]string, 0, len(users.ids[uid]))
+	for id := range users.ids[uid] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// userCount возвращает количество неудаленных URL пользователя.
+func (s *shardedURLs) userCount(uid uuid.UUID) int {
+	users := &s.users[uuidShard(uid)]
+
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+
+	return len(users.ids[uid])
+}
+
+// ids возвращает не более limit отсортированных идентификаторов URL, включая удаленные, больше переданного.
+func (s *shardedURLs) ids(afterID string, limit int) []string {
+	return s.index.page(afterID, limit)
+}
+
+// values возвращает копии всех URL, включая удаленные.
+func (s *shardedURLs) values() []*model.URL {
+	urls := make([]*model.URL, 0)
+	for i := range s.urls {
+		shard := &s.urls[i]
+		shard.mu.RLock()
+		for _, url := range shard.urls {
+			u := *url
+			urls = append(urls, &u)
+		}
+		shard.mu.RUnlock()
+	}
+
+	return urls
+}
+
+// stringShard возвращает номер сегмента для строкового ключа по хешу FNV-1a.
+func stringShard(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h & (shardCount - 1)
+}
+
+// uuidShard возвращает номер сегмента для идентификатора пользователя по хешу FNV-1a.
+func uuidShard(uid uuid.UUID) uint32 {
+	h := uint32(2166136261)
+	for _, b := range uid {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return h & (shardCount - 1)
+}
@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/database"
+	"github.com/RomanAgaltsev/urlcut/internal/database/queries"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища SQLite репозиторием.
+var _ interfaces.Repository = (*SQLiteRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*SQLiteRepository)(nil)
+	_ interfaces.Truncater     = (*SQLiteRepository)(nil)
+	_ interfaces.Replacer      = (*SQLiteRepository)(nil)
+	_ interfaces.QuotaStorer   = (*SQLiteRepository)(nil)
+	_ interfaces.LimitedStorer = (*SQLiteRepository)(nil)
+	_ interfaces.UserStorer    = (*SQLiteRepository)(nil)
+)
+
+// sqliteScheme - схема строки соединения с БД SQLite, за ней следует путь к файлу БД: sqlite:///var/lib/urlcut.db
+const sqliteScheme = "sqlite"
+
+func init() {
+	Register(sqliteScheme, Backend{
+		Open: func(ctx context.Context, dsn string, _ *config.Config) (interfaces.Repository, error) {
+			path := strings.TrimPrefix(dsn, sqliteScheme+"://")
+			if path == "" {
+				return nil, fmt.Errorf("no database file path in %q", dsn)
+			}
+
+			db, err := database.NewSQLiteConnection(ctx, path)
+			if err != nil {
+				return nil, err
+			}
+			return NewSQLiteRepository(db)
+		},
+		Health: pingHealth,
+		Shared: true,
+	})
+}
+
+// SQLiteRepository является SQLite хранилищем URL.
+// Запросы к БД те же, что и у DBRepository, семантика конфликтов данных совпадает.
+type SQLiteRepository struct {
+	db *sql.DB          // Соединение с БД
+	q  *queries.Queries // Подготовленные запросы
+}
+
+// NewSQLiteRepository создает новое SQLite хранилище URL.
+func NewSQLiteRepository(db *sql.DB) (*SQLiteRepository, error) {
+	// Сначала пробуем подготовить стейтменты запросов
+	q, err := queries.Prepare(context.Background(), db)
+	if err != nil {
+		q = queries.New(db)
+	}
+
+	return &SQLiteRepository{
+		db: db,
+		q:  q,
+	}, nil
+}
+
+// Store сохраняет слайс переданных URL в SQLite хранилище.
+// При конфликте данных транзакция откатывается и возвращается ранее сохраненный URL и ошибка конфликта.
+func (r *SQLiteRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	return r.store(ctx, urls, uuid.Nil, 0)
+}
+
+// StoreLimited сохраняет URL пользователя в SQLite хранилище, если количество его неудаленных URL не превысит limit.
+// Подсчет выполняется в той же транзакции, что и сохранение. BeginTx открывает немедленные транзакции,
+// поэтому конкурентные сохранения выполняются по очереди.
+func (r *SQLiteRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	return r.store(ctx, urls, uid, limit)
+}
+
+// store сохраняет URL в одной транзакции, предварительно проверяя квоту количества URL пользователя,
+// если limit положителен.
+func (r *SQLiteRepository) store(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	if err := checkDuplicateLong(urls); err != nil {
+		return nil, err
+	}
+
+	// Начинаем транзакцию
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Откладываем откат транзакции - если всё будет ок, эффекта не будет
+	defer func() { _ = tx.Rollback() }()
+
+	// Получаем подготовленные запросы с ранее открытой транзакцией
+	qtx := r.q.WithTx(tx)
+
+	if limit > 0 {
+		count, errc := qtx.CountUserURLs(ctx, uid)
+		if errc != nil {
+			return nil, errc
+		}
+		if errc = checkLinksQuota(int(count), urls, uid, limit); errc != nil {
+			return nil, errc
+		}
+	}
+
+	for _, url := range urls {
+		_, err = qtx.StoreURL(ctx, queries.StoreURLParams{
+			LongUrl:   url.Long,
+			BaseUrl:   url.Base,
+			UrlID:     url.ID,
+			Uid:       url.UID,
+			IsDeleted: url.Deleted,
+		})
+		if isSQLiteConstraintViolation(err) && url.Deleted {
+			// Удаленный URL не конфликтует с неудаленными - нарушено другое ограничение
+			return nil, fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+		}
+		if isSQLiteConstraintViolation(err) {
+			// Это конфликт. Откатываем транзакцию и получаем конфликтный URL
+			if err = tx.Rollback(); err != nil {
+				return nil, err
+			}
+
+			urlByLong, errgbl := r.q.GetURLByLong(ctx, url.Long)
+			if errors.Is(errgbl, sql.ErrNoRows) {
+				// Неудаленного URL с тем же адресом нет - нарушено другое ограничение
+				return nil, fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+			}
+			if errgbl != nil {
+				return nil, errgbl
+			}
+
+			return &model.URL{
+				Long: urlByLong.LongUrl,
+				Base: urlByLong.BaseUrl,
+				ID:   urlByLong.UrlID,
+				UID:  urlByLong.Uid}, ErrConflict
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, tx.Commit()
+}
+
+// Get возвращает из SQLite хранилища данные URL по переданному идентификатору.
+func (r *SQLiteRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	url, err := r.q.GetURL(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIDNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.URL{
+		Long:    url.LongUrl,
+		Base:    url.BaseUrl,
+		ID:      url.UrlID,
+		UID:     url.Uid,
+		Deleted: url.IsDeleted,
+	}, nil
+}
+
+// GetUserURLs возвращает из SQLite хранилища неудаленные URL пользователя по переданному идентификатору.
+func (r *SQLiteRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	urlsQuery, err := r.q.GetUserURLs(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Создаем слайс для возврата ссылок пользователя
+	urls := make([]*model.URL, 0, len(urlsQuery))
+
+	for _, url := range urlsQuery {
+		urls = append(urls, &model.URL{
+			Long: url.LongUrl,
+			Base: url.BaseUrl,
+			ID:   url.UrlID,
+			UID:  url.Uid,
+		})
+	}
+
+	return urls, nil
+}
+
+// ScanURLs возвращает из SQLite хранилища страницу URL, включая удаленные, после переданного идентификатора.
+func (r *SQLiteRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	urlsQuery, err := r.q.ScanURLs(ctx, queries.ScanURLsParams{
+		UrlID: afterID,
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return urlsFromQuery(urlsQuery), nil
+}
+
+// DeleteURLs помечает удаленными в SQLite хранилище переданные URL.
+func (r *SQLiteRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	// Начинаем транзакцию
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Откладываем откат транзакции - если всё будет ок, эффекта не будет
+	defer func() { _ = tx.Rollback() }()
+
+	// Получаем подготовленные запросы с ранее открытой транзакцией
+	qtx := r.q.WithTx(tx)
+
+	for _, url := range urls {
+		err = qtx.DeleteURL(ctx, queries.DeleteURLParams{
+			UrlID: url.ID,
+			Uid:   url.UID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ExportURLs выгружает все URL из SQLite хранилища в одной отложенной читающей транзакции.
+// В режиме WAL такая транзакция видит состояние БД на момент первого чтения и не блокирует запись.
+// Транзакция открывается вручную на отдельном соединении, потому что BeginTx открывает
+// немедленные транзакции, которые блокируют запись.
+func (r *SQLiteRepository) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err = conn.ExecContext(ctx, "BEGIN DEFERRED"); err != nil {
+		return err
+	}
+	// Транзакция только читает - откатываем её в любом случае
+	defer func() { _, _ = conn.ExecContext(context.Background(), "ROLLBACK") }()
+
+	return exportQueryURLs(ctx, queries.New(conn), fn)
+}
+
+// Truncate удаляет все URL из SQLite хранилища.
+func (r *SQLiteRepository) Truncate(ctx context.Context) error {
+	return r.q.DeleteAllURLs(ctx)
+}
+
+// ReplaceURLs заменяет все URL SQLite хранилища URL, переданными функцией load, в одной транзакции.
+func (r *SQLiteRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Откладываем откат транзакции - если всё будет ок, эффекта не будет
+	defer func() { _ = tx.Rollback() }()
+
+	// Ошибка отменяет только сам запрос, поэтому нарушенное ограничение определяем запросом в той же транзакции
+	qtx := r.q.WithTx(tx)
+	err = replaceQueryURLs(ctx, qtx, load, func(url *model.URL, err error) error {
+		if !isSQLiteConstraintViolation(err) {
+			return err
+		}
+		if !url.Deleted {
+			if _, errgbl := qtx.GetURLByLong(ctx, url.Long); errgbl == nil {
+				return fmt.Errorf("%w: %q", ErrDuplicateURL, url.Long)
+			}
+		}
+		return fmt.Errorf("%w: %q", ErrIntegrity, url.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetQuota возвращает переопределенные квоты пользователя из SQLite хранилища.
+func (r *SQLiteRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	return getQueryQuota(ctx, r.q, uid)
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя в SQLite хранилище.
+func (r *SQLiteRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	return r.q.UpsertUserQuota(ctx, queries.UpsertUserQuotaParams{
+		Uid:          uid,
+		MaxLinks:     int32(quota.MaxLinks),
+		MaxBatchSize: int32(quota.MaxBatchSize),
+		MaxUrlLength: int32(quota.MaxURLLength),
+	})
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя из SQLite хранилища.
+func (r *SQLiteRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	return r.q.DeleteUserQuota(ctx, uid)
+}
+
+// CreateUser сохраняет нового пользователя в SQLite хранилище и передает ему URL анонимного пользователя
+// в одной транзакции.
+func (r *SQLiteRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Откладываем откат транзакции - если всё будет ок, эффекта не будет
+	defer func() { _ = tx.Rollback() }()
+
+	err = createQueryUser(ctx, r.q.WithTx(tx), user, anonymous)
+	if isSQLiteConstraintViolation(err) {
+		return ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUser возвращает пользователя по идентификатору из SQLite хранилища.
+func (r *SQLiteRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return userFromQuery(r.q.GetUser(ctx, id))
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты из SQLite хранилища.
+func (r *SQLiteRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return userFromQuery(r.q.GetUserByEmail(ctx, email))
+}
+
+// Health проверяет соединение с БД.
+func (r *SQLiteRepository) Health(ctx context.Context) map[string]model.Health {
+	return map[string]model.Health{
+		"sqlite": model.NewHealth(r.Ping(ctx), false),
+	}
+}
+
+// Ping проверяет соединение с БД.
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close закрывает соединение с БД.
+func (r *SQLiteRepository) Close() error {
+	err := r.q.Close()
+	if err != nil {
+		return err
+	}
+	return r.db.Close()
+}
+
+// isSQLiteConstraintViolation проверяет, является ли ошибка нарушением ограничения целостности SQLite.
+func isSQLiteConstraintViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Младший байт расширенного кода ошибки содержит основной код
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_CONSTRAINT
+}
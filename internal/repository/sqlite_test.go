@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/database"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	const (
+		longURL = "https://app.pachca.com"
+		BaseURL = "http://localhost:8080"
+		urlID   = "1q2w3e4r"
+	)
+
+	uid, _ := uuid.NewRandom()
+	otherUID, _ := uuid.NewRandom()
+
+	url := &model.URL{
+		Long: longURL,
+		Base: BaseURL,
+		ID:   urlID,
+		UID:  uid,
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "urlcut.db")
+
+	db, err := database.NewSQLiteConnection(context.TODO(), dbPath)
+	require.NoError(t, err)
+
+	var journalMode string
+	err = db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", journalMode)
+
+	sqliteRepository, err := NewSQLiteRepository(db)
+	require.NoError(t, err)
+
+	urlStore, err := sqliteRepository.Store(context.TODO(), []*model.URL{url})
+	require.NoError(t, err)
+	assert.Nil(t, urlStore)
+
+	// Повторное сохранение того же оригинального URL - конфликт, весь батч откатывается
+	urlConflict, err := sqliteRepository.Store(context.TODO(), []*model.URL{
+		{Long: "https://practicum.yandex.ru", Base: BaseURL, ID: "9o8i7u6y", UID: otherUID},
+		{Long: longURL, Base: BaseURL, ID: "5t6y7u8i", UID: otherUID},
+	})
+	assert.ErrorIs(t, err, ErrConflict)
+	require.NotNil(t, urlConflict)
+	assert.Equal(t, url, urlConflict)
+
+	_, err = sqliteRepository.Get(context.TODO(), "9o8i7u6y")
+	assert.ErrorIs(t, err, ErrIDNotFound)
+
+	// Совпадение идентификатора при новом оригинальном URL - не конфликт, а нарушение ограничения
+	_, err = sqliteRepository.Store(context.TODO(), []*model.URL{
+		{Long: "https://practicum.yandex.ru", Base: BaseURL, ID: urlID, UID: otherUID},
+	})
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.NotErrorIs(t, err, ErrConflict)
+
+	urlGet, err := sqliteRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.Equal(t, url, urlGet)
+
+	userURLs, err := sqliteRepository.GetUserURLs(context.TODO(), uid)
+	require.NoError(t, err)
+	assert.Equal(t, []*model.URL{url}, userURLs)
+
+	// Чужой пользователь не может удалить URL
+	err = sqliteRepository.DeleteURLs(context.TODO(), []*model.URL{{ID: urlID, UID: otherUID}})
+	require.NoError(t, err)
+
+	urlGet, err = sqliteRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.False(t, urlGet.Deleted)
+
+	err = sqliteRepository.DeleteURLs(context.TODO(), []*model.URL{{ID: urlID, UID: uid}})
+	require.NoError(t, err)
+
+	urlGet, err = sqliteRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	userURLs, err = sqliteRepository.GetUserURLs(context.TODO(), uid)
+	require.NoError(t, err)
+	assert.Empty(t, userURLs)
+
+	err = sqliteRepository.Close()
+	require.NoError(t, err)
+
+	// Данные переживают переоткрытие БД, миграции повторно не мешают
+	db, err = database.NewSQLiteConnection(context.TODO(), dbPath)
+	require.NoError(t, err)
+
+	sqliteRepository, err = NewSQLiteRepository(db)
+	require.NoError(t, err)
+
+	urlGet, err = sqliteRepository.Get(context.TODO(), urlID)
+	require.NoError(t, err)
+	assert.True(t, urlGet.Deleted)
+
+	err = sqliteRepository.Close()
+	require.NoError(t, err)
+}
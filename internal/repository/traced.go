@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/tracing"
+)
+
+// Неиспользуемая переменная для проверки реализации интерфейса хранилища репозиторием с трассировкой.
+var _ interfaces.Repository = (*TracedRepository)(nil)
+
+// Неиспользуемые переменные для проверки реализации необязательных интерфейсов хранилища.
+var (
+	_ interfaces.Exporter      = (*TracedRepository)(nil)
+	_ interfaces.Truncater     = (*TracedRepository)(nil)
+	_ interfaces.Replacer      = (*TracedRepository)(nil)
+	_ interfaces.QuotaStorer   = (*TracedRepository)(nil)
+	_ interfaces.LimitedStorer = (*TracedRepository)(nil)
+	_ interfaces.UserStorer    = (*TracedRepository)(nil)
+)
+
+// TracedRepository создает спан на каждую операцию переданного хранилища.
+// Повторные попытки операций БД хранилища записываются в спан событиями "retry".
+type TracedRepository struct {
+	repo    interfaces.Repository // Основное хранилище
+	backend string                // Тип хранилища - атрибут спанов
+}
+
+// NewTracedRepository создает репозиторий, трассирующий операции переданного хранилища.
+func NewTracedRepository(repo interfaces.Repository, backend string) *TracedRepository {
+	return &TracedRepository{
+		repo:    repo,
+		backend: backend,
+	}
+}
+
+// Store сохраняет URL в основном хранилище.
+func (r *TracedRepository) Store(ctx context.Context, urls []*model.URL) (*model.URL, error) {
+	ctx, span := r.start(ctx, "Store", attribute.Int("urlcut.urls", len(urls)))
+	url, err := r.repo.Store(ctx, urls)
+	r.end(span, err)
+	return url, err
+}
+
+// Get возвращает данные URL из основного хранилища.
+func (r *TracedRepository) Get(ctx context.Context, id string) (*model.URL, error) {
+	ctx, span := r.start(ctx, "Get", attribute.String("urlcut.url_id", id))
+	url, err := r.repo.Get(ctx, id)
+	r.end(span, err)
+	return url, err
+}
+
+// GetUserURLs возвращает URL пользователя из основного хранилища.
+func (r *TracedRepository) GetUserURLs(ctx context.Context, uid uuid.UUID) ([]*model.URL, error) {
+	ctx, span := r.start(ctx, "GetUserURLs", attribute.String("urlcut.uid", uid.String()))
+	urls, err := r.repo.GetUserURLs(ctx, uid)
+	r.end(span, err)
+	return urls, err
+}
+
+// ScanURLs возвращает страницу URL из основного хранилища.
+func (r *TracedRepository) ScanURLs(ctx context.Context, afterID string, limit int) ([]*model.URL, error) {
+	ctx, span := r.start(ctx, "ScanURLs", attribute.Int("urlcut.limit", limit))
+	urls, err := r.repo.ScanURLs(ctx, afterID, limit)
+	r.end(span, err)
+	return urls, err
+}
+
+// DeleteURLs помечает URL удаленными в основном хранилище.
+func (r *TracedRepository) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	ctx, span := r.start(ctx, "DeleteURLs", attribute.Int("urlcut.urls", len(urls)))
+	err := r.repo.DeleteURLs(ctx, urls)
+	r.end(span, err)
+	return err
+}
+
+// ExportURLs выгружает все URL из основного хранилища.
+func (r *TracedRepository) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	ctx, span := r.start(ctx, "ExportURLs")
+	err := ExportURLs(ctx, r.repo, fn)
+	r.end(span, err)
+	return err
+}
+
+// Truncate удаляет все URL из основного хранилища.
+func (r *TracedRepository) Truncate(ctx context.Context) error {
+	ctx, span := r.start(ctx, "Truncate")
+	err := Truncate(ctx, r.repo)
+	r.end(span, err)
+	return err
+}
+
+// ReplaceURLs заменяет все URL основного хранилища.
+func (r *TracedRepository) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	ctx, span := r.start(ctx, "ReplaceURLs")
+	err := ReplaceURLs(ctx, r.repo, load)
+	r.end(span, err)
+	return err
+}
+
+// GetQuota возвращает переопределенные квоты пользователя из основного хранилища.
+func (r *TracedRepository) GetQuota(ctx context.Context, uid uuid.UUID) (*model.Quota, error) {
+	ctx, span := r.start(ctx, "GetQuota")
+	quota, err := GetQuota(ctx, r.repo, uid)
+	r.end(span, err)
+	return quota, err
+}
+
+// SetQuota сохраняет переопределенные квоты пользователя в основное хранилище.
+func (r *TracedRepository) SetQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	ctx, span := r.start(ctx, "SetQuota")
+	err := SetQuota(ctx, r.repo, uid, quota)
+	r.end(span, err)
+	return err
+}
+
+// DeleteQuota удаляет переопределенные квоты пользователя из основного хранилища.
+func (r *TracedRepository) DeleteQuota(ctx context.Context, uid uuid.UUID) error {
+	ctx, span := r.start(ctx, "DeleteQuota")
+	err := DeleteQuota(ctx, r.repo, uid)
+	r.end(span, err)
+	return err
+}
+
+// StoreLimited сохраняет URL пользователя в основном хранилище с проверкой квоты количества URL.
+func (r *TracedRepository) StoreLimited(ctx context.Context, urls []*model.URL, uid uuid.UUID, limit int) (*model.URL, error) {
+	ctx, span := r.start(ctx, "StoreLimited", attribute.Int("urlcut.urls", len(urls)), attribute.Int("urlcut.limit", limit))
+	url, err := StoreLimited(ctx, r.repo, urls, uid, limit)
+	r.end(span, err)
+	return url, err
+}
+
+// CreateUser сохраняет нового пользователя в основное хранилище и передает ему URL анонимного пользователя.
+func (r *TracedRepository) CreateUser(ctx context.Context, user *model.User, anonymous uuid.UUID) error {
+	ctx, span := r.start(ctx, "CreateUser")
+	err := CreateUser(ctx, r.repo, user, anonymous)
+	r.end(span, err)
+	return err
+}
+
+// GetUser возвращает пользователя по идентификатору из основного хранилища.
+func (r *TracedRepository) GetUser(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	ctx, span := r.start(ctx, "GetUser")
+	user, err := GetUser(ctx, r.repo, id)
+	r.end(span, err)
+	return user, err
+}
+
+// GetUserByEmail возвращает пользователя по адресу почты из основного хранилища.
+func (r *TracedRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := r.start(ctx, "GetUserByEmail")
+	user, err := GetUserByEmail(ctx, r.repo, email)
+	r.end(span, err)
+	return user, err
+}
+
+// Health возвращает состояние основного хранилища.
+func (r *TracedRepository) Health(ctx context.Context) map[string]model.Health {
+	return r.repo.Health(ctx)
+}
+
+// Close закрывает основное хранилище.
+func (r *TracedRepository) Close() error {
+	return r.repo.Close()
+}
+
+// start начинает спан операции хранилища.
+func (r *TracedRepository) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "repository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, attribute.String("urlcut.backend", r.backend))...),
+	)
+}
+
+// end завершает спан операции хранилища. Отсутствие URL и конфликт данных - штатные ответы хранилища,
+// они записываются атрибутом, а не ошибкой спана.
+func (r *TracedRepository) end(span trace.Span, err error) {
+	switch {
+	case errors.Is(err, ErrIDNotFound):
+		span.SetAttributes(attribute.Bool("urlcut.not_found", true))
+		err = nil
+	case errors.Is(err, ErrConflict):
+		span.SetAttributes(attribute.Bool("urlcut.conflict", true))
+		err = nil
+	case errors.Is(err, ErrQuotaNotFound), errors.Is(err, ErrUserNotFound):
+		span.SetAttributes(attribute.Bool("urlcut.not_found", true))
+		err = nil
+	case errors.Is(err, ErrUserExists):
+		span.SetAttributes(attribute.Bool("urlcut.conflict", true))
+		err = nil
+	case errors.Is(err, model.ErrQuotaExceeded):
+		span.SetAttributes(attribute.Bool("urlcut.quota_exceeded", true))
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+// retryNotify возвращает функцию, которая записывает каждую неудачную попытку retry операции
+// событием в спан из контекста.
+func retryNotify(ctx context.Context) backoff.Notify {
+	span := trace.SpanFromContext(ctx)
+	attempt := 0
+
+	return func(err error, wait time.Duration) {
+		attempt++
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt),
+			attribute.String("retry.error", err.Error()),
+			attribute.String("retry.wait", wait.String()),
+		))
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedRepository(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	uid := uuid.New()
+	rows := sqlmock.NewRows([]string{"id", "long_url", "base_url", "url_id", "created_at", "uid", "is_deleted"}).
+		AddRow(1, "https://example.com", "http://localhost:8080", "qwerty12", time.Now(), uid, false)
+
+	// Первая попытка завершается временной ошибкой, вторая - успешно
+	mock.ExpectQuery("(.*)SELECT(.*)").WithArgs("qwerty12").WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery("(.*)SELECT(.*)").WithArgs("qwerty12").WillReturnRows(rows)
+	// Отсутствие URL - не ошибка спана
+	mock.ExpectQuery("(.*)SELECT(.*)").WithArgs("missing").WillReturnError(sql.ErrNoRows)
+
+	dbRepository, err := NewDBRepository(db)
+	require.NoError(t, err)
+
+	repo := NewTracedRepository(dbRepository, postgresScheme)
+
+	url, err := repo.Get(context.Background(), "qwerty12")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", url.Long)
+
+	_, err = repo.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrIDNotFound)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	// Повторная попытка записана событием спана операции
+	assert.Equal(t, "repository.Get", spans[0].Name())
+	require.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, "retry", spans[0].Events()[0].Name)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Empty(t, spans[1].Events())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
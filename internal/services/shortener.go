@@ -6,15 +6,21 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/RomanAgaltsev/urlcut/internal/config"
 	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/metrics"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/pkg/password"
 	"github.com/RomanAgaltsev/urlcut/internal/pkg/random"
 	"github.com/RomanAgaltsev/urlcut/internal/repository"
+	"github.com/RomanAgaltsev/urlcut/internal/tracing"
 )
 
 // Неиспользуемая переменная для проверки соответствия сокращателя интерфейсу сервиса
@@ -27,21 +33,48 @@ var ErrInitServiceFailed = fmt.Errorf("failed to init service")
 type Shortener struct {
 	repository interfaces.Repository // Репозиторий (интерфейс) для хранения URL
 	cfg        *config.Config        // Конфигурация приложения
+	hasher     *password.Hasher      // Хэширование паролей зарегистрированных пользователей
+
+	// Хэш пароля, с которым сравнивается пароль при входе неизвестного пользователя,
+	// чтобы по времени ответа нельзя было узнать, зарегистрирован ли адрес почты
+	dummyHashOnce sync.Once
+	dummyHash     string
 
 	urlDelChan chan *model.URL // Канал для сбора URL к отложенному удалению
+	urlDelDone chan struct{}   // Закрывается, когда горутина удаления сохранила последние URL и завершилась
 }
 
+// Параметры отложенного удаления URL.
+const (
+	// deleteFlushInterval - интервал, с которым накопленные URL помечаются удаленными.
+	deleteFlushInterval = 10 * time.Second
+
+	// deleteMaxAttempts - количество попыток пометить удаленными накопленные URL, после которых они отбрасываются.
+	deleteMaxAttempts = 3
+)
+
 // NewShortener создает новый сокращатель ссылок.
-func NewShortener(repository interfaces.Repository, cfg *config.Config) (*Shortener, error) {
+func NewShortener(repo interfaces.Repository, cfg *config.Config) (*Shortener, error) {
 	// Считаем, что без базового адреса и без идентификатора сокращенной ссылки быть не может
 	if cfg.BaseURL == "" || cfg.IDlength == 0 {
 		return nil, ErrInitServiceFailed
 	}
 
+	hasher, err := password.NewHasher(cfg.PasswordHashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInitServiceFailed, err)
+	}
+
 	shortener := &Shortener{
-		repository: repository,
+		// Метрики и спаны операций собираются со всего хранилища, включая кэш и фильтр
+		repository: repository.NewTracedRepository(
+			repository.NewInstrumentedRepository(repo, repository.BackendName(cfg)),
+			repository.BackendName(cfg),
+		),
 		cfg:        cfg,
+		hasher:     hasher,
 		urlDelChan: make(chan *model.URL, 1024),
+		urlDelDone: make(chan struct{}),
 	}
 
 	// Запускаем горутину фоновой пометки на удаление URL
@@ -52,6 +85,19 @@ func NewShortener(repository interfaces.Repository, cfg *config.Config) (*Shorte
 
 // Shorten сокращает переданную ссылку.
 func (s *Shortener) Shorten(ctx context.Context, longURL string, uid uuid.UUID) (*model.URL, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.Shorten")
+	defer span.End()
+
+	// Проверяем квоты пользователя
+	quota, err := s.quota(ctx, uid)
+	if err != nil {
+		tracing.SetError(span, err)
+		return &model.URL{}, err
+	}
+	if err = model.CheckQuota(model.QuotaURLLength, quota.MaxURLLength, len(longURL)); err != nil {
+		return &model.URL{}, err
+	}
+
 	// Создаем структуру URL
 	url := &model.URL{
 		Long: longURL,
@@ -60,44 +106,84 @@ func (s *Shortener) Shorten(ctx context.Context, longURL string, uid uuid.UUID)
 		UID:  uid,
 	}
 
-	// Сохраняем структуру URL в репозитории
-	duplicatedURL, err := s.repository.Store(ctx, []*model.URL{url})
+	// Сохраняем структуру URL в репозитории, хранилище атомарно проверяет квоту количества URL
+	duplicatedURL, err := repository.StoreLimited(ctx, s.repository, []*model.URL{url}, uid, quota.MaxLinks)
 	if errors.Is(err, repository.ErrConflict) {
+		metrics.Conflicts.Inc()
 		return duplicatedURL, err
 	}
+	if errors.Is(err, model.ErrQuotaExceeded) {
+		return &model.URL{}, err
+	}
 	if err != nil {
+		tracing.SetError(span, err)
 		return &model.URL{}, err
 	}
 
+	metrics.URLsCreated.Inc()
+
 	return url, nil
 }
 
 // ShortenBatch сокращает переданный батч ссылок.
 func (s *Shortener) ShortenBatch(ctx context.Context, batch []model.IncomingBatchDTO, uid uuid.UUID) ([]model.OutgoingBatchDTO, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.ShortenBatch", trace.WithAttributes(attribute.Int("urlcut.urls", len(batch))))
+	defer span.End()
+
 	// Создаем слайс для хранения сокращенных ссылок батча
 	batchShortened := make([]model.OutgoingBatchDTO, 0, len(batch))
-	// Создаем слайс URL
+
+	// Проверяем квоты пользователя
+	quota, err := s.quota(ctx, uid)
+	if err != nil {
+		tracing.SetError(span, err)
+		return batchShortened, err
+	}
+	if err = model.CheckQuota(model.QuotaBatchSize, quota.MaxBatchSize, len(batch)); err != nil {
+		return batchShortened, err
+	}
+	for _, batchReq := range batch {
+		if err = model.CheckQuota(model.QuotaURLLength, quota.MaxURLLength, len(batchReq.OriginalURL)); err != nil {
+			return batchShortened, err
+		}
+	}
+
+	// Создаем слайс URL и слайс сокращенных URL по порядку батча
 	urls := make([]*model.URL, 0, len(batch))
+	shortened := make([]*model.URL, 0, len(batch))
+	// Повторы оригинального URL в батче получают одну сокращенную ссылку
+	byLong := make(map[string]*model.URL, len(batch))
 
 	// Обходим батч, создаем сокращенные ссылки и сохраняем в слайс URL
 	for _, batchReq := range batch {
-		urls = append(urls, &model.URL{
-			Long:   batchReq.OriginalURL,
-			Base:   s.cfg.BaseURL,
-			ID:     random.String(s.cfg.IDlength),
-			CorrID: batchReq.CorrelationID,
-			UID:    uid,
-		})
+		url, ok := byLong[batchReq.OriginalURL]
+		if !ok {
+			url = &model.URL{
+				Long:   batchReq.OriginalURL,
+				Base:   s.cfg.BaseURL,
+				ID:     random.String(s.cfg.IDlength),
+				CorrID: batchReq.CorrelationID,
+				UID:    uid,
+			}
+			byLong[url.Long] = url
+			urls = append(urls, url)
+		}
+		shortened = append(shortened, url)
 	}
 
-	// Сохраняем слайс URL в БД
-	duplicatedURL, err := s.repository.Store(ctx, urls)
+	// Сохраняем слайс URL в БД, хранилище атомарно проверяет квоту количества URL
+	duplicatedURL, err := repository.StoreLimited(ctx, s.repository, urls, uid, quota.MaxLinks)
+	if errors.Is(err, model.ErrQuotaExceeded) {
+		return batchShortened, err
+	}
 	if err != nil && !errors.Is(err, repository.ErrConflict) {
+		tracing.SetError(span, err)
 		return batchShortened, err
 	}
 
 	// Если был конфликт, вернем дубль
 	if errors.Is(err, repository.ErrConflict) {
+		metrics.Conflicts.Inc()
 		batchShortened = append(batchShortened, model.OutgoingBatchDTO{
 			CorrelationID: duplicatedURL.CorrID,
 			ShortURL:      duplicatedURL.Short(),
@@ -106,11 +192,13 @@ func (s *Shortener) ShortenBatch(ctx context.Context, batch []model.IncomingBatc
 		return batchShortened, nil
 	}
 
+	metrics.URLsCreated.Add(float64(len(urls)))
+
 	// Перекладываем сокращенные ссылки в слайс батча для возврата
-	for _, url := range urls {
+	for i, batchReq := range batch {
 		batchShortened = append(batchShortened, model.OutgoingBatchDTO{
-			CorrelationID: url.CorrID,
-			ShortURL:      url.Short(),
+			CorrelationID: batchReq.CorrelationID,
+			ShortURL:      shortened[i].Short(),
 		})
 	}
 
@@ -119,18 +207,31 @@ func (s *Shortener) ShortenBatch(ctx context.Context, batch []model.IncomingBatc
 
 // Expand возвращает оригинальную ссылку по переданному идентификатору.
 func (s *Shortener) Expand(ctx context.Context, id string) (*model.URL, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.Expand")
+	defer span.End()
+
 	url, err := s.repository.Get(ctx, id)
 	if err != nil {
+		// Отсутствие URL - штатный ответ, ошибкой спана не считается
+		if !errors.Is(err, repository.ErrIDNotFound) {
+			tracing.SetError(span, err)
+		}
 		return &model.URL{}, fmt.Errorf("expanding URL failed: %w", err)
 	}
 
+	metrics.URLsExpanded.Inc()
+
 	return url, nil
 }
 
 // UserURLs возвращает слайс URL пользователя с переданным uid пользователя.
 func (s *Shortener) UserURLs(ctx context.Context, uid uuid.UUID) ([]model.UserURLDTO, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.UserURLs")
+	defer span.End()
+
 	urls, err := s.repository.GetUserURLs(ctx, uid)
 	if err != nil {
+		tracing.SetError(span, err)
 		return nil, err
 	}
 
@@ -149,30 +250,192 @@ func (s *Shortener) UserURLs(ctx context.Context, uid uuid.UUID) ([]model.UserUR
 }
 
 // DeleteUserURLs устанавливает пометку на удаление у всех URL с переданным uid пользователя и идентификаторами URL.
+// Пометка удаления выполняется позже в фоне, поэтому спан покрывает только постановку URL в очередь.
 func (s *Shortener) DeleteUserURLs(ctx context.Context, uid uuid.UUID, shortURLs *model.ShortURLsDTO) error {
+	_, span := tracing.Start(ctx, "Shortener.DeleteUserURLs", trace.WithAttributes(attribute.Int("urlcut.urls", len(shortURLs.IDs))))
+	defer span.End()
+
 	// Перекладываем идентификаторы и uid в слайс URL
 	for _, id := range shortURLs.IDs {
 		s.urlDelChan <- &model.URL{
 			ID:  id,
 			UID: uid,
 		}
+		metrics.DeleteQueueDepth.Inc()
 	}
 
 	return nil
 }
 
+// UserQuota возвращает переопределенные и действующие квоты пользователя.
+func (s *Shortener) UserQuota(ctx context.Context, uid uuid.UUID) (*model.UserQuotaDTO, error) {
+	override, err := repository.GetQuota(ctx, s.repository, uid)
+	if errors.Is(err, repository.ErrQuotaNotFound) {
+		return &model.UserQuotaDTO{Effective: s.globalQuota()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.UserQuotaDTO{
+		Override:  override,
+		Effective: s.globalQuota().Override(*override),
+	}, nil
+}
+
+// SetUserQuota переопределяет квоты пользователя.
+func (s *Shortener) SetUserQuota(ctx context.Context, uid uuid.UUID, quota model.Quota) error {
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+	return repository.SetQuota(ctx, s.repository, uid, quota)
+}
+
+// DeleteUserQuota удаляет переопределение квот пользователя.
+func (s *Shortener) DeleteUserQuota(ctx context.Context, uid uuid.UUID) error {
+	return repository.DeleteQuota(ctx, s.repository, uid)
+}
+
+// Register регистрирует пользователя с новым идентификатором и передает ему URL, сокращенные
+// с переданным анонимным идентификатором. Анонимный токен после этого не дает доступа к URL пользователя,
+// а URL уже зарегистрированного пользователя не передаются другому.
+func (s *Shortener) Register(ctx context.Context, email, pass string, uid uuid.UUID) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.Register")
+	defer span.End()
+
+	email, err := model.NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err = model.ValidatePassword(pass); err != nil {
+		return nil, err
+	}
+
+	hash, err := s.hasher.Hash(pass)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	user := &model.User{
+		ID:           uuid.New(),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err = repository.CreateUser(ctx, s.repository, user, uid); err != nil {
+		if !errors.Is(err, repository.ErrUserExists) {
+			tracing.SetError(span, err)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Login возвращает зарегистрированного пользователя по адресу почты и паролю.
+// Неизвестный адрес и неверный пароль неразличимы для клиента - возвращается model.ErrInvalidCredentials.
+func (s *Shortener) Login(ctx context.Context, email, pass string) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "Shortener.Login")
+	defer span.End()
+
+	email, err := model.NormalizeEmail(email)
+	if err != nil {
+		return nil, model.ErrInvalidCredentials
+	}
+
+	user, err := repository.GetUserByEmail(ctx, s.repository, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		// Тратим на неизвестного пользователя столько же времени, сколько на проверку пароля
+		_, _ = password.Verify(s.getDummyHash(), pass)
+		return nil, model.ErrInvalidCredentials
+	}
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+
+	ok, err := password.Verify(user.PasswordHash, pass)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, model.ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// Health возвращает состояние хранилища сокращателя и его зависимостей.
+func (s *Shortener) Health(ctx context.Context) map[string]model.Health {
+	return s.repository.Health(ctx)
+}
+
+// globalQuota возвращает квоты из конфигурации, действующие для всех пользователей.
+func (s *Shortener) globalQuota() model.Quota {
+	return model.Quota{
+		MaxLinks:     s.cfg.QuotaMaxLinks,
+		MaxBatchSize: s.cfg.QuotaMaxBatchSize,
+		MaxURLLength: s.cfg.QuotaMaxURLLength,
+	}
+}
+
+// quota возвращает действующие квоты пользователя - глобальные квоты с учетом переопределения.
+// Если хранилище не умеет хранить квоты или они не переопределены, действуют глобальные квоты.
+func (s *Shortener) quota(ctx context.Context, uid uuid.UUID) (model.Quota, error) {
+	override, err := repository.GetQuota(ctx, s.repository, uid)
+	switch {
+	case err == nil:
+		return s.globalQuota().Override(*override), nil
+	case errors.Is(err, repository.ErrQuotaNotFound), errors.Is(err, repository.ErrQuotaUnsupported):
+		return s.globalQuota(), nil
+	default:
+		return model.Quota{}, err
+	}
+}
+
+// getDummyHash возвращает хэш случайного пароля, вычисленный при первом обращении.
+func (s *Shortener) getDummyHash() string {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.hasher.Hash(uuid.New().String())
+		if err != nil {
+			slog.Error("failed to hash dummy password", slog.String("error", err.Error()))
+		}
+		s.dummyHash = hash
+	})
+	return s.dummyHash
+}
+
 // deleteURLs устанавливаем пометку на удаление URL с определенным интервалом.
+// После закрытия канала накопленные URL сохраняются, и горутина завершается.
 func (s *Shortener) deleteURLs() {
-	// Сохраняем URL, накопленные за последние 10 секунд
-	ticker := time.NewTicker(10 * time.Second)
+	defer close(s.urlDelDone)
+
+	// Сохраняем URL, накопленные за последний интервал
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
 
 	// Накапливаем URL к удалению в слайсе
 	var urls []*model.URL
+	// Количество неудачных попыток сохранить накопленные URL
+	attempts := 0
 
 	for {
 		select {
 		// Пробуем получить URL из канала
-		case url := <-s.urlDelChan:
+		case url, ok := <-s.urlDelChan:
+			if !ok {
+				// Сервис закрывается - сохраняем то, что успели накопить
+				for attempts < deleteMaxAttempts && len(urls) > 0 {
+					urls, attempts = s.flushDeleted(urls, attempts)
+				}
+				s.dropDeleted(urls)
+				return
+			}
+			if url == nil {
+				continue
+			}
 			// Полученный URL добавляем в слайс
 			urls = append(urls, url)
 		case <-ticker.C:
@@ -180,22 +443,53 @@ func (s *Shortener) deleteURLs() {
 			if len(urls) == 0 {
 				continue
 			}
-			// Устанавливаем пометку на удаление для полученных URL
-			err := s.repository.DeleteURLs(context.TODO(), urls)
-			if err != nil {
-				slog.Info("failed to delete URLs", "error", err.Error())
-				continue
+			urls, attempts = s.flushDeleted(urls, attempts)
+			if attempts >= deleteMaxAttempts {
+				s.dropDeleted(urls)
+				urls, attempts = nil, 0
 			}
-			// Обнуляем слайс URL
-			urls = nil
 		}
 	}
 }
 
+// flushDeleted помечает удаленными накопленные URL. При ошибке URL остаются накопленными,
+// а количество неудачных попыток увеличивается.
+func (s *Shortener) flushDeleted(urls []*model.URL, attempts int) ([]*model.URL, int) {
+	start := time.Now()
+	err := s.repository.DeleteURLs(context.TODO(), urls)
+	metrics.DeleteFlushDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		slog.Info("failed to delete URLs", "error", err.Error(), "attempt", attempts+1)
+		return urls, attempts + 1
+	}
+
+	metrics.URLsDeleted.Add(float64(len(urls)))
+	metrics.DeleteQueueDepth.Sub(float64(len(urls)))
+
+	return nil, 0
+}
+
+// dropDeleted отбрасывает URL, которые не удалось пометить удаленными за все попытки.
+func (s *Shortener) dropDeleted(urls []*model.URL) {
+	if len(urls) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(urls))
+	for _, url := range urls {
+		ids = append(ids, url.ID)
+	}
+	slog.Error("dropped URLs that failed to be deleted", "count", len(urls), "ids", ids)
+
+	metrics.URLsDeleteDropped.Add(float64(len(urls)))
+	metrics.DeleteQueueDepth.Sub(float64(len(urls)))
+}
+
 // Close закрывает репозиторий ссылок сокращателя.
 func (s *Shortener) Close() error {
-	// Закрываем канал сбора URL к удалению
+	// Закрываем канал сбора URL к удалению и ждем, пока накопленные URL будут помечены удаленными
 	close(s.urlDelChan)
+	<-s.urlDelDone
 	// Закрываем соединения
 	return s.repository.Close()
 }
@@ -2,17 +2,26 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
 	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
 	"github.com/RomanAgaltsev/urlcut/internal/mocks"
 	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
 )
 
 func TestShortener(t *testing.T) {
@@ -49,7 +58,7 @@ func TestShortener(t *testing.T) {
 	require.NoError(t, err)
 
 	mockRepo.EXPECT().
-		Store(context.TODO(), gomock.Any()).
+		Store(gomock.Any(), gomock.Any()).
 		Return(nil, nil).
 		Times(1)
 
@@ -62,7 +71,7 @@ func TestShortener(t *testing.T) {
 
 	mockRepo.
 		EXPECT().
-		Get(context.TODO(), urlS.ID).
+		Get(gomock.Any(), urlS.ID).
 		Return(&model.URL{
 			Long: urlS.Long,
 			Base: urlS.Base,
@@ -82,7 +91,7 @@ func TestShortener(t *testing.T) {
 		Times(1)
 
 	mockRepo.EXPECT().
-		Store(context.TODO(), gomock.Any()).
+		Store(gomock.Any(), gomock.Any()).
 		Return(nil, nil).
 		Times(1)
 
@@ -95,7 +104,7 @@ func TestShortener(t *testing.T) {
 	assert.Equal(t, len(inBatch), len(outBatch))
 
 	mockRepo.EXPECT().
-		GetUserURLs(context.TODO(), gomock.Any()).
+		GetUserURLs(gomock.Any(), gomock.Any()).
 		Return(nil, nil).
 		Times(1)
 
@@ -103,7 +112,7 @@ func TestShortener(t *testing.T) {
 	require.NoError(t, err)
 
 	mockRepo.EXPECT().
-		DeleteURLs(context.TODO(), gomock.Any()).
+		DeleteURLs(gomock.Any(), gomock.Any()).
 		Return(nil).
 		Times(1)
 
@@ -117,3 +126,293 @@ func TestShortener(t *testing.T) {
 	err = shortener.Close()
 	require.NoError(t, err)
 }
+
+func TestShortenerQuotas(t *testing.T) {
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+
+	shortener, err := NewShortener(repo, &config.Config{
+		BaseURL:           "http://localhost:8080",
+		IDlength:          8,
+		QuotaMaxLinks:     2,
+		QuotaMaxBatchSize: 3,
+		QuotaMaxURLLength: 30,
+	})
+	require.NoError(t, err)
+	defer func() { _ = shortener.Close() }()
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	var quotaErr *model.QuotaError
+
+	// Длина URL
+	_, err = shortener.Shorten(ctx, "https://example.com/"+strings.Repeat("a", 20), uid)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, model.QuotaError{Quota: model.QuotaURLLength, Limit: 30, Actual: 40}, *quotaErr)
+
+	// Размер батча
+	batch := []model.IncomingBatchDTO{
+		{CorrelationID: "1", OriginalURL: "https://example.com/1"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/2"},
+		{CorrelationID: "3", OriginalURL: "https://example.com/3"},
+		{CorrelationID: "4", OriginalURL: "https://example.com/4"},
+	}
+	_, err = shortener.ShortenBatch(ctx, batch, uid)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, model.QuotaBatchSize, quotaErr.Quota)
+
+	// Количество URL пользователя
+	_, err = shortener.ShortenBatch(ctx, batch[:3], uid)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, model.QuotaError{Quota: model.QuotaLinks, Limit: 2, Actual: 3}, *quotaErr)
+
+	_, err = shortener.ShortenBatch(ctx, batch[:2], uid)
+	require.NoError(t, err)
+
+	_, err = shortener.Shorten(ctx, batch[2].OriginalURL, uid)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, model.QuotaLinks, quotaErr.Quota)
+
+	// Квоты других пользователей не затрагиваются
+	_, err = shortener.Shorten(ctx, batch[2].OriginalURL, uuid.New())
+	require.NoError(t, err)
+
+	// Переопределение квот пользователя
+	require.NoError(t, shortener.SetUserQuota(ctx, uid, model.Quota{MaxLinks: -1, MaxURLLength: 100}))
+
+	quota, err := shortener.UserQuota(ctx, uid)
+	require.NoError(t, err)
+	assert.Equal(t, &model.Quota{MaxLinks: -1, MaxURLLength: 100}, quota.Override)
+	assert.Equal(t, model.Quota{MaxLinks: 0, MaxBatchSize: 3, MaxURLLength: 100}, quota.Effective)
+
+	_, err = shortener.Shorten(ctx, "https://example.com/"+strings.Repeat("a", 20), uid)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, shortener.SetUserQuota(ctx, uid, model.Quota{MaxLinks: math.MaxInt32 + 1}), model.ErrInvalidQuota)
+
+	// После удаления переопределения снова действуют глобальные квоты
+	require.NoError(t, shortener.DeleteUserQuota(ctx, uid))
+
+	quota, err = shortener.UserQuota(ctx, uid)
+	require.NoError(t, err)
+	assert.Nil(t, quota.Override)
+	assert.Equal(t, model.Quota{MaxLinks: 2, MaxBatchSize: 3, MaxURLLength: 30}, quota.Effective)
+
+	_, err = shortener.Shorten(ctx, "https://example.com/5", uid)
+	assert.ErrorIs(t, err, model.ErrQuotaExceeded)
+}
+
+func TestShortenerQuotasConcurrent(t *testing.T) {
+	// Redis хранилище обслуживает запросы по сети - они выполняются по-настоящему параллельно
+	repo, err := repository.Open(context.Background(), "redis://"+miniredis.RunT(t).Addr(), &config.Config{})
+	require.NoError(t, err)
+
+	shortener, err := NewShortener(repo, &config.Config{
+		BaseURL:       "http://localhost:8080",
+		IDlength:      8,
+		QuotaMaxLinks: 5,
+	})
+	require.NoError(t, err)
+	defer func() { _ = shortener.Close() }()
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	// Параллельные запросы пользователя не превышают квоту количества URL
+	const requests = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	start := make(chan struct{})
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := shortener.Shorten(ctx, fmt.Sprintf("https://example.com/%d", i), uid)
+			errs <- err
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	exceeded := 0
+	for err := range errs {
+		if errors.Is(err, model.ErrQuotaExceeded) {
+			exceeded++
+			continue
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, requests-5, exceeded)
+
+	urls, err := shortener.UserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Len(t, urls, 5)
+}
+
+func TestShortenerUsers(t *testing.T) {
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+
+	shortener, err := NewShortener(repo, &config.Config{
+		BaseURL:  "http://localhost:8080",
+		IDlength: 8,
+	})
+	require.NoError(t, err)
+	defer func() { _ = shortener.Close() }()
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url, err := shortener.Shorten(ctx, "https://example.com", uid)
+	require.NoError(t, err)
+
+	// Некорректные адрес почты и пароль
+	_, err = shortener.Register(ctx, "not an email", "correct horse", uid)
+	assert.ErrorIs(t, err, model.ErrInvalidEmail)
+	_, err = shortener.Register(ctx, "user@example.com", "short", uid)
+	assert.ErrorIs(t, err, model.ErrInvalidPassword)
+
+	// Зарегистрированный пользователь получает новый идентификатор и URL анонимного пользователя
+	user, err := shortener.Register(ctx, " User@Example.com ", "correct horse", uid)
+	require.NoError(t, err)
+	assert.NotEqual(t, uid, user.ID)
+	assert.Equal(t, "user@example.com", user.Email)
+	assert.NotContains(t, user.PasswordHash, "correct horse")
+
+	// Анонимный идентификатор больше не дает доступа к URL
+	urls, err := shortener.UserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	_, err = shortener.Register(ctx, "user@example.com", "correct horse", uuid.New())
+	assert.ErrorIs(t, err, repository.ErrUserExists)
+
+	// URL зарегистрированного пользователя не передаются другому
+	other, err := shortener.Register(ctx, "other@example.com", "correct horse", user.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, user.ID, other.ID)
+
+	// Вход возвращает пользователя с его URL
+	registered := user.ID
+	user, err = shortener.Login(ctx, "USER@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, registered, user.ID)
+
+	urls, err = shortener.UserURLs(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, url.Long, urls[0].OriginalURL)
+
+	// Неверный пароль и неизвестный адрес неразличимы
+	_, err = shortener.Login(ctx, "user@example.com", "battery staple")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+	_, err = shortener.Login(ctx, "nobody@example.com", "correct horse")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+	_, err = shortener.Login(ctx, "not an email", "correct horse")
+	assert.ErrorIs(t, err, model.ErrInvalidCredentials)
+}
+
+func TestShortenerBatchDuplicates(t *testing.T) {
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+
+	shortener, err := NewShortener(repo, &config.Config{
+		BaseURL:  "http://localhost:8080",
+		IDlength: 8,
+	})
+	require.NoError(t, err)
+	defer func() { _ = shortener.Close() }()
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	// Повторы оригинального URL в батче получают одну сокращенную ссылку
+	shortened, err := shortener.ShortenBatch(ctx, []model.IncomingBatchDTO{
+		{CorrelationID: "1", OriginalURL: "https://example.com/1"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/2"},
+		{CorrelationID: "3", OriginalURL: "https://example.com/1"},
+	}, uid)
+	require.NoError(t, err)
+	require.Len(t, shortened, 3)
+	assert.Equal(t, []string{"1", "2", "3"}, []string{shortened[0].CorrelationID, shortened[1].CorrelationID, shortened[2].CorrelationID})
+	assert.Equal(t, shortened[0].ShortURL, shortened[2].ShortURL)
+	assert.NotEqual(t, shortened[0].ShortURL, shortened[1].ShortURL)
+
+	urls, err := shortener.UserURLs(ctx, uid)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+}
+
+// deleteRecorder подсчитывает пометки удаления, при заданной ошибке не выполняет их,
+// и не закрывает хранилище, чтобы его можно было проверить после закрытия сервиса.
+type deleteRecorder struct {
+	interfaces.Repository
+	err   error
+	calls atomic.Int32
+}
+
+func (r *deleteRecorder) DeleteURLs(ctx context.Context, urls []*model.URL) error {
+	r.calls.Add(1)
+	if r.err != nil {
+		return r.err
+	}
+	return r.Repository.DeleteURLs(ctx, urls)
+}
+
+func (r *deleteRecorder) Close() error {
+	return nil
+}
+
+func TestShortenerCloseFlushesDeletes(t *testing.T) {
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+	recorder := &deleteRecorder{Repository: repo}
+
+	shortener, err := NewShortener(recorder, &config.Config{
+		BaseURL:  "http://localhost:8080",
+		IDlength: 8,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	url, err := shortener.Shorten(ctx, "https://example.com", uid)
+	require.NoError(t, err)
+	require.NoError(t, shortener.DeleteUserURLs(ctx, uid, &model.ShortURLsDTO{IDs: []string{url.ID}}))
+
+	// Закрытие сервиса помечает удаленными накопленные URL
+	require.NoError(t, shortener.Close())
+
+	stored, err := repo.Get(ctx, url.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Deleted)
+	assert.Equal(t, int32(1), recorder.calls.Load())
+}
+
+func TestShortenerCloseDropsFailedDeletes(t *testing.T) {
+	repo, err := repository.NewInMemoryRepository("", repository.FileStorageOptions{})
+	require.NoError(t, err)
+	recorder := &deleteRecorder{Repository: repo, err: repository.ErrStorageUnavailable}
+
+	shortener, err := NewShortener(recorder, &config.Config{
+		BaseURL:  "http://localhost:8080",
+		IDlength: 8,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	uid := uuid.New()
+
+	require.NoError(t, shortener.DeleteUserURLs(ctx, uid, &model.ShortURLsDTO{IDs: []string{"qwerty12"}}))
+
+	// Неудачная пометка удаления повторяется ограниченное количество раз, и закрытие не зависает
+	require.NoError(t, shortener.Close())
+	assert.Equal(t, int32(deleteMaxAttempts), recorder.calls.Load())
+}
@@ -0,0 +1,325 @@
+// Пакет snapshot создает снимки всех URL хранилища и восстанавливает хранилища из снимков.
+//
+// Снимок - это сжатый gzip файл в формате JSON Lines. Первая строка содержит заголовок
+// с форматом и версией снимка, за ней следуют URL, а последняя строка содержит количество URL
+// и контрольную сумму, по которым при восстановлении проверяется целостность снимка.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/migrator"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+// Формат и версия снимка.
+const (
+	snapshotFormat  = "urlcut-snapshot"
+	snapshotVersion = 1
+)
+
+// Режимы восстановления из снимка.
+const (
+	// ModeMerge - URL из снимка добавляются к данным хранилища, уже присутствующие URL пропускаются.
+	ModeMerge = "merge"
+
+	// ModeReplace - все URL хранилища атомарно заменяются URL из снимка.
+	// При ошибке восстановления, в том числе при конфликте URL снимка, в хранилище остаются прежние URL.
+	ModeReplace = "replace"
+)
+
+// restoreBatchSize - количество URL, восстанавливаемых за один шаг.
+const restoreBatchSize = 500
+
+// Переменные ошибок.
+var (
+	// ErrSnapshotCorrupted ошибка поврежденного или неполного снимка.
+	ErrSnapshotCorrupted = fmt.Errorf("snapshot is corrupted")
+
+	// ErrSnapshotVersion ошибка неподдерживаемой версии снимка.
+	ErrSnapshotVersion = fmt.Errorf("unsupported snapshot version")
+
+	// ErrUnknownMode ошибка неизвестного режима восстановления.
+	ErrUnknownMode = fmt.Errorf("unknown restore mode")
+)
+
+// Header - заголовок снимка.
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Backend   string    `json:"backend"` // Схема хранилища, из которого сделан снимок
+}
+
+// Summary - итог снимка, записываемый последней строкой.
+type Summary struct {
+	Count    int    `json:"count"`
+	Checksum string `json:"sha256"` // Контрольная сумма строк URL снимка
+}
+
+// summaryLine - итоговая строка снимка.
+type summaryLine struct {
+	End *Summary `json:"end"`
+}
+
+// line - строка снимка с URL или с итогом снимка.
+type line struct {
+	ID      string    `json:"id,omitempty"`
+	Long    string    `json:"long,omitempty"`
+	Base    string    `json:"base,omitempty"`
+	UID     uuid.UUID `json:"uid,omitempty"`
+	Deleted bool      `json:"deleted,omitempty"`
+
+	End *Summary `json:"end,omitempty"` // Итог снимка, есть только в последней строке
+}
+
+// Write записывает в переданный writer сжатый снимок всех URL хранилища, включая удаленные.
+// Снимок хранилищ, реализующих interfaces.Exporter, согласован на один момент времени.
+func Write(ctx context.Context, w io.Writer, repo interfaces.Repository, backend string) (Summary, error) {
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	err := enc.Encode(Header{
+		Format:    snapshotFormat,
+		Version:   snapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Backend:   backend,
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	// Контрольная сумма считается по тем же байтам, что попадают в снимок
+	sum := sha256.New()
+	enc = json.NewEncoder(io.MultiWriter(gz, sum))
+
+	var count int
+	err = repository.ExportURLs(ctx, repo, func(url *model.URL) error {
+		count++
+		return enc.Encode(line{
+			ID:      url.ID,
+			Long:    url.Long,
+			Base:    url.Base,
+			UID:     url.UID,
+			Deleted: url.Deleted,
+		})
+	})
+	if err != nil {
+		return Summary{}, fmt.Errorf("export URLs: %w", err)
+	}
+
+	summary := Summary{Count: count, Checksum: hex.EncodeToString(sum.Sum(nil))}
+	if err = json.NewEncoder(gz).Encode(summaryLine{End: &summary}); err != nil {
+		return Summary{}, err
+	}
+
+	return summary, gz.Close()
+}
+
+// Read читает снимок и вызывает переданную функцию для каждого URL снимка.
+// Целостность снимка проверяется по итоговой строке только после чтения всех URL,
+// поэтому перед изменением данных снимок стоит проверить, передав nil вместо функции.
+func Read(r io.Reader, fn func(url *model.URL) error) (Header, Summary, error) {
+	var header Header
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return header, Summary{}, fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	reader := bufio.NewReader(gz)
+
+	data, err := reader.ReadBytes('\n')
+	if err != nil {
+		return header, Summary{}, fmt.Errorf("%w: no header: %w", ErrSnapshotCorrupted, err)
+	}
+	if err = json.Unmarshal(data, &header); err != nil || header.Format != snapshotFormat {
+		return header, Summary{}, fmt.Errorf("%w: not a snapshot", ErrSnapshotCorrupted)
+	}
+	if header.Version > snapshotVersion {
+		return header, Summary{}, fmt.Errorf("%w %d, supported up to %d", ErrSnapshotVersion, header.Version, snapshotVersion)
+	}
+
+	summary, err := readLines(reader, sha256.New(), fn)
+	if err != nil {
+		return header, summary, err
+	}
+
+	// Дочитываем снимок до конца, чтобы gzip проверил свою контрольную сумму
+	rest, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return header, summary, fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+	}
+	if rest > 0 {
+		return header, summary, fmt.Errorf("%w: data after summary", ErrSnapshotCorrupted)
+	}
+
+	return header, summary, nil
+}
+
+// readLines читает строки URL снимка до итоговой строки и сверяет с ней количество и контрольную сумму.
+func readLines(reader *bufio.Reader, sum hash.Hash, fn func(url *model.URL) error) (Summary, error) {
+	var count int
+
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			// Снимок оборвался до итоговой строки
+			return Summary{}, fmt.Errorf("%w: unexpected end after %d URLs", ErrSnapshotCorrupted, count)
+		}
+
+		var l line
+		if err = json.Unmarshal(data, &l); err != nil {
+			return Summary{}, fmt.Errorf("%w: URL %d: %w", ErrSnapshotCorrupted, count+1, err)
+		}
+
+		if l.End != nil {
+			checksum := hex.EncodeToString(sum.Sum(nil))
+			if l.End.Count != count || l.End.Checksum != checksum {
+				return Summary{}, fmt.Errorf("%w: summary mismatch", ErrSnapshotCorrupted)
+			}
+			return *l.End, nil
+		}
+
+		sum.Write(data)
+		count++
+
+		if fn == nil {
+			continue
+		}
+		err = fn(&model.URL{
+			Long:    l.Long,
+			Base:    l.Base,
+			ID:      l.ID,
+			UID:     l.UID,
+			Deleted: l.Deleted,
+		})
+		if err != nil {
+			return Summary{}, err
+		}
+	}
+}
+
+// Backup создает снимок всех URL хранилища в переданном месте хранения снимков.
+func Backup(ctx context.Context, target Target, repo interfaces.Repository, backend string) (Summary, error) {
+	var summary Summary
+
+	err := target.Put(ctx, func(w io.Writer) error {
+		var err error
+		summary, err = Write(ctx, w, repo, backend)
+		return err
+	})
+
+	return summary, err
+}
+
+// Restore загружает в хранилище все URL снимка из переданного места хранения снимков.
+// Снимок сначала полностью проверяется и только затем загружается в хранилище.
+// В режиме ModeReplace снимок пакетами передается в атомарную замену всех URL хранилища,
+// хранилище должно реализовывать interfaces.Replacer. Загрузка идемпотентна - прерванное
+// восстановление можно повторить.
+func Restore(ctx context.Context, target Target, repo interfaces.Repository, mode string) (migrator.Stats, error) {
+	var stats migrator.Stats
+
+	if mode != ModeMerge && mode != ModeReplace {
+		return stats, fmt.Errorf("%w %q", ErrUnknownMode, mode)
+	}
+
+	// Проверяем снимок целиком до любых изменений в хранилище
+	if err := readTarget(ctx, target, nil); err != nil {
+		return stats, err
+	}
+
+	if mode == ModeMerge {
+		err := readBatches(ctx, target, func(batch []*model.URL) error {
+			if err := migrator.CopyBatch(ctx, repo, batch, &stats); err != nil {
+				return err
+			}
+			countBatch(&stats, batch)
+			return nil
+		})
+		return stats, err
+	}
+
+	// Хранилище заменяется целиком только после успешной загрузки всего снимка
+	err := repository.ReplaceURLs(ctx, repo, func(store func(urls []*model.URL) error) error {
+		return readBatches(ctx, target, func(batch []*model.URL) error {
+			if err := store(batch); err != nil {
+				return err
+			}
+			countBatch(&stats, batch)
+			stats.Stored += len(batch)
+			for _, url := range batch {
+				if url.Deleted {
+					stats.Deleted++
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return stats, fmt.Errorf("replace storage: %w", err)
+	}
+
+	return stats, nil
+}
+
+// readBatches читает снимок из места хранения снимков и передает его URL в переданную функцию пакетами.
+func readBatches(ctx context.Context, target Target, fn func(batch []*model.URL) error) error {
+	batch := make([]*model.URL, 0, restoreBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		batch = make([]*model.URL, 0, restoreBatchSize)
+		return nil
+	}
+
+	err := readTarget(ctx, target, func(url *model.URL) error {
+		batch = append(batch, url)
+		if len(batch) < restoreBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// countBatch учитывает восстановленный пакет URL в счетчиках восстановления.
+func countBatch(stats *migrator.Stats, batch []*model.URL) {
+	stats.Scanned += len(batch)
+	stats.LastID = batch[len(batch)-1].ID
+}
+
+// readTarget читает снимок из места хранения снимков.
+func readTarget(ctx context.Context, target Target, fn func(url *model.URL) error) error {
+	rc, err := target.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	_, _, err = Read(rc, fn)
+	return err
+}
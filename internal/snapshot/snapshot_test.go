@@ -0,0 +1,349 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+	"github.com/RomanAgaltsev/urlcut/internal/interfaces"
+	"github.com/RomanAgaltsev/urlcut/internal/migrator"
+	"github.com/RomanAgaltsev/urlcut/internal/model"
+	"github.com/RomanAgaltsev/urlcut/internal/repository"
+)
+
+func openRepository(t *testing.T, dsn string) interfaces.Repository {
+	repo, err := repository.Open(context.TODO(), dsn, &config.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = repo.Close() })
+	return repo
+}
+
+// fill сохраняет в хранилище count URL с переданным префиксом, первый из которых удален.
+func fill(t *testing.T, repo interfaces.Repository, prefix string, count int) []*model.URL {
+	uid := uuid.New()
+
+	urls := make([]*model.URL, 0, count)
+	for i := 0; i < count; i++ {
+		urls = append(urls, &model.URL{
+			Long: fmt.Sprintf("https://example.com/%s/%d", prefix, i),
+			Base: "http://localhost:8080",
+			ID:   fmt.Sprintf("%s%04d", prefix, i),
+			UID:  uid,
+		})
+	}
+	_, err := repo.Store(context.TODO(), urls)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteURLs(context.TODO(), []*model.URL{{ID: urls[0].ID, UID: uid}}))
+
+	return urls
+}
+
+func TestBackupRestore(t *testing.T) {
+	src := openRepository(t, "memory://")
+	fill(t, src, "a", 1200)
+
+	target, err := ParseTarget(filepath.Join(t.TempDir(), "urlcut.snapshot.gz"))
+	require.NoError(t, err)
+
+	summary, err := Backup(context.TODO(), target, src, "memory")
+	require.NoError(t, err)
+	assert.Equal(t, 1200, summary.Count)
+
+	// Восстановление в пустое хранилище другого типа
+	dst := openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))
+
+	stats, err := Restore(context.TODO(), target, dst, ModeMerge)
+	require.NoError(t, err)
+	assert.Equal(t, 1200, stats.Stored)
+	assert.Equal(t, 1, stats.Deleted)
+
+	report, err := migrator.NewMigrator(src, dst, migrator.Options{}).Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+
+	// Повторное восстановление ничего не меняет
+	stats, err = Restore(context.TODO(), target, dst, ModeMerge)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Stored)
+	assert.Equal(t, 1200, stats.Existing)
+
+	// В режиме замены данные, которых нет в снимке, удаляются
+	other := openRepository(t, "file://"+filepath.Join(t.TempDir(), "storage.json"))
+	extra := fill(t, other, "b", 3)
+
+	_, err = Restore(context.TODO(), target, other, ModeMerge)
+	require.NoError(t, err)
+	_, err = other.Get(context.TODO(), extra[1].ID)
+	require.NoError(t, err)
+
+	_, err = Restore(context.TODO(), target, other, ModeReplace)
+	require.NoError(t, err)
+	_, err = other.Get(context.TODO(), extra[1].ID)
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+
+	report, err = migrator.NewMigrator(src, other, migrator.Options{}).Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+
+	_, err = Restore(context.TODO(), target, other, "overwrite")
+	assert.ErrorIs(t, err, ErrUnknownMode)
+}
+
+func TestRestoreReshortened(t *testing.T) {
+	src := openRepository(t, "memory://")
+	uid := uuid.New()
+
+	// Удаленный URL и его повторное сокращение с тем же оригинальным адресом
+	deleted := &model.URL{Long: "https://example.com", Base: "http://localhost:8080", ID: "a-deleted", UID: uid}
+	_, err := src.Store(context.TODO(), []*model.URL{deleted})
+	require.NoError(t, err)
+	require.NoError(t, src.DeleteURLs(context.TODO(), []*model.URL{deleted}))
+	_, err = src.Store(context.TODO(), []*model.URL{{Long: deleted.Long, Base: deleted.Base, ID: "b-again", UID: uid}})
+	require.NoError(t, err)
+
+	target, err := ParseTarget(filepath.Join(t.TempDir(), "urlcut.snapshot.gz"))
+	require.NoError(t, err)
+	_, err = Backup(context.TODO(), target, src, "memory")
+	require.NoError(t, err)
+
+	for _, mode := range []string{ModeMerge, ModeReplace} {
+		t.Run(mode, func(t *testing.T) {
+			dst := openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))
+			fill(t, dst, "c", 3)
+
+			stats, err := Restore(context.TODO(), target, dst, mode)
+			require.NoError(t, err)
+			assert.Equal(t, 2, stats.Stored)
+			assert.Equal(t, 1, stats.Deleted)
+			assert.Zero(t, stats.Conflicts)
+
+			for _, id := range []string{"a-deleted", "b-again"} {
+				_, err = dst.Get(context.TODO(), id)
+				assert.NoError(t, err, id)
+			}
+
+			// При слиянии прежние URL остаются, при замене - удаляются
+			_, err = dst.Get(context.TODO(), "c0001")
+			if mode == ModeMerge {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, repository.ErrIDNotFound)
+			}
+		})
+	}
+}
+
+// noReplaceRepository скрывает необязательные интерфейсы хранилища.
+type noReplaceRepository struct {
+	interfaces.Repository
+}
+
+func TestRestoreReplaceFailure(t *testing.T) {
+	src := openRepository(t, "memory://")
+	fill(t, src, "a", 10)
+
+	target, err := ParseTarget(filepath.Join(t.TempDir(), "urlcut.snapshot.gz"))
+	require.NoError(t, err)
+	_, err = Backup(context.TODO(), target, src, "memory")
+	require.NoError(t, err)
+
+	// Неудачное восстановление в режиме замены не затрагивает данные хранилища
+	dst := openRepository(t, "memory://")
+	existing := fill(t, dst, "b", 3)
+
+	_, err = Restore(context.TODO(), target, noReplaceRepository{dst}, ModeReplace)
+	require.ErrorIs(t, err, repository.ErrReplaceUnsupported)
+
+	_, err = dst.Get(context.TODO(), existing[1].ID)
+	assert.NoError(t, err)
+	_, err = dst.Get(context.TODO(), "a0001")
+	assert.ErrorIs(t, err, repository.ErrIDNotFound)
+}
+
+// batchRecorder запоминает размеры пакетов, которые замена URL передает в хранилище.
+type batchRecorder struct {
+	interfaces.Repository
+	sizes []int
+}
+
+func (r *batchRecorder) ReplaceURLs(ctx context.Context, load func(store func(urls []*model.URL) error) error) error {
+	return repository.ReplaceURLs(ctx, r.Repository, func(store func(urls []*model.URL) error) error {
+		return load(func(urls []*model.URL) error {
+			r.sizes = append(r.sizes, len(urls))
+			return store(urls)
+		})
+	})
+}
+
+func TestRestoreReplaceBatches(t *testing.T) {
+	src := openRepository(t, "memory://")
+	fill(t, src, "a", 1200)
+
+	target, err := ParseTarget(filepath.Join(t.TempDir(), "urlcut.snapshot.gz"))
+	require.NoError(t, err)
+	_, err = Backup(context.TODO(), target, src, "memory")
+	require.NoError(t, err)
+
+	// Снимок передается в хранилище пакетами, а не одним слайсом
+	dst := &batchRecorder{Repository: openRepository(t, "sqlite://"+filepath.Join(t.TempDir(), "urlcut.db"))}
+
+	stats, err := Restore(context.TODO(), target, dst, ModeReplace)
+	require.NoError(t, err)
+	assert.Equal(t, []int{restoreBatchSize, restoreBatchSize, 200}, dst.sizes)
+	assert.Equal(t, 1200, stats.Scanned)
+	assert.Equal(t, 1200, stats.Stored)
+	assert.Equal(t, 1, stats.Deleted)
+
+	report, err := migrator.NewMigrator(src, dst, migrator.Options{}).Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+}
+
+func TestReadCorrupted(t *testing.T) {
+	src := openRepository(t, "memory://")
+	fill(t, src, "a", 10)
+
+	buf := bytes.NewBuffer(nil)
+	_, err := Write(context.TODO(), buf, src, "memory")
+	require.NoError(t, err)
+
+	header, summary, err := Read(bytes.NewReader(buf.Bytes()), nil)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotVersion, header.Version)
+	assert.Equal(t, "memory", header.Backend)
+	assert.Equal(t, 10, summary.Count)
+
+	// Оборванный снимок
+	_, _, err = Read(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), nil)
+	assert.ErrorIs(t, err, ErrSnapshotCorrupted)
+
+	// Не снимок
+	_, _, err = Read(strings.NewReader("plain text"), nil)
+	assert.ErrorIs(t, err, ErrSnapshotCorrupted)
+
+	// Поврежденный снимок не загружается в хранилище
+	path := filepath.Join(t.TempDir(), "broken.gz")
+	require.NoError(t, os.WriteFile(path, buf.Bytes()[:buf.Len()-10], 0666))
+	target, err := ParseTarget("file://" + path)
+	require.NoError(t, err)
+
+	dst := openRepository(t, "memory://")
+	_, err = Restore(context.TODO(), target, dst, ModeReplace)
+	assert.ErrorIs(t, err, ErrSnapshotCorrupted)
+}
+
+// s3Stub - минимальная замена S3-совместимого хранилища для тестов: объекты хранятся в памяти,
+// подписи запросов не проверяются.
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err == nil && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data, err = decodeAWSChunked(data)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[r.URL.Path] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "", time.Now(), bytes.NewReader(data))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeAWSChunked извлекает данные из тела запроса с потоковой подписью:
+// каждый фрагмент имеет вид "<размер в hex>;chunk-signature=<подпись>\r\n<данные>\r\n".
+func decodeAWSChunked(body []byte) ([]byte, error) {
+	data := make([]byte, 0, len(body))
+	for {
+		line, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return nil, fmt.Errorf("malformed chunk")
+		}
+		sizeHex, _, _ := bytes.Cut(line, []byte(";"))
+
+		var size int
+		if _, err := fmt.Sscanf(string(sizeHex), "%x", &size); err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		if len(rest) < size+2 {
+			return nil, fmt.Errorf("short chunk")
+		}
+
+		data = append(data, rest[:size]...)
+		body = rest[size+2:]
+	}
+}
+
+func TestS3Target(t *testing.T) {
+	stub := &s3Stub{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "minioadmin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minioadmin")
+
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+
+	target, err := ParseTarget("s3://backups/urlcut/snapshot.gz?secure=false&endpoint=" + endpoint)
+	require.NoError(t, err)
+	assert.Equal(t, "s3://backups/urlcut/snapshot.gz", target.String())
+
+	src := openRepository(t, "memory://")
+	fill(t, src, "a", 20)
+
+	summary, err := Backup(context.TODO(), target, src, "memory")
+	require.NoError(t, err)
+	assert.Contains(t, stub.objects, "/backups/urlcut/snapshot.gz")
+
+	dst := openRepository(t, "memory://")
+	stats, err := Restore(context.TODO(), target, dst, ModeReplace)
+	require.NoError(t, err)
+	assert.Equal(t, summary.Count, stats.Scanned)
+
+	report, err := migrator.NewMigrator(src, dst, migrator.Options{}).Verify(context.TODO())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report)
+
+	_, err = ParseTarget("s3://backups")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	_, err = ParseTarget("ftp://backups/snapshot.gz")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
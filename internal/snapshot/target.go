@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrInvalidTarget ошибка разбора адреса места хранения снимков.
+var ErrInvalidTarget = fmt.Errorf("invalid snapshot target")
+
+// Target - место хранения снимка.
+type Target interface {
+	// Put записывает снимок при помощи переданной функции. Снимок становится доступен
+	// целиком и только если функция завершилась без ошибки.
+	Put(ctx context.Context, write func(w io.Writer) error) error
+
+	// Get открывает снимок на чтение.
+	Get(ctx context.Context) (io.ReadCloser, error)
+
+	// String возвращает адрес снимка.
+	String() string
+}
+
+// ParseTarget разбирает адрес снимка. Поддерживаются локальные пути, в том числе со схемой file://,
+// и S3-совместимые хранилища:
+//
+//	s3://bucket/path/snapshot.gz?endpoint=minio:9000&secure=false&region=us-east-1
+//
+// Ключи доступа к S3 берутся из переменных окружения AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY.
+func ParseTarget(target string) (Target, error) {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		return newFileTarget(target)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "file":
+		return newFileTarget(rest)
+	case "s3":
+		return newS3Target(target)
+	default:
+		return nil, fmt.Errorf("%w: unknown scheme %q", ErrInvalidTarget, scheme)
+	}
+}
+
+// fileTarget - снимок в локальном файле.
+type fileTarget struct {
+	path string
+}
+
+// newFileTarget создает место хранения снимка в локальном файле.
+func newFileTarget(path string) (*fileTarget, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidTarget)
+	}
+	return &fileTarget{path: path}, nil
+}
+
+// Put записывает снимок во временный файл и атомарно переименовывает его после fsync.
+func (t *fileTarget) Put(_ context.Context, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), "."+filepath.Base(t.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Если что-то пойдет не так, временный файл не нужен
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errc := tmp.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), t.path)
+}
+
+// Get открывает файл снимка.
+func (t *fileTarget) Get(_ context.Context) (io.ReadCloser, error) {
+	return os.Open(t.path)
+}
+
+// String возвращает путь к файлу снимка.
+func (t *fileTarget) String() string {
+	return t.path
+}
+
+// s3Target - снимок в S3-совместимом хранилище.
+type s3Target struct {
+	client *minio.Client
+	bucket string
+	key    string
+}
+
+// newS3Target создает место хранения снимка в S3-совместимом хранилище по адресу вида s3://bucket/key.
+func newS3Target(target string) (*s3Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("%w: expected s3://bucket/key", ErrInvalidTarget)
+	}
+
+	query := u.Query()
+
+	endpoint := query.Get("endpoint")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	region := query.Get("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	secure := true
+	if s := query.Get("secure"); s != "" {
+		if secure, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("%w: secure: %w", ErrInvalidTarget, err)
+		}
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: secure,
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+
+	return &s3Target{
+		client: client,
+		bucket: u.Host,
+		key:    key,
+	}, nil
+}
+
+// Put записывает снимок во временный локальный файл и загружает его в S3 с известным размером.
+// Объект в S3 появляется только после успешной загрузки целиком.
+func (t *s3Target) Put(ctx context.Context, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp("", "urlcut-snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = t.client.PutObject(ctx, t.bucket, t.key, tmp, size, minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	})
+	if err != nil {
+		return fmt.Errorf("upload snapshot to %s: %w", t, err)
+	}
+
+	return nil
+}
+
+// Get открывает объект снимка в S3.
+func (t *s3Target) Get(ctx context.Context) (io.ReadCloser, error) {
+	obj, err := t.client.GetObject(ctx, t.bucket, t.key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("download snapshot from %s: %w", t, err)
+	}
+	return obj, nil
+}
+
+// String возвращает адрес объекта снимка.
+func (t *s3Target) String() string {
+	return "s3://" + t.bucket + "/" + t.key
+}
@@ -0,0 +1,115 @@
+// Пакет tracing настраивает трассировку OpenTelemetry сервиса сокращателя ссылок.
+//
+// Контекст трассировки передается между сервисами в заголовках W3C trace context.
+// Спаны экспортируются в stdout или по протоколу OTLP/HTTP в зависимости от конфигурации.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/RomanAgaltsev/urlcut/internal/config"
+)
+
+// ServiceName - имя сервиса в спанах.
+const ServiceName = "urlcut"
+
+// instrumentationName - имя библиотеки инструментирования сервиса.
+const instrumentationName = "github.com/RomanAgaltsev/urlcut"
+
+// Экспортеры спанов.
+const (
+	// ExporterStdout - спаны выводятся в stdout в формате JSON.
+	ExporterStdout = "stdout"
+
+	// ExporterOTLP - спаны отправляются коллектору по протоколу OTLP/HTTP.
+	ExporterOTLP = "otlp"
+)
+
+// ErrUnknownExporter ошибка неизвестного экспортера спанов.
+var ErrUnknownExporter = fmt.Errorf("unknown tracing exporter")
+
+// Init настраивает глобальные провайдер трассировки и пропагатор W3C trace context.
+// Если экспортер в конфигурации не задан, спаны не записываются, но контекст трассировки
+// входящих запросов передается дальше. Возвращает функцию, которая выгружает оставшиеся спаны
+// и останавливает провайдер.
+func Init(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.TracingExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if cfg.TracingEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TracingEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownExporter, cfg.TracingExporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer возвращает трассировщик сервиса из глобального провайдера.
+// Провайдер запрашивается при каждом вызове, поэтому подмена провайдера в тестах учитывается.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start начинает спан с переданным именем дочерним к спану из контекста.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// SetError отмечает спан ошибкой, если она передана.
+func SetError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// End завершает спан, отмечая его ошибкой, если она передана.
+func End(span trace.Span, err error) {
+	SetError(span, err)
+	span.End()
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    users
+(
+    id            UUID PRIMARY KEY,
+    email         TEXT UNIQUE NOT NULL,
+    password_hash TEXT        NOT NULL,
+    created_at    TIMESTAMP   NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+DROP INDEX long_url_del_idx;
+
+CREATE UNIQUE INDEX long_url_live_idx ON urls (long_url) WHERE is_deleted = FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX long_url_live_idx;
+
+CREATE UNIQUE INDEX long_url_del_idx ON urls (long_url, is_deleted);
+-- +goose StatementEnd
@@ -3,5 +3,12 @@ package migrations
 
 import "embed"
 
+// Migrations содержит миграции БД Postgres.
+//
 //go:embed "*.sql"
 var Migrations embed.FS
+
+// SQLiteMigrations содержит миграции БД SQLite.
+//
+//go:embed "sqlite/*.sql"
+var SQLiteMigrations embed.FS
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    urls
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    long_url   TEXT        NOT NULL,
+    base_url   TEXT        NOT NULL,
+    url_id     TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    uid        TEXT        NOT NULL,
+    is_deleted BOOLEAN     NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX uid_idx ON urls (uid);
+
+CREATE UNIQUE INDEX long_url_live_idx ON urls (long_url) WHERE is_deleted = FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX long_url_live_idx;
+
+DROP INDEX uid_idx;
+
+DROP TABLE IF EXISTS urls;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+    user_quotas
+(
+    uid            TEXT PRIMARY KEY,
+    max_links      INTEGER NOT NULL DEFAULT 0,
+    max_batch_size INTEGER NOT NULL DEFAULT 0,
+    max_url_length INTEGER NOT NULL DEFAULT 0
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_quotas;
+-- +goose StatementEnd
\ No newline at end of file